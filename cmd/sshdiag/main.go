@@ -7,12 +7,16 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/jonelmawirat/netmigo/internal/sshdiag"
+	"github.com/jonelmawirat/netmigo/netmigo/challenge"
 )
 
+const defaultOTPPrompt = `(?i)(verification|one[- ]time|otp|token|passcode)`
+
 func main() {
 	cfg, err := parseFlags()
 	if err != nil {
@@ -61,6 +65,9 @@ func parseFlags() (cliConfig, error) {
 	keyPath := flag.String("key-path", "", "target private key path")
 	keyPassphrase := flag.String("key-passphrase", "", "target private key passphrase")
 	authMode := flag.String("auth-mode", string(sshdiag.AuthModeAuto), "target auth mode: auto|password|keyboard-interactive|key")
+	otpSeed := flag.String("otp-seed", "", "target base32 TOTP seed used to answer OTP prompts")
+	var challenges challengeFlags
+	flag.Var(&challenges, "challenge", "target keyboard-interactive answer as regex=answer (repeatable)")
 
 	jumpHost := flag.String("jump-host", "", "optional jump host or IP")
 	jumpPort := flag.String("jump-port", "22", "jump host SSH port")
@@ -69,6 +76,10 @@ func parseFlags() (cliConfig, error) {
 	jumpKeyPath := flag.String("jump-key-path", "", "jump host private key path")
 	jumpKeyPassphrase := flag.String("jump-key-passphrase", "", "jump host private key passphrase")
 	jumpAuthMode := flag.String("jump-auth-mode", string(sshdiag.AuthModeAuto), "jump host auth mode: auto|password|keyboard-interactive|key")
+	jumpOTPSeed := flag.String("jump-otp-seed", "", "jump host base32 TOTP seed used to answer OTP prompts")
+	var jumpChallenges challengeFlags
+	flag.Var(&jumpChallenges, "jump-challenge", "jump host keyboard-interactive answer as regex=answer (repeatable)")
+	otpPrompt := flag.String("otp-prompt", defaultOTPPrompt, "regex matching the prompts answered with the TOTP code")
 
 	timeout := flag.Duration("timeout", 10*time.Second, "SSH connection timeout per attempt")
 	retries := flag.Int("retries", 3, "SSH connection retries per auth mode")
@@ -81,6 +92,15 @@ func parseFlags() (cliConfig, error) {
 
 	flag.Parse()
 
+	targetRules, err := buildChallengeRules(challenges, *otpSeed, *otpPrompt)
+	if err != nil {
+		return cliConfig{}, fmt.Errorf("target challenges: %w", err)
+	}
+	jumpRules, err := buildChallengeRules(jumpChallenges, *jumpOTPSeed, *otpPrompt)
+	if err != nil {
+		return cliConfig{}, fmt.Errorf("jump challenges: %w", err)
+	}
+
 	cfg.logFormat = strings.ToLower(strings.TrimSpace(*logFormat))
 	cfg.logLevel = strings.ToLower(strings.TrimSpace(*logLevel))
 	cfg.logFilePath = strings.TrimSpace(*logFile)
@@ -96,6 +116,7 @@ func parseFlags() (cliConfig, error) {
 			AuthMode:          sshdiag.AuthMode(strings.TrimSpace(*authMode)),
 			ConnectionTimeout: *timeout,
 			Retries:           *retries,
+			Challenges:        targetRules,
 		},
 		Command:            *command,
 		CommandTimeout:     *commandTimeout,
@@ -114,6 +135,7 @@ func parseFlags() (cliConfig, error) {
 			AuthMode:          sshdiag.AuthMode(strings.TrimSpace(*jumpAuthMode)),
 			ConnectionTimeout: *timeout,
 			Retries:           *retries,
+			Challenges:        jumpRules,
 		}
 	}
 
@@ -130,6 +152,46 @@ func parseFlags() (cliConfig, error) {
 	return cfg, nil
 }
 
+// challengeFlags collects repeated regex=answer flags.
+type challengeFlags []string
+
+func (f *challengeFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *challengeFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected regex=answer, got %q", value)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// buildChallengeRules turns regex=answer specs and an optional TOTP seed into
+// keyboard-interactive rules. Explicit answers are matched first.
+func buildChallengeRules(specs []string, otpSeed, otpPrompt string) ([]challenge.Rule, error) {
+	var rules []challenge.Rule
+	for _, spec := range specs {
+		pattern, answer, _ := strings.Cut(spec, "=")
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid challenge pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, challenge.Rule{Pattern: re, Respond: challenge.Static(answer)})
+	}
+	if otpSeed != "" {
+		re, err := regexp.Compile(otpPrompt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --otp-prompt %q: %w", otpPrompt, err)
+		}
+		if _, err := challenge.GenerateTOTP(otpSeed, time.Now()); err != nil {
+			return nil, err
+		}
+		rules = append(rules, challenge.Rule{Pattern: re, Respond: challenge.TOTP(otpSeed)})
+	}
+	return rules, nil
+}
+
 func newLogger(logFilePath, format, level string) (*slog.Logger, func(), error) {
 	var writer io.Writer = os.Stdout
 	closeWriter := func() {}
@@ -0,0 +1,136 @@
+// Package devicetest is a fake device service for tests of the packages
+// built on top of one. It answers Execute from prepared output and records
+// the commands and configuration lines it was sent.
+package devicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+// Device answers Execute with a file from Files, or else with Output
+// written to a new file in a test's temporary directory. It implements
+// service.DeviceService and the optional service.Configurer.
+type Device struct {
+	t testing.TB
+
+	// Files maps commands to output files, returned as they are. When it
+	// is set, commands not in it fail.
+	Files map[string]string
+	// Output is the answer to every command when Files is nil.
+	Output string
+
+	mu       sync.Mutex
+	commands []string
+	sent     []string
+}
+
+// New returns a Device that answers every command with output.
+func New(t testing.TB, output string) *Device {
+	return &Device{t: t, Output: output}
+}
+
+// WithFiles returns a Device that answers the commands in files with the
+// output files they map to.
+func WithFiles(t testing.TB, files map[string]string) *Device {
+	return &Device{t: t, Files: files}
+}
+
+func (d *Device) Connect(cfg *config.DeviceConfig) error {
+	return nil
+}
+
+func (d *Device) ConnectContext(ctx context.Context, cfg *config.DeviceConfig) error {
+	return ctx.Err()
+}
+
+func (d *Device) Execute(command string, opts ...repository.ExecuteOption) (string, error) {
+	d.mu.Lock()
+	d.commands = append(d.commands, command)
+	d.mu.Unlock()
+
+	if d.Files != nil {
+		path, ok := d.Files[command]
+		if !ok {
+			return "", fmt.Errorf("unexpected command %q", command)
+		}
+		return path, nil
+	}
+	f, err := os.CreateTemp(d.t.TempDir(), "output-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(d.Output)
+	return f.Name(), err
+}
+
+func (d *Device) ExecuteMultiple(commands []string, opts ...repository.ExecuteOption) ([]string, error) {
+	var paths []string
+	for _, command := range commands {
+		path, err := d.Execute(command, opts...)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (d *Device) Download(remoteFilePath, localFilePath string) error {
+	return errors.New("download is not supported by devicetest.Device")
+}
+
+func (d *Device) Disconnect() {}
+
+// SendConfigSet records lines and reports each of them as accepted and
+// committed.
+func (d *Device) SendConfigSet(lines []string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+	d.mu.Lock()
+	d.sent = append(d.sent, lines...)
+	d.mu.Unlock()
+
+	result := &repository.ConfigResult{Committed: true}
+	for _, line := range lines {
+		result.Lines = append(result.Lines, repository.ConfigLineResult{Line: line})
+	}
+	return result, nil
+}
+
+// SendConfigFile is SendConfigSet with the non-blank lines of the file at
+// path.
+func (d *Device) SendConfigFile(path string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return d.SendConfigSet(lines, opts...)
+}
+
+// Commands returns the commands Execute was called with, in order.
+func (d *Device) Commands() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.commands...)
+}
+
+// Sent returns the configuration lines sent with SendConfigSet, in order.
+func (d *Device) Sent() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.sent...)
+}
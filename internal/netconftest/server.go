@@ -0,0 +1,359 @@
+// Package netconftest runs an in-process NETCONF server for tests. It
+// serves the "netconf" SSH subsystem through sshtest, speaks both
+// end-of-message and chunked framing, and keeps running and candidate
+// datastores as plain XML strings so tests can see what a client changed.
+package netconftest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+)
+
+const (
+	baseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	base10        = "urn:ietf:params:netconf:base:1.0"
+	base11        = "urn:ietf:params:netconf:base:1.1"
+	endOfMessage  = "]]>]]>"
+)
+
+// DefaultCapabilities is advertised when Options.Capabilities is empty.
+var DefaultCapabilities = []string{
+	base10,
+	base11,
+	"urn:ietf:params:netconf:capability:candidate:1.0",
+	"urn:ietf:params:netconf:capability:validate:1.1",
+	"urn:ietf:params:netconf:capability:notification:1.0",
+	"urn:ietf:params:netconf:capability:xpath:1.0",
+}
+
+// Options configures a test server. Running seeds both datastores. State
+// is returned by get after the running configuration. Validate, when set,
+// rejects a candidate by returning an error message.
+type Options struct {
+	Username     string
+	Password     string
+	Capabilities []string
+	Running      string
+	State        string
+	Validate     func(config string) string
+}
+
+// Server is a test NETCONF server.
+type Server struct {
+	*sshtest.Server
+
+	opts Options
+
+	mu          sync.Mutex
+	running     string
+	candidate   string
+	locks       map[string]uint64
+	nextID      uint64
+	operations  []string
+	subscribers map[uint64]*session
+}
+
+// Start starts a server and shuts it down when the test finishes.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+	if len(opts.Capabilities) == 0 {
+		opts.Capabilities = DefaultCapabilities
+	}
+	s := &Server{
+		opts:        opts,
+		running:     opts.Running,
+		candidate:   opts.Running,
+		locks:       make(map[string]uint64),
+		subscribers: make(map[uint64]*session),
+	}
+	s.Server = sshtest.Start(t, sshtest.Options{
+		Username:   opts.Username,
+		Password:   opts.Password,
+		Subsystems: map[string]sshtest.ShellHandler{"netconf": s.serve},
+	})
+	return s
+}
+
+// Running returns the running datastore.
+func (s *Server) Running() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Candidate returns the candidate datastore.
+func (s *Server) Candidate() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.candidate
+}
+
+// Operations returns the names of the operations received, in order.
+func (s *Server) Operations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.operations...)
+}
+
+// Notify sends an event to every subscribed session.
+func (s *Server) Notify(eventTime, event string) {
+	s.mu.Lock()
+	subscribers := make([]*session, 0, len(s.subscribers))
+	for _, sess := range s.subscribers {
+		subscribers = append(subscribers, sess)
+	}
+	s.mu.Unlock()
+	msg := fmt.Sprintf(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>%s</eventTime>%s</notification>`, eventTime, event)
+	for _, sess := range subscribers {
+		sess.write(msg)
+	}
+}
+
+type session struct {
+	id      uint64
+	channel ssh.Channel
+	reader  *bufio.Reader
+	chunked bool
+	wmu     sync.Mutex
+}
+
+func (s *Server) serve(channel ssh.Channel) {
+	s.mu.Lock()
+	s.nextID++
+	sess := &session{id: s.nextID, channel: channel, reader: bufio.NewReader(channel)}
+	s.mu.Unlock()
+	defer s.endSession(sess)
+
+	var caps strings.Builder
+	for _, capability := range s.opts.Capabilities {
+		caps.WriteString("<capability>" + capability + "</capability>")
+	}
+	sess.write(fmt.Sprintf(`<hello xmlns="%s"><capabilities>%s</capabilities><session-id>%d</session-id></hello>`, baseNamespace, caps.String(), sess.id))
+
+	msg, err := sess.read()
+	if err != nil {
+		return
+	}
+	var clientHello struct {
+		Capabilities []string `xml:"capabilities>capability"`
+	}
+	if xml.Unmarshal(msg, &clientHello) != nil {
+		return
+	}
+	sess.chunked = contains(s.opts.Capabilities, base11) && contains(clientHello.Capabilities, base11)
+
+	for {
+		msg, err := sess.read()
+		if err != nil {
+			return
+		}
+		if !s.handle(sess, msg) {
+			return
+		}
+	}
+}
+
+func (s *Server) endSession(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sess.id)
+	for datastore, holder := range s.locks {
+		if holder == sess.id {
+			delete(s.locks, datastore)
+		}
+	}
+}
+
+type rpc struct {
+	MessageID string `xml:"message-id,attr"`
+	Operation struct {
+		XMLName xml.Name
+		Source  datastore `xml:"source"`
+		Target  datastore `xml:"target"`
+		Config  struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"config"`
+		DefaultOperation string `xml:"default-operation"`
+	} `xml:",any"`
+}
+
+type datastore struct {
+	Inner string `xml:",innerxml"`
+}
+
+var datastoreName = regexp.MustCompile(`<(?:\w+:)?([\w-]+)`)
+
+func (d datastore) name() string {
+	if m := datastoreName.FindStringSubmatch(d.Inner); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// handle answers one rpc. It returns false once the session should end.
+func (s *Server) handle(sess *session, msg []byte) bool {
+	var req rpc
+	if err := xml.Unmarshal(msg, &req); err != nil {
+		return false
+	}
+	op := req.Operation
+	name := op.XMLName.Local
+
+	s.mu.Lock()
+	s.operations = append(s.operations, name)
+	reply, keepOpen := s.apply(sess, name, op.Source.name(), op.Target.name(), op.Config.Inner, op.DefaultOperation)
+	s.mu.Unlock()
+
+	sess.write(fmt.Sprintf(`<rpc-reply xmlns="%s" message-id="%s">%s</rpc-reply>`, baseNamespace, req.MessageID, reply))
+	return keepOpen
+}
+
+// apply runs an operation against the datastores. s.mu is held.
+func (s *Server) apply(sess *session, name, source, target, config, defaultOperation string) (string, bool) {
+	const ok = "<ok/>"
+	switch name {
+	case "get":
+		return "<data>" + s.running + s.opts.State + "</data>", true
+	case "get-config":
+		switch source {
+		case "running":
+			return "<data>" + s.running + "</data>", true
+		case "candidate":
+			return "<data>" + s.candidate + "</data>", true
+		}
+		return rpcError("protocol", "invalid-value", "unknown datastore "+source, ""), true
+	case "edit-config":
+		if holder, held := s.locks[target]; held && holder != sess.id {
+			return rpcError("protocol", "in-use", "datastore is locked by another session", ""), true
+		}
+		store := &s.running
+		if target == "candidate" {
+			store = &s.candidate
+		} else if target != "running" {
+			return rpcError("protocol", "invalid-value", "unknown datastore "+target, ""), true
+		}
+		if defaultOperation == "replace" || *store == "" {
+			*store = config
+		} else {
+			*store += config
+		}
+		return ok, true
+	case "lock":
+		if holder, held := s.locks[target]; held {
+			return rpcError("protocol", "lock-denied", "lock is already held", fmt.Sprintf("<session-id>%d</session-id>", holder)), true
+		}
+		s.locks[target] = sess.id
+		return ok, true
+	case "unlock":
+		if s.locks[target] != sess.id {
+			return rpcError("protocol", "operation-failed", "lock is not held by this session", ""), true
+		}
+		delete(s.locks, target)
+		return ok, true
+	case "validate":
+		if s.opts.Validate != nil {
+			if message := s.opts.Validate(s.candidate); message != "" {
+				return rpcError("application", "operation-failed", message, ""), true
+			}
+		}
+		return ok, true
+	case "commit":
+		if holder, held := s.locks["running"]; held && holder != sess.id {
+			return rpcError("protocol", "in-use", "running is locked by another session", ""), true
+		}
+		s.running = s.candidate
+		return ok, true
+	case "discard-changes":
+		s.candidate = s.running
+		return ok, true
+	case "create-subscription":
+		s.subscribers[sess.id] = sess
+		return ok, true
+	case "close-session":
+		return ok, false
+	}
+	return rpcError("protocol", "operation-not-supported", name+" is not supported", ""), true
+}
+
+func rpcError(errorType, tag, message, info string) string {
+	var b strings.Builder
+	b.WriteString("<rpc-error><error-type>" + errorType + "</error-type><error-tag>" + tag + "</error-tag><error-severity>error</error-severity>")
+	b.WriteString("<error-message>")
+	xml.EscapeText(&b, []byte(message))
+	b.WriteString("</error-message>")
+	if info != "" {
+		b.WriteString("<error-info>" + info + "</error-info>")
+	}
+	b.WriteString("</rpc-error>")
+	return b.String()
+}
+
+func (sess *session) write(msg string) {
+	sess.wmu.Lock()
+	defer sess.wmu.Unlock()
+	if sess.chunked {
+		fmt.Fprintf(sess.channel, "\n#%d\n%s\n##\n", len(msg), msg)
+		return
+	}
+	io.WriteString(sess.channel, msg+endOfMessage)
+}
+
+func (sess *session) read() ([]byte, error) {
+	if !sess.chunked {
+		var msg []byte
+		for {
+			part, err := sess.reader.ReadBytes('>')
+			msg = append(msg, part...)
+			if bytes.HasSuffix(msg, []byte(endOfMessage)) {
+				return msg[:len(msg)-len(endOfMessage)], nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	var msg []byte
+	for {
+		header, err := sess.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if header == "\n" {
+			continue
+		}
+		header = strings.TrimSuffix(header, "\n")
+		if header == "##" {
+			return msg, nil
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(header, "#"))
+		if err != nil || !strings.HasPrefix(header, "#") {
+			return nil, fmt.Errorf("netconftest: bad chunk header %q", header)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(sess.reader, chunk); err != nil {
+			return nil, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+func contains(list []string, want string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == want {
+			return true
+		}
+	}
+	return false
+}
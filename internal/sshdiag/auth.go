@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/jonelmawirat/netmigo/netmigo/challenge"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -37,6 +39,9 @@ type EndpointConfig struct {
 	AuthMode          AuthMode
 	ConnectionTimeout time.Duration
 	Retries           int
+	// Challenges answer keyboard-interactive prompts they match, such as an
+	// OTP prompt. Unmatched prompts are answered with Password.
+	Challenges []challenge.Rule
 }
 
 type authPlan struct {
@@ -66,7 +71,11 @@ func (c EndpointConfig) withDefaults() EndpointConfig {
 
 func (c EndpointConfig) Address() string {
 	cfg := c.withDefaults()
-	return fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
+	host := strings.TrimSpace(cfg.Host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return net.JoinHostPort(host, cfg.Port)
 }
 
 func (c EndpointConfig) Validate() error {
@@ -80,10 +89,14 @@ func (c EndpointConfig) Validate() error {
 
 	switch cfg.AuthMode {
 	case AuthModeAuto:
-		if cfg.Password == "" && cfg.KeyPath == "" {
+		if cfg.Password == "" && cfg.KeyPath == "" && len(cfg.Challenges) == 0 {
 			return fmt.Errorf("%s requires password or key path when auth mode is auto", cfg.Label)
 		}
-	case AuthModePassword, AuthModeKeyboardInteractive:
+	case AuthModeKeyboardInteractive:
+		if cfg.Password == "" && len(cfg.Challenges) == 0 {
+			return fmt.Errorf("%s password or challenge answers are required for auth mode %q", cfg.Label, cfg.AuthMode)
+		}
+	case AuthModePassword:
 		if cfg.Password == "" {
 			return fmt.Errorf("%s password is required for auth mode %q", cfg.Label, cfg.AuthMode)
 		}
@@ -126,17 +139,17 @@ func buildAuthPlans(cfg EndpointConfig, logger *slog.Logger) ([]authPlan, error)
 		if cfg.KeyPath != "" {
 			plans = append(plans, newKeyPlan(cfg))
 		}
+		if cfg.Password != "" || len(cfg.Challenges) > 0 {
+			plans = append(plans, authPlan{Mode: AuthModeKeyboardInteractive, Methods: []ssh.AuthMethod{keyboardInteractiveAuth(cfg.Label, cfg.Password, cfg.Challenges, logger)}})
+		}
 		if cfg.Password != "" {
-			plans = append(plans,
-				authPlan{Mode: AuthModeKeyboardInteractive, Methods: []ssh.AuthMethod{keyboardInteractiveAuth(cfg.Label, cfg.Password, logger)}},
-				authPlan{Mode: AuthModePassword, Methods: []ssh.AuthMethod{ssh.Password(cfg.Password)}},
-			)
+			plans = append(plans, authPlan{Mode: AuthModePassword, Methods: []ssh.AuthMethod{ssh.Password(cfg.Password)}})
 		}
 		return plans, nil
 	case AuthModePassword:
 		return []authPlan{{Mode: AuthModePassword, Methods: []ssh.AuthMethod{ssh.Password(cfg.Password)}}}, nil
 	case AuthModeKeyboardInteractive:
-		return []authPlan{{Mode: AuthModeKeyboardInteractive, Methods: []ssh.AuthMethod{keyboardInteractiveAuth(cfg.Label, cfg.Password, logger)}}}, nil
+		return []authPlan{{Mode: AuthModeKeyboardInteractive, Methods: []ssh.AuthMethod{keyboardInteractiveAuth(cfg.Label, cfg.Password, cfg.Challenges, logger)}}}, nil
 	case AuthModeKey:
 		return []authPlan{newKeyPlan(cfg)}, nil
 	default:
@@ -158,7 +171,13 @@ func newKeyPlan(cfg EndpointConfig) authPlan {
 	}
 }
 
-func keyboardInteractiveAuth(label, secret string, logger *slog.Logger) ssh.AuthMethod {
+// keyboardInteractiveAuth answers prompts matching one of rules with that
+// rule and every other prompt with secret.
+func keyboardInteractiveAuth(label, secret string, rules []challenge.Rule, logger *slog.Logger) ssh.AuthMethod {
+	handler := &challenge.Handler{Rules: rules}
+	if secret != "" {
+		handler.Fallback = challenge.Static(secret)
+	}
 	return ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
 		if logger != nil {
 			logger.Debug("Received keyboard-interactive challenge",
@@ -166,14 +185,10 @@ func keyboardInteractiveAuth(label, secret string, logger *slog.Logger) ssh.Auth
 				"user", user,
 				"instruction", instruction,
 				"promptCount", len(questions),
+				"prompts", questions,
 			)
 		}
-
-		answers := make([]string, len(questions))
-		for i := range questions {
-			answers[i] = secret
-		}
-		return answers, nil
+		return handler.Challenge(user, instruction, questions, echos)
 	})
 }
 
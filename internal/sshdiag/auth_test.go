@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/jonelmawirat/netmigo/netmigo/challenge"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -119,7 +120,7 @@ func TestBuildAuthPlansReportsHelpfulErrorForEncryptedKeyWithoutPassphrase(t *te
 }
 
 func TestKeyboardInteractiveAuthRepeatsSecretForEveryPrompt(t *testing.T) {
-	method := keyboardInteractiveAuth("target", "super-secret", nil)
+	method := keyboardInteractiveAuth("target", "super-secret", nil, nil)
 	challenge, ok := method.(ssh.KeyboardInteractiveChallenge)
 	if !ok {
 		t.Fatalf("expected keyboard-interactive challenge, got %T", method)
@@ -136,6 +137,35 @@ func TestKeyboardInteractiveAuthRepeatsSecretForEveryPrompt(t *testing.T) {
 	}
 }
 
+func TestKeyboardInteractiveAuthUsesChallengeRulesBeforeSecret(t *testing.T) {
+	rules := []challenge.Rule{challenge.MustMatch(`(?i)otp`, challenge.Static("123456"))}
+	method := keyboardInteractiveAuth("target", "super-secret", rules, nil)
+	respond := method.(ssh.KeyboardInteractiveChallenge)
+
+	answers, err := respond("tester", "", []string{"Password:", "OTP:"}, []bool{false, false})
+	if err != nil {
+		t.Fatalf("keyboardInteractiveAuth returned error: %v", err)
+	}
+	want := []string{"super-secret", "123456"}
+	if !reflect.DeepEqual(answers, want) {
+		t.Fatalf("unexpected answers: got %v want %v", answers, want)
+	}
+
+	plans, err := buildAuthPlans(EndpointConfig{
+		Label:      "target",
+		Host:       "10.0.0.1",
+		Username:   "tester",
+		AuthMode:   AuthModeKeyboardInteractive,
+		Challenges: rules,
+	}, nil)
+	if err != nil {
+		t.Fatalf("buildAuthPlans without password returned error: %v", err)
+	}
+	if got := planModes(plans); !reflect.DeepEqual(got, []AuthMode{AuthModeKeyboardInteractive}) {
+		t.Fatalf("unexpected auth plans: %v", got)
+	}
+}
+
 func planModes(plans []authPlan) []AuthMode {
 	modes := make([]AuthMode, 0, len(plans))
 	for _, plan := range plans {
@@ -169,3 +199,18 @@ func writePrivateKeyFile(t *testing.T, encrypted bool, passphrase string) string
 	}
 	return path
 }
+
+func TestEndpointAddressBracketsIPv6Literals(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1":        "10.0.0.1:22",
+		"router1.example": "router1.example:22",
+		"2001:db8::1":     "[2001:db8::1]:22",
+		"[2001:db8::1]":   "[2001:db8::1]:22",
+	}
+	for host, want := range cases {
+		got := EndpointConfig{Host: host}.Address()
+		if got != want {
+			t.Fatalf("Address() for %q = %q, want %q", host, got, want)
+		}
+	}
+}
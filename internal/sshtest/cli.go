@@ -0,0 +1,175 @@
+package sshtest
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CLI is a scripted device shell. With UserPrompt set the shell starts in
+// user EXEC and enable asks for Secret; commands starting with sudo ask for
+// SudoPassword, honouring sudo's -p prompt option.
+type CLI struct {
+	// Prompt is the privileged prompt and defaults to "router#".
+	Prompt       string
+	UserPrompt   string
+	Secret       string
+	SudoPassword string
+	// EchoInput echoes every line typed, passwords included, like a
+	// terminal that ignores the client's echo setting.
+	EchoInput bool
+	// Handler returns a command's output. privileged is true after enable
+	// and for commands run with sudo.
+	Handler func(command string, privileged bool) string
+	// Configure enables configuration mode: "configure" and "configure
+	// terminal" switch to a (config)# prompt, "end" leaves it and every
+	// other line is answered by Configure.
+	Configure func(line string) string
+	// Candidate makes configuration mode keep changes until "commit", like
+	// IOS-XR; "end" with uncommitted changes asks whether to commit them.
+	Candidate bool
+}
+
+// Shell serves one session; pass it as a ShellHandler.
+func (c CLI) Shell(channel ssh.Channel) {
+	prompt := c.Prompt
+	if prompt == "" {
+		prompt = "router#"
+	}
+	reader := bufio.NewReader(channel)
+	privileged := c.UserPrompt == ""
+	write := func(text string) {
+		io.WriteString(channel, strings.ReplaceAll(text, "\n", "\r\n"))
+	}
+	readLine := func() (string, bool) {
+		var line []byte
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			switch b {
+			case '\r', '\n':
+				if c.EchoInput {
+					write(string(line) + "\n")
+				}
+				return string(line), true
+			case 0x03:
+				write("^C\n")
+				return "\x03", true
+			default:
+				line = append(line, b)
+			}
+		}
+	}
+	// ask prompts for a password up to three times, printing retry
+	// between attempts.
+	ask := func(prompt, want, retry string) bool {
+		for attempt := 0; attempt < 3; attempt++ {
+			write(prompt)
+			answer, ok := readLine()
+			if !ok || answer == "\x03" {
+				return false
+			}
+			if answer == want {
+				return true
+			}
+			if attempt < 2 {
+				write(retry)
+			}
+		}
+		return false
+	}
+
+	configPrompt := strings.TrimSuffix(prompt, "#") + "(config)#"
+	configuring, pending := false, false
+	for {
+		if configuring {
+			write("\n" + configPrompt)
+			line, ok := readLine()
+			if !ok {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "":
+			case line == "end" || line == "exit":
+				if pending {
+					write("\nUncommitted changes found, commit them before exiting(yes/no/cancel)? [cancel]:")
+					answer, ok := readLine()
+					if !ok {
+						return
+					}
+					if answer = strings.TrimSpace(answer); answer == "cancel" || answer == "" {
+						continue
+					}
+					pending = false
+				}
+				configuring = false
+			case line == "commit" && c.Candidate:
+				pending = false
+				write("\n")
+			default:
+				write("\n")
+				if output := c.Configure(line); output != "" {
+					write(strings.TrimSuffix(output, "\n") + "\n")
+				} else {
+					pending = c.Candidate
+				}
+			}
+			continue
+		}
+		if privileged {
+			write("\n" + prompt)
+		} else {
+			write("\n" + c.UserPrompt)
+		}
+		command, ok := readLine()
+		if !ok {
+			return
+		}
+		command = strings.Trim(command, " \x03")
+		switch {
+		case command == "":
+		case command == "exit":
+			return
+		case command == "enable" && c.UserPrompt != "":
+			if privileged {
+				continue
+			}
+			write("\n")
+			if ask("Password: ", c.Secret, "") {
+				privileged = true
+			} else {
+				write("% Bad secrets\n")
+			}
+		case (command == "configure" || command == "configure terminal") && c.Configure != nil && privileged:
+			configuring = true
+		case command == "disable":
+			privileged = c.UserPrompt == ""
+		case strings.HasPrefix(command, "sudo "):
+			args := strings.TrimPrefix(command, "sudo ")
+			sudoPrompt := "[sudo] password: "
+			if strings.HasPrefix(args, "-p '") {
+				end := strings.Index(args[4:], "'")
+				sudoPrompt = args[4 : 4+end]
+				args = strings.TrimSpace(args[4+end+1:])
+			}
+			write("\n")
+			if !ask(sudoPrompt, c.SudoPassword, "Sorry, try again.\n") {
+				write("sudo: 3 incorrect password attempts\n")
+				continue
+			}
+			if args != "-v" && c.Handler != nil {
+				write(strings.TrimSuffix(c.Handler(args, true), "\n") + "\n")
+			}
+		default:
+			write("\n")
+			if c.Handler != nil {
+				write(strings.TrimSuffix(c.Handler(command, privileged), "\n") + "\n")
+			}
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Package sshtest runs an in-process SSH server for tests. It accepts
+// password authentication, serves interactive shells and subsystems through
+// handler functions and forwards direct-tcpip channels so it can act as a jump host.
+package sshtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var errPermissionDenied = errors.New("permission denied")
+
+// ShellHandler serves one interactive shell session. It returns when the
+// session should be closed.
+type ShellHandler func(channel ssh.Channel)
+
+// Server is a test SSH server listening on a loopback address.
+type Server struct {
+	Addr     string
+	Username string
+	Password string
+
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	shell       ShellHandler
+	subsystems  map[string]ShellHandler
+	connections atomic.Int32
+	channels    atomic.Int32
+	mu          sync.Mutex
+	conns       []*ssh.ServerConn
+}
+
+// Options configures a test server. Password auth is enabled when
+// Password is set; user certificates signed by UserCA are accepted when
+// UserCA is set. HostSigner defaults to a fresh ed25519 key.
+type Options struct {
+	Username string
+	Password string
+	Shell    ShellHandler
+	// Subsystems serves subsystem requests such as "netconf" by name.
+	Subsystems map[string]ShellHandler
+	UserCA     ssh.PublicKey
+	HostSigner ssh.Signer
+	// KeyboardInteractive, when set, is installed as the server's
+	// keyboard-interactive callback.
+	KeyboardInteractive func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error)
+}
+
+// NewServer starts a server that accepts username/password and is shut
+// down when the test finishes.
+func NewServer(t testing.TB, username, password string, shell ShellHandler) *Server {
+	t.Helper()
+	return Start(t, Options{Username: username, Password: password, Shell: shell})
+}
+
+// Start starts a server with the given options and shuts it down when the
+// test finishes.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+
+	signer := opts.HostSigner
+	if signer == nil {
+		signer = NewSigner(t)
+	}
+
+	s := &Server{Username: opts.Username, Password: opts.Password, shell: opts.Shell, subsystems: opts.Subsystems}
+	s.config = &ssh.ServerConfig{}
+	if opts.Password != "" {
+		s.config.PasswordCallback = func(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if meta.User() == s.Username && string(pass) == s.Password {
+				return nil, nil
+			}
+			return nil, errPermissionDenied
+		}
+	}
+	s.config.KeyboardInteractiveCallback = opts.KeyboardInteractive
+	if opts.UserCA != nil {
+		checker := &ssh.CertChecker{
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return bytes.Equal(auth.Marshal(), opts.UserCA.Marshal())
+			},
+		}
+		s.config.PublicKeyCallback = checker.Authenticate
+	}
+	s.config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("sshtest: listen: %v", err)
+	}
+	s.listener = listener
+	s.Addr = listener.Addr().String()
+	t.Cleanup(s.Close)
+
+	go s.acceptLoop()
+	return s
+}
+
+// NewSigner returns a fresh ed25519 signer.
+func NewSigner(t testing.TB) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("sshtest: generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("sshtest: signer: %v", err)
+	}
+	return signer
+}
+
+// SignCertificate signs key with ca and returns the certificate.
+func SignCertificate(t testing.TB, ca ssh.Signer, key ssh.PublicKey, certType uint32, principals []string, validAfter, validBefore time.Time) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          1,
+		CertType:        certType,
+		KeyId:           "sshtest",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if certType == ssh.UserCert {
+		cert.Permissions.Extensions = map[string]string{"permit-pty": ""}
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("sshtest: sign certificate: %v", err)
+	}
+	return cert
+}
+
+// Host and Port split Addr for use with config.NewDeviceConfig.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return port
+}
+
+// Connections reports how many SSH connections completed the handshake.
+func (s *Server) Connections() int {
+	return int(s.connections.Load())
+}
+
+// OpenChannels reports how many channels are currently open.
+func (s *Server) OpenChannels() int {
+	return int(s.channels.Load())
+}
+
+// DropConnections closes every established SSH connection while leaving
+// the listener running.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+	s.DropConnections()
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(netConn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	s.connections.Add(1)
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+
+	go s.handleGlobalRequests(serverConn, reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(newChannel)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *Server) handleSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	s.channels.Add(1)
+	defer s.channels.Add(-1)
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req", "env":
+			req.Reply(true, nil)
+		case "shell", "subsystem":
+			handler := s.shell
+			if req.Type == "subsystem" {
+				var payload struct{ Name string }
+				if ssh.Unmarshal(req.Payload, &payload) != nil {
+					req.Reply(false, nil)
+					return
+				}
+				handler = s.subsystems[payload.Name]
+			}
+			req.Reply(handler != nil, nil)
+			if handler == nil {
+				return
+			}
+			go func() {
+				for req := range requests {
+					if req.WantReply {
+						req.Reply(false, nil)
+					}
+				}
+			}()
+			handler(channel)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	s.channels.Add(1)
+	defer s.channels.Add(-1)
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(channel, target); channel.CloseWrite(); done <- struct{}{} }()
+	go func() { io.Copy(target, channel); target.Close(); done <- struct{}{} }()
+	<-done
+	<-done
+	channel.Close()
+}
+
+// handleGlobalRequests answers keepalives and serves tcpip-forward requests
+// (remote port forwarding) by listening on the loopback interface.
+func (s *Server) handleGlobalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			var payload struct {
+				Addr string
+				Port uint32
+			}
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(payload.Port))))
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			port := uint32(listener.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(payload.Addr, strconv.Itoa(int(port)))] = listener
+			if payload.Port == 0 {
+				listeners[net.JoinHostPort(payload.Addr, "0")] = listener
+			}
+			req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			go s.serveForwarded(conn, listener, payload.Addr, port)
+		case "cancel-tcpip-forward":
+			var payload struct {
+				Addr string
+				Port uint32
+			}
+			ssh.Unmarshal(req.Payload, &payload)
+			key := net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port)))
+			if listener, ok := listeners[key]; ok {
+				listener.Close()
+				delete(listeners, key)
+			}
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		default:
+			if req.WantReply {
+				req.Reply(req.Type == "keepalive@openssh.com", nil)
+			}
+		}
+	}
+}
+
+func (s *Server) serveForwarded(conn *ssh.ServerConn, listener net.Listener, addr string, port uint32) {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer client.Close()
+			origin := client.RemoteAddr().(*net.TCPAddr)
+			payload := ssh.Marshal(struct {
+				Addr       string
+				Port       uint32
+				OriginAddr string
+				OriginPort uint32
+			}{addr, port, origin.IP.String(), uint32(origin.Port)})
+			channel, requests, err := conn.OpenChannel("forwarded-tcpip", payload)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			done := make(chan struct{}, 2)
+			go func() { io.Copy(channel, client); channel.CloseWrite(); done <- struct{}{} }()
+			go func() { io.Copy(client, channel); done <- struct{}{} }()
+			<-done
+			<-done
+			channel.Close()
+		}()
+	}
+}
@@ -0,0 +1,457 @@
+// Package telnettest runs an in-process Telnet server for tests. It
+// negotiates echo, suppress-go-ahead, terminal type and window size like a
+// router's vty line, asks for a username and password, and answers
+// commands through a handler function. With Console set it acts as a
+// console server port in front of a device's serial line.
+package telnettest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	se   = 240
+	brk  = 243
+	sb   = 250
+	will = 251
+	wont = 252
+	do   = 253
+	dont = 254
+	iac  = 255
+
+	optEcho  = 1
+	optSGA   = 3
+	optTType = 24
+	optNAWS  = 31
+)
+
+// Handler returns the output of command, without the trailing prompt. An
+// output ending in "[confirm]" waits for another line before the prompt.
+type Handler func(command string) string
+
+// Options configures a test server. Login prompts are skipped when
+// Username and Password are both empty. Prompt defaults to "router#". With
+// Secret set the session starts in user EXEC at Prompt with > in place of
+// #, and enable asks for Secret.
+type Options struct {
+	Username string
+	Password string
+	Secret   string
+	Prompt   string
+	Banner   string
+	Handler  Handler
+	Console  *Console
+}
+
+// Console makes the server a console server port. Username and Password
+// in Options are then the console server's own login; the fields here are
+// the device login behind it. The line stays silent until woken with a
+// carriage return, and its state is kept between connections like a real
+// serial line.
+type Console struct {
+	Username   string
+	Password   string
+	LoggedIn   bool
+	ConfigMode bool
+	Busy       bool
+}
+
+// Server is a test Telnet server listening on a loopback address.
+type Server struct {
+	Addr string
+
+	opts        Options
+	listener    net.Listener
+	connections atomic.Int32
+
+	mu           sync.Mutex
+	conns        []net.Conn
+	terminalType string
+	width        int
+	height       int
+	line         Console
+	rommon       bool
+	breaks       int
+}
+
+// Start starts a server and shuts it down when the test finishes.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+	if opts.Prompt == "" {
+		opts.Prompt = "router#"
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("telnettest: listen: %v", err)
+	}
+	s := &Server{Addr: listener.Addr().String(), opts: opts, listener: listener}
+	if opts.Console != nil {
+		s.line = *opts.Console
+	}
+	t.Cleanup(s.Close)
+	go s.acceptLoop()
+	return s
+}
+
+// Host and Port split Addr for use with config.NewDeviceConfig.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return port
+}
+
+// Connections reports how many connections were accepted.
+func (s *Server) Connections() int {
+	return int(s.connections.Load())
+}
+
+// TerminalType reports the terminal type the last client sent.
+func (s *Server) TerminalType() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.terminalType
+}
+
+// WindowSize reports the window size the last client sent.
+func (s *Server) WindowSize() (width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.width, s.height
+}
+
+// SetBusy marks the console line as held by another session.
+func (s *Server) SetBusy(busy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line.Busy = busy
+}
+
+// LoggedIn reports whether the device on the console line is logged in.
+func (s *Server) LoggedIn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.line.LoggedIn
+}
+
+// Breaks reports how many breaks the console line received.
+func (s *Server) Breaks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.breaks
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.connections.Add(1)
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	sess := &session{server: s, conn: conn, reader: bufio.NewReader(conn)}
+
+	s.mu.Lock()
+	busy := s.opts.Console != nil && s.line.Busy
+	s.mu.Unlock()
+	if busy {
+		sess.print("% Connection refused by remote host\n")
+		return
+	}
+
+	sess.write([]byte{iac, will, optEcho, iac, will, optSGA, iac, do, optTType, iac, do, optNAWS})
+	if s.opts.Banner != "" {
+		sess.print(s.opts.Banner + "\n")
+	}
+
+	if s.opts.Username != "" || s.opts.Password != "" {
+		for attempt := 0; ; attempt++ {
+			if attempt == 3 {
+				return
+			}
+			sess.print("\nUser Access Verification\n\nUsername: ")
+			username, ok := sess.readLine(true)
+			if !ok {
+				return
+			}
+			sess.print("Password: ")
+			password, ok := sess.readLine(false)
+			if !ok {
+				return
+			}
+			sess.print("\n")
+			if username == s.opts.Username && password == s.opts.Password {
+				break
+			}
+			sess.print("% Login invalid\n")
+		}
+	}
+
+	if s.opts.Console != nil {
+		s.serveConsole(sess)
+		return
+	}
+
+	userPrompt := strings.TrimSuffix(s.opts.Prompt, "#") + ">"
+	privileged := s.opts.Secret == ""
+	for {
+		if privileged {
+			sess.print("\n" + s.opts.Prompt)
+		} else {
+			sess.print("\n" + userPrompt)
+		}
+		command, ok := sess.readLine(true)
+		if !ok {
+			return
+		}
+		command = strings.TrimSpace(command)
+		switch {
+		case command == "exit" || command == "logout":
+			return
+		case command == "enable" && !privileged:
+			for attempt := 0; attempt < 3 && !privileged; attempt++ {
+				sess.print("Password: ")
+				secret, ok := sess.readLine(false)
+				if !ok {
+					return
+				}
+				sess.print("\n")
+				privileged = secret == s.opts.Secret
+			}
+			if !privileged {
+				sess.print("% Bad secrets\n")
+			}
+		case command == "disable":
+			privileged = s.opts.Secret == ""
+		case !sess.handle(command):
+			return
+		}
+	}
+}
+
+// handle runs command through the handler and prints its output.
+func (sess *session) handle(command string) bool {
+	handler := sess.server.opts.Handler
+	if command == "" || handler == nil {
+		return true
+	}
+	output := handler(command)
+	if strings.HasSuffix(output, "[confirm]") {
+		sess.print(output)
+		if _, ok := sess.readLine(true); !ok {
+			return false
+		}
+		return true
+	}
+	if output != "" {
+		sess.print(strings.TrimSuffix(output, "\n") + "\n")
+	}
+	return true
+}
+
+// serveConsole plays the device on the serial line: nothing is printed
+// until the line is woken, then the device shows ROMMON, its login or the
+// session left behind by the previous user.
+func (s *Server) serveConsole(sess *session) {
+	prompt := s.opts.Prompt
+	configPrompt := strings.TrimSuffix(prompt, "#") + "(config)#"
+	if _, ok := sess.readLine(false); !ok {
+		return
+	}
+	for {
+		s.mu.Lock()
+		line, rommon := s.line, s.rommon
+		s.mu.Unlock()
+
+		switch {
+		case rommon:
+			sess.print("\nrommon 1 > ")
+			if _, ok := sess.readLine(true); !ok {
+				return
+			}
+		case !line.LoggedIn && line.Username != "":
+			sess.print("\nUser Access Verification\n\nUsername: ")
+			username, ok := sess.readLine(true)
+			if !ok {
+				return
+			}
+			sess.print("Password: ")
+			password, ok := sess.readLine(false)
+			if !ok {
+				return
+			}
+			sess.print("\n")
+			if username != line.Username || password != line.Password {
+				sess.print("% Login invalid\n")
+				continue
+			}
+			s.mu.Lock()
+			s.line.LoggedIn = true
+			s.mu.Unlock()
+		default:
+			if line.ConfigMode {
+				sess.print("\n" + configPrompt)
+			} else {
+				sess.print("\n" + prompt)
+			}
+			command, ok := sess.readLine(true)
+			if !ok {
+				return
+			}
+			command = strings.TrimSpace(command)
+			switch {
+			case command == "end":
+				s.mu.Lock()
+				s.line.ConfigMode = false
+				s.mu.Unlock()
+			case command == "exit" || command == "logout":
+				s.mu.Lock()
+				s.line.LoggedIn = false
+				s.line.ConfigMode = false
+				s.mu.Unlock()
+				sess.print("\n\nrouter con0 is now available\n\nPress RETURN to get started.\n")
+				if _, ok := sess.readLine(false); !ok {
+					return
+				}
+			case !sess.handle(command):
+				return
+			}
+		}
+	}
+}
+
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (sess *session) write(b []byte) {
+	sess.conn.Write(b)
+}
+
+// print writes text with NVT line endings.
+func (sess *session) print(text string) {
+	sess.write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+}
+
+// readLine reads one line of client input, handling option negotiation on
+// the way, and echoes it when echo is set.
+func (sess *session) readLine(echo bool) (string, bool) {
+	var line []byte
+	for {
+		b, err := sess.reader.ReadByte()
+		if err != nil {
+			return "", false
+		}
+		switch b {
+		case iac:
+			if !sess.command() {
+				return "", false
+			}
+		case '\r', '\n':
+			if b == '\r' {
+				if next, err := sess.reader.Peek(1); err == nil && (next[0] == '\n' || next[0] == 0) {
+					sess.reader.ReadByte()
+				}
+			}
+			if echo {
+				sess.print(string(line) + "\n")
+			}
+			return string(line), true
+		default:
+			line = append(line, b)
+		}
+	}
+}
+
+func (sess *session) command() bool {
+	cmd, err := sess.reader.ReadByte()
+	if err != nil {
+		return false
+	}
+	switch cmd {
+	case brk:
+		s := sess.server
+		s.mu.Lock()
+		s.breaks++
+		s.rommon = true
+		s.mu.Unlock()
+	case will, wont, do, dont:
+		opt, err := sess.reader.ReadByte()
+		if err != nil {
+			return false
+		}
+		if cmd == will && opt == optTType {
+			sess.write([]byte{iac, sb, optTType, 1, iac, se})
+		}
+	case sb:
+		var payload []byte
+		for {
+			b, err := sess.reader.ReadByte()
+			if err != nil {
+				return false
+			}
+			if b == iac {
+				next, err := sess.reader.ReadByte()
+				if err != nil {
+					return false
+				}
+				if next == se {
+					break
+				}
+				b = next
+			}
+			payload = append(payload, b)
+		}
+		sess.subnegotiation(payload)
+	}
+	return true
+}
+
+func (sess *session) subnegotiation(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	s := sess.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch payload[0] {
+	case optTType:
+		if len(payload) > 1 && payload[1] == 0 {
+			s.terminalType = string(payload[2:])
+		}
+	case optNAWS:
+		if len(payload) == 5 {
+			s.width = int(payload[1])<<8 | int(payload[2])
+			s.height = int(payload[3])<<8 | int(payload[4])
+		}
+	}
+}
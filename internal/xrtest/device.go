@@ -0,0 +1,382 @@
+// Package xrtest is a fake IOS-XR device for tests. It serves an SSH shell
+// through sshtest with IOS-XR's two-stage configuration: lines go to a
+// candidate configuration, commit applies it to the running configuration
+// and records it in a commit database, commit confirmed applies it on
+// trial, and rollback configuration last N undoes commits.
+package xrtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+)
+
+const (
+	hostname = "RP/0/RSP0/CPU0:router"
+
+	commitFailed = "% Failed to commit one or more configuration items during a pseudo-atomic operation. " +
+		"All changes made have been reverted. Please issue 'show configuration failed [inheritance]' from this session to view the errors"
+	uncommitted = "Uncommitted changes found, commit them before exiting(yes/no/cancel)? [cancel]:"
+)
+
+// Options configures a device. Running seeds the running configuration.
+// Reject returns a parse error for a line as it is typed, and Verify
+// returns a semantic error for a line at commit time; an empty string
+// accepts the line.
+type Options struct {
+	Username string
+	Password string
+	Running  []string
+	Reject   func(line string) string
+	Verify   func(line string) string
+}
+
+// Commit is an entry in the commit database.
+type Commit struct {
+	ID      string
+	Label   string
+	Comment string
+	Lines   []string
+	// Trial is set while a commit confirmed waits for its confirmation.
+	Trial bool
+
+	before []string
+}
+
+// Device is a fake IOS-XR device.
+type Device struct {
+	*sshtest.Server
+
+	opts Options
+
+	mu      sync.Mutex
+	running []string
+	commits []*Commit
+	nextID  int
+	trial   *time.Timer
+}
+
+// Start starts a device and shuts it down when the test finishes.
+func Start(t testing.TB, opts Options) *Device {
+	t.Helper()
+	d := &Device{opts: opts, running: slices.Clone(opts.Running), nextID: 1000000001}
+	d.Server = sshtest.NewServer(t, opts.Username, opts.Password, d.shell)
+	t.Cleanup(func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.trial != nil {
+			d.trial.Stop()
+		}
+	})
+	return d
+}
+
+// Running returns the running configuration.
+func (d *Device) Running() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.running)
+}
+
+// Commits returns the commit database, newest first.
+func (d *Device) Commits() []Commit {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	commits := make([]Commit, 0, len(d.commits))
+	for i := len(d.commits) - 1; i >= 0; i-- {
+		commits = append(commits, *d.commits[i])
+	}
+	return commits
+}
+
+// ExpireConfirmed lets the timer of a pending commit confirmed run out
+// now, rolling the commit back.
+func (d *Device) ExpireConfirmed() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.trial != nil {
+		d.trial.Stop()
+		d.revertTrial()
+	}
+}
+
+// revertTrial undoes a commit confirmed that was not confirmed. d.mu must
+// be held.
+func (d *Device) revertTrial() {
+	d.trial = nil
+	if n := len(d.commits); n > 0 && d.commits[n-1].Trial {
+		d.running = d.commits[n-1].before
+		d.commits = d.commits[:n-1]
+	}
+}
+
+// commit applies candidate to the running configuration. It returns the
+// lines Verify rejected, in which case nothing changes.
+func (d *Device) commit(candidate []string, label, comment string, confirmed time.Duration) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var failed []string
+	if d.opts.Verify != nil {
+		for _, line := range candidate {
+			if msg := d.opts.Verify(line); msg != "" {
+				failed = append(failed, line+"\n!!% "+msg)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+
+	if d.trial != nil {
+		d.trial.Stop()
+		d.trial = nil
+		d.commits[len(d.commits)-1].Trial = false
+	}
+	c := &Commit{
+		ID:      strconv.Itoa(d.nextID),
+		Label:   label,
+		Comment: comment,
+		Lines:   slices.Clone(candidate),
+		before:  slices.Clone(d.running),
+	}
+	d.nextID++
+	d.running = apply(d.running, candidate)
+	d.commits = append(d.commits, c)
+	if confirmed > 0 {
+		c.Trial = true
+		d.trial = time.AfterFunc(confirmed, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.revertTrial()
+		})
+	}
+	return nil
+}
+
+// confirm confirms a pending commit confirmed. It reports whether there
+// was one.
+func (d *Device) confirm() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.trial == nil {
+		return false
+	}
+	d.trial.Stop()
+	d.trial = nil
+	d.commits[len(d.commits)-1].Trial = false
+	return true
+}
+
+// rollback undoes the last n commits as a new commit.
+func (d *Device) rollback(n int) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n < 1 || n > len(d.commits) {
+		return fmt.Sprintf("%% Invalid rollback point: only %d commits are available", len(d.commits))
+	}
+	target := d.commits[len(d.commits)-n].before
+	d.commits = append(d.commits, &Commit{
+		ID:     strconv.Itoa(d.nextID),
+		Label:  "rollback",
+		before: d.running,
+	})
+	d.nextID++
+	d.running = slices.Clone(target)
+	return fmt.Sprintf("Loading Rollback Changes.\nLoaded Rollback Changes in 1 sec \nCommitting.\n"+
+		"Updating.\nUpdated Commit database in 1 sec \nConfiguration successfully rolled back %d commits.", n)
+}
+
+// apply adds the lines of candidate to running, removing the lines "no"
+// lines name.
+func apply(running, candidate []string) []string {
+	running = slices.Clone(running)
+	for _, line := range candidate {
+		if negated, ok := strings.CutPrefix(strings.TrimSpace(line), "no "); ok {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+			running = slices.DeleteFunc(running, func(l string) bool { return l == indent+negated })
+			continue
+		}
+		if !slices.Contains(running, line) {
+			running = append(running, line)
+		}
+	}
+	return running
+}
+
+// parseCommit reads "commit [label L] [confirmed [seconds]] [comment ...]".
+// The comment runs to the end of the line, as on IOS-XR.
+func parseCommit(line string) (label, comment string, confirmed time.Duration, ok bool) {
+	fields := strings.Fields(line)
+	for i := 1; i < len(fields); i++ {
+		switch fields[i] {
+		case "label":
+			if i+1 >= len(fields) {
+				return "", "", 0, false
+			}
+			label = fields[i+1]
+			i++
+		case "confirmed":
+			confirmed = 600 * time.Second
+			if i+1 < len(fields) {
+				if seconds, err := strconv.Atoi(fields[i+1]); err == nil {
+					if seconds < 30 || seconds > 65535 {
+						return "", "", 0, false
+					}
+					confirmed = time.Duration(seconds) * time.Second
+					i++
+				}
+			}
+		case "comment":
+			_, comment, _ = strings.Cut(line, " comment ")
+			return label, comment, confirmed, comment != ""
+		default:
+			return "", "", 0, false
+		}
+	}
+	return label, comment, confirmed, true
+}
+
+func (d *Device) shell(channel ssh.Channel) {
+	reader := bufio.NewReader(channel)
+	write := func(text string) {
+		io.WriteString(channel, strings.ReplaceAll(text, "\n", "\r\n"))
+	}
+	readLine := func() (string, bool) {
+		var line []byte
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			if b == '\r' || b == '\n' {
+				return string(line), true
+			}
+			line = append(line, b)
+		}
+	}
+
+	var (
+		configuring bool
+		submode     string
+		candidate   []string
+		failed      []string
+	)
+	for {
+		switch {
+		case !configuring:
+			write("\n" + hostname + "#")
+		case submode != "":
+			write("\n" + hostname + "(config-" + submode + ")#")
+		default:
+			write("\n" + hostname + "(config)#")
+		}
+		raw, ok := readLine()
+		if !ok {
+			return
+		}
+		line := strings.TrimSpace(raw)
+		write("\n")
+
+		if !configuring {
+			switch {
+			case line == "":
+			case line == "exit":
+				return
+			case line == "configure" || line == "configure terminal":
+				configuring, candidate, failed = true, nil, nil
+			case line == "show running-config":
+				write(strings.Join(d.Running(), "\n") + "\nend\n")
+			case line == "show configuration commit list":
+				for _, c := range d.Commits() {
+					write(fmt.Sprintf("%s  %-10s admin\n", c.ID, c.Label))
+				}
+			case strings.HasPrefix(line, "rollback configuration last "):
+				n, err := strconv.Atoi(strings.TrimPrefix(line, "rollback configuration last "))
+				if err != nil {
+					write("% Invalid input detected at '^' marker.\n")
+					continue
+				}
+				write(d.rollback(n) + "\n")
+			default:
+				write("% Invalid input detected at '^' marker.\n")
+			}
+			continue
+		}
+
+		switch {
+		case line == "":
+		case line == "abort":
+			configuring, submode, candidate = false, "", nil
+		case line == "end" || (line == "exit" && submode == ""):
+			if len(candidate) > 0 {
+				write(uncommitted)
+				answer, ok := readLine()
+				if !ok {
+					return
+				}
+				write("\n")
+				switch strings.TrimSpace(answer) {
+				case "yes":
+					if failed = d.commit(candidate, "", "", 0); failed != nil {
+						write(commitFailed + "\n")
+						continue
+					}
+				case "no":
+				default:
+					continue
+				}
+			}
+			configuring, submode, candidate = false, "", nil
+		case line == "exit" || line == "root":
+			submode = ""
+		case line == "show configuration":
+			write("Building configuration...\n" + strings.Join(candidate, "\n") + "\nend\n")
+		case line == "show configuration failed":
+			if failed != nil {
+				write("!! SEMANTIC ERRORS: This configuration was rejected by \n!! the system due to semantic errors.\n" +
+					strings.Join(failed, "\n") + "\nend\n")
+			}
+		case line == "commit" || strings.HasPrefix(line, "commit "):
+			label, comment, confirmed, ok := parseCommit(line)
+			switch {
+			case !ok:
+				write("% Invalid input detected at '^' marker.\n")
+			case len(candidate) == 0 && confirmed == 0 && d.confirm():
+			case len(candidate) == 0:
+				write("% No configuration changes to commit.\n")
+			default:
+				// A rejected commit keeps the candidate, so it can be fixed
+				// or aborted.
+				if failed = d.commit(candidate, label, comment, confirmed); failed != nil {
+					write(commitFailed + "\n")
+					continue
+				}
+				candidate = nil
+			}
+		default:
+			if d.opts.Reject != nil {
+				if msg := d.opts.Reject(line); msg != "" {
+					write("                   ^\n" + msg + "\n")
+					continue
+				}
+			}
+			if submode != "" {
+				line = " " + line
+			} else if strings.HasPrefix(line, "interface ") {
+				submode = "if"
+			}
+			candidate = append(candidate, line)
+		}
+	}
+}
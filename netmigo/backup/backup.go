@@ -0,0 +1,266 @@
+// Package backup retrieves device configurations, strips the lines that
+// change on every retrieval, stores them as versions in a directory or a
+// git repository, and diffs versions against each other.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+	"github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+// ErrNoProfile is returned when there is no Profile for a platform.
+var ErrNoProfile = errors.New("no backup profile for platform")
+
+// Profile says how to retrieve a platform's configuration. Normalize gets
+// the command's raw output, prompts and echo included, and returns the
+// configuration to store.
+type Profile struct {
+	Command   string
+	Normalize func(command string, output []byte) []byte
+}
+
+var (
+	// ciscoVolatile matches lines of Cisco running configurations that
+	// change on every retrieval without the configuration changing.
+	ciscoVolatile = regexp.MustCompile(`^(` +
+		`Building configuration\.*|` +
+		`Current configuration\s*:.*|` +
+		`!!?\s*Last configuration change .*|` +
+		`!\s*NVRAM config last updated .*|` +
+		`!\s*No configuration change since last restart|` +
+		`!Time: .*|` +
+		`!Running configuration last done at: .*|` +
+		`\s*ntp clock-period \d+|` +
+		// IOS-XR prints the time before the output of every show command.
+		`(Mon|Tue|Wed|Thu|Fri|Sat|Sun) (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d+ \d\d:\d\d:\d\d(\.\d+)? \S+` +
+		`)\s*$`)
+	// promptLine matches a device prompt, alone or with a command after it.
+	promptLine = regexp.MustCompile(`^\S*[\w.\-@:/~\])]\s?[>#$%]\s*(exit)?$`)
+)
+
+// CiscoProfile retrieves show running-config from IOS, IOS-XE, IOS-XR and
+// NX-OS.
+var CiscoProfile = Profile{Command: "show running-config", Normalize: NormalizeCisco}
+
+// Profiles are the built-in profiles. Linux hosts have no single
+// configuration, so they need a Profile from WithProfile.
+var Profiles = map[config.Platform]Profile{
+	config.CISCO_IOSXR: CiscoProfile,
+	config.CISCO_IOSXE: CiscoProfile,
+	config.CISCO_NXOS:  CiscoProfile,
+}
+
+// NormalizeCisco cuts the configuration out of the output of command,
+// from the line after the echoed command to the final "end", and drops
+// volatile lines such as timestamps, "Building configuration..." and NTP
+// clock periods.
+func NormalizeCisco(command string, output []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(output), "\r", ""), "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(strings.TrimSpace(line), command) {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	end := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) == "end" {
+			end = i + 1
+			break
+		}
+	}
+	lines = lines[:end]
+	for len(lines) > 0 && (strings.TrimSpace(lines[len(lines)-1]) == "" || promptLine.MatchString(lines[len(lines)-1])) {
+		lines = lines[:len(lines)-1]
+	}
+
+	var kept []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if ciscoVolatile.MatchString(line) {
+			continue
+		}
+		if len(kept) == 0 && line == "" {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(kept, "\n") + "\n")
+}
+
+// Manager runs backups into a Store.
+type Manager struct {
+	store    Store
+	logger   *slog.Logger
+	profiles map[config.Platform]Profile
+	execOpts []repository.ExecuteOption
+	message  func(name string, added, removed int) string
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithProfile sets how configurations of platform are retrieved.
+func WithProfile(platform config.Platform, profile Profile) Option {
+	return func(m *Manager) {
+		m.profiles[platform] = profile
+	}
+}
+
+// WithExecuteOptions passes opts to the Execute that retrieves the
+// configuration, e.g. a longer timeout for large configurations.
+func WithExecuteOptions(opts ...repository.ExecuteOption) Option {
+	return func(m *Manager) {
+		m.execOpts = append(m.execOpts, opts...)
+	}
+}
+
+// WithMessage sets the message stored with each version. added and
+// removed count the lines changed since the previous version.
+func WithMessage(message func(name string, added, removed int) string) Option {
+	return func(m *Manager) {
+		m.message = message
+	}
+}
+
+func defaultMessage(name string, added, removed int) string {
+	return fmt.Sprintf("Backup of %s: %d lines added, %d removed", name, added, removed)
+}
+
+// New returns a Manager that stores versions in store.
+func New(logger *slog.Logger, store Store, opts ...Option) *Manager {
+	m := &Manager{
+		store:    store,
+		logger:   logger,
+		profiles: make(map[config.Platform]Profile, len(Profiles)),
+		message:  defaultMessage,
+	}
+	for platform, profile := range Profiles {
+		m.profiles[platform] = profile
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Result is the outcome of a backup. A configuration equal to the last
+// stored version is not stored again; Changed is false and Version is that
+// last version.
+type Result struct {
+	Name    string
+	Version Version
+	Changed bool
+	Config  []byte
+	// Diff is the unified diff from the previous version, empty for the
+	// first backup of a device.
+	Diff string
+}
+
+// Backup retrieves the configuration of a connected device and stores it
+// as a new version of name when it changed.
+func (m *Manager) Backup(device service.DeviceService, platform config.Platform, name string) (*Result, error) {
+	profile, ok := m.profiles[platform]
+	if !ok {
+		return nil, fmt.Errorf("%w %v", ErrNoProfile, platform)
+	}
+	m.logger.Info("Retrieving configuration", "device", name, "command", profile.Command)
+	cfg, err := Fetch(device, profile, m.execOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving configuration of %s: %w", name, err)
+	}
+	return m.Store(name, cfg)
+}
+
+// Fetch runs profile's command on a connected device and returns the
+// normalized configuration.
+func Fetch(device service.DeviceService, profile Profile, opts ...repository.ExecuteOption) ([]byte, error) {
+	path, err := device.Execute(profile.Command, opts...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := output
+	if profile.Normalize != nil {
+		cfg = profile.Normalize(profile.Command, output)
+	}
+	if len(cfg) == 0 {
+		return nil, errors.New("empty configuration")
+	}
+	return cfg, nil
+}
+
+// Store stores cfg as a new version of name when it differs from the last
+// version, for configurations retrieved some other way.
+func (m *Manager) Store(name string, cfg []byte) (*Result, error) {
+	versions, err := m.store.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Name: name, Config: cfg}
+	var previous []byte
+	if len(versions) > 0 {
+		if previous, err = m.store.Load(name, versions[0].ID); err != nil {
+			return nil, err
+		}
+		if string(previous) == string(cfg) {
+			m.logger.Info("Configuration unchanged", "device", name, "version", versions[0].ID)
+			result.Version = versions[0]
+			return result, nil
+		}
+	}
+
+	added, removed := DiffStat(previous, cfg)
+	version, err := m.store.Save(name, cfg, m.message(name, added, removed))
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		result.Diff = Diff(previous, cfg, name+"@"+versions[0].ID, name+"@"+version.ID)
+	}
+	m.logger.Info("Configuration stored", "device", name, "version", version.ID, "added", added, "removed", removed)
+	result.Version = version
+	result.Changed = true
+	return result, nil
+}
+
+// LastDiff returns the unified diff between the two newest versions of
+// name, or "" when they are equal.
+func (m *Manager) LastDiff(name string) (string, error) {
+	versions, err := m.store.Versions(name)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) < 2 {
+		return "", fmt.Errorf("%w: %s has %d versions, need two to compare", ErrNoVersion, name, len(versions))
+	}
+	return m.DiffVersions(name, versions[1].ID, versions[0].ID)
+}
+
+// DiffVersions returns the unified diff from version from to version to
+// of name.
+func (m *Manager) DiffVersions(name, from, to string) (string, error) {
+	a, err := m.store.Load(name, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := m.store.Load(name, to)
+	if err != nil {
+		return "", err
+	}
+	return Diff(a, b, name+"@"+from, name+"@"+to), nil
+}
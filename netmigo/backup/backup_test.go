@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/internal/devicetest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNormalizeCiscoDropsVolatileLines(t *testing.T) {
+	got := string(NormalizeCisco("show running-config", []byte(readTestdata(t, "iosxr_running_config.txt"))))
+	want := "!! IOS XR Configuration 7.3.2\n" +
+		"!\n" +
+		"hostname edge1\n" +
+		"interface GigabitEthernet0/0/0/0\n" +
+		" description uplink\n" +
+		" ipv4 address 192.0.2.1 255.255.255.252\n" +
+		"!\n" +
+		"end\n"
+	if got != want {
+		t.Fatalf("NormalizeCisco() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func testStores(t *testing.T) map[string]Store {
+	stores := map[string]Store{"dir": NewDirStore(t.TempDir())}
+	if _, err := exec.LookPath("git"); err == nil {
+		stores["git"] = NewGitStore(filepath.Join(t.TempDir(), "configs"))
+	}
+	return stores
+}
+
+func TestBackupStoresChangedVersionsOnly(t *testing.T) {
+	for kind, store := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			manager := New(logger, store)
+			device := devicetest.New(t, readTestdata(t, "iosxr_running_config.txt"))
+
+			first, err := manager.Backup(device, config.CISCO_IOSXR, "edge1")
+			if err != nil {
+				t.Fatalf("Backup returned error: %v", err)
+			}
+			if !first.Changed || first.Diff != "" || device.Commands()[0] != "show running-config" {
+				t.Fatalf("first backup = %+v, want a stored version without a diff", first)
+			}
+
+			// Only the timestamps moved, so nothing is stored.
+			device.Output = strings.NewReplacer("02:00:01.512", "03:00:02.001", "14:22:09", "14:22:10").Replace(device.Output)
+			second, err := manager.Backup(device, config.CISCO_IOSXR, "edge1")
+			if err != nil {
+				t.Fatalf("Backup returned error: %v", err)
+			}
+			if second.Changed || second.Version.ID != first.Version.ID {
+				t.Fatalf("second backup = %+v, want the first version kept", second)
+			}
+
+			device.Output = strings.Replace(device.Output, " description uplink", " description uplink to core\n mtu 9216", 1)
+			third, err := manager.Backup(device, config.CISCO_IOSXR, "edge1")
+			if err != nil {
+				t.Fatalf("Backup returned error: %v", err)
+			}
+			if !third.Changed || !strings.Contains(third.Diff, "- description uplink\n+ description uplink to core\n+ mtu 9216\n") {
+				t.Fatalf("third backup diff =\n%s", third.Diff)
+			}
+
+			versions, err := store.Versions("edge1")
+			if err != nil || len(versions) != 2 {
+				t.Fatalf("Versions() = %+v, %v, want two versions", versions, err)
+			}
+			if versions[0].Message != "Backup of edge1: 2 lines added, 1 removed" {
+				t.Fatalf("message = %q", versions[0].Message)
+			}
+			diff, err := manager.LastDiff("edge1")
+			if err != nil {
+				t.Fatalf("LastDiff returned error: %v", err)
+			}
+			if diff != third.Diff {
+				t.Fatalf("LastDiff() =\n%s\nwant\n%s", diff, third.Diff)
+			}
+		})
+	}
+}
+
+func TestBackupNeedsProfileForLinux(t *testing.T) {
+	manager := New(slog.New(slog.NewTextHandler(io.Discard, nil)), NewDirStore(t.TempDir()))
+	if _, err := manager.Backup(devicetest.New(t, ""), config.LINUX, "server"); !errors.Is(err, ErrNoProfile) {
+		t.Fatalf("Backup error = %v, want ErrNoProfile", err)
+	}
+	if _, err := manager.LastDiff("server"); !errors.Is(err, ErrNoVersion) {
+		t.Fatalf("LastDiff error = %v, want ErrNoVersion", err)
+	}
+}
+
+func TestStoresKeepDeviceNamesApartUnderConcurrentSaves(t *testing.T) {
+	names := []string{"r1/a", "r1 a", "r1_a", "r1%2Fa", ".r1", "r1"}
+	for kind, store := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make([]error, len(names))
+			for i, name := range names {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = store.Save(name, []byte("hostname "+name+"\n"), "Backup of "+name)
+				}()
+			}
+			wg.Wait()
+
+			for i, name := range names {
+				if errs[i] != nil {
+					t.Fatalf("Save(%q) returned error: %v", name, errs[i])
+				}
+				versions, err := store.Versions(name)
+				if err != nil || len(versions) != 1 {
+					t.Fatalf("Versions(%q) = %+v, %v, want one version", name, versions, err)
+				}
+				config, err := store.Load(name, versions[0].ID)
+				if err != nil || string(config) != "hostname "+name+"\n" {
+					t.Fatalf("Load(%q) = %q, %v", name, config, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type edit struct {
+	kind opKind
+	line string
+}
+
+// Diff returns a unified diff from a to b, labelled fromName and toName, or
+// "" when they are equal.
+func Diff(a, b []byte, fromName, toName string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+	hunks := groupHunks(edits)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLines), hunkRange(h.bStart, h.bLines))
+		for _, e := range h.edits {
+			out.WriteByte(byte(e.kind))
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// DiffStat counts the lines added and removed from a to b.
+func DiffStat(a, b []byte) (added, removed int) {
+	for _, e := range diffLines(splitLines(a), splitLines(b)) {
+		switch e.kind {
+		case opInsert:
+			added++
+		case opDelete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func splitLines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines computes a shortest edit script with Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		// Only diagonals -d..d are reachable in step d, so that window of v
+		// is all the backtrack needs.
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Walk the trace back from the end to recover the edits.
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[d+k-1] < vd[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{opEqual, a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{opInsert, b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{opDelete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{opEqual, a[x]})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+type hunk struct {
+	aStart, aLines int
+	bStart, bLines int
+	edits          []edit
+}
+
+// groupHunks splits edits into hunks with diffContext lines of context,
+// merging changes that are close together.
+func groupHunks(edits []edit) []hunk {
+	var hunks []hunk
+	var cur *hunk
+	aLine, bLine := 0, 0
+	lastChange := -1
+	for i, e := range edits {
+		if e.kind != opEqual {
+			if cur == nil || i-lastChange > 2*diffContext {
+				if cur != nil {
+					hunks = append(hunks, trimHunk(*cur, edits, lastChange))
+				}
+				start := max(0, i-diffContext)
+				cur = &hunk{aStart: aLine - (i - start), bStart: bLine - (i - start)}
+				for _, c := range edits[start:i] {
+					cur.edits = append(cur.edits, c)
+					cur.aLines++
+					cur.bLines++
+				}
+			} else {
+				for _, c := range edits[lastChange+1 : i] {
+					cur.edits = append(cur.edits, c)
+					cur.aLines++
+					cur.bLines++
+				}
+			}
+			cur.edits = append(cur.edits, e)
+			if e.kind == opDelete {
+				cur.aLines++
+			} else {
+				cur.bLines++
+			}
+			lastChange = i
+		}
+		if e.kind != opInsert {
+			aLine++
+		}
+		if e.kind != opDelete {
+			bLine++
+		}
+	}
+	if cur != nil {
+		hunks = append(hunks, trimHunk(*cur, edits, lastChange))
+	}
+	return hunks
+}
+
+// trimHunk appends up to diffContext lines of trailing context.
+func trimHunk(h hunk, edits []edit, lastChange int) hunk {
+	end := min(len(edits), lastChange+1+diffContext)
+	for _, c := range edits[lastChange+1 : end] {
+		h.edits = append(h.edits, c)
+		h.aLines++
+		h.bLines++
+	}
+	return h
+}
+
+// hunkRange formats a hunk range the way diff -u does: 1-based, with the
+// line count left out when it is one.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
@@ -0,0 +1,33 @@
+package backup
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"from empty", "", "a\nb\n", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{
+			"change with context",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n",
+			"--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"separate hunks",
+			"a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			"A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff([]byte(tt.a), []byte(tt.b), "old", "new"); got != tt.want {
+				t.Fatalf("Diff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
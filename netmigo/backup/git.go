@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitStore keeps each device's configuration as <device>.cfg in a git
+// repository and every version as a commit. It runs the git command, so
+// git must be installed. Saves are serialised, since git allows one
+// writer of the index at a time, so a GitStore may be shared by backups
+// running concurrently.
+type GitStore struct {
+	Root string
+	// AuthorName and AuthorEmail sign the commits. They default to
+	// "netmigo" and "netmigo@localhost".
+	AuthorName  string
+	AuthorEmail string
+
+	mu sync.Mutex
+}
+
+// NewGitStore returns a GitStore for the repository at root. The
+// repository is created on the first Save if it does not exist.
+func NewGitStore(root string) *GitStore {
+	return &GitStore{Root: root}
+}
+
+func (s *GitStore) Save(name string, config []byte, message string) (Version, error) {
+	file, err := fileName(name)
+	if err != nil {
+		return Version{}, err
+	}
+	file += ".cfg"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.init(); err != nil {
+		return Version{}, err
+	}
+	if err := os.WriteFile(filepath.Join(s.Root, file), config, 0644); err != nil {
+		return Version{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := s.git("add", "--", file); err != nil {
+		return Version{}, err
+	}
+	// --allow-empty records a version even when the file did not change,
+	// like DirStore does.
+	if _, err := s.git("commit", "--allow-empty", "--quiet", "-m", message, "--", file); err != nil {
+		return Version{}, err
+	}
+	versions, err := s.versions(file, "-1")
+	if err != nil {
+		return Version{}, err
+	}
+	if len(versions) == 0 {
+		return Version{}, fmt.Errorf("git commit for %s not found", file)
+	}
+	return versions[0], nil
+}
+
+func (s *GitStore) Versions(name string) ([]Version, error) {
+	file, err := fileName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, ".git")); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return s.versions(file + ".cfg")
+}
+
+func (s *GitStore) Load(name, id string) ([]byte, error) {
+	file, err := fileName(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(id, "-") || strings.ContainsAny(id, ": ") {
+		return nil, fmt.Errorf("%w: %q for %s", ErrNoVersion, id, name)
+	}
+	config, err := s.git("show", id+":"+file+".cfg")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q for %s: %w", ErrNoVersion, id, name, err)
+	}
+	return config, nil
+}
+
+func (s *GitStore) versions(file string, args ...string) ([]Version, error) {
+	args = append([]string{"log", "--format=%H%x00%ct%x00%s"}, args...)
+	out, err := s.git(append(args, "--", file)...)
+	if err != nil {
+		// A repository without commits has no log yet.
+		if strings.Contains(err.Error(), "does not have any commits") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var versions []Version
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(fields[1], 10, 64)
+		versions = append(versions, Version{ID: fields[0], Time: time.Unix(seconds, 0).UTC(), Message: fields[2]})
+	}
+	return versions, nil
+}
+
+func (s *GitStore) init() error {
+	if _, err := os.Stat(filepath.Join(s.Root, ".git")); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.Root, 0755); err != nil {
+		return fmt.Errorf("failed to create backup repository %s: %w", s.Root, err)
+	}
+	_, err := s.git("init", "--quiet")
+	return err
+}
+
+func (s *GitStore) git(args ...string) ([]byte, error) {
+	name, email := s.AuthorName, s.AuthorEmail
+	if name == "" {
+		name = "netmigo"
+	}
+	if email == "" {
+		email = "netmigo@localhost"
+	}
+	args = append([]string{"-c", "user.name=" + name, "-c", "user.email=" + email}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.Root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[4], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
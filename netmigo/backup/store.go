@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// versionIDLayout names the files of a DirStore. It sorts by time.
+const versionIDLayout = "20060102T150405.000000000Z"
+
+// ErrNoVersion is returned when a device has no stored version to load or
+// compare.
+var ErrNoVersion = errors.New("no stored configuration version")
+
+// unsafeName matches the characters escaped in device names before they
+// are used as file names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Version is one stored configuration of a device.
+type Version struct {
+	ID      string
+	Time    time.Time
+	Message string
+}
+
+// Store keeps versions of device configurations.
+type Store interface {
+	// Save stores config as the newest version of name.
+	Save(name string, config []byte, message string) (Version, error)
+	// Versions lists the versions of name, newest first.
+	Versions(name string) ([]Version, error)
+	// Load returns the configuration stored as version id of name.
+	Load(name, id string) ([]byte, error)
+}
+
+// fileName turns a device name into a file name. Unsafe bytes and a
+// leading dot are percent-encoded, so different names never share a file.
+func fileName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("invalid device name %q", name)
+	}
+	safe := unsafeName.ReplaceAllStringFunc(name, func(s string) string {
+		var escaped strings.Builder
+		for i := 0; i < len(s); i++ {
+			fmt.Fprintf(&escaped, "%%%02X", s[i])
+		}
+		return escaped.String()
+	})
+	if strings.HasPrefix(safe, ".") {
+		safe = "%2E" + safe[1:]
+	}
+	return safe, nil
+}
+
+// DirStore keeps each version as a file under Root/<device>/, named after
+// the time it was saved, with the message in a .msg file beside it.
+type DirStore struct {
+	Root string
+}
+
+// NewDirStore returns a DirStore rooted at root.
+func NewDirStore(root string) *DirStore {
+	return &DirStore{Root: root}
+}
+
+func (s *DirStore) Save(name string, config []byte, message string) (Version, error) {
+	dir, err := s.dir(name)
+	if err != nil {
+		return Version{}, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Version{}, fmt.Errorf("failed to create backup directory %s: %w", dir, err)
+	}
+	now := time.Now().UTC()
+	v := Version{ID: now.Format(versionIDLayout), Time: now, Message: message}
+	if err := os.WriteFile(filepath.Join(dir, v.ID+".cfg"), config, 0644); err != nil {
+		return Version{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, v.ID+".msg"), []byte(message), 0644); err != nil {
+		return Version{}, fmt.Errorf("failed to write backup message: %w", err)
+	}
+	return v, nil
+}
+
+func (s *DirStore) Versions(name string) ([]Version, error) {
+	dir, err := s.dir(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups in %s: %w", dir, err)
+	}
+	var versions []Version
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".cfg")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(versionIDLayout, id)
+		if err != nil {
+			continue
+		}
+		message, _ := os.ReadFile(filepath.Join(dir, id+".msg"))
+		versions = append(versions, Version{ID: id, Time: t, Message: string(bytes.TrimSpace(message))})
+	}
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+func (s *DirStore) Load(name, id string) ([]byte, error) {
+	dir, err := s.dir(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := time.Parse(versionIDLayout, id); err != nil {
+		return nil, fmt.Errorf("%w: %q for %s", ErrNoVersion, id, name)
+	}
+	config, err := os.ReadFile(filepath.Join(dir, id+".cfg"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q for %s", ErrNoVersion, id, name)
+	}
+	return config, err
+}
+
+func (s *DirStore) dir(name string) (string, error) {
+	file, err := fileName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, file), nil
+}
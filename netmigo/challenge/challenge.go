@@ -0,0 +1,93 @@
+// Package challenge answers SSH keyboard-interactive prompts, such as a
+// password followed by a one-time code, by matching each prompt against a
+// list of rules.
+package challenge
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Responder produces the answer for a single prompt.
+type Responder func(prompt string, echo bool) (string, error)
+
+// Rule answers prompts matching Pattern with Respond.
+type Rule struct {
+	Pattern *regexp.Regexp
+	Respond Responder
+}
+
+// Match returns a rule for prompts matching pattern, or the error from
+// compiling it. Use (?i) for case-insensitive matches.
+func Match(pattern string, respond Responder) (Rule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("challenge pattern: %w", err)
+	}
+	return Rule{Pattern: re, Respond: respond}, nil
+}
+
+// MustMatch is like Match but panics if pattern does not compile. It is
+// meant for patterns written into the program.
+func MustMatch(pattern string, respond Responder) Rule {
+	rule, err := Match(pattern, respond)
+	if err != nil {
+		panic(err)
+	}
+	return rule
+}
+
+// Static always answers with secret.
+func Static(secret string) Responder {
+	return func(string, bool) (string, error) {
+		return secret, nil
+	}
+}
+
+// Handler answers keyboard-interactive challenges. The first rule whose
+// pattern matches a prompt answers it; prompts no rule matches go to
+// Fallback, or fail the authentication when Fallback is nil.
+type Handler struct {
+	Rules    []Rule
+	Fallback Responder
+}
+
+// New returns a Handler for rules without a fallback.
+func New(rules ...Rule) *Handler {
+	return &Handler{Rules: rules}
+}
+
+// Challenge implements ssh.KeyboardInteractiveChallenge. Rounds without
+// questions, which servers use to show a banner, are answered with nothing.
+func (h *Handler) Challenge(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, question := range questions {
+		echo := i < len(echos) && echos[i]
+		respond := h.responderFor(question)
+		if respond == nil {
+			return nil, fmt.Errorf("no answer configured for keyboard-interactive prompt %q", question)
+		}
+		answer, err := respond(question, echo)
+		if err != nil {
+			return nil, fmt.Errorf("keyboard-interactive prompt %q: %w", question, err)
+		}
+		answers[i] = answer
+	}
+	return answers, nil
+}
+
+// AuthMethod returns an ssh.AuthMethod backed by h.
+func (h *Handler) AuthMethod() ssh.AuthMethod {
+	return ssh.KeyboardInteractive(h.Challenge)
+}
+
+func (h *Handler) responderFor(question string) Responder {
+	for _, rule := range h.Rules {
+		if rule.Pattern != nil && rule.Pattern.MatchString(question) {
+			return rule.Respond
+		}
+	}
+	return h.Fallback
+}
@@ -0,0 +1,97 @@
+package challenge
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Seed is the SHA-1 test secret from RFC 6238 appendix B, base32
+// encoded.
+const rfc6238Seed = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTPMatchesRFC6238(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := GenerateTOTP(rfc6238Seed, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTP(%d) returned error: %v", unix, err)
+		}
+		if got != want {
+			t.Fatalf("GenerateTOTP(%d) = %s, want %s", unix, got, want)
+		}
+	}
+
+	spaced := strings.ToLower("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if got, _ := GenerateTOTP(spaced, time.Unix(59, 0)); got != "287082" {
+		t.Fatalf("GenerateTOTP with spaced lowercase seed = %s", got)
+	}
+	if _, err := GenerateTOTP("not base32!", time.Now()); err == nil {
+		t.Fatal("expected invalid seed error")
+	}
+}
+
+func TestHandlerMatchesPromptsInOrder(t *testing.T) {
+	original := nowFunc
+	t.Cleanup(func() { nowFunc = original })
+	nowFunc = func() time.Time { return time.Unix(59, 0) }
+
+	var seen []string
+	h := New(
+		MustMatch(`(?i)password`, Static("s3cret")),
+		MustMatch(`(?i)verification code|otp`, TOTP(rfc6238Seed)),
+		MustMatch(`(?i)token serial`, func(prompt string, echo bool) (string, error) {
+			seen = append(seen, prompt)
+			if !echo {
+				return "", errors.New("expected echoed prompt")
+			}
+			return "42", nil
+		}),
+	)
+
+	answers, err := h.Challenge("neteng", "", []string{"Password: ", "Verification code: ", "Token serial: "}, []bool{false, false, true})
+	if err != nil {
+		t.Fatalf("Challenge returned error: %v", err)
+	}
+	if want := []string{"s3cret", "287082", "42"}; !reflect.DeepEqual(answers, want) {
+		t.Fatalf("answers = %v, want %v", answers, want)
+	}
+	if len(seen) != 1 || seen[0] != "Token serial: " {
+		t.Fatalf("callback saw %v", seen)
+	}
+
+	if answers, err := h.Challenge("neteng", "banner", nil, nil); err != nil || len(answers) != 0 {
+		t.Fatalf("empty round = %v, %v", answers, err)
+	}
+}
+
+func TestHandlerUnmatchedPrompt(t *testing.T) {
+	h := New(MustMatch(`(?i)password`, Static("s3cret")))
+	_, err := h.Challenge("neteng", "", []string{"PIN: "}, []bool{false})
+	if err == nil || !strings.Contains(err.Error(), `"PIN: "`) {
+		t.Fatalf("Challenge error = %v, want unmatched prompt error", err)
+	}
+
+	h.Fallback = Static("fallback")
+	answers, err := h.Challenge("neteng", "", []string{"PIN: "}, []bool{false})
+	if err != nil || answers[0] != "fallback" {
+		t.Fatalf("fallback answers = %v, %v", answers, err)
+	}
+}
+
+func TestMatchReportsBadPatterns(t *testing.T) {
+	if _, err := Match(`(?i)code[`, Static("123456")); err == nil {
+		t.Fatal("Match accepted a pattern that does not compile")
+	}
+	rule, err := Match(`(?i)code`, Static("123456"))
+	if err != nil || !rule.Pattern.MatchString("Verification Code: ") {
+		t.Fatalf("Match = %v, %v, want a rule for the pattern", rule.Pattern, err)
+	}
+}
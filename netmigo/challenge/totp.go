@@ -0,0 +1,58 @@
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	totpStep   = 30 * time.Second
+	totpDigits = 6
+)
+
+var nowFunc = time.Now
+
+// TOTP answers with the current RFC 6238 code (SHA-1, 30 second step, six
+// digits) for a base32 seed, as shown by most authenticator apps.
+func TOTP(seed string) Responder {
+	return func(string, bool) (string, error) {
+		return GenerateTOTP(seed, nowFunc())
+	}
+}
+
+// GenerateTOTP returns the code for seed at t. Spaces and padding in the
+// seed are ignored and it is not case sensitive.
+func GenerateTOTP(seed string, t time.Time) (string, error) {
+	key, err := decodeSeed(seed)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpStep/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+func decodeSeed(seed string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(seed), ""))
+	normalized = strings.TrimRight(normalized, "=")
+	if normalized == "" {
+		return nil, fmt.Errorf("empty TOTP seed")
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP seed: %w", err)
+	}
+	return key, nil
+}
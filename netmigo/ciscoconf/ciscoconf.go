@@ -0,0 +1,289 @@
+// Package ciscoconf parses indentation-based configurations, as printed by
+// show running-config on IOS, IOS-XE, IOS-XR and NX-OS, into a tree where
+// each line's children are the lines indented under it.
+package ciscoconf
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+)
+
+var (
+	// bannerStart matches the first line of a banner and captures the
+	// delimiter, which show running-config prints as ^C, and the text
+	// after it.
+	bannerStart = regexp.MustCompile(`^banner\s+\S+\s+(\^C|\S)(.*)$`)
+	// sectionEnd matches the lines that close IOS-XR route policies and
+	// sets, such as end-policy and end-set.
+	sectionEnd = regexp.MustCompile(`^end-[a-z-]+$`)
+	// echoedShow matches a prompt followed by the show command it ran, the
+	// first line of an Execute output file.
+	echoedShow = regexp.MustCompile(`^\S*[#>]\s*(show\s.*?)\s*$`)
+)
+
+// Node is a configuration line and the lines indented under it.
+type Node struct {
+	// Text is the line without its indentation.
+	Text     string
+	Indent   int
+	Parent   *Node
+	Children []*Node
+	// Body holds the lines of a multi-line banner as they are. They are
+	// text, not configuration, so they are not parsed.
+	Body []string
+	// End is the line that closes the block, such as IOS-XR's end-policy
+	// or a banner's closing delimiter, or "" when indentation alone ends
+	// it.
+	End string
+}
+
+// Config is a parsed configuration.
+type Config struct {
+	Children []*Node
+}
+
+// Parse builds the tree of text. Blank lines, "!" comment lines and the
+// final "end" carry no configuration and are left out, but a "!" line
+// still closes the blocks at or below its indentation, as IOS-XR uses it.
+// Banners keep their text in Body, and IOS-XR route policies and sets
+// keep their end-policy or end-set line in End.
+func Parse(text string) *Config {
+	cfg := &Config{}
+	var stack []*Node
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for i := 0; i < len(lines); i++ {
+		raw := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" {
+			continue
+		}
+		indent := indentation(raw)
+		if strings.HasPrefix(trimmed, "!") {
+			if trimmed == "!" {
+				stack = closeBlocks(stack, indent)
+			}
+			continue
+		}
+		if indent == 0 && trimmed == "end" {
+			continue
+		}
+		if sectionEnd.MatchString(trimmed) {
+			if owner := blockAt(stack, indent); owner != nil {
+				owner.End = trimmed
+				stack = closeBlocks(stack, indent)
+				continue
+			}
+		}
+
+		stack = closeBlocks(stack, indent)
+		node := &Node{Text: trimmed, Indent: indent}
+		if len(stack) == 0 {
+			cfg.Children = append(cfg.Children, node)
+		} else {
+			node.Parent = stack[len(stack)-1]
+			node.Parent.Children = append(node.Parent.Children, node)
+		}
+		if m := bannerStart.FindStringSubmatch(trimmed); m != nil && !strings.Contains(m[2], m[1]) {
+			i = readBanner(node, m[1], lines, i+1)
+			continue
+		}
+		stack = append(stack, node)
+	}
+	return cfg
+}
+
+// ParseFile parses the configuration in the file at path. A file written
+// by Execute is cut down to the configuration first: the prompt, the
+// echoed show command and lines such as "Building configuration..." are
+// dropped.
+func ParseFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	first, _, _ := strings.Cut(strings.TrimLeft(string(data), "\r\n"), "\n")
+	if m := echoedShow.FindStringSubmatch(strings.TrimRight(first, "\r")); m != nil {
+		data = backup.NormalizeCisco(m[1], data)
+	}
+	return Parse(string(data)), nil
+}
+
+// readBanner reads the lines of a banner from lines[start:] into n, up to
+// the line holding delimiter, and returns the index of that line.
+func readBanner(n *Node, delimiter string, lines []string, start int) int {
+	for i := start; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if strings.Contains(line, delimiter) {
+			n.End = strings.TrimRight(line, " \t")
+			return i
+		}
+		n.Body = append(n.Body, line)
+	}
+	return len(lines)
+}
+
+// closeBlocks pops the blocks that a line at indent is not part of.
+func closeBlocks(stack []*Node, indent int) []*Node {
+	for len(stack) > 0 && stack[len(stack)-1].Indent >= indent {
+		stack = stack[:len(stack)-1]
+	}
+	return stack
+}
+
+func blockAt(stack []*Node, indent int) *Node {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Indent == indent {
+			return stack[i]
+		}
+		if stack[i].Indent < indent {
+			break
+		}
+	}
+	return nil
+}
+
+// Path returns the texts of n's parents and n, outermost first.
+func (n *Node) Path() []string {
+	var path []string
+	for p := n; p != nil; p = p.Parent {
+		path = append(path, p.Text)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Lines renders n and its children with one space of indentation per
+// level below depth. Banner text is rendered as it is.
+func (n *Node) Lines(depth int) []string {
+	indent := strings.Repeat(" ", depth)
+	lines := []string{indent + n.Text}
+	for _, child := range n.Children {
+		lines = append(lines, child.Lines(depth+1)...)
+	}
+	lines = append(lines, n.Body...)
+	if n.End != "" {
+		if n.IsBanner() {
+			lines = append(lines, n.End)
+		} else {
+			lines = append(lines, indent+n.End)
+		}
+	}
+	return lines
+}
+
+// IsBanner reports whether n is a banner.
+func (n *Node) IsBanner() bool {
+	return bannerStart.MatchString(n.Text)
+}
+
+// Find returns the nodes under n, at any depth, whose text matches re.
+func (n *Node) Find(re *regexp.Regexp) []*Node {
+	return find(n.Children, re)
+}
+
+// Child returns the first direct child of n whose text matches re, or nil.
+func (n *Node) Child(re *regexp.Regexp) *Node {
+	for _, child := range n.Children {
+		if re.MatchString(child.Text) {
+			return child
+		}
+	}
+	return nil
+}
+
+// HasChild reports whether a direct child of n matches re.
+func (n *Node) HasChild(re *regexp.Regexp) bool {
+	return n.Child(re) != nil
+}
+
+// Value returns the first submatch of re in the first direct child it
+// matches, or the whole match when re has no groups; ok is false when no
+// child matches. With `^description (.*)` it returns an interface's
+// description.
+func (n *Node) Value(re *regexp.Regexp) (value string, ok bool) {
+	for _, child := range n.Children {
+		if m := re.FindStringSubmatch(child.Text); m != nil {
+			if len(m) > 1 {
+				return m[1], true
+			}
+			return m[0], true
+		}
+	}
+	return "", false
+}
+
+// Find returns the nodes, at any depth, whose text matches re, in
+// configuration order.
+func (c *Config) Find(re *regexp.Regexp) []*Node {
+	return find(c.Children, re)
+}
+
+// FindWithChild returns the top-level blocks matching parent that have a
+// direct child matching child, such as the interfaces that are shut down:
+//
+//	cfg.FindWithChild(regexp.MustCompile(`^interface `), regexp.MustCompile(`^shutdown$`))
+func (c *Config) FindWithChild(parent, child *regexp.Regexp) []*Node {
+	return c.filter(parent, func(n *Node) bool { return n.HasChild(child) })
+}
+
+// FindWithoutChild returns the top-level blocks matching parent that have
+// no direct child matching child.
+func (c *Config) FindWithoutChild(parent, child *regexp.Regexp) []*Node {
+	return c.filter(parent, func(n *Node) bool { return !n.HasChild(child) })
+}
+
+func (c *Config) filter(parent *regexp.Regexp, keep func(*Node) bool) []*Node {
+	var out []*Node
+	for _, n := range c.Children {
+		if parent.MatchString(n.Text) && keep(n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func find(nodes []*Node, re *regexp.Regexp) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		if re.MatchString(n.Text) {
+			out = append(out, n)
+		}
+		out = append(out, find(n.Children, re)...)
+	}
+	return out
+}
+
+// String renders the configuration with normalized indentation.
+func (c *Config) String() string {
+	var b strings.Builder
+	for _, node := range c.Children {
+		for _, line := range node.Lines(0) {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// indentation measures the leading whitespace of line, counting a tab as
+// four spaces.
+func indentation(line string) int {
+	indent := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 4
+		default:
+			return indent
+		}
+	}
+	return indent
+}
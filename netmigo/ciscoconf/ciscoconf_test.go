@@ -0,0 +1,121 @@
+package ciscoconf
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cfg := Parse("hostname r1\r\n!\r\ninterface Gi0/0\r\n description uplink\r\n service-policy input qos\r\n  priority level 1\r\n!\r\nend\r\n")
+	if len(cfg.Children) != 2 {
+		t.Fatalf("Parse() top level = %d nodes, want 2", len(cfg.Children))
+	}
+	priority := cfg.Children[1].Children[1].Children[0]
+	if want := []string{"interface Gi0/0", "service-policy input qos", "priority level 1"}; !reflect.DeepEqual(priority.Path(), want) {
+		t.Fatalf("Path() = %q, want %q", priority.Path(), want)
+	}
+	want := "hostname r1\ninterface Gi0/0\n description uplink\n service-policy input qos\n  priority level 1\n"
+	if got := cfg.String(); got != want {
+		t.Fatalf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseFileFromExecuteOutput(t *testing.T) {
+	cfg, err := ParseFile(filepath.Join("testdata", "iosxr_show_running_config.txt"))
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	var top []string
+	for _, n := range cfg.Children {
+		top = append(top, n.Text)
+	}
+	want := []string{
+		"hostname edge1",
+		"banner motd ^C",
+		"interface Loopback0",
+		"interface GigabitEthernet0/0/0/0",
+		"interface GigabitEthernet0/0/0/1",
+		"interface GigabitEthernet0/0/0/2",
+		"prefix-set CUSTOMERS",
+		"route-policy FROM-CUSTOMERS",
+		"router bgp 65000",
+	}
+	if !reflect.DeepEqual(top, want) {
+		t.Fatalf("top level =\n%s\nwant\n%s", strings.Join(top, "\n"), strings.Join(want, "\n"))
+	}
+
+	banner := cfg.Children[1]
+	if want := []string{"! Authorized access only", "  Disconnect now if you are not"}; !reflect.DeepEqual(banner.Body, want) || banner.End != "^C" || banner.Children != nil {
+		t.Fatalf("banner = %+v, want body %q", banner, want)
+	}
+	policy := cfg.Children[7]
+	if policy.End != "end-policy" || len(policy.Children) != 3 || len(policy.Children[0].Children) != 1 {
+		t.Fatalf("route-policy = %+v", policy)
+	}
+
+	wantText := strings.Join([]string{
+		"banner motd ^C",
+		"! Authorized access only",
+		"  Disconnect now if you are not",
+		"^C",
+		"interface Loopback0",
+	}, "\n")
+	if !strings.Contains(cfg.String(), wantText) || !strings.Contains(cfg.String(), "  drop\n endif\nend-policy\n") {
+		t.Fatalf("String() =\n%s", cfg.String())
+	}
+}
+
+func TestQueries(t *testing.T) {
+	cfg, err := ParseFile(filepath.Join("testdata", "iosxr_show_running_config.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface, shutdown := regexp.MustCompile(`^interface `), regexp.MustCompile(`^shutdown$`)
+
+	var down []string
+	for _, n := range cfg.FindWithChild(iface, shutdown) {
+		down = append(down, n.Text)
+	}
+	if want := []string{"interface GigabitEthernet0/0/0/1", "interface GigabitEthernet0/0/0/2"}; !reflect.DeepEqual(down, want) {
+		t.Fatalf("FindWithChild() = %q, want %q", down, want)
+	}
+	if up := cfg.FindWithoutChild(iface, shutdown); len(up) != 2 {
+		t.Fatalf("FindWithoutChild() = %d blocks, want 2", len(up))
+	}
+
+	uplink := cfg.FindWithoutChild(iface, shutdown)[1]
+	if description, ok := uplink.Value(regexp.MustCompile(`^description (.*)`)); !ok || description != "uplink to core" {
+		t.Fatalf("Value() = %q, %v", description, ok)
+	}
+	if _, ok := cfg.Children[2].Value(regexp.MustCompile(`^description (.*)`)); ok {
+		t.Fatal("Value() found a description on Loopback0")
+	}
+
+	policies := cfg.Find(regexp.MustCompile(`^route-policy \S+ in$`))
+	if len(policies) != 1 {
+		t.Fatalf("Find() = %d nodes, want 1", len(policies))
+	}
+	if want := []string{"router bgp 65000", "neighbor 192.0.2.2", "address-family ipv4 unicast", "route-policy FROM-CUSTOMERS in"}; !reflect.DeepEqual(policies[0].Path(), want) {
+		t.Fatalf("Path() = %q, want %q", policies[0].Path(), want)
+	}
+}
+
+func TestBangClosesSections(t *testing.T) {
+	// A "!" closes the block at its indentation even when the next line is
+	// indented like a child of it.
+	cfg := Parse("router bgp 1\n neighbor 192.0.2.2\n  remote-as 2\n !\n  bfd fast-detect\n")
+	neighbor := cfg.Children[0].Children[0]
+	if len(neighbor.Children) != 1 || len(cfg.Children[0].Children) != 2 {
+		t.Fatalf("Parse() = %s", cfg)
+	}
+}
+
+func TestSingleLineBanner(t *testing.T) {
+	cfg := Parse("banner login ^CKeep out^C\nhostname r1\n")
+	if len(cfg.Children) != 2 || cfg.Children[0].Body != nil || cfg.String() != "banner login ^CKeep out^C\nhostname r1\n" {
+		t.Fatalf("Parse() = %s", cfg)
+	}
+}
@@ -0,0 +1,304 @@
+// Package compliance checks device configurations against golden-config
+// rules: lines that must be present, patterns that must not be, scoped to
+// sections such as interfaces or vty lines and to platforms. Results are
+// collected per device into a report written as JSON or JUnit XML.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+	"github.com/jonelmawirat/netmigo/netmigo/ciscoconf"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+	"github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+// Rule is one compliance check. Without Section it applies to the whole
+// configuration; with Section it applies to every block whose line matches
+// it, at any depth, and the block's lines are those under it.
+type Rule struct {
+	Name string `json:"name"`
+	// Platforms limits the rule to these platforms, named as
+	// config.ParsePlatform accepts, such as "iosxr". Empty means all.
+	Platforms []string `json:"platforms,omitempty"`
+	// Section is a regular expression for the block lines the rule
+	// applies to, such as "^line vty ". A rule whose section matches
+	// nothing is skipped.
+	Section string `json:"section,omitempty"`
+	// Required are lines that must be present, compared without
+	// indentation.
+	Required []string `json:"required,omitempty"`
+	// Forbidden are regular expressions no line may match.
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	platforms map[config.Platform]bool
+	section   *regexp.Regexp
+	forbidden []*regexp.Regexp
+}
+
+// RuleSet is a named set of rules. Build it with NewRuleSet or
+// LoadRuleSet, which check the rules.
+type RuleSet struct {
+	Name  string
+	rules []compiledRule
+}
+
+// NewRuleSet checks rules and returns them as a RuleSet.
+func NewRuleSet(name string, rules ...Rule) (*RuleSet, error) {
+	rs := &RuleSet{Name: name}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if len(rule.Required) == 0 && len(rule.Forbidden) == 0 {
+			return nil, fmt.Errorf("rule %s has no required or forbidden lines", rule.Name)
+		}
+		c := compiledRule{Rule: rule}
+		if len(rule.Platforms) > 0 {
+			c.platforms = make(map[config.Platform]bool, len(rule.Platforms))
+			for _, name := range rule.Platforms {
+				p, err := config.ParsePlatform(name)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+				}
+				c.platforms[p] = true
+			}
+		}
+		if rule.Section != "" {
+			re, err := regexp.Compile(rule.Section)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid section: %w", rule.Name, err)
+			}
+			c.section = re
+		}
+		for _, pattern := range rule.Forbidden {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid forbidden pattern: %w", rule.Name, err)
+			}
+			c.forbidden = append(c.forbidden, re)
+		}
+		rs.rules = append(rs.rules, c)
+	}
+	return rs, nil
+}
+
+// LoadRuleSet reads a rule set from a JSON file:
+//
+//	{
+//	  "name": "baseline",
+//	  "rules": [
+//	    {"name": "ntp", "required": ["ntp server 192.0.2.123"]},
+//	    {"name": "snmp", "forbidden": ["^snmp-server community (public|private)\\b"]},
+//	    {"name": "vty ssh", "platforms": ["iosxe"], "section": "^line vty ", "required": ["transport input ssh"]}
+//	  ]
+//	}
+func LoadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule set: %w", err)
+	}
+	var file struct {
+		Name  string `json:"name"`
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rule set %s: %w", path, err)
+	}
+	return NewRuleSet(file.Name, file.Rules...)
+}
+
+// Status is the outcome of a rule on a device.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Fail Status = "fail"
+	// Skip means the rule does not apply: it is for other platforms or
+	// its section is not in the configuration.
+	Skip Status = "skip"
+)
+
+// RuleResult is the outcome of a rule on a device.
+type RuleResult struct {
+	Rule       string   `json:"rule"`
+	Status     Status   `json:"status"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// DeviceReport holds the results of a rule set on one device.
+type DeviceReport struct {
+	Device   string       `json:"device"`
+	Platform string       `json:"platform"`
+	Passed   bool         `json:"passed"`
+	Rules    []RuleResult `json:"rules,omitempty"`
+	// Error is set when the configuration could not be retrieved, and
+	// the device then fails.
+	Error string `json:"error,omitempty"`
+}
+
+// Check runs the rules against a parsed configuration.
+func (rs *RuleSet) Check(device string, platform config.Platform, cfg *ciscoconf.Config) *DeviceReport {
+	report := &DeviceReport{Device: device, Platform: platform.String(), Passed: true}
+	for _, rule := range rs.rules {
+		result := rule.check(platform, cfg)
+		if result.Status == Fail {
+			report.Passed = false
+		}
+		report.Rules = append(report.Rules, result)
+	}
+	return report
+}
+
+// CheckConfig runs the rules against the configuration in text.
+func (rs *RuleSet) CheckConfig(device string, platform config.Platform, text string) *DeviceReport {
+	return rs.Check(device, platform, ciscoconf.Parse(text))
+}
+
+// CheckFile runs the rules against a saved configuration, such as a
+// backup or an Execute output file.
+func (rs *RuleSet) CheckFile(device string, platform config.Platform, path string) (*DeviceReport, error) {
+	cfg, err := ciscoconf.ParseFile(path)
+	if err != nil {
+		return failed(device, platform, err), err
+	}
+	return rs.Check(device, platform, cfg), nil
+}
+
+// CheckStore runs the rules against the newest version of device in a
+// backup store.
+func (rs *RuleSet) CheckStore(store backup.Store, device string, platform config.Platform) (*DeviceReport, error) {
+	versions, err := store.Versions(device)
+	if err == nil && len(versions) == 0 {
+		err = fmt.Errorf("%w for %s", backup.ErrNoVersion, device)
+	}
+	if err != nil {
+		return failed(device, platform, err), err
+	}
+	cfg, err := store.Load(device, versions[0].ID)
+	if err != nil {
+		return failed(device, platform, err), err
+	}
+	return rs.CheckConfig(device, platform, string(cfg)), nil
+}
+
+type deviceOptions struct {
+	profile  *backup.Profile
+	execOpts []repository.ExecuteOption
+}
+
+// DeviceOption configures CheckDevice.
+type DeviceOption func(*deviceOptions)
+
+// WithProfile sets how the configuration is retrieved, in place of the
+// platform's backup profile. Linux hosts need one.
+func WithProfile(profile backup.Profile) DeviceOption {
+	return func(o *deviceOptions) {
+		o.profile = &profile
+	}
+}
+
+// WithExecuteOptions passes opts to the Execute that retrieves the
+// configuration.
+func WithExecuteOptions(opts ...repository.ExecuteOption) DeviceOption {
+	return func(o *deviceOptions) {
+		o.execOpts = append(o.execOpts, opts...)
+	}
+}
+
+// CheckDevice retrieves the configuration of a connected device with the
+// backup profile for platform and runs the rules against it. When
+// retrieval fails the report records the error, so it can still be added
+// to a Report.
+func (rs *RuleSet) CheckDevice(device service.DeviceService, platform config.Platform, name string, opts ...DeviceOption) (*DeviceReport, error) {
+	var o deviceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.profile == nil {
+		p, ok := backup.Profiles[platform]
+		if !ok {
+			err := fmt.Errorf("%w %v", backup.ErrNoProfile, platform)
+			return failed(name, platform, err), err
+		}
+		o.profile = &p
+	}
+	cfg, err := backup.Fetch(device, *o.profile, o.execOpts...)
+	if err != nil {
+		err = fmt.Errorf("retrieving configuration of %s: %w", name, err)
+		return failed(name, platform, err), err
+	}
+	return rs.CheckConfig(name, platform, string(cfg)), nil
+}
+
+func failed(device string, platform config.Platform, err error) *DeviceReport {
+	return &DeviceReport{Device: device, Platform: platform.String(), Error: err.Error()}
+}
+
+func (r compiledRule) check(platform config.Platform, cfg *ciscoconf.Config) RuleResult {
+	result := RuleResult{Rule: r.Name, Status: Pass}
+	if r.platforms != nil && !r.platforms[platform] {
+		result.Status = Skip
+		return result
+	}
+	if r.section == nil {
+		result.Violations = r.violations("", lines(cfg.Children))
+	} else {
+		sections := cfg.Find(r.section)
+		if len(sections) == 0 {
+			result.Status = Skip
+			return result
+		}
+		for _, section := range sections {
+			below := append(lines(section.Children), section.Body...)
+			result.Violations = append(result.Violations, r.violations(strings.Join(section.Path(), " > ")+": ", below)...)
+		}
+	}
+	if len(result.Violations) > 0 {
+		result.Status = Fail
+	}
+	return result
+}
+
+// violations lists the required lines missing from lines and the lines
+// matching a forbidden pattern, each after prefix.
+func (r compiledRule) violations(prefix string, lines []string) []string {
+	var out []string
+	present := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		present[strings.TrimSpace(line)] = true
+	}
+	for _, required := range r.Required {
+		if !present[strings.TrimSpace(required)] {
+			out = append(out, prefix+"missing: "+required)
+		}
+	}
+	for _, line := range lines {
+		for _, re := range r.forbidden {
+			if re.MatchString(strings.TrimSpace(line)) {
+				out = append(out, prefix+"forbidden: "+strings.TrimSpace(line))
+				break
+			}
+		}
+	}
+	return out
+}
+
+// lines flattens nodes, their children and banner text, in order.
+func lines(nodes []*ciscoconf.Node) []string {
+	var out []string
+	for _, n := range nodes {
+		out = append(out, n.Text)
+		out = append(out, lines(n.Children)...)
+		out = append(out, n.Body...)
+	}
+	return out
+}
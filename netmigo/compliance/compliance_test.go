@@ -0,0 +1,158 @@
+package compliance
+
+import (
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/internal/devicetest"
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+func loadBaseline(t *testing.T) *RuleSet {
+	t.Helper()
+	rs, err := LoadRuleSet(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("LoadRuleSet returned error: %v", err)
+	}
+	return rs
+}
+
+func statuses(report *DeviceReport) map[string]Status {
+	out := make(map[string]Status)
+	for _, r := range report.Rules {
+		out[r.Rule] = r.Status
+	}
+	return out
+}
+
+func TestCheckFile(t *testing.T) {
+	rs := loadBaseline(t)
+	report, err := rs.CheckFile("core1", config.CISCO_IOSXE, filepath.Join("testdata", "iosxe_show_running_config.txt"))
+	if err != nil {
+		t.Fatalf("CheckFile returned error: %v", err)
+	}
+	want := map[string]Status{
+		"aaa":              Pass,
+		"ntp":              Pass,
+		"snmp communities": Fail,
+		"banner":           Pass,
+		"vty ssh only":     Fail,
+		"no proxy arp":     Fail,
+		"xr ssh":           Skip,
+	}
+	if got := statuses(report); !reflect.DeepEqual(got, want) || report.Passed {
+		t.Fatalf("statuses = %v, passed = %v, want %v", got, report.Passed, want)
+	}
+
+	var vty []string
+	for _, r := range report.Rules {
+		if r.Rule == "vty ssh only" {
+			vty = r.Violations
+		}
+	}
+	if want := []string{"line vty 5 15: missing: transport input ssh", "line vty 5 15: forbidden: transport input telnet ssh"}; !reflect.DeepEqual(vty, want) {
+		t.Fatalf("vty violations = %q, want %q", vty, want)
+	}
+}
+
+func TestCheckConfigOnOtherPlatform(t *testing.T) {
+	rs := loadBaseline(t)
+	report := rs.CheckConfig("edge1", config.CISCO_IOSXR, "hostname edge1\naaa new-model\naaa authentication login default group tacacs+ local\nntp server 192.0.2.123\n")
+	want := map[string]Status{
+		"aaa":              Pass,
+		"ntp":              Pass,
+		"snmp communities": Pass,
+		"banner":           Skip,
+		"vty ssh only":     Skip,
+		"no proxy arp":     Skip,
+		"xr ssh":           Fail,
+	}
+	if got := statuses(report); !reflect.DeepEqual(got, want) {
+		t.Fatalf("statuses = %v, want %v", got, want)
+	}
+}
+
+func TestNewRuleSetRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{Name: "empty"},
+		{Name: "platform", Platforms: []string{"vyos"}, Required: []string{"x"}},
+		{Name: "pattern", Forbidden: []string{"("}},
+	} {
+		if _, err := NewRuleSet("bad", rule); err == nil {
+			t.Fatalf("NewRuleSet(%+v) returned no error", rule)
+		}
+	}
+}
+
+func TestReportFromDevicesAndStores(t *testing.T) {
+	rs, err := NewRuleSet("ntp", Rule{Name: "ntp", Required: []string{"ntp server 192.0.2.123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewReport(rs)
+
+	device := devicetest.WithFiles(t, map[string]string{"show running-config": filepath.Join("testdata", "iosxe_show_running_config.txt")})
+	core1, err := rs.CheckDevice(device, config.CISCO_IOSXE, "core1")
+	if err != nil {
+		t.Fatalf("CheckDevice returned error: %v", err)
+	}
+	server, err := rs.CheckDevice(device, config.LINUX, "server1")
+	if !errors.Is(err, backup.ErrNoProfile) || server.Passed || !strings.Contains(server.Error, "LINUX") {
+		t.Fatalf("CheckDevice = %+v, %v, want ErrNoProfile", server, err)
+	}
+
+	store := backup.NewDirStore(t.TempDir())
+	if _, err := store.Save("edge1", []byte("hostname edge1\nntp server 192.0.2.1\n"), "initial"); err != nil {
+		t.Fatal(err)
+	}
+	edge1, err := rs.CheckStore(store, "edge1", config.CISCO_IOSXR)
+	if err != nil {
+		t.Fatalf("CheckStore returned error: %v", err)
+	}
+	report.Add(core1, server, edge1)
+
+	if err := report.Err(); !errors.Is(err, ErrNotCompliant) || !strings.HasSuffix(err.Error(), "server1, edge1") {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	var js strings.Builder
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatalf("WriteJSON returned error: %v", err)
+	}
+	for _, part := range []string{`"rule_set": "ntp"`, `"device": "core1"`, `"passed": true`, `"violations": [`, `"missing: ntp server 192.0.2.123"`} {
+		if !strings.Contains(js.String(), part) {
+			t.Fatalf("JSON report missing %s:\n%s", part, js.String())
+		}
+	}
+
+	var junit strings.Builder
+	if err := report.WriteJUnit(&junit); err != nil {
+		t.Fatalf("WriteJUnit returned error: %v", err)
+	}
+	var parsed junitSuites
+	if err := xml.Unmarshal([]byte(junit.String()), &parsed); err != nil {
+		t.Fatalf("JUnit report is not valid XML: %v\n%s", err, junit.String())
+	}
+	if parsed.Tests != 3 || parsed.Failures != 1 || parsed.Errors != 1 || len(parsed.Suites) != 3 {
+		t.Fatalf("JUnit totals = %+v", parsed)
+	}
+	if c := parsed.Suites[2].Cases[0]; c.ClassName != "edge1" || c.Failure == nil || c.Failure.Text != "missing: ntp server 192.0.2.123" {
+		t.Fatalf("edge1 test case = %+v", c)
+	}
+}
+
+func TestCheckDeviceWithProfile(t *testing.T) {
+	rs, err := NewRuleSet("sshd", Rule{Name: "root login", Platforms: []string{"linux"}, Forbidden: []string{`^PermitRootLogin\s+yes`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := rs.CheckDevice(devicetest.New(t, "PermitRootLogin yes\nPasswordAuthentication no\n"), config.LINUX, "server1", WithProfile(backup.Profile{Command: "cat /etc/ssh/sshd_config"}))
+	if err != nil || report.Passed || report.Rules[0].Violations[0] != "forbidden: PermitRootLogin yes" {
+		t.Fatalf("CheckDevice = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,142 @@
+package compliance
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotCompliant is returned by Report.Err when a device did not pass.
+var ErrNotCompliant = errors.New("configuration not compliant")
+
+// Report collects the device reports of a rule set.
+type Report struct {
+	RuleSet string          `json:"rule_set"`
+	Devices []*DeviceReport `json:"devices"`
+}
+
+// NewReport returns an empty report for rs.
+func NewReport(rs *RuleSet) *Report {
+	return &Report{RuleSet: rs.Name}
+}
+
+// Add adds device reports.
+func (r *Report) Add(reports ...*DeviceReport) {
+	r.Devices = append(r.Devices, reports...)
+}
+
+// Failed returns the devices that did not pass.
+func (r *Report) Failed() []*DeviceReport {
+	var failed []*DeviceReport
+	for _, d := range r.Devices {
+		if !d.Passed {
+			failed = append(failed, d)
+		}
+	}
+	return failed
+}
+
+// Err returns nil when every device passed, or an error wrapping
+// ErrNotCompliant that names the devices that did not.
+func (r *Report) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	var names []string
+	for _, d := range failed {
+		names = append(names, d.Device)
+	}
+	return fmt.Errorf("%w: %s", ErrNotCompliant, strings.Join(names, ", "))
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML for CI systems: a test suite
+// per device and a test case per rule. A device whose configuration could
+// not be retrieved has a single test case with an error.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{Name: r.RuleSet}
+	for _, d := range r.Devices {
+		suite := junitSuite{Name: d.Device}
+		if d.Error != "" {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      "retrieve configuration",
+				ClassName: d.Device,
+				Error:     &junitMessage{Message: d.Error},
+			})
+			suite.Errors++
+		}
+		for _, rule := range d.Rules {
+			c := junitCase{Name: rule.Rule, ClassName: d.Device}
+			switch rule.Status {
+			case Fail:
+				c.Failure = &junitMessage{
+					Message: fmt.Sprintf("%d violations", len(rule.Violations)),
+					Text:    strings.Join(rule.Violations, "\n"),
+				}
+				suite.Failures++
+			case Skip:
+				c.Skipped = &junitMessage{Message: "not applicable"}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
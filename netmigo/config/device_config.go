@@ -1,16 +1,262 @@
 package config
 
-import "time"
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "fmt"
+    "io"
+    "net"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/netmigo/challenge"
+    "github.com/jonelmawirat/netmigo/netmigo/credentials"
+    "github.com/jonelmawirat/netmigo/netmigo/proxy"
+    "golang.org/x/crypto/ssh"
+)
 
 type DeviceConfig struct {
-    IP                string
-    Username          string
-    Password          string
-    KeyPath           string
-    Port              string
-    JumpServer        *DeviceConfig
-    MaxRetry          int
-    ConnectionTimeout time.Duration
+    IP                    string
+    Username              string
+    Password              string
+    KeyPath               string
+    // KeyPassphrase decrypts an encrypted KeyPath or PrivateKey. When it is
+    // empty and the key turns out to be encrypted, KeyPassphraseFunc is
+    // asked for one instead.
+    KeyPassphrase         string
+    KeyPassphraseFunc     func() ([]byte, error)
+    // PrivateKey holds PEM key material, e.g. fetched from a secret
+    // manager, and takes precedence over KeyPath. Signer takes precedence
+    // over both.
+    PrivateKey            []byte
+    Signer                ssh.Signer
+    Port                  string
+    JumpServer            *DeviceConfig
+    MaxRetry              int
+    ConnectionTimeout     time.Duration
+    AddressFamily         AddressFamily
+    Resolver              *net.Resolver
+    SourceAddress         string
+    Dialer                Dialer
+    // ProxyCommand, like OpenSSH's, is run through the shell and its
+    // stdin/stdout used as the transport instead of Dialer. %h, %p and %r
+    // are replaced with the host, port and username at dial time.
+    ProxyCommand          string
+    // CertPath is the OpenSSH user certificate for the key. When it is
+    // empty and CertFromKeyPath is set, KeyPath + "-cert.pub" is used; see
+    // CertificatePath.
+    CertPath              string
+    CertFromKeyPath       bool
+    // KeyboardInteractive answers keyboard-interactive prompts, e.g. a
+    // password followed by a one-time code on an MFA bastion.
+    KeyboardInteractive   ssh.KeyboardInteractiveChallenge
+    // KeyboardInteractiveID names KeyboardInteractive for Key; see
+    // WithKeyboardInteractiveID.
+    KeyboardInteractiveID string
+    HostCAPath            string
+    // CredentialProviders are consulted at connect time, in order, after the
+    // Password/KeyPath set on the config itself. When authentication with
+    // one credential fails the next one is tried.
+    CredentialProviders   []credentials.CredentialProvider
+    // Transport selects SSH, Telnet or SSH with a Telnet fallback. Telnet
+    // connects to TelnetPort and detects the CLI prompt with Prompt.
+    Transport             Transport
+    TelnetPort            string
+    Prompt                *regexp.Regexp
+    // Console, when set, reaches the device through a console server line
+    // instead of its own management interface.
+    Console               *ConsoleConfig
+    // Secret is the enable secret on Cisco devices and the sudo password on
+    // Linux hosts; sudo falls back to Password when it is empty.
+    Secret                string
+}
+
+// ConsoleConfig describes access through a console server (reverse Telnet
+// ports such as 2001-2048, or SSH to an Opengear port). The DeviceConfig
+// address, port, transport and credentials reach the console server; the
+// Username and Password here log in to the device on the line.
+type ConsoleConfig struct {
+    Username string
+    Password string
+    // Break sends a break once the line is up, e.g. to drop a rebooting
+    // router into ROMMON.
+    Break    bool
+    // ClearServer is the console server's own CLI. When the line is busy
+    // with a stale session, ClearCommand (with %s replaced by Line) is run
+    // there and the connection retried once.
+    ClearServer  *DeviceConfig
+    Line         string
+    ClearCommand string
+}
+
+// Transport is the protocol used to reach the device.
+type Transport int
+
+const (
+    TransportSSH Transport = iota
+    TransportTelnet
+    // TransportSSHThenTelnet tries SSH first and uses Telnet when the SSH
+    // connection cannot be established. An SSH authentication failure does
+    // not fall back, so a rejected password is never retried in clear text.
+    TransportSSHThenTelnet
+)
+
+func (t Transport) String() string {
+    switch t {
+    case TransportSSH:
+        return "ssh"
+    case TransportTelnet:
+        return "telnet"
+    case TransportSSHThenTelnet:
+        return "ssh-then-telnet"
+    default:
+        return fmt.Sprintf("Transport(%d)", int(t))
+    }
+}
+
+// Dialer opens the transport connection used for the SSH session. When set
+// on a DeviceConfig it replaces the default TCP dialer, e.g. to go through a
+// SOCKS5 or HTTP CONNECT proxy.
+type Dialer interface {
+    DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialerFunc adapts an ordinary function to the Dialer interface.
+type DialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f DialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+    return f(ctx, network, address)
+}
+
+// DialerWithID gives dialer an ID, so that configs built separately with
+// the same dialer share connections (see Key). The proxy dialers set by
+// WithSOCKS5Proxy and WithHTTPConnectProxy have one already. The ID is
+// hashed into the key and may contain secrets.
+func DialerWithID(id string, dialer Dialer) Dialer {
+    return identifiedDialer{Dialer: dialer, id: id}
+}
+
+type identifiedDialer struct {
+    Dialer
+    id string
+}
+
+func (d identifiedDialer) ID() string { return d.id }
+
+// dialerID returns the ID of dialer, or "" when it has none.
+func dialerID(dialer Dialer) string {
+    if identified, ok := dialer.(interface{ ID() string }); ok {
+        return identified.ID()
+    }
+    return ""
+}
+
+// AddressFamily controls which IP family is used when the device host is a
+// DNS name, or restricts dialing to a single family.
+type AddressFamily int
+
+const (
+    AddressFamilyAny AddressFamily = iota
+    AddressFamilyIPv4
+    AddressFamilyIPv6
+    AddressFamilyPreferIPv4
+    AddressFamilyPreferIPv6
+)
+
+// Host returns the device host with any surrounding IPv6 brackets removed.
+func (c DeviceConfig) Host() string {
+    host := strings.TrimSpace(c.IP)
+    if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+        host = host[1 : len(host)-1]
+    }
+    return host
+}
+
+// Address returns the host:port dial target, bracketing IPv6 literals.
+func (c DeviceConfig) Address() string {
+    return net.JoinHostPort(c.Host(), c.Port)
+}
+
+// TelnetAddress returns the host:port dial target used for Telnet.
+func (c DeviceConfig) TelnetAddress() string {
+    return net.JoinHostPort(c.Host(), c.TelnetPort)
+}
+
+// keySalt is mixed into every Key hash, so a logged key cannot be used to
+// guess the secrets it was computed from.
+var keySalt = func() []byte {
+    salt := make([]byte, 16)
+    if _, err := rand.Read(salt); err != nil {
+        panic(fmt.Sprintf("config: reading random key salt: %v", err))
+    }
+    return salt
+}()
+
+// Key identifies the connection c describes: user, address, the
+// credentials and transport used to reach it and the jump chain in front
+// of it. Two configs for the same host with different accounts get
+// different keys. Secrets are hashed with a per-process salt, so the key is
+// safe to log, but it is only stable within a process.
+//
+// Credential providers, dialers and keyboard-interactive callbacks are
+// compared by ID: see credentials.WithID, DialerWithID and
+// WithKeyboardInteractiveID. The built-in providers and proxy dialers have
+// one. When one of them has no ID the key also names c itself, so only
+// users of the same *DeviceConfig share the connection.
+func (c *DeviceConfig) Key() string {
+    h := sha256.New()
+    h.Write(keySalt)
+    for _, field := range []string{c.Password, c.KeyPath, string(c.PrivateKey), c.CertificatePath(), c.Secret, c.ProxyCommand} {
+        fmt.Fprintf(h, "%d:", len(field))
+        io.WriteString(h, field)
+    }
+    if c.Signer != nil {
+        h.Write(c.Signer.PublicKey().Marshal())
+    }
+
+    shared := true
+    writeID := func(kind, id string) {
+        if id == "" {
+            shared = false
+            return
+        }
+        fmt.Fprintf(h, "|%s%d:", kind, len(id))
+        io.WriteString(h, id)
+    }
+    for _, provider := range c.CredentialProviders {
+        var id string
+        if identified, ok := provider.(credentials.Identified); ok {
+            id = identified.ID()
+        }
+        writeID("provider", id)
+    }
+    if c.KeyboardInteractive != nil {
+        writeID("ki", c.KeyboardInteractiveID)
+    }
+    if c.Dialer != nil {
+        writeID("dialer", dialerID(c.Dialer))
+    }
+
+    if c.Console != nil {
+        for _, field := range []string{c.Console.Username, c.Console.Password} {
+            fmt.Fprintf(h, "|console%d:", len(field))
+            io.WriteString(h, field)
+        }
+    }
+    if c.Transport != TransportSSH {
+        fmt.Fprintf(h, "|%s:%s", c.Transport, c.TelnetPort)
+    }
+
+    key := fmt.Sprintf("%s@%s#%x", c.Username, c.Address(), h.Sum(nil)[:8])
+    if !shared {
+        key += fmt.Sprintf(" config %p", c)
+    }
+    if c.JumpServer != nil {
+        key += " via " + c.JumpServer.Key()
+    }
+    return key
 }
 
 type DeviceConfigOption func(*DeviceConfig)
@@ -19,6 +265,7 @@ func NewDeviceConfig(ip string, opts ...DeviceConfigOption) *DeviceConfig {
     cfg := &DeviceConfig{
         IP:                ip,
         Port:              "22",
+        TelnetPort:        "23",
         MaxRetry:          3,
         ConnectionTimeout: 10 * time.Second,
     }
@@ -42,18 +289,192 @@ func WithPassword(password string) DeviceConfigOption {
     }
 }
 
+// WithSecret sets the enable secret, or the sudo password when it differs
+// from the login password.
+func WithSecret(secret string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.Secret = secret
+    }
+}
+
 func WithKeyPath(keyPath string) DeviceConfigOption {
     return func(c *DeviceConfig) {
         c.KeyPath = keyPath
     }
 }
 
+// WithKeyPassphrase sets the passphrase for an encrypted private key.
+func WithKeyPassphrase(passphrase string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.KeyPassphrase = passphrase
+    }
+}
+
+// WithKeyPassphraseCallback asks fn for the passphrase only when the private
+// key turns out to be encrypted, e.g. to prompt on a terminal.
+func WithKeyPassphraseCallback(fn func() ([]byte, error)) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.KeyPassphraseFunc = fn
+    }
+}
+
+// WithPrivateKey authenticates with PEM encoded key material held in memory
+// so keys from a secret manager never have to be written to disk.
+func WithPrivateKey(pemBytes []byte) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.PrivateKey = pemBytes
+    }
+}
+
+// WithSigner authenticates with an existing ssh.Signer, such as one backed
+// by an SSH agent or a hardware token.
+func WithSigner(signer ssh.Signer) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.Signer = signer
+    }
+}
+
+// WithCertificate pairs the private key with an OpenSSH user certificate.
+// An empty path means KeyPath + "-cert.pub", with KeyPath as it is at
+// connect time, so the options may come in any order.
+func WithCertificate(certPath string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.CertPath = certPath
+        c.CertFromKeyPath = certPath == ""
+    }
+}
+
+// CertificatePath returns the certificate to pair with the key: CertPath,
+// or KeyPath + "-cert.pub" when CertPath is empty and CertFromKeyPath is
+// set. It is empty when no certificate is configured.
+func (c DeviceConfig) CertificatePath() string {
+    if c.CertPath == "" && c.CertFromKeyPath {
+        return c.KeyPath + "-cert.pub"
+    }
+    return c.CertPath
+}
+
+// WithKeyboardInteractive enables keyboard-interactive authentication with
+// fn answering the server's prompts. A config with it only shares jump and
+// pooled connections through the same *DeviceConfig; use
+// WithKeyboardInteractiveID to share them between configs.
+func WithKeyboardInteractive(fn ssh.KeyboardInteractiveChallenge) DeviceConfigOption {
+    return WithKeyboardInteractiveID("", fn)
+}
+
+// WithKeyboardInteractiveID is WithKeyboardInteractive with an ID for Key,
+// so configs built separately with the same callback share connections.
+// The ID is hashed into the key and may contain secrets.
+func WithKeyboardInteractiveID(id string, fn ssh.KeyboardInteractiveChallenge) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.KeyboardInteractive = fn
+        c.KeyboardInteractiveID = id
+    }
+}
+
+// WithChallengeResponse enables keyboard-interactive authentication, answering
+// each prompt with the first rule whose pattern matches it. A prompt no rule
+// matches fails the attempt.
+func WithChallengeResponse(rules ...challenge.Rule) DeviceConfigOption {
+    return WithKeyboardInteractive(challenge.New(rules...).Challenge)
+}
+
+// WithChallengeResponseID is WithChallengeResponse with an ID for Key, see
+// WithKeyboardInteractiveID.
+func WithChallengeResponseID(id string, rules ...challenge.Rule) DeviceConfigOption {
+    return WithKeyboardInteractiveID(id, challenge.New(rules...).Challenge)
+}
+
+// WithHostCAFile verifies the device host certificate against the CA public
+// keys in path (one authorized_keys-style key per line) instead of
+// accepting any host key.
+func WithHostCAFile(path string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.HostCAPath = path
+    }
+}
+
+func WithCredentialProvider(providers ...credentials.CredentialProvider) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.CredentialProviders = append(c.CredentialProviders, providers...)
+    }
+}
+
 func WithPort(port string) DeviceConfigOption {
     return func(c *DeviceConfig) {
         c.Port = port
     }
 }
 
+// WithTransport selects how the device is reached. The default is SSH.
+func WithTransport(transport Transport) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.Transport = transport
+    }
+}
+
+// WithTelnetPort sets the Telnet port, 23 by default. Console servers
+// usually expose one port per line, e.g. 2001 and up.
+func WithTelnetPort(port string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.TelnetPort = port
+    }
+}
+
+// WithPrompt sets the pattern that matches the device CLI prompt on a Telnet
+// session, checked against the last line of output. The default accepts a
+// line ending in >, #, $ or %. Compile a pattern that comes from user input
+// with regexp.Compile and handle the error there.
+func WithPrompt(prompt *regexp.Regexp) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.Prompt = prompt
+    }
+}
+
+// WithConsole reaches the device through a console server line and logs in
+// to the device with username and password once the line is woken up.
+// Leave them empty for a console without login.
+func WithConsole(username, password string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        console := c.console()
+        console.Username = username
+        console.Password = password
+    }
+}
+
+// WithConsoleBreak sends a break after connecting to the console line,
+// which drops a booting Cisco router into ROMMON.
+func WithConsoleBreak() DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.console().Break = true
+    }
+}
+
+// WithConsoleClearLine clears a busy console line by logging in to server,
+// the console server's management CLI, and running "clear line <line>".
+func WithConsoleClearLine(server *DeviceConfig, line string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        console := c.console()
+        console.ClearServer = server
+        console.Line = line
+    }
+}
+
+// WithConsoleClearCommand replaces the "clear line %s" command used by
+// WithConsoleClearLine, for console servers with a different CLI.
+func WithConsoleClearCommand(format string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.console().ClearCommand = format
+    }
+}
+
+func (c *DeviceConfig) console() *ConsoleConfig {
+    if c.Console == nil {
+        c.Console = &ConsoleConfig{}
+    }
+    return c.Console
+}
+
 func WithJumpServer(jumpServer *DeviceConfig) DeviceConfigOption {
     return func(c *DeviceConfig) {
         c.JumpServer = jumpServer
@@ -72,6 +493,92 @@ func WithConnectionTimeout(timeout time.Duration) DeviceConfigOption {
     }
 }
 
+func WithAddressFamily(family AddressFamily) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.AddressFamily = family
+    }
+}
+
+func WithResolver(resolver *net.Resolver) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.Resolver = resolver
+    }
+}
+
+// WithDNSServer resolves device host names through the given DNS server
+// (host or host:port) instead of the system resolver.
+func WithDNSServer(server string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        if _, _, err := net.SplitHostPort(server); err != nil {
+            server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+        }
+        c.Resolver = &net.Resolver{
+            PreferGo: true,
+            Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+                var d net.Dialer
+                return d.DialContext(ctx, network, server)
+            },
+        }
+    }
+}
+
+// WithSourceAddress binds outgoing connections to a local IP address, which
+// is useful on multi-homed automation hosts.
+func WithSourceAddress(addr string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.SourceAddress = addr
+    }
+}
+
+func WithDialer(dialer Dialer) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.ProxyCommand = ""
+        c.Dialer = dialer
+    }
+}
+
+// WithSOCKS5Proxy reaches the device through a SOCKS5 proxy. Leave username
+// empty when the proxy does not require authentication.
+func WithSOCKS5Proxy(proxyAddress, username, password string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.ProxyCommand = ""
+        c.Dialer = proxy.NewSOCKS5Dialer(proxyAddress, proxyAuth(username, password), c.Dialer)
+    }
+}
+
+// WithHTTPConnectProxy reaches the device through an HTTP proxy using the
+// CONNECT method. Leave username empty when the proxy does not require
+// authentication.
+func WithHTTPConnectProxy(proxyAddress, username, password string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.ProxyCommand = ""
+        c.Dialer = proxy.NewHTTPConnectDialer(proxyAddress, proxyAuth(username, password), c.Dialer)
+    }
+}
+
+// WithProxyCommand runs command through the shell and uses its stdin/stdout
+// as the transport, like OpenSSH's ProxyCommand. It replaces a dialer set
+// by an earlier option, and a later dialer option replaces it.
+func WithProxyCommand(command string) DeviceConfigOption {
+    return func(c *DeviceConfig) {
+        c.ProxyCommand = command
+        c.Dialer = nil
+    }
+}
+
+// ExpandProxyCommand returns ProxyCommand with %h, %p and %r replaced with
+// the host, port and username, and %% with %.
+func (c DeviceConfig) ExpandProxyCommand() string {
+    return strings.NewReplacer("%%", "%", "%h", c.Host(), "%p", c.Port, "%r", c.Username).Replace(c.ProxyCommand)
+}
+
+func proxyAuth(username, password string) *proxy.Auth {
+    if username == "" {
+        return nil
+    }
+    return &proxy.Auth{Username: username, Password: password}
+}
+
 type Platform int
 
 const (
@@ -79,4 +586,35 @@ const (
     CISCO_IOSXE
     CISCO_NXOS
     LINUX
+    JUNIPER_JUNOS
+    ARISTA_EOS
 )
+
+var platformNames = map[Platform]string{
+    CISCO_IOSXR:   "CISCO_IOSXR",
+    CISCO_IOSXE:   "CISCO_IOSXE",
+    CISCO_NXOS:    "CISCO_NXOS",
+    LINUX:         "LINUX",
+    JUNIPER_JUNOS: "JUNIPER_JUNOS",
+    ARISTA_EOS:    "ARISTA_EOS",
+}
+
+func (p Platform) String() string {
+    if name, ok := platformNames[p]; ok {
+        return name
+    }
+    return fmt.Sprintf("Platform(%d)", int(p))
+}
+
+// ParsePlatform returns the platform named name, matched case-insensitively
+// with or without the vendor prefix, so "cisco_iosxr" and "iosxr" both name
+// CISCO_IOSXR and "junos" names JUNIPER_JUNOS.
+func ParsePlatform(name string) (Platform, error) {
+    for p, n := range platformNames {
+        _, short, _ := strings.Cut(n, "_")
+        if strings.EqualFold(name, n) || short != "" && strings.EqualFold(name, short) {
+            return p, nil
+        }
+    }
+    return 0, fmt.Errorf("unknown platform %q", name)
+}
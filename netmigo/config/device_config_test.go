@@ -0,0 +1,102 @@
+package config
+
+import (
+    "context"
+    "testing"
+
+    "github.com/jonelmawirat/netmigo/netmigo/challenge"
+    "github.com/jonelmawirat/netmigo/netmigo/credentials"
+)
+
+func TestProxyCommandExpandsWithFinalConfig(t *testing.T) {
+    cfg := NewDeviceConfig("r1",
+        WithProxyCommand("nc -X 5 -x bastion:1080 %h %p # %r 100%%"),
+        WithPort("2222"),
+        WithUsername("admin"),
+    )
+    if want := "nc -X 5 -x bastion:1080 r1 2222 # admin 100%"; cfg.ExpandProxyCommand() != want {
+        t.Fatalf("ExpandProxyCommand() = %q, want %q", cfg.ExpandProxyCommand(), want)
+    }
+
+    cfg = NewDeviceConfig("r1", WithProxyCommand("nc %h %p"), WithSOCKS5Proxy("bastion:1080", "", ""))
+    if cfg.ProxyCommand != "" || cfg.Dialer == nil {
+        t.Fatalf("a later dialer option should replace the proxy command: %+v", cfg)
+    }
+}
+
+func TestCertificatePathFollowsFinalKeyPath(t *testing.T) {
+    cfg := NewDeviceConfig("bastion", WithCertificate(""), WithKeyPath("/keys/id_ed25519"))
+    if want := "/keys/id_ed25519-cert.pub"; cfg.CertificatePath() != want {
+        t.Fatalf("CertificatePath() = %q, want %q", cfg.CertificatePath(), want)
+    }
+    cfg = NewDeviceConfig("bastion", WithKeyPath("/keys/id_ed25519"), WithCertificate("/certs/neteng.pub"))
+    if want := "/certs/neteng.pub"; cfg.CertificatePath() != want {
+        t.Fatalf("CertificatePath() = %q, want %q", cfg.CertificatePath(), want)
+    }
+    if cfg = NewDeviceConfig("bastion", WithKeyPath("/keys/id_ed25519")); cfg.CertificatePath() != "" {
+        t.Fatalf("CertificatePath() = %q without WithCertificate, want none", cfg.CertificatePath())
+    }
+}
+
+func TestKeyTellsProvidersApart(t *testing.T) {
+    account := func(username string) credentials.CredentialProvider {
+        return credentials.WithID(username, credentials.ProviderFunc(func(context.Context, credentials.Target) (credentials.Credential, error) {
+            return credentials.Credential{Username: username, Password: "secret"}, nil
+        }))
+    }
+    tacacs, local := account("tacacs"), account("local")
+    otp := func(string, string, []string, []bool) ([]string, error) { return nil, nil }
+    keyWith := func(opts ...DeviceConfigOption) string {
+        return NewDeviceConfig("bastion", append([]DeviceConfigOption{WithUsername("jump")}, opts...)...).Key()
+    }
+
+    keys := map[string]bool{
+        keyWith(WithCredentialProvider(tacacs)):                                    true,
+        keyWith(WithCredentialProvider(local)):                                     true,
+        keyWith(WithCredentialProvider(credentials.Static("a", "ops", "one"))):     true,
+        keyWith(WithCredentialProvider(credentials.Static("a", "ops", "two"))):     true,
+        keyWith(WithCredentialProvider(credentials.Command("pass", "show", "%h"))): true,
+        keyWith(WithKeyboardInteractiveID("otp", otp)):                             true,
+        keyWith(WithSOCKS5Proxy("socks:1080", "", "")):                             true,
+        keyWith(WithProxyCommand("nc %h %p")):                                      true,
+        keyWith():                                                                  true,
+    }
+    if len(keys) != 9 {
+        t.Fatalf("configs that differ only by provider, callback or transport share a key: %v", keys)
+    }
+
+    same := [][]DeviceConfigOption{
+        {WithCredentialProvider(account("tacacs"))},
+        {WithCredentialProvider(credentials.Static("a", "ops", "one"))},
+        {WithChallengeResponseID("otp", challenge.MustMatch(`(?i)code`, challenge.Static("123456")))},
+        {WithDialer(DialerWithID("tunnel", DialerFunc(nil))), WithSOCKS5Proxy("socks:1080", "proxy", "pass")},
+        {WithHTTPConnectProxy("proxy:3128", "", "")},
+    }
+    for _, opts := range same {
+        if first, second := keyWith(opts...), keyWith(opts...); first != second {
+            t.Errorf("configs built the same way with IDs get different keys: %s, %s", first, second)
+        }
+    }
+}
+
+func TestKeyDoesNotShareConfigsWithoutIDs(t *testing.T) {
+    otp := func(string, string, []string, []bool) ([]string, error) { return nil, nil }
+    provider := credentials.ProviderFunc(func(context.Context, credentials.Target) (credentials.Credential, error) {
+        return credentials.Credential{}, nil
+    })
+    for name, opts := range map[string][]DeviceConfigOption{
+        "provider": {WithCredentialProvider(provider)},
+        "callback": {WithKeyboardInteractive(otp)},
+        "dialer":   {WithDialer(DialerFunc(nil))},
+        // A proxy reached through a dialer without an ID has none either.
+        "proxy": {WithDialer(DialerFunc(nil)), WithSOCKS5Proxy("socks:1080", "", "")},
+    } {
+        cfg := NewDeviceConfig("bastion", opts...)
+        if cfg.Key() != cfg.Key() {
+            t.Errorf("%s: one config gets different keys", name)
+        }
+        if cfg.Key() == NewDeviceConfig("bastion", opts...).Key() {
+            t.Errorf("%s: separate configs without an ID share a key", name)
+        }
+    }
+}
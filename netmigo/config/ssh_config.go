@@ -0,0 +1,231 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/netmigo/sshconfig"
+)
+
+const maxProxyJumpDepth = 8
+
+// LoadSSHConfig builds a DeviceConfig for alias from an OpenSSH client
+// config file. HostName, User, Port, IdentityFile, CertificateFile,
+// ConnectTimeout, ConnectionAttempts, AddressFamily, ProxyJump and
+// ProxyCommand are honoured; ProxyJump hosts become a JumpServer chain
+// resolved from the same file. An empty path means ~/.ssh/config. The options are applied to the
+// target and every jump host after the file settings, e.g. to supply a
+// password.
+func LoadSSHConfig(path, alias string, opts ...DeviceConfigOption) (*DeviceConfig, error) {
+    if path == "" {
+        defaultPath, err := sshconfig.DefaultPath()
+        if err != nil {
+            return nil, err
+        }
+        path = defaultPath
+    }
+    parsed, err := sshconfig.ParseFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return FromSSHConfig(parsed, alias, opts...)
+}
+
+// FromSSHConfig is LoadSSHConfig for an already parsed config.
+func FromSSHConfig(parsed *sshconfig.Config, alias string, opts ...DeviceConfigOption) (*DeviceConfig, error) {
+    if strings.TrimSpace(alias) == "" {
+        return nil, errors.New("ssh config host alias is required")
+    }
+    return buildFromSSHConfig(parsed, alias, "", "", opts, 0)
+}
+
+func buildFromSSHConfig(parsed *sshconfig.Config, alias, userOverride, portOverride string, opts []DeviceConfigOption, depth int) (*DeviceConfig, error) {
+    if depth > maxProxyJumpDepth {
+        return nil, fmt.Errorf("ssh config ProxyJump chain for %q is too deep", alias)
+    }
+
+    host := parsed.Get(alias, "HostName")
+    if host == "" {
+        host = alias
+    }
+    host = strings.ReplaceAll(host, "%h", alias)
+
+    cfg := NewDeviceConfig(host)
+    cfg.Username = firstNonEmpty(userOverride, parsed.Get(alias, "User"), currentUsername())
+    cfg.Port = firstNonEmpty(portOverride, parsed.Get(alias, "Port"), cfg.Port)
+
+    if value := parsed.Get(alias, "ConnectTimeout"); value != "" {
+        seconds, err := strconv.Atoi(value)
+        if err != nil || seconds < 0 {
+            return nil, fmt.Errorf("ssh config %q: invalid ConnectTimeout %q", alias, value)
+        }
+        if seconds > 0 {
+            cfg.ConnectionTimeout = time.Duration(seconds) * time.Second
+        }
+    }
+    if value := parsed.Get(alias, "ConnectionAttempts"); value != "" {
+        attempts, err := strconv.Atoi(value)
+        if err != nil || attempts < 1 {
+            return nil, fmt.Errorf("ssh config %q: invalid ConnectionAttempts %q", alias, value)
+        }
+        cfg.MaxRetry = attempts
+    }
+    switch strings.ToLower(parsed.Get(alias, "AddressFamily")) {
+    case "inet":
+        cfg.AddressFamily = AddressFamilyIPv4
+    case "inet6":
+        cfg.AddressFamily = AddressFamilyIPv6
+    }
+
+    tokens := sshConfigTokens(alias, cfg)
+    for _, identity := range parsed.GetAll(alias, "IdentityFile") {
+        path := expandSSHConfigPath(tokens.Replace(identity))
+        if _, err := os.Stat(path); err == nil {
+            cfg.KeyPath = path
+            break
+        }
+    }
+
+    if cfg.KeyPath != "" {
+        for _, certificate := range parsed.GetAll(alias, "CertificateFile") {
+            path := expandSSHConfigPath(tokens.Replace(certificate))
+            if _, err := os.Stat(path); err == nil {
+                cfg.CertPath = path
+                break
+            }
+        }
+    }
+
+    proxyJump := parsed.Get(alias, "ProxyJump")
+    proxyCommand := parsed.GetRaw(alias, "ProxyCommand")
+    switch {
+    case proxyJump != "" && !strings.EqualFold(proxyJump, "none"):
+        jump, err := buildProxyJumpChain(parsed, proxyJump, opts, depth)
+        if err != nil {
+            return nil, fmt.Errorf("ssh config %q: %w", alias, err)
+        }
+        cfg.JumpServer = jump
+    case proxyCommand != "" && !strings.EqualFold(proxyCommand, "none"):
+        // %h, %p and %r are left for dial time, so options applied below
+        // still change them.
+        cfg.ProxyCommand = sshConfigLocalTokens(alias).Replace(proxyCommand)
+    }
+
+    for _, opt := range opts {
+        opt(cfg)
+    }
+    return cfg, nil
+}
+
+// buildProxyJumpChain turns "a,b,c" into c -> b -> a, so the target goes
+// through c, which is reached through b, which is reached through a.
+func buildProxyJumpChain(parsed *sshconfig.Config, spec string, opts []DeviceConfigOption, depth int) (*DeviceConfig, error) {
+    var previous *DeviceConfig
+    for _, hop := range strings.Split(spec, ",") {
+        alias, username, port, err := parseJumpHop(strings.TrimSpace(hop))
+        if err != nil {
+            return nil, err
+        }
+        jump, err := buildFromSSHConfig(parsed, alias, username, port, opts, depth+1)
+        if err != nil {
+            return nil, err
+        }
+        if previous != nil {
+            jump.JumpServer = previous
+            jump.Dialer = nil
+            jump.ProxyCommand = ""
+        }
+        previous = jump
+    }
+    if previous == nil {
+        return nil, fmt.Errorf("empty ProxyJump %q", spec)
+    }
+    return previous, nil
+}
+
+// parseJumpHop parses [user@]host[:port] and ssh://[user@]host[:port].
+func parseJumpHop(hop string) (alias, username, port string, err error) {
+    if hop == "" {
+        return "", "", "", errors.New("empty ProxyJump hop")
+    }
+    if strings.HasPrefix(hop, "ssh://") {
+        u, parseErr := url.Parse(hop)
+        if parseErr != nil {
+            return "", "", "", fmt.Errorf("invalid ProxyJump hop %q: %w", hop, parseErr)
+        }
+        return u.Hostname(), u.User.Username(), u.Port(), nil
+    }
+    if at := strings.LastIndex(hop, "@"); at >= 0 {
+        username = hop[:at]
+        hop = hop[at+1:]
+    }
+    alias = hop
+    if strings.HasPrefix(hop, "[") {
+        if end := strings.Index(hop, "]"); end > 0 {
+            alias = hop[1:end]
+            port = strings.TrimPrefix(hop[end+1:], ":")
+        }
+    } else if strings.Count(hop, ":") == 1 {
+        alias, port, _ = strings.Cut(hop, ":")
+    }
+    return alias, username, port, nil
+}
+
+func sshConfigTokens(alias string, cfg *DeviceConfig) *strings.Replacer {
+    home, _ := os.UserHomeDir()
+    return strings.NewReplacer(
+        "%%", "%",
+        "%h", cfg.Host(),
+        "%p", cfg.Port,
+        "%r", cfg.Username,
+        "%n", alias,
+        "%d", home,
+        "%u", currentUsername(),
+    )
+}
+
+// sshConfigLocalTokens expands the tokens that do not depend on the
+// DeviceConfig and keeps %% for ExpandProxyCommand, escaping any % in the
+// values it inserts.
+func sshConfigLocalTokens(alias string) *strings.Replacer {
+    home, _ := os.UserHomeDir()
+    escape := func(value string) string { return strings.ReplaceAll(value, "%", "%%") }
+    return strings.NewReplacer(
+        "%%", "%%",
+        "%n", escape(alias),
+        "%d", escape(home),
+        "%u", escape(currentUsername()),
+    )
+}
+
+func expandSSHConfigPath(path string) string {
+    if path == "~" || strings.HasPrefix(path, "~/") {
+        if home, err := os.UserHomeDir(); err == nil {
+            return filepath.Join(home, strings.TrimPrefix(path, "~"))
+        }
+    }
+    return path
+}
+
+func currentUsername() string {
+    if u, err := user.Current(); err == nil {
+        return u.Username
+    }
+    return os.Getenv("USER")
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, value := range values {
+        if value != "" {
+            return value
+        }
+    }
+    return ""
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func writeSSHConfig(t *testing.T, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "config")
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatalf("write ssh config: %v", err)
+    }
+    return path
+}
+
+func TestLoadSSHConfigBuildsProxyJumpChain(t *testing.T) {
+    keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+    if err := os.WriteFile(keyPath, []byte("key"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    path := writeSSHConfig(t, `
+Host pe1
+    HostName 2001:db8::1
+    User neteng
+    ProxyJump ops@bastion-a,bastion-b:2200
+    ConnectTimeout 4
+    IdentityFile /does/not/exist
+    IdentityFile `+keyPath+`
+
+Host bastion-a
+    HostName 198.51.100.10
+    Port 2022
+
+Host bastion-b
+    HostName 10.0.0.5
+    User jump
+`)
+
+    cfg, err := LoadSSHConfig(path, "pe1", WithPassword("secret"))
+    if err != nil {
+        t.Fatalf("LoadSSHConfig returned error: %v", err)
+    }
+
+    if cfg.Address() != "[2001:db8::1]:22" || cfg.Username != "neteng" {
+        t.Fatalf("target = %s@%s, want neteng@[2001:db8::1]:22", cfg.Username, cfg.Address())
+    }
+    if cfg.KeyPath != keyPath {
+        t.Fatalf("KeyPath = %q, want %q", cfg.KeyPath, keyPath)
+    }
+    if cfg.ConnectionTimeout != 4*time.Second {
+        t.Fatalf("ConnectionTimeout = %s, want 4s", cfg.ConnectionTimeout)
+    }
+    if cfg.Password != "secret" {
+        t.Fatal("options were not applied to the target")
+    }
+
+    last := cfg.JumpServer
+    if last == nil || last.Address() != "10.0.0.5:2200" || last.Username != "jump" {
+        t.Fatalf("last hop = %+v, want jump@10.0.0.5:2200", last)
+    }
+    first := last.JumpServer
+    if first == nil || first.Address() != "198.51.100.10:2022" || first.Username != "ops" {
+        t.Fatalf("first hop = %+v, want ops@198.51.100.10:2022", first)
+    }
+    if first.JumpServer != nil {
+        t.Fatal("first hop should connect directly")
+    }
+    if first.Password != "secret" {
+        t.Fatal("options were not applied to jump hosts")
+    }
+}
+
+func TestLoadSSHConfigUsesProxyCommand(t *testing.T) {
+    path := writeSSHConfig(t, `
+Host oob-*
+    User console
+    Port 2201
+    ProxyCommand ssh -W %h:%p gateway
+
+Host lab-*
+    ProxyCommand sh -c "exec nc -X connect -x 'proxy:3128' %h %p"
+`)
+
+    cfg, err := LoadSSHConfig(path, "oob-r7")
+    if err != nil {
+        t.Fatalf("LoadSSHConfig returned error: %v", err)
+    }
+    if want := "ssh -W oob-r7:2201 gateway"; cfg.ExpandProxyCommand() != want {
+        t.Fatalf("ExpandProxyCommand() = %q, want %q", cfg.ExpandProxyCommand(), want)
+    }
+
+    // Options applied after the file still reach the proxy command.
+    cfg, err = LoadSSHConfig(path, "oob-r7", WithPort("2202"))
+    if err != nil {
+        t.Fatalf("LoadSSHConfig returned error: %v", err)
+    }
+    if want := "ssh -W oob-r7:2202 gateway"; cfg.ExpandProxyCommand() != want {
+        t.Fatalf("ExpandProxyCommand() = %q, want %q", cfg.ExpandProxyCommand(), want)
+    }
+    // The command reaches the shell with its quoting intact.
+    cfg, err = LoadSSHConfig(path, "lab-r1")
+    if err != nil {
+        t.Fatalf("LoadSSHConfig returned error: %v", err)
+    }
+    if want := `sh -c "exec nc -X connect -x 'proxy:3128' lab-r1 22"`; cfg.ExpandProxyCommand() != want {
+        t.Fatalf("ExpandProxyCommand() = %q, want %q", cfg.ExpandProxyCommand(), want)
+    }
+}
+
+func TestLoadSSHConfigRejectsProxyJumpLoops(t *testing.T) {
+    path := writeSSHConfig(t, `
+Host a
+    ProxyJump b
+Host b
+    ProxyJump a
+`)
+
+    if _, err := LoadSSHConfig(path, "a"); err == nil {
+        t.Fatal("expected error for ProxyJump loop")
+    }
+}
@@ -0,0 +1,348 @@
+// Package configdiff compares a candidate configuration with a running one.
+// Cisco-style configurations are compared as trees, so a line only matches
+// the same line under the same parents, and the result includes the
+// commands that turn the running configuration into the candidate. Flat
+// files, such as Linux configuration files, are compared line by line.
+package configdiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+	"github.com/jonelmawirat/netmigo/netmigo/ciscoconf"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+	"github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+// ChangeKind says whether a line is added or removed.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+)
+
+func (k ChangeKind) String() string {
+	if k == Removed {
+		return "removed"
+	}
+	return "added"
+}
+
+// Change is a line the candidate adds or removes. Path holds the parent
+// lines it sits under, outermost first. A removed parent is one change;
+// its children go with it.
+type Change struct {
+	Kind ChangeKind
+	Path []string
+	Line string
+}
+
+func (c Change) String() string {
+	sign := "+"
+	if c.Kind == Removed {
+		sign = "-"
+	}
+	return sign + " " + strings.Join(append(append([]string(nil), c.Path...), c.Line), " > ")
+}
+
+// Result is a comparison of a candidate with a running configuration.
+type Result struct {
+	// Unified is a unified diff from running to candidate, with
+	// indentation normalized and comments left out.
+	Unified string
+	Changes []Change
+	// Commands turn the running configuration into the candidate. Each
+	// parent is sent before the lines under it, indented one space per
+	// level, removals before additions. Commands is nil for flat files.
+	Commands []string
+}
+
+// Equal reports whether the configurations match.
+func (r *Result) Equal() bool {
+	return len(r.Changes) == 0
+}
+
+type options struct {
+	flat     bool
+	merge    bool
+	execOpts []repository.ExecuteOption
+}
+
+// Option configures a comparison.
+type Option func(*options)
+
+// Flat compares the configurations line by line instead of as trees and
+// leaves Commands empty.
+func Flat() Option {
+	return func(o *options) {
+		o.flat = true
+	}
+}
+
+// Merge treats the candidate as a snippet to merge into the running
+// configuration rather than a whole configuration: lines it leaves out are
+// kept, and only its "no" lines remove anything.
+func Merge() Option {
+	return func(o *options) {
+		o.merge = true
+	}
+}
+
+// WithExecuteOptions passes opts to the Execute that fetches the running
+// configuration in CompareRunning.
+func WithExecuteOptions(opts ...repository.ExecuteOption) Option {
+	return func(o *options) {
+		o.execOpts = append(o.execOpts, opts...)
+	}
+}
+
+// Compare compares candidate with running.
+func Compare(running, candidate string, opts ...Option) *Result {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.flat {
+		return compareFlat(running, candidate, o.merge)
+	}
+
+	runningCfg, candidateCfg := ciscoconf.Parse(running), ciscoconf.Parse(candidate)
+	c := comparer{merge: o.merge}
+	changes, commands := c.compare(nil, runningCfg.Children, candidateCfg.Children)
+	result := &Result{Changes: changes, Commands: commands}
+	if len(changes) > 0 {
+		result.Unified = backup.Diff([]byte(runningCfg.String()), []byte(c.target(runningCfg, candidateCfg).String()), "running", "candidate")
+	}
+	return result
+}
+
+// CompareRunning fetches the running configuration of a connected device
+// with the backup profile for platform and compares candidate with it.
+func CompareRunning(device service.DeviceService, platform config.Platform, candidate string, opts ...Option) (*Result, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	profile, ok := backup.Profiles[platform]
+	if !ok {
+		return nil, fmt.Errorf("%w %v", backup.ErrNoProfile, platform)
+	}
+	running, err := backup.Fetch(device, profile, o.execOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching running configuration: %w", err)
+	}
+	return Compare(string(running), candidate, opts...), nil
+}
+
+type comparer struct {
+	merge bool
+}
+
+// compare walks two sibling lists under path and returns the changes and
+// the commands that make running match candidate. Removals come first, so
+// that replacing a single-valued line such as an IP address does not
+// remove the new value.
+func (c comparer) compare(path []string, running, candidate []*ciscoconf.Node) ([]Change, []string) {
+	var changes []Change
+	var commands []string
+	indent := strings.Repeat(" ", len(path))
+	runningByText, candidateByText := index(running), index(candidate)
+	if !c.merge {
+		for _, r := range running {
+			if _, ok := candidateByText[r.Text]; !ok {
+				changes = append(changes, Change{Kind: Removed, Path: path, Line: r.Text})
+				commands = append(commands, indent+negate(r.Text))
+			}
+		}
+	}
+	for _, cand := range candidate {
+		if c.merge {
+			if rest, ok := strings.CutPrefix(cand.Text, "no "); ok {
+				if _, present := runningByText[rest]; present {
+					changes = append(changes, Change{Kind: Removed, Path: path, Line: rest})
+					commands = append(commands, indent+cand.Text)
+				}
+				continue
+			}
+		}
+		childPath := append(clone(path), cand.Text)
+		r, ok := runningByText[cand.Text]
+		if !ok {
+			changes = append(changes, Change{Kind: Added, Path: path, Line: cand.Text})
+			changes = append(changes, added(childPath, cand.Children)...)
+			changes = append(changes, lineChanges(childPath, nil, cand.Body, false)...)
+			commands = append(commands, cand.Lines(len(path))...)
+			continue
+		}
+		// Banners and blocks closed by a line such as end-policy are
+		// replaced as a whole, so any change sends all of the candidate's.
+		if cand.IsBanner() || cand.End != "" {
+			subChanges := lineChanges(childPath, r.Body, cand.Body, false)
+			subChanges = append(subChanges, comparer{}.changes(childPath, r.Children, cand.Children)...)
+			if len(subChanges) > 0 {
+				changes = append(changes, subChanges...)
+				commands = append(commands, cand.Lines(len(path))...)
+			}
+			continue
+		}
+		subChanges, subCommands := c.compare(childPath, r.Children, cand.Children)
+		changes = append(changes, subChanges...)
+		if len(subCommands) > 0 {
+			commands = append(commands, indent+cand.Text)
+			commands = append(commands, subCommands...)
+		}
+	}
+	return changes, commands
+}
+
+func (c comparer) changes(path []string, running, candidate []*ciscoconf.Node) []Change {
+	changes, _ := c.compare(path, running, candidate)
+	return changes
+}
+
+func added(path []string, nodes []*ciscoconf.Node) []Change {
+	var out []Change
+	for _, n := range nodes {
+		out = append(out, Change{Kind: Added, Path: path, Line: n.Text})
+		out = append(out, added(append(clone(path), n.Text), n.Children)...)
+	}
+	return out
+}
+
+// target is the configuration the device ends up with: the candidate, or
+// with Merge the running configuration with the candidate merged in.
+func (c comparer) target(running, candidate *ciscoconf.Config) *ciscoconf.Config {
+	if !c.merge {
+		return candidate
+	}
+	return &ciscoconf.Config{Children: mergeNodes(nil, running.Children, candidate.Children)}
+}
+
+func mergeNodes(parent *ciscoconf.Node, running, candidate []*ciscoconf.Node) []*ciscoconf.Node {
+	candidateByText := index(candidate)
+	removed := make(map[string]bool)
+	for _, cand := range candidate {
+		if rest, ok := strings.CutPrefix(cand.Text, "no "); ok {
+			removed[rest] = true
+		}
+	}
+	var out []*ciscoconf.Node
+	seen := make(map[string]bool)
+	for _, r := range running {
+		if removed[r.Text] {
+			continue
+		}
+		seen[r.Text] = true
+		node := &ciscoconf.Node{Text: r.Text, Parent: parent}
+		cand, ok := candidateByText[r.Text]
+		if ok && (cand.IsBanner() || cand.End != "") {
+			out = append(out, cand)
+			continue
+		}
+		if ok {
+			node.Children = mergeNodes(node, r.Children, cand.Children)
+		} else {
+			node.Children = r.Children
+		}
+		out = append(out, node)
+	}
+	for _, cand := range candidate {
+		if seen[cand.Text] || strings.HasPrefix(cand.Text, "no ") {
+			continue
+		}
+		out = append(out, cand)
+	}
+	return out
+}
+
+// negate returns the command that removes line: the line with "no " in
+// front, or without it when it is already a "no" line. A banner is
+// removed by its type alone.
+func negate(line string) string {
+	if rest, ok := strings.CutPrefix(line, "no "); ok {
+		return rest
+	}
+	if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "banner" {
+		return "no banner " + fields[1]
+	}
+	return "no " + line
+}
+
+func index(nodes []*ciscoconf.Node) map[string]*ciscoconf.Node {
+	byText := make(map[string]*ciscoconf.Node, len(nodes))
+	for _, n := range nodes {
+		if _, ok := byText[n.Text]; !ok {
+			byText[n.Text] = n
+		}
+	}
+	return byText
+}
+
+func clone(path []string) []string {
+	return append([]string(nil), path...)
+}
+
+// compareFlat compares files line by line. Blank lines and surrounding
+// whitespace are ignored when listing changes; the unified diff shows the
+// files as they are. With merge only added lines count.
+func compareFlat(running, candidate string, merge bool) *Result {
+	result := &Result{Changes: lineChanges(nil, orderedLines(running), orderedLines(candidate), merge)}
+	target := candidate
+	if merge && len(result.Changes) > 0 {
+		var merged []string
+		for _, change := range result.Changes {
+			merged = append(merged, change.Line)
+		}
+		target = strings.TrimRight(running, "\n") + "\n" + strings.Join(merged, "\n") + "\n"
+	}
+	if len(result.Changes) > 0 {
+		result.Unified = backup.Diff([]byte(running), []byte(target), "running", "candidate")
+	}
+	return result
+}
+
+// lineChanges compares two lists of lines as multisets, so reordering
+// alone is no change. With merge only added lines count.
+func lineChanges(path, running, candidate []string, merge bool) []Change {
+	var changes []Change
+	if !merge {
+		remaining := counts(candidate)
+		for _, line := range running {
+			if remaining[line] > 0 {
+				remaining[line]--
+				continue
+			}
+			changes = append(changes, Change{Kind: Removed, Path: path, Line: line})
+		}
+	}
+	remaining := counts(running)
+	for _, line := range candidate {
+		if remaining[line] > 0 {
+			remaining[line]--
+			continue
+		}
+		changes = append(changes, Change{Kind: Added, Path: path, Line: line})
+	}
+	return changes
+}
+
+func orderedLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func counts(lines []string) map[string]int {
+	counts := make(map[string]int, len(lines))
+	for _, line := range lines {
+		counts[line]++
+	}
+	return counts
+}
@@ -0,0 +1,168 @@
+package configdiff
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/internal/devicetest"
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+const running = `hostname edge1
+!
+interface GigabitEthernet0/0/0/0
+ description uplink
+ ipv4 address 192.0.2.1 255.255.255.252
+ shutdown
+!
+interface GigabitEthernet0/0/0/1
+ description spare
+!
+router static
+ address-family ipv4 unicast
+  0.0.0.0/0 192.0.2.2
+ !
+!
+no ip domain lookup
+end
+`
+
+const candidate = `hostname edge1
+!
+interface GigabitEthernet0/0/0/0
+ description uplink to core
+ ipv4 address 192.0.2.1 255.255.255.252
+!
+router static
+ address-family ipv4 unicast
+  0.0.0.0/0 192.0.2.2
+  10.0.0.0/8 192.0.2.2
+ !
+!
+interface Loopback0
+ ipv4 address 10.255.0.1 255.255.255.255
+!
+end
+`
+
+func TestCompareProducesConvergeCommands(t *testing.T) {
+	result := Compare(running, candidate)
+	want := []string{
+		"no interface GigabitEthernet0/0/0/1",
+		"ip domain lookup",
+		"interface GigabitEthernet0/0/0/0",
+		" no description uplink",
+		" no shutdown",
+		" description uplink to core",
+		"router static",
+		" address-family ipv4 unicast",
+		"  10.0.0.0/8 192.0.2.2",
+		"interface Loopback0",
+		" ipv4 address 10.255.0.1 255.255.255.255",
+	}
+	if !reflect.DeepEqual(result.Commands, want) {
+		t.Fatalf("Commands =\n%s\nwant\n%s", strings.Join(result.Commands, "\n"), strings.Join(want, "\n"))
+	}
+
+	var changes []string
+	for _, c := range result.Changes {
+		changes = append(changes, c.String())
+	}
+	wantChanges := []string{
+		"- interface GigabitEthernet0/0/0/1",
+		"- no ip domain lookup",
+		"- interface GigabitEthernet0/0/0/0 > description uplink",
+		"- interface GigabitEthernet0/0/0/0 > shutdown",
+		"+ interface GigabitEthernet0/0/0/0 > description uplink to core",
+		"+ router static > address-family ipv4 unicast > 10.0.0.0/8 192.0.2.2",
+		"+ interface Loopback0",
+		"+ interface Loopback0 > ipv4 address 10.255.0.1 255.255.255.255",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Fatalf("Changes =\n%s\nwant\n%s", strings.Join(changes, "\n"), strings.Join(wantChanges, "\n"))
+	}
+
+	for _, line := range []string{"--- running\n", "+++ candidate\n", "- description uplink\n", "+ description uplink to core\n", "+interface Loopback0\n"} {
+		if !strings.Contains(result.Unified, line) {
+			t.Fatalf("Unified diff missing %q:\n%s", line, result.Unified)
+		}
+	}
+}
+
+func TestCompareIgnoresCommentsAndIndentation(t *testing.T) {
+	tabbed := strings.ReplaceAll(strings.ReplaceAll(running, "\n ", "\n\t"), "\n!\n", "\n! comment\n")
+	if result := Compare(running, tabbed); !result.Equal() || result.Unified != "" || result.Commands != nil {
+		t.Fatalf("Compare() = %+v, want no differences", result)
+	}
+}
+
+func TestCompareMergeKeepsLinesLeftOut(t *testing.T) {
+	snippet := "interface GigabitEthernet0/0/0/0\n no shutdown\n mtu 9216\nno ip domain lookup\n"
+	result := Compare(running, snippet, Merge())
+	want := []string{
+		"interface GigabitEthernet0/0/0/0",
+		" no shutdown",
+		" mtu 9216",
+	}
+	if !reflect.DeepEqual(result.Commands, want) {
+		t.Fatalf("Commands = %q, want %q", result.Commands, want)
+	}
+	if !strings.Contains(result.Unified, "- shutdown\n+ mtu 9216\n") || strings.Contains(result.Unified, "-hostname") {
+		t.Fatalf("Unified diff =\n%s", result.Unified)
+	}
+}
+
+func TestCompareReplacesBannersAndPoliciesWhole(t *testing.T) {
+	before := "banner motd ^C\nWelcome\n^C\nroute-policy PASS\n  if destination in CUSTOMERS then\n    pass\n  endif\nend-policy\n"
+	after := "banner motd ^C\nAuthorized access only\n^C\nroute-policy PASS\n  if destination in CUSTOMERS then\n    pass\n  else\n    drop\n  endif\nend-policy\n"
+	result := Compare(before, after)
+	want := []string{
+		"banner motd ^C",
+		"Authorized access only",
+		"^C",
+		"route-policy PASS",
+		" if destination in CUSTOMERS then",
+		"  pass",
+		" else",
+		"  drop",
+		" endif",
+		"end-policy",
+	}
+	if !reflect.DeepEqual(result.Commands, want) {
+		t.Fatalf("Commands =\n%s\nwant\n%s", strings.Join(result.Commands, "\n"), strings.Join(want, "\n"))
+	}
+	if got := Compare(before, "").Commands; !reflect.DeepEqual(got, []string{"no banner motd", "no route-policy PASS"}) {
+		t.Fatalf("Commands = %q", got)
+	}
+}
+
+func TestCompareFlat(t *testing.T) {
+	result := Compare("PermitRootLogin yes\nPort 22\n\nUseDNS no\n", "Port 22\nPermitRootLogin no\nUseDNS no\n", Flat())
+	want := []Change{
+		{Kind: Removed, Line: "PermitRootLogin yes"},
+		{Kind: Added, Line: "PermitRootLogin no"},
+	}
+	if !reflect.DeepEqual(result.Changes, want) || result.Commands != nil {
+		t.Fatalf("Compare() = %+v, want changes %+v", result, want)
+	}
+	if !strings.Contains(result.Unified, "-PermitRootLogin yes\n") {
+		t.Fatalf("Unified diff =\n%s", result.Unified)
+	}
+}
+
+func TestCompareRunning(t *testing.T) {
+	device := devicetest.New(t, "RP/0/RSP0/CPU0:edge1#show running-config\nBuilding configuration...\n"+running+"\nRP/0/RSP0/CPU0:edge1#")
+	result, err := CompareRunning(device, config.CISCO_IOSXR, running)
+	if err != nil {
+		t.Fatalf("CompareRunning returned error: %v", err)
+	}
+	if !result.Equal() {
+		t.Fatalf("CompareRunning() changes = %v, want none", result.Changes)
+	}
+	if _, err := CompareRunning(device, config.LINUX, running); !errors.Is(err, backup.ErrNoProfile) {
+		t.Fatalf("CompareRunning error = %v, want ErrNoProfile", err)
+	}
+}
@@ -0,0 +1,58 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Command runs an external secret tool such as `pass show` or the vault
+// CLI. %h, %p and %r in the arguments are replaced with the target host,
+// port and username. Output that starts with "{" is decoded as JSON with
+// username, password and key_path fields; otherwise the first line is the
+// password, following the pass convention.
+func Command(name string, args ...string) CredentialProvider {
+	return WithID(idOf("command", append([]string{name}, args...)...), ProviderFunc(func(ctx context.Context, target Target) (Credential, error) {
+		replacer := strings.NewReplacer("%%", "%", "%h", target.Host, "%p", target.Port, "%r", target.Username)
+		expanded := make([]string, len(args))
+		for i, arg := range args {
+			expanded[i] = replacer.Replace(arg)
+		}
+
+		cmd := exec.CommandContext(ctx, name, expanded...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			detail := strings.TrimSpace(stderr.String())
+			if detail != "" {
+				return Credential{}, fmt.Errorf("credential command %s: %w: %s", name, err, detail)
+			}
+			return Credential{}, fmt.Errorf("credential command %s: %w", name, err)
+		}
+
+		label := "command:" + name
+		output := strings.TrimSpace(stdout.String())
+		if strings.HasPrefix(output, "{") {
+			var decoded struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+				KeyPath  string `json:"key_path"`
+			}
+			if err := json.Unmarshal([]byte(output), &decoded); err != nil {
+				return Credential{}, fmt.Errorf("credential command %s: decode JSON output: %w", name, err)
+			}
+			return Credential{Label: label, Username: decoded.Username, Password: decoded.Password, KeyPath: decoded.KeyPath}, nil
+		}
+
+		password, _, _ := strings.Cut(output, "\n")
+		password = strings.TrimRight(password, "\r")
+		if password == "" {
+			return Credential{}, fmt.Errorf("credential command %s returned no output: %w", name, ErrNotFound)
+		}
+		return Credential{Label: label, Password: password}, nil
+	}))
+}
@@ -0,0 +1,103 @@
+// Package credentials supplies device credentials at connect time instead of
+// storing them in DeviceConfig. Providers are consulted in order, so a list
+// such as [TACACS account, local emergency account] falls back to the next
+// credential when authentication fails.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by a provider that has no credential for the
+// requested target. The connector skips such providers.
+var ErrNotFound = errors.New("credential not found")
+
+// Target identifies the device a credential is requested for. Username is
+// the username already configured on the device, if any.
+type Target struct {
+	Host     string
+	Port     string
+	Username string
+}
+
+// Credential is a username with a password and/or private key path. Empty
+// fields fall back to the values configured on the device.
+type Credential struct {
+	Label    string
+	Username string
+	Password string
+	KeyPath  string
+}
+
+// CredentialProvider returns the credential to use for a target. ctx is the
+// context the connection was opened with, so a slow secret store can be
+// cancelled with it.
+type CredentialProvider interface {
+	Credential(ctx context.Context, target Target) (Credential, error)
+}
+
+// ProviderFunc adapts an ordinary function to CredentialProvider.
+type ProviderFunc func(ctx context.Context, target Target) (Credential, error)
+
+func (f ProviderFunc) Credential(ctx context.Context, target Target) (Credential, error) {
+	return f(ctx, target)
+}
+
+// Identified is a provider that names the credential source it reads, such
+// as every provider in this package. DeviceConfig.Key includes the ID, so
+// connections are only shared between configs whose providers have the
+// same ID; a config with a provider without one only shares them through
+// the same *DeviceConfig. The ID is hashed into the key and may contain
+// secrets.
+type Identified interface {
+	CredentialProvider
+	ID() string
+}
+
+// WithID gives provider an ID, e.g. so that configs built separately with
+// the same ProviderFunc logic share pooled connections.
+func WithID(id string, provider CredentialProvider) CredentialProvider {
+	return identified{CredentialProvider: provider, id: id}
+}
+
+type identified struct {
+	CredentialProvider
+	id string
+}
+
+func (p identified) ID() string { return p.id }
+
+// Static always returns the same credential, e.g. a local emergency account
+// used after the AAA-backed account.
+func Static(label, username, password string) CredentialProvider {
+	return WithID(idOf("static", label, username, password), ProviderFunc(func(context.Context, Target) (Credential, error) {
+		return Credential{Label: label, Username: username, Password: password}, nil
+	}))
+}
+
+// Env reads the username and password from environment variables. An empty
+// usernameVar keeps the device username. ErrNotFound is returned when the
+// password variable is unset.
+func Env(usernameVar, passwordVar string) CredentialProvider {
+	return WithID(idOf("env", usernameVar, passwordVar), ProviderFunc(func(context.Context, Target) (Credential, error) {
+		password, ok := os.LookupEnv(passwordVar)
+		if !ok {
+			return Credential{}, fmt.Errorf("environment variable %s: %w", passwordVar, ErrNotFound)
+		}
+		cred := Credential{Label: "env:" + passwordVar, Password: password}
+		if usernameVar != "" {
+			cred.Username = os.Getenv(usernameVar)
+		}
+		return cred, nil
+	}))
+}
+
+// idOf joins the parameters a built-in provider was created with into its
+// ID.
+func idOf(kind string, params ...string) string {
+	return kind + "\x00" + strings.Join(params, "\x00")
+}
@@ -0,0 +1,121 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("NETMIGO_TEST_USER", "tacacs-user")
+	t.Setenv("NETMIGO_TEST_PASS", "s3cret")
+
+	cred, err := Env("NETMIGO_TEST_USER", "NETMIGO_TEST_PASS").Credential(context.Background(), Target{Host: "r1"})
+	if err != nil {
+		t.Fatalf("Credential returned error: %v", err)
+	}
+	if cred.Username != "tacacs-user" || cred.Password != "s3cret" {
+		t.Fatalf("credential = %+v", cred)
+	}
+
+	_, err = Env("", "NETMIGO_TEST_MISSING").Credential(context.Background(), Target{Host: "r1"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing variable error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNetrcProviderMatchesMachineThenDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	content := `# lab devices
+machine r1.lab login admin password r1-secret
+machine r2.lab
+    login ops
+    password r2-secret
+macdef init
+cd /tmp
+put file
+
+default login fallback password default-secret
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider := Netrc(path)
+
+	cases := map[string]Credential{
+		"r1.lab": {Label: "netrc:r1.lab", Username: "admin", Password: "r1-secret"},
+		"R2.LAB": {Label: "netrc:r2.lab", Username: "ops", Password: "r2-secret"},
+		"r3.lab": {Label: "netrc:default", Username: "fallback", Password: "default-secret"},
+	}
+	for host, want := range cases {
+		got, err := provider.Credential(context.Background(), Target{Host: host})
+		if err != nil {
+			t.Fatalf("Credential(%s) returned error: %v", host, err)
+		}
+		if got != want {
+			t.Fatalf("Credential(%s) = %+v, want %+v", host, got, want)
+		}
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.vault")
+	entries := []VaultEntry{
+		{Host: "core-*", Label: "tacacs", Username: "svc-net", Password: "core-secret"},
+		{Host: "*", Username: "local", Password: "emergency"},
+	}
+	if err := WriteVault(path, "correct horse", entries); err != nil {
+		t.Fatalf("WriteVault returned error: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "core-secret") {
+		t.Fatal("vault file contains plaintext secret")
+	}
+
+	provider := Vault(path, "correct horse")
+	cred, err := provider.Credential(context.Background(), Target{Host: "core-r1"})
+	if err != nil {
+		t.Fatalf("Credential returned error: %v", err)
+	}
+	if cred.Label != "tacacs" || cred.Password != "core-secret" {
+		t.Fatalf("credential = %+v", cred)
+	}
+	cred, err = provider.Credential(context.Background(), Target{Host: "edge-r9"})
+	if err != nil || cred.Username != "local" {
+		t.Fatalf("catch-all credential = %+v, %v", cred, err)
+	}
+
+	if _, err := Vault(path, "wrong").Credential(context.Background(), Target{Host: "core-r1"}); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("wrong passphrase error = %v", err)
+	}
+}
+
+func TestCommandProvider(t *testing.T) {
+	cred, err := Command("sh", "-c", "printf 'pw-for-%s\\nurl: x\\n' \"$0\"", "%h").Credential(context.Background(), Target{Host: "r1"})
+	if err != nil {
+		t.Fatalf("Credential returned error: %v", err)
+	}
+	if cred.Password != "pw-for-r1" {
+		t.Fatalf("password = %q, want pw-for-r1", cred.Password)
+	}
+
+	cred, err = Command("echo", `{"username":"ops","password":"json-secret"}`).Credential(context.Background(), Target{Host: "r1"})
+	if err != nil {
+		t.Fatalf("Credential returned error: %v", err)
+	}
+	if cred.Username != "ops" || cred.Password != "json-secret" {
+		t.Fatalf("credential = %+v", cred)
+	}
+
+	_, err = Command("sh", "-c", "echo 'no such secret' >&2; exit 1").Credential(context.Background(), Target{Host: "r1"})
+	if err == nil || !strings.Contains(err.Error(), "no such secret") {
+		t.Fatalf("failing command error = %v", err)
+	}
+}
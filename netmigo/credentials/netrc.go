@@ -0,0 +1,116 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Netrc looks the target host up in a netrc-style file with machine, login
+// and password tokens, falling back to the "default" entry. Macro
+// definitions (macdef) are skipped.
+func Netrc(path string) CredentialProvider {
+	return WithID(idOf("netrc", path), ProviderFunc(func(_ context.Context, target Target) (Credential, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Credential{}, fmt.Errorf("read netrc %s: %w", path, err)
+		}
+		entries, err := parseNetrc(string(data))
+		if err != nil {
+			return Credential{}, fmt.Errorf("parse netrc %s: %w", path, err)
+		}
+
+		var fallback *netrcEntry
+		for i := range entries {
+			entry := &entries[i]
+			if entry.isDefault {
+				if fallback == nil {
+					fallback = entry
+				}
+				continue
+			}
+			if strings.EqualFold(entry.machine, target.Host) && (target.Username == "" || entry.login == "" || entry.login == target.Username) {
+				return entry.credential(), nil
+			}
+		}
+		if fallback != nil {
+			return fallback.credential(), nil
+		}
+		return Credential{}, fmt.Errorf("netrc %s has no entry for %s: %w", path, target.Host, ErrNotFound)
+	}))
+}
+
+type netrcEntry struct {
+	machine   string
+	isDefault bool
+	login     string
+	password  string
+}
+
+func (e *netrcEntry) credential() Credential {
+	label := "netrc:" + e.machine
+	if e.isDefault {
+		label = "netrc:default"
+	}
+	return Credential{Label: label, Username: e.login, Password: e.password}
+}
+
+func parseNetrc(content string) ([]netrcEntry, error) {
+	var entries []netrcEntry
+	var current *netrcEntry
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens := strings.Fields(line)
+		for j := 0; j < len(tokens); j++ {
+			token := tokens[j]
+			next := func() (string, error) {
+				if j+1 >= len(tokens) {
+					return "", fmt.Errorf("line %d: missing value for %s", i+1, token)
+				}
+				j++
+				return tokens[j], nil
+			}
+			switch token {
+			case "machine":
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, netrcEntry{machine: value})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{isDefault: true})
+				current = &entries[len(entries)-1]
+			case "login", "password", "account":
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				if current == nil {
+					return nil, fmt.Errorf("line %d: %s before machine", i+1, token)
+				}
+				switch token {
+				case "login":
+					current.login = value
+				case "password":
+					current.password = value
+				}
+			case "macdef":
+				// A macro body runs until the next blank line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(tokens)
+			default:
+				return nil, fmt.Errorf("line %d: unexpected token %q", i+1, token)
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,157 @@
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	vaultVersion = 1
+	vaultKDF     = "scrypt"
+	vaultScryptN = 1 << 15
+	vaultScryptR = 8
+	vaultScryptP = 1
+	vaultKeySize = 32
+	vaultSaltLen = 16
+)
+
+// VaultEntry is one credential stored in a vault file. Host is matched
+// against the target host with shell-style wildcards; "*" acts as a
+// catch-all. Entries are checked in order.
+type VaultEntry struct {
+	Host     string `json:"host"`
+	Label    string `json:"label,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	KeyPath  string `json:"key_path,omitempty"`
+}
+
+type vaultEnvelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Vault reads credentials from a passphrase-encrypted vault file written by
+// WriteVault. The file is decrypted on every lookup so rotated secrets are
+// picked up without restarting.
+func Vault(path, passphrase string) CredentialProvider {
+	return WithID(idOf("vault", path, passphrase), ProviderFunc(func(_ context.Context, target Target) (Credential, error) {
+		entries, err := ReadVault(path, passphrase)
+		if err != nil {
+			return Credential{}, err
+		}
+		for _, entry := range entries {
+			if matchHost(entry.Host, target.Host) {
+				label := entry.Label
+				if label == "" {
+					label = "vault:" + entry.Host
+				}
+				return Credential{Label: label, Username: entry.Username, Password: entry.Password, KeyPath: entry.KeyPath}, nil
+			}
+		}
+		return Credential{}, fmt.Errorf("vault %s has no entry for %s: %w", path, target.Host, ErrNotFound)
+	}))
+}
+
+// WriteVault encrypts entries with a key derived from passphrase (scrypt)
+// using AES-256-GCM and writes them to path with 0600 permissions.
+func WriteVault(path, passphrase string, entries []VaultEntry) error {
+	if passphrase == "" {
+		return errors.New("vault passphrase is empty")
+	}
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("encode vault entries: %w", err)
+	}
+
+	envelope := vaultEnvelope{
+		Version: vaultVersion,
+		KDF:     vaultKDF,
+		N:       vaultScryptN,
+		R:       vaultScryptR,
+		P:       vaultScryptP,
+		Salt:    make([]byte, vaultSaltLen),
+	}
+	if _, err := rand.Read(envelope.Salt); err != nil {
+		return fmt.Errorf("generate vault salt: %w", err)
+	}
+	aead, err := vaultCipher(passphrase, envelope)
+	if err != nil {
+		return err
+	}
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(envelope.Nonce); err != nil {
+		return fmt.Errorf("generate vault nonce: %w", err)
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode vault: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadVault decrypts the vault at path.
+func ReadVault(path, passphrase string) ([]VaultEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read vault %s: %w", path, err)
+	}
+	var envelope vaultEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("parse vault %s: %w", path, err)
+	}
+	if envelope.Version != vaultVersion || envelope.KDF != vaultKDF {
+		return nil, fmt.Errorf("vault %s: unsupported version %d/%s", path, envelope.Version, envelope.KDF)
+	}
+	aead, err := vaultCipher(passphrase, envelope)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("vault %s: invalid nonce", path)
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s: wrong passphrase or corrupted file", path)
+	}
+	var entries []VaultEntry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("vault %s: decode entries: %w", path, err)
+	}
+	return entries, nil
+}
+
+func vaultCipher(passphrase string, envelope vaultEnvelope) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), envelope.Salt, envelope.N, envelope.R, envelope.P, vaultKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive vault key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("vault cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func matchHost(pattern, host string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return err == nil && ok
+}
@@ -9,14 +9,18 @@ import (
     "github.com/jonelmawirat/netmigo/netmigo/service"
 )
 
-func NewDevice(logger *slog.Logger, platform config.Platform) (service.DeviceService, error) {
-    repo := repository.NewSSHRepository(logger)
+func NewDevice(logger *slog.Logger, platform config.Platform, opts ...repository.RepositoryOption) (service.DeviceService, error) {
+    repo := repository.NewSSHRepository(logger, opts...)
+    telnet := service.WithTelnetRepository(repository.NewTelnetRepository(logger, opts...))
+    console := service.WithConsoleRepository(repository.NewConsoleRepository(logger, opts...))
 
     switch platform {
     case config.CISCO_IOSXR:
-        return service.NewIosxrDeviceService(repo, logger), nil
+        return service.NewIosxrDeviceService(repo, logger, telnet, console), nil
+    case config.CISCO_IOSXE:
+        return service.NewIosxeDeviceService(repo, logger, telnet, console), nil
     case config.LINUX:
-        return service.NewLinuxDeviceService(repo, logger), nil
+        return service.NewLinuxDeviceService(repo, logger, telnet, console), nil
     default:
         return nil, errors.New("unsupported platform in factory")
     }
@@ -0,0 +1,230 @@
+// Package getters reads common facts from devices as structured data:
+// hostname, software version, model and serial number, interfaces and
+// their counters, LLDP neighbors, the ARP table and BGP neighbors. Each
+// platform runs its own show commands and parses their output, so callers
+// get the same types whatever the device.
+package getters
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+	"github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+// ErrUnsupportedPlatform is returned by New for platforms without getters.
+var ErrUnsupportedPlatform = errors.New("no getters for platform")
+
+// Facts describe a device.
+type Facts struct {
+	Hostname     string        `json:"hostname"`
+	Vendor       string        `json:"vendor"`
+	Model        string        `json:"model"`
+	SerialNumber string        `json:"serial_number"`
+	OSVersion    string        `json:"os_version"`
+	Uptime       time.Duration `json:"uptime"`
+	Interfaces   []string      `json:"interfaces"`
+}
+
+// Interface is the state of an interface. Speed is in Mbit/s, 0 when the
+// device does not report it.
+type Interface struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Up          bool   `json:"up"`
+	MACAddress  string `json:"mac_address"`
+	MTU         int    `json:"mtu"`
+	Speed       int    `json:"speed"`
+}
+
+// InterfaceCounters are the packet and byte counters of an interface.
+// Counters a platform does not keep are 0.
+type InterfaceCounters struct {
+	Interface          string `json:"interface"`
+	RxPackets          uint64 `json:"rx_packets"`
+	RxBytes            uint64 `json:"rx_bytes"`
+	RxErrors           uint64 `json:"rx_errors"`
+	RxDrops            uint64 `json:"rx_drops"`
+	RxBroadcastPackets uint64 `json:"rx_broadcast_packets"`
+	RxMulticastPackets uint64 `json:"rx_multicast_packets"`
+	TxPackets          uint64 `json:"tx_packets"`
+	TxBytes            uint64 `json:"tx_bytes"`
+	TxErrors           uint64 `json:"tx_errors"`
+	TxDrops            uint64 `json:"tx_drops"`
+	TxBroadcastPackets uint64 `json:"tx_broadcast_packets"`
+	TxMulticastPackets uint64 `json:"tx_multicast_packets"`
+}
+
+// LLDPNeighbor is a device seen on LocalInterface. Port is the neighbor's
+// interface.
+type LLDPNeighbor struct {
+	LocalInterface string `json:"local_interface"`
+	Hostname       string `json:"hostname"`
+	Port           string `json:"port"`
+}
+
+// ARPEntry maps an IPv4 address to a MAC address, written as six
+// colon-separated lowercase pairs. Age is 0 for the device's own addresses
+// and on platforms that do not report it.
+type ARPEntry struct {
+	Interface string        `json:"interface"`
+	IP        string        `json:"ip"`
+	MAC       string        `json:"mac"`
+	Age       time.Duration `json:"age"`
+}
+
+// BGPNeighbor is a BGP session. State is "Established" or the state the
+// session is stuck in, such as "Idle" or "Active". Uptime is how long an
+// established session has been up.
+type BGPNeighbor struct {
+	VRF              string        `json:"vrf"`
+	Address          string        `json:"address"`
+	RemoteAS         uint32        `json:"remote_as"`
+	LocalAS          uint32        `json:"local_as"`
+	RouterID         string        `json:"router_id"`
+	State            string        `json:"state"`
+	Up               bool          `json:"up"`
+	Uptime           time.Duration `json:"uptime"`
+	PrefixesReceived int           `json:"prefixes_received"`
+}
+
+// Getters read facts from a connected device. Lists come in the order the
+// device prints them.
+type Getters interface {
+	GetFacts() (*Facts, error)
+	GetInterfaces() ([]Interface, error)
+	GetInterfaceCounters() ([]InterfaceCounters, error)
+	GetLLDPNeighbors() ([]LLDPNeighbor, error)
+	GetARPTable() ([]ARPEntry, error)
+	GetBGPNeighbors() ([]BGPNeighbor, error)
+}
+
+// New returns the getters of platform for a connected device. opts are
+// passed to every Execute, e.g. a longer timeout for devices with many
+// interfaces.
+func New(device service.DeviceService, platform config.Platform, opts ...repository.ExecuteOption) (Getters, error) {
+	r := runner{device: device, opts: opts}
+	switch platform {
+	case config.CISCO_IOSXR:
+		return &iosxr{r}, nil
+	case config.LINUX:
+		return &linux{r}, nil
+	}
+	return nil, fmt.Errorf("%w %v", ErrUnsupportedPlatform, platform)
+}
+
+type runner struct {
+	device service.DeviceService
+	opts   []repository.ExecuteOption
+}
+
+// run executes command and returns its output without the prompts and the
+// echoed command.
+func (r runner) run(command string) (string, error) {
+	path, err := r.device.Execute(command, r.opts...)
+	if err != nil {
+		return "", fmt.Errorf("running %q: %w", command, err)
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return repository.CommandOutput(command, output), nil
+}
+
+var (
+	// durationPart matches one unit of an uptime such as "2 weeks, 3 days".
+	durationPart = regexp.MustCompile(`(\d+)\s*(year|week|day|hour|minute|second)s?`)
+	// shortDuration matches the compact uptimes of BGP tables, such as
+	// "2w3d", "1d02h" and "1y5w".
+	shortDuration = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+)
+
+var units = map[string]time.Duration{
+	"year":   365 * 24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"day":    24 * time.Hour,
+	"hour":   time.Hour,
+	"minute": time.Minute,
+	"second": time.Second,
+}
+
+// parseUptime parses a spelled-out uptime, "2 weeks, 3 days, 4 hours".
+func parseUptime(text string) time.Duration {
+	var d time.Duration
+	for _, m := range durationPart.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.Atoi(m[1])
+		d += time.Duration(n) * units[m[2]]
+	}
+	return d
+}
+
+// parseShortDuration parses "hh:mm:ss" and compact durations such as
+// "2w3d". "never" and anything else it does not know are 0.
+func parseShortDuration(text string) time.Duration {
+	if parts := strings.Split(text, ":"); len(parts) == 3 {
+		var d time.Duration
+		for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil {
+				return 0
+			}
+			d += time.Duration(n) * unit
+		}
+		return d
+	}
+	m := shortDuration.FindStringSubmatch(text)
+	if m == nil || text == "" {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{units["year"], units["week"], units["day"], time.Hour, time.Minute, time.Second} {
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d
+}
+
+// parseASN parses an AS number in plain or asdot notation, "65000.10".
+func parseASN(text string) uint32 {
+	high, low, dotted := strings.Cut(text, ".")
+	if !dotted {
+		n, _ := strconv.ParseUint(text, 10, 32)
+		return uint32(n)
+	}
+	h, _ := strconv.ParseUint(high, 10, 16)
+	l, _ := strconv.ParseUint(low, 10, 16)
+	return uint32(h<<16 | l)
+}
+
+// normalizeMAC writes a MAC address in Cisco's dotted or colon notation as
+// six colon-separated lowercase pairs.
+func normalizeMAC(mac string) string {
+	hex := strings.ToLower(strings.NewReplacer(".", "", ":", "", "-", "").Replace(mac))
+	if len(hex) != 12 {
+		return strings.ToLower(mac)
+	}
+	pairs := make([]string, 6)
+	for i := range pairs {
+		pairs[i] = hex[2*i : 2*i+2]
+	}
+	return strings.Join(pairs, ":")
+}
+
+func atoi(text string) int {
+	n, _ := strconv.Atoi(text)
+	return n
+}
+
+func atou(text string) uint64 {
+	n, _ := strconv.ParseUint(text, 10, 64)
+	return n
+}
@@ -0,0 +1,267 @@
+package getters
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/devicetest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+// recordedDevice answers Execute with output recorded from a device, one
+// file in testdata/dir per command.
+func recordedDevice(t *testing.T, dir string, files map[string]string) *devicetest.Device {
+	paths := make(map[string]string, len(files))
+	for command, file := range files {
+		paths[command] = filepath.Join("testdata", dir, file)
+	}
+	return devicetest.WithFiles(t, paths)
+}
+
+func iosxrGetters(t *testing.T) Getters {
+	t.Helper()
+	g, err := New(recordedDevice(t, "iosxr", map[string]string{
+		"show version":                 "show_version.txt",
+		"show inventory":               "show_inventory.txt",
+		"show running-config hostname": "show_running-config_hostname.txt",
+		"show interfaces":              "show_interfaces.txt",
+		"show lldp neighbors":          "show_lldp_neighbors.txt",
+		"show arp":                     "show_arp.txt",
+		"show bgp summary":             "show_bgp_summary.txt",
+		"show bgp vrf all summary":     "show_bgp_vrf_all_summary.txt",
+	}), config.CISCO_IOSXR)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	return g
+}
+
+func linuxGetters(t *testing.T) Getters {
+	t.Helper()
+	g, err := New(recordedDevice(t, "linux", map[string]string{
+		"hostname":            "hostname.txt",
+		"cat /etc/os-release": "os-release.txt",
+		linuxDMI:              "dmi.txt",
+		"cat /proc/uptime":    "uptime.txt",
+		"ip -o link show":     "ip-link.txt",
+		linuxSpeed:            "speed.txt",
+		"cat /proc/net/dev":   "net-dev.txt",
+		"lldpctl -f keyvalue": "lldpctl.txt",
+		"ip neigh show":       "ip-neigh.txt",
+		linuxBGP:              "vtysh-bgp.txt",
+	}), config.LINUX)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	return g
+}
+
+func TestIosxrFactsAndInterfaces(t *testing.T) {
+	g := iosxrGetters(t)
+
+	facts, err := g.GetFacts()
+	if err != nil {
+		t.Fatalf("GetFacts returned error: %v", err)
+	}
+	want := &Facts{
+		Hostname:     "edge1",
+		Vendor:       "Cisco",
+		Model:        "ASR-9006-AC-V2",
+		SerialNumber: "FOX1234ABCD",
+		OSVersion:    "7.3.2",
+		Uptime:       17*24*time.Hour + 4*time.Hour + 5*time.Minute,
+		Interfaces:   []string{"Loopback0", "GigabitEthernet0/0/0/0", "GigabitEthernet0/0/0/1", "GigabitEthernet0/0/0/2"},
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Errorf("GetFacts = %+v, want %+v", facts, want)
+	}
+
+	interfaces, err := g.GetInterfaces()
+	if err != nil {
+		t.Fatalf("GetInterfaces returned error: %v", err)
+	}
+	wantInterfaces := []Interface{
+		{Name: "Loopback0", Description: "router-id", Enabled: true, Up: true, MTU: 1500},
+		{Name: "GigabitEthernet0/0/0/0", Description: "uplink to core", Enabled: true, Up: true, MACAddress: "00:11:22:33:44:55", MTU: 1514, Speed: 1000},
+		{Name: "GigabitEthernet0/0/0/1", MACAddress: "00:11:22:33:44:56", MTU: 1514, Speed: 1000},
+		{Name: "GigabitEthernet0/0/0/2", Description: "server1", Enabled: true, MACAddress: "00:11:22:33:44:57", MTU: 9216, Speed: 10000},
+	}
+	if !reflect.DeepEqual(interfaces, wantInterfaces) {
+		t.Errorf("GetInterfaces = %+v, want %+v", interfaces, wantInterfaces)
+	}
+
+	counters, err := g.GetInterfaceCounters()
+	if err != nil {
+		t.Fatalf("GetInterfaceCounters returned error: %v", err)
+	}
+	wantCounters := InterfaceCounters{
+		Interface: "GigabitEthernet0/0/0/0",
+		RxPackets: 1234567, RxBytes: 987654321, RxErrors: 3, RxDrops: 12, RxBroadcastPackets: 100, RxMulticastPackets: 2000,
+		TxPackets: 7654321, TxBytes: 123456789, TxBroadcastPackets: 50, TxMulticastPackets: 3000,
+	}
+	if len(counters) != 4 || counters[1] != wantCounters {
+		t.Errorf("GetInterfaceCounters = %+v, want %+v second", counters, wantCounters)
+	}
+}
+
+func TestIosxrNeighborTables(t *testing.T) {
+	g := iosxrGetters(t)
+
+	lldp, err := g.GetLLDPNeighbors()
+	if err != nil {
+		t.Fatalf("GetLLDPNeighbors returned error: %v", err)
+	}
+	wantLLDP := []LLDPNeighbor{
+		{LocalInterface: "GigabitEthernet0/0/0/0", Hostname: "core1.example.net", Port: "GigabitEthernet0/0/0/1"},
+		{LocalInterface: "GigabitEthernet0/0/0/2", Hostname: "server1", Port: "eth0"},
+	}
+	if !reflect.DeepEqual(lldp, wantLLDP) {
+		t.Errorf("GetLLDPNeighbors = %+v, want %+v", lldp, wantLLDP)
+	}
+
+	arp, err := g.GetARPTable()
+	if err != nil {
+		t.Fatalf("GetARPTable returned error: %v", err)
+	}
+	wantARP := []ARPEntry{
+		{Interface: "GigabitEthernet0/0/0/0", IP: "192.0.2.1", MAC: "00:11:22:33:44:55"},
+		{Interface: "GigabitEthernet0/0/0/0", IP: "192.0.2.2", MAC: "00:11:22:33:44:66", Age: 83 * time.Second},
+		{Interface: "MgmtEth0/RSP0/CPU0/0", IP: "198.51.100.1", MAC: "00:11:22:33:44:88", Age: time.Hour + 2*time.Minute + 3*time.Second},
+	}
+	if !reflect.DeepEqual(arp, wantARP) {
+		t.Errorf("GetARPTable = %+v, want %+v", arp, wantARP)
+	}
+
+	bgp, err := g.GetBGPNeighbors()
+	if err != nil {
+		t.Fatalf("GetBGPNeighbors returned error: %v", err)
+	}
+	wantBGP := []BGPNeighbor{
+		{VRF: "default", Address: "192.0.2.2", RemoteAS: 65001, LocalAS: 65000, RouterID: "10.255.0.1", State: "Established", Up: true, Uptime: 17 * 24 * time.Hour, PrefixesReceived: 10},
+		{VRF: "default", Address: "192.0.2.6", RemoteAS: 65002, LocalAS: 65000, RouterID: "10.255.0.1", State: "Idle"},
+		{VRF: "default", Address: "2001:db8:ffff::2", RemoteAS: 65003, LocalAS: 65000, RouterID: "10.255.0.1", State: "Established", Up: true, Uptime: 26 * time.Hour, PrefixesReceived: 4},
+		{VRF: "customer", Address: "198.51.100.2", RemoteAS: 65010, LocalAS: 65000, RouterID: "10.255.0.1", State: "Established", Up: true, Uptime: 41*time.Minute + 10*time.Second, PrefixesReceived: 3},
+	}
+	if !reflect.DeepEqual(bgp, wantBGP) {
+		t.Errorf("GetBGPNeighbors = %+v, want %+v", bgp, wantBGP)
+	}
+}
+
+func TestLinuxFactsAndInterfaces(t *testing.T) {
+	g := linuxGetters(t)
+
+	facts, err := g.GetFacts()
+	if err != nil {
+		t.Fatalf("GetFacts returned error: %v", err)
+	}
+	want := &Facts{
+		Hostname:     "server1",
+		Vendor:       "Dell Inc.",
+		Model:        "PowerEdge R640",
+		SerialNumber: "7XJ2K93",
+		OSVersion:    "Ubuntu 22.04.4 LTS",
+		Uptime:       1479903 * time.Second,
+		Interfaces:   []string{"lo", "eth0", "eth1", "eth0.10"},
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Errorf("GetFacts = %+v, want %+v", facts, want)
+	}
+
+	interfaces, err := g.GetInterfaces()
+	if err != nil {
+		t.Fatalf("GetInterfaces returned error: %v", err)
+	}
+	wantInterfaces := []Interface{
+		{Name: "lo", Enabled: true, Up: true, MTU: 65536},
+		{Name: "eth0", Enabled: true, Up: true, MACAddress: "52:54:00:12:34:56", MTU: 1500, Speed: 10000},
+		{Name: "eth1", Description: "storage network", MACAddress: "52:54:00:12:34:57", MTU: 9000},
+		{Name: "eth0.10", Enabled: true, MACAddress: "52:54:00:12:34:56", MTU: 1500},
+	}
+	if !reflect.DeepEqual(interfaces, wantInterfaces) {
+		t.Errorf("GetInterfaces = %+v, want %+v", interfaces, wantInterfaces)
+	}
+
+	counters, err := g.GetInterfaceCounters()
+	if err != nil {
+		t.Fatalf("GetInterfaceCounters returned error: %v", err)
+	}
+	wantCounters := InterfaceCounters{
+		Interface: "eth0.10",
+		RxPackets: 32, RxBytes: 4096, RxDrops: 1, RxMulticastPackets: 4,
+		TxPackets: 16, TxBytes: 2048,
+	}
+	if len(counters) != 4 || counters[3] != wantCounters {
+		t.Errorf("GetInterfaceCounters = %+v, want %+v last", counters, wantCounters)
+	}
+}
+
+func TestLinuxNeighborTables(t *testing.T) {
+	g := linuxGetters(t)
+
+	lldp, err := g.GetLLDPNeighbors()
+	if err != nil {
+		t.Fatalf("GetLLDPNeighbors returned error: %v", err)
+	}
+	wantLLDP := []LLDPNeighbor{
+		{LocalInterface: "eth0", Hostname: "edge1", Port: "GigabitEthernet0/0/0/2"},
+		{LocalInterface: "eth1", Port: "52:54:00:aa:bb:cd"},
+	}
+	if !reflect.DeepEqual(lldp, wantLLDP) {
+		t.Errorf("GetLLDPNeighbors = %+v, want %+v", lldp, wantLLDP)
+	}
+
+	arp, err := g.GetARPTable()
+	if err != nil {
+		t.Fatalf("GetARPTable returned error: %v", err)
+	}
+	wantARP := []ARPEntry{
+		{Interface: "eth0", IP: "192.0.2.1", MAC: "00:11:22:33:44:57"},
+		{Interface: "eth1", IP: "203.0.113.5", MAC: "52:54:00:aa:bb:cd"},
+	}
+	if !reflect.DeepEqual(arp, wantARP) {
+		t.Errorf("GetARPTable = %+v, want %+v", arp, wantARP)
+	}
+
+	bgp, err := g.GetBGPNeighbors()
+	if err != nil {
+		t.Fatalf("GetBGPNeighbors returned error: %v", err)
+	}
+	wantBGP := []BGPNeighbor{
+		{VRF: "default", Address: "192.0.2.1", RemoteAS: 65000, LocalAS: 65100, RouterID: "10.0.0.10", State: "Established", Up: true, Uptime: 25*time.Hour + 12*time.Minute, PrefixesReceived: 16},
+		{VRF: "default", Address: "192.0.2.13", RemoteAS: 65200, LocalAS: 65100, RouterID: "10.0.0.10", State: "Active"},
+		{VRF: "tenant", Address: "198.51.100.9", RemoteAS: 65300, LocalAS: 65100, RouterID: "10.0.0.10", State: "Established", Up: true, Uptime: 5 * time.Minute, PrefixesReceived: 1},
+	}
+	if !reflect.DeepEqual(bgp, wantBGP) {
+		t.Errorf("GetBGPNeighbors = %+v, want %+v", bgp, wantBGP)
+	}
+}
+
+func TestNewRejectsUnsupportedPlatform(t *testing.T) {
+	if _, err := New(devicetest.New(t, ""), config.CISCO_NXOS); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Fatalf("New(CISCO_NXOS) error = %v, want ErrUnsupportedPlatform", err)
+	}
+}
+
+func TestParseDurationsAndASNs(t *testing.T) {
+	for text, want := range map[string]time.Duration{
+		"2w3d":     17 * 24 * time.Hour,
+		"1d02h":    26 * time.Hour,
+		"1y5w":     (365 + 35) * 24 * time.Hour,
+		"00:41:10": 41*time.Minute + 10*time.Second,
+		"never":    0,
+		"-":        0,
+	} {
+		if got := parseShortDuration(text); got != want {
+			t.Errorf("parseShortDuration(%q) = %v, want %v", text, got, want)
+		}
+	}
+	if got, want := parseUptime("1 year, 2 weeks, 1 day, 3 hours, 1 minute"), (365+15)*24*time.Hour+3*time.Hour+time.Minute; got != want {
+		t.Errorf("parseUptime = %v, want %v", got, want)
+	}
+	if got := parseASN("1.10"); got != 65546 {
+		t.Errorf("parseASN(1.10) = %d, want 65546", got)
+	}
+}
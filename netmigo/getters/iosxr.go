@@ -0,0 +1,263 @@
+package getters
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jonelmawirat/netmigo/netmigo/textfsm"
+)
+
+//go:embed templates/*.textfsm
+var templateFiles embed.FS
+
+var (
+	templatesOnce sync.Once
+	templates     map[string]*textfsm.Template
+	templatesErr  error
+)
+
+// parseTable parses output with the embedded template name.
+func parseTable(name, output string) ([]map[string]any, error) {
+	templatesOnce.Do(func() {
+		templates = make(map[string]*textfsm.Template)
+		entries, err := templateFiles.ReadDir("templates")
+		if err != nil {
+			templatesErr = err
+			return
+		}
+		for _, entry := range entries {
+			f, err := templateFiles.Open("templates/" + entry.Name())
+			if err != nil {
+				templatesErr = err
+				return
+			}
+			t, err := textfsm.ParseTemplate(entry.Name(), f)
+			f.Close()
+			if err != nil {
+				templatesErr = err
+				return
+			}
+			templates[strings.TrimSuffix(entry.Name(), ".textfsm")] = t
+		}
+	})
+	if templatesErr != nil {
+		return nil, templatesErr
+	}
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", textfsm.ErrNoTemplate, name)
+	}
+	return t.Parse(output)
+}
+
+func field(record map[string]any, key string) string {
+	s, _ := record[key].(string)
+	return s
+}
+
+var (
+	xrVersion  = regexp.MustCompile(`(?m)^Cisco IOS XR Software, Version\s+([^\s\[]+)`)
+	xrUptime   = regexp.MustCompile(`(?m)uptime is (.*)$`)
+	xrPID      = regexp.MustCompile(`(?m)^PID:\s*([^,]*?)\s*,.*SN:\s*(\S*)`)
+	xrHostname = regexp.MustCompile(`(?m)^hostname\s+(\S+)`)
+)
+
+// iosxr reads facts from IOS-XR with show commands, parsing tables with
+// the embedded TextFSM templates.
+type iosxr struct {
+	runner
+}
+
+func (x *iosxr) GetFacts() (*Facts, error) {
+	version, err := x.run("show version")
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := x.run("show inventory")
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := x.run("show running-config hostname")
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := x.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	facts := &Facts{Vendor: "Cisco"}
+	if m := xrVersion.FindStringSubmatch(version); m != nil {
+		facts.OSVersion = m[1]
+	}
+	if m := xrUptime.FindStringSubmatch(version); m != nil {
+		facts.Uptime = parseUptime(m[1])
+	}
+	// The chassis comes first in show inventory.
+	if m := xrPID.FindStringSubmatch(inventory); m != nil {
+		facts.Model, facts.SerialNumber = m[1], m[2]
+	}
+	if m := xrHostname.FindStringSubmatch(hostname); m != nil {
+		facts.Hostname = m[1]
+	}
+	for _, iface := range interfaces {
+		facts.Interfaces = append(facts.Interfaces, iface.Name)
+	}
+	return facts, nil
+}
+
+func (x *iosxr) showInterfaces() ([]map[string]any, error) {
+	output, err := x.run("show interfaces")
+	if err != nil {
+		return nil, err
+	}
+	return parseTable("cisco_xr_show_interfaces", output)
+}
+
+func (x *iosxr) GetInterfaces() ([]Interface, error) {
+	records, err := x.showInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	interfaces := make([]Interface, 0, len(records))
+	for _, r := range records {
+		iface := Interface{
+			Name:        field(r, "interface"),
+			Description: field(r, "description"),
+			Enabled:     field(r, "admin_state") == "up",
+			Up:          field(r, "line_protocol") == "up",
+			MTU:         atoi(field(r, "mtu")),
+			Speed:       atoi(field(r, "bandwidth")) / 1000,
+		}
+		if mac := field(r, "mac_address"); mac != "" {
+			iface.MACAddress = normalizeMAC(mac)
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+func (x *iosxr) GetInterfaceCounters() ([]InterfaceCounters, error) {
+	records, err := x.showInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	counters := make([]InterfaceCounters, 0, len(records))
+	for _, r := range records {
+		counters = append(counters, InterfaceCounters{
+			Interface:          field(r, "interface"),
+			RxPackets:          atou(field(r, "input_packets")),
+			RxBytes:            atou(field(r, "input_bytes")),
+			RxErrors:           atou(field(r, "input_errors")),
+			RxDrops:            atou(field(r, "input_drops")),
+			RxBroadcastPackets: atou(field(r, "input_broadcast")),
+			RxMulticastPackets: atou(field(r, "input_multicast")),
+			TxPackets:          atou(field(r, "output_packets")),
+			TxBytes:            atou(field(r, "output_bytes")),
+			TxErrors:           atou(field(r, "output_errors")),
+			TxDrops:            atou(field(r, "output_drops")),
+			TxBroadcastPackets: atou(field(r, "output_broadcast")),
+			TxMulticastPackets: atou(field(r, "output_multicast")),
+		})
+	}
+	return counters, nil
+}
+
+func (x *iosxr) GetLLDPNeighbors() ([]LLDPNeighbor, error) {
+	output, err := x.run("show lldp neighbors")
+	if err != nil {
+		return nil, err
+	}
+	records, err := parseTable("cisco_xr_show_lldp_neighbors", output)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := make([]LLDPNeighbor, 0, len(records))
+	for _, r := range records {
+		neighbors = append(neighbors, LLDPNeighbor{
+			LocalInterface: field(r, "local_interface"),
+			Hostname:       field(r, "neighbor"),
+			Port:           field(r, "neighbor_interface"),
+		})
+	}
+	return neighbors, nil
+}
+
+// GetARPTable lists the ARP entries of all line cards. An entry that more
+// than one line card holds is listed once.
+func (x *iosxr) GetARPTable() ([]ARPEntry, error) {
+	output, err := x.run("show arp")
+	if err != nil {
+		return nil, err
+	}
+	records, err := parseTable("cisco_xr_show_arp", output)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ARPEntry, 0, len(records))
+	seen := make(map[ARPEntry]bool)
+	for _, r := range records {
+		entry := ARPEntry{
+			Interface: field(r, "interface"),
+			IP:        field(r, "address"),
+			MAC:       normalizeMAC(field(r, "mac_address")),
+		}
+		key := entry
+		entry.Age = parseShortDuration(field(r, "age"))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetBGPNeighbors lists the neighbors of the default VRF and then those of
+// the other VRFs.
+func (x *iosxr) GetBGPNeighbors() ([]BGPNeighbor, error) {
+	var neighbors []BGPNeighbor
+	seen := make(map[string]bool)
+	for _, command := range []string{"show bgp summary", "show bgp vrf all summary"} {
+		output, err := x.run(command)
+		if err != nil {
+			return nil, err
+		}
+		records, err := parseTable("cisco_xr_show_bgp_summary", output)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			n := BGPNeighbor{
+				VRF:      field(r, "vrf"),
+				Address:  field(r, "neighbor"),
+				RemoteAS: parseASN(field(r, "remote_as")),
+				LocalAS:  parseASN(field(r, "local_as")),
+				RouterID: field(r, "router_id"),
+				Uptime:   parseShortDuration(field(r, "up_down")),
+			}
+			if n.VRF == "" {
+				n.VRF = "default"
+			}
+			if seen[n.VRF+" "+n.Address] {
+				continue
+			}
+			seen[n.VRF+" "+n.Address] = true
+			// St/PfxRcd holds the number of prefixes received once the
+			// session is established and the state before that.
+			state := field(r, "state_pfxrcd")
+			if prefixes, err := strconv.Atoi(state); err == nil {
+				n.State, n.Up, n.PrefixesReceived = "Established", true, prefixes
+			} else {
+				n.State, _, _ = strings.Cut(state, " ")
+				n.Uptime = 0
+			}
+			neighbors = append(neighbors, n)
+		}
+	}
+	return neighbors, nil
+}
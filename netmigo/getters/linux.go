@@ -0,0 +1,346 @@
+package getters
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	linuxDMI   = "grep -s . /sys/class/dmi/id/sys_vendor /sys/class/dmi/id/product_name /sys/class/dmi/id/product_serial"
+	linuxSpeed = "grep -s . /sys/class/net/*/speed"
+	linuxBGP   = "vtysh -c 'show bgp vrf all summary json'"
+)
+
+// linux reads facts from /proc, /sys and iproute2. LLDP neighbors come
+// from lldpd and BGP neighbors from FRR.
+type linux struct {
+	runner
+}
+
+func (l *linux) GetFacts() (*Facts, error) {
+	hostname, err := l.run("hostname")
+	if err != nil {
+		return nil, err
+	}
+	osRelease, err := l.run("cat /etc/os-release")
+	if err != nil {
+		return nil, err
+	}
+	// Reading the serial number needs root, so any of these may be
+	// missing.
+	dmi, err := l.run(linuxDMI)
+	if err != nil {
+		return nil, err
+	}
+	uptime, err := l.run("cat /proc/uptime")
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := l.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	facts := &Facts{Hostname: strings.TrimSpace(hostname)}
+	for _, line := range strings.Split(osRelease, "\n") {
+		if value, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+			facts.OSVersion = strings.Trim(value, `"'`)
+		}
+	}
+	for file, value := range fileValues(dmi) {
+		switch file {
+		case "sys_vendor":
+			facts.Vendor = value
+		case "product_name":
+			facts.Model = value
+		case "product_serial":
+			facts.SerialNumber = value
+		}
+	}
+	if fields := strings.Fields(uptime); len(fields) > 0 {
+		if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			facts.Uptime = time.Duration(seconds) * time.Second
+		}
+	}
+	for _, iface := range interfaces {
+		facts.Interfaces = append(facts.Interfaces, iface.Name)
+	}
+	return facts, nil
+}
+
+// fileValues reads the "path:value" lines grep prints for several files,
+// keyed by the last element of the path.
+func fileValues(output string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		file, value, ok := strings.Cut(line, ":")
+		if ok {
+			values[path.Base(file)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// GetInterfaces lists the links of ip -o link show. Enabled is the UP
+// flag and Up the LOWER_UP flag; Speed comes from /sys/class/net.
+func (l *linux) GetInterfaces() ([]Interface, error) {
+	links, err := l.run("ip -o link show")
+	if err != nil {
+		return nil, err
+	}
+	speeds, err := l.run(linuxSpeed)
+	if err != nil {
+		return nil, err
+	}
+	speedByName := make(map[string]int)
+	for _, line := range strings.Split(speeds, "\n") {
+		file, value, ok := strings.Cut(line, ":")
+		if speed := atoi(strings.TrimSpace(value)); ok && speed > 0 {
+			speedByName[path.Base(path.Dir(file))] = speed
+		}
+	}
+
+	var interfaces []Interface
+	for _, line := range strings.Split(links, "\n") {
+		// ip -o prints each link on one line, with a backslash where the
+		// details would start a new line.
+		parts := strings.Split(line, `\`)
+		fields := strings.Fields(parts[0])
+		if len(fields) < 3 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimSuffix(fields[1], ":"), "@")
+		flags := strings.Split(strings.Trim(fields[2], "<>"), ",")
+		iface := Interface{
+			Name:    name,
+			Enabled: slices.Contains(flags, "UP"),
+			Up:      slices.Contains(flags, "LOWER_UP"),
+			Speed:   speedByName[name],
+		}
+		for i := 3; i+1 < len(fields); i++ {
+			if fields[i] == "mtu" {
+				iface.MTU = atoi(fields[i+1])
+			}
+		}
+		for _, part := range parts[1:] {
+			part = strings.TrimSpace(part)
+			if mac, ok := strings.CutPrefix(part, "link/ether "); ok {
+				iface.MACAddress = normalizeMAC(strings.Fields(mac)[0])
+			}
+			if alias, ok := strings.CutPrefix(part, "alias "); ok {
+				iface.Description = alias
+			}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// GetInterfaceCounters reads /proc/net/dev, which has no broadcast
+// counters and only counts multicast packets received.
+func (l *linux) GetInterfaceCounters() ([]InterfaceCounters, error) {
+	output, err := l.run("cat /proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	var counters []InterfaceCounters
+	for _, line := range strings.Split(output, "\n") {
+		name, values, ok := strings.Cut(line, ":")
+		fields := strings.Fields(values)
+		if !ok || strings.Contains(name, "|") || len(fields) < 16 {
+			continue
+		}
+		counters = append(counters, InterfaceCounters{
+			Interface:          strings.TrimSpace(name),
+			RxBytes:            atou(fields[0]),
+			RxPackets:          atou(fields[1]),
+			RxErrors:           atou(fields[2]),
+			RxDrops:            atou(fields[3]),
+			RxMulticastPackets: atou(fields[7]),
+			TxBytes:            atou(fields[8]),
+			TxPackets:          atou(fields[9]),
+			TxErrors:           atou(fields[10]),
+			TxDrops:            atou(fields[11]),
+		})
+	}
+	return counters, nil
+}
+
+// GetLLDPNeighbors asks lldpd. A neighbor that does not send its port name
+// is listed with its port's MAC address.
+func (l *linux) GetLLDPNeighbors() ([]LLDPNeighbor, error) {
+	output, err := l.run("lldpctl -f keyvalue")
+	if err != nil {
+		return nil, err
+	}
+	// Every line is lldp.<local interface>.<attribute>=<value>.
+	var locals []string
+	attributes := make(map[string]map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		rest, isLLDP := strings.CutPrefix(key, "lldp.")
+		if !ok || !isLLDP {
+			continue
+		}
+		local, attribute, ok := strings.Cut(rest, ".")
+		if !ok {
+			continue
+		}
+		if attributes[local] == nil {
+			locals = append(locals, local)
+			attributes[local] = make(map[string]string)
+		}
+		attributes[local][attribute] = value
+	}
+	neighbors := make([]LLDPNeighbor, 0, len(locals))
+	for _, local := range locals {
+		neighbor := LLDPNeighbor{LocalInterface: local, Hostname: attributes[local]["chassis.name"]}
+		for _, key := range []string{"port.ifname", "port.local", "port.mac"} {
+			if port := attributes[local][key]; port != "" {
+				neighbor.Port = port
+				break
+			}
+		}
+		neighbors = append(neighbors, neighbor)
+	}
+	return neighbors, nil
+}
+
+// GetARPTable lists the IPv4 entries of ip neigh show that have a MAC
+// address. The kernel does not report their age.
+func (l *linux) GetARPTable() ([]ARPEntry, error) {
+	output, err := l.run("ip neigh show")
+	if err != nil {
+		return nil, err
+	}
+	var entries []ARPEntry
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.Contains(fields[0], ":") {
+			continue
+		}
+		entry := ARPEntry{IP: fields[0]}
+		for i := 1; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "dev":
+				entry.Interface = fields[i+1]
+			case "lladdr":
+				entry.MAC = normalizeMAC(fields[i+1])
+			}
+		}
+		if entry.MAC != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type frrPeer struct {
+	RemoteAS       uint32 `json:"remoteAs"`
+	LocalAS        uint32 `json:"localAs"`
+	State          string `json:"state"`
+	PeerUptimeMsec int64  `json:"peerUptimeMsec"`
+	PfxRcd         int    `json:"pfxRcd"`
+}
+
+type frrAddressFamily struct {
+	RouterID string             `json:"routerId"`
+	AS       uint32             `json:"as"`
+	Peers    map[string]frrPeer `json:"peers"`
+}
+
+// GetBGPNeighbors asks FRR for the neighbors of all VRFs, the default VRF
+// first and then the others by name, each sorted by address. A neighbor
+// with several address families is listed once, with the prefixes
+// received in all of them.
+func (l *linux) GetBGPNeighbors() ([]BGPNeighbor, error) {
+	output, err := l.run(linuxBGP)
+	if err != nil {
+		return nil, err
+	}
+	var vrfs map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(output), &vrfs); err != nil {
+		return nil, fmt.Errorf("parsing output of %q: %w", linuxBGP, err)
+	}
+	names := make([]string, 0, len(vrfs))
+	for name := range vrfs {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if a == "default" || b == "default" {
+			return compareBool(a != "default", b != "default")
+		}
+		return strings.Compare(a, b)
+	})
+
+	var neighbors []BGPNeighbor
+	for _, vrf := range names {
+		byAddress := make(map[string]*BGPNeighbor)
+		var addresses []string
+		for _, raw := range vrfs[vrf] {
+			var family frrAddressFamily
+			if json.Unmarshal(raw, &family) != nil {
+				continue
+			}
+			for address, peer := range family.Peers {
+				n, ok := byAddress[address]
+				if !ok {
+					n = &BGPNeighbor{
+						VRF:      vrf,
+						Address:  address,
+						RemoteAS: peer.RemoteAS,
+						LocalAS:  peer.LocalAS,
+						RouterID: family.RouterID,
+						State:    peer.State,
+						Up:       peer.State == "Established",
+					}
+					if n.LocalAS == 0 {
+						n.LocalAS = family.AS
+					}
+					if n.Up {
+						n.Uptime = time.Duration(peer.PeerUptimeMsec) * time.Millisecond
+					}
+					byAddress[address] = n
+					addresses = append(addresses, address)
+				}
+				n.PrefixesReceived += peer.PfxRcd
+			}
+		}
+		slices.SortFunc(addresses, compareAddresses)
+		for _, address := range addresses {
+			neighbors = append(neighbors, *byAddress[address])
+		}
+	}
+	return neighbors, nil
+}
+
+// compareAddresses orders IP addresses numerically and anything else,
+// such as FRR's interface neighbors, after them by name.
+func compareAddresses(a, b string) int {
+	x, errA := netip.ParseAddr(a)
+	y, errB := netip.ParseAddr(b)
+	if errA != nil || errB != nil {
+		if c := compareBool(errA != nil, errB != nil); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+	return x.Compare(y)
+}
+
+// compareBool orders false before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
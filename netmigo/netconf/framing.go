@@ -0,0 +1,153 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// endOfMessage terminates NETCONF 1.0 messages and every hello (RFC 6242
+// section 4.1).
+const endOfMessage = "]]>]]>"
+
+// maxChunkSize is the largest chunk RFC 6242 section 4.2 allows.
+const maxChunkSize = 4294967295
+
+var errBadChunk = errors.New("netconf: malformed chunked framing")
+
+// framer reads and writes whole NETCONF messages, delimited by ]]>]]> or,
+// once both peers advertise base:1.1, by chunked framing.
+type framer struct {
+	r       *bufio.Reader
+	w       io.Writer
+	wmu     sync.Mutex
+	chunked bool
+}
+
+func newFramer(r io.Reader, w io.Writer) *framer {
+	return &framer{r: bufio.NewReader(r), w: w}
+}
+
+func (f *framer) readMessage() ([]byte, error) {
+	if f.chunked {
+		return f.readChunked()
+	}
+	return f.readDelimited()
+}
+
+func (f *framer) readDelimited() ([]byte, error) {
+	var msg []byte
+	for {
+		part, err := f.r.ReadBytes('>')
+		msg = append(msg, part...)
+		if bytes.HasSuffix(msg, []byte(endOfMessage)) {
+			return bytes.TrimSpace(msg[:len(msg)-len(endOfMessage)]), nil
+		}
+		if err != nil {
+			if err == io.EOF && len(bytes.TrimSpace(msg)) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// readChunked reads a chunked message. Chunks are copied as they arrive
+// rather than allocated up front, since the size is the peer's claim.
+func (f *framer) readChunked() ([]byte, error) {
+	var msg bytes.Buffer
+	started := false
+	for {
+		if err := f.expect("\n#"); err != nil {
+			if err == io.EOF && !started {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		b, err := f.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == '#' {
+			if err := f.expect("\n"); err != nil {
+				return nil, err
+			}
+			return msg.Bytes(), nil
+		}
+		started = true
+		size, err := f.chunkSize(b)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(&msg, f.r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// chunkSize reads the decimal chunk size that starts with first, up to and
+// including the line feed after it.
+func (f *framer) chunkSize(first byte) (int, error) {
+	digits := []byte{first}
+	for {
+		b, err := f.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b == '\n' {
+			break
+		}
+		digits = append(digits, b)
+		if len(digits) > 10 {
+			return 0, errBadChunk
+		}
+	}
+	if digits[0] < '1' || digits[0] > '9' {
+		return 0, fmt.Errorf("%w: chunk size %q", errBadChunk, digits)
+	}
+	size, err := strconv.ParseUint(string(digits), 10, 64)
+	if err != nil || size > maxChunkSize {
+		return 0, fmt.Errorf("%w: chunk size %q", errBadChunk, digits)
+	}
+	return int(size), nil
+}
+
+func (f *framer) expect(s string) error {
+	for i := 0; i < len(s); i++ {
+		b, err := f.r.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if b != s[i] {
+			return fmt.Errorf("%w: got %q, want %q", errBadChunk, b, s[i])
+		}
+	}
+	return nil
+}
+
+func (f *framer) writeMessage(msg []byte) error {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+
+	var buf bytes.Buffer
+	if f.chunked {
+		fmt.Fprintf(&buf, "\n#%d\n", len(msg))
+		buf.Write(msg)
+		buf.WriteString("\n##\n")
+	} else {
+		buf.Write(msg)
+		buf.WriteString(endOfMessage)
+	}
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
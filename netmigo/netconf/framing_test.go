@@ -0,0 +1,86 @@
+package netconf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFramerReadsEndOfMessageFraming(t *testing.T) {
+	f := newFramer(strings.NewReader("<a>]]></a>\n]]>]]>\n<b/>]]>]]>"), io.Discard)
+
+	for _, want := range []string{"<a>]]></a>", "<b/>"} {
+		msg, err := f.readMessage()
+		if err != nil {
+			t.Fatalf("readMessage returned error: %v", err)
+		}
+		if string(msg) != want {
+			t.Fatalf("message = %q, want %q", msg, want)
+		}
+	}
+	if _, err := f.readMessage(); err != io.EOF {
+		t.Fatalf("readMessage at end = %v, want EOF", err)
+	}
+}
+
+func TestFramerReadsChunkedFraming(t *testing.T) {
+	f := newFramer(strings.NewReader("\n#4\n<rpc\n#17\n message-id=\"1\"/>\n##\n\n#5\n<ok/>\n##\n"), io.Discard)
+	f.chunked = true
+
+	for _, want := range []string{`<rpc message-id="1"/>`, "<ok/>"} {
+		msg, err := f.readMessage()
+		if err != nil {
+			t.Fatalf("readMessage returned error: %v", err)
+		}
+		if string(msg) != want {
+			t.Fatalf("message = %q, want %q", msg, want)
+		}
+	}
+}
+
+func TestFramerRejectsMalformedChunks(t *testing.T) {
+	for _, input := range []string{
+		"\n#0\n\n##\n",
+		"\n#abc\n<ok/>\n##\n",
+		"\n#01\nx\n##\n",
+		"#5\n<ok/>\n##\n",
+	} {
+		f := newFramer(strings.NewReader(input), io.Discard)
+		f.chunked = true
+		if _, err := f.readMessage(); !errors.Is(err, errBadChunk) {
+			t.Errorf("readMessage(%q) error = %v, want errBadChunk", input, err)
+		}
+	}
+}
+
+func TestFramerDoesNotTrustChunkSize(t *testing.T) {
+	f := newFramer(strings.NewReader("\n#4294967295\n<rpc-reply/>"), io.Discard)
+	f.chunked = true
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := f.readMessage()
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("readMessage error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("allocated %d bytes for a 12 byte chunk", allocated)
+	}
+}
+
+func TestFramerWritesBothFramings(t *testing.T) {
+	var out bytes.Buffer
+	f := newFramer(strings.NewReader(""), &out)
+
+	f.writeMessage([]byte("<hello/>"))
+	f.chunked = true
+	f.writeMessage([]byte("<rpc/>"))
+
+	if want := "<hello/>]]>]]>\n#6\n<rpc/>\n##\n"; out.String() != want {
+		t.Fatalf("written = %q, want %q", out.String(), want)
+	}
+}
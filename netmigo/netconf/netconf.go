@@ -0,0 +1,456 @@
+// Package netconf is a NETCONF client (RFC 6241) over the SSH "netconf"
+// subsystem (RFC 6242). It connects through the same connector as the CLI
+// devices, so credentials, jump servers and proxy transports all apply.
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+// Capability URIs used by this package.
+const (
+	CapBase10       = "urn:ietf:params:netconf:base:1.0"
+	CapBase11       = "urn:ietf:params:netconf:base:1.1"
+	CapCandidate    = "urn:ietf:params:netconf:capability:candidate:1.0"
+	CapValidate     = "urn:ietf:params:netconf:capability:validate:1.1"
+	CapNotification = "urn:ietf:params:netconf:capability:notification:1.0"
+)
+
+const (
+	baseNamespace         = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	notificationNamespace = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+
+	closeSessionTimeout = 5 * time.Second
+)
+
+// ErrClosed is returned by calls on a session that has ended.
+var ErrClosed = errors.New("netconf session closed")
+
+// Session is a NETCONF session. RPCs may be issued from several goroutines;
+// replies are matched to requests by message-id.
+type Session struct {
+	logger     *slog.Logger
+	framer     *framer
+	close      func() error
+	id         uint64
+	serverCaps []string
+	chunked    bool
+	nextID     atomic.Uint64
+
+	mu            sync.Mutex
+	pending       map[string]chan *Reply
+	notifications chan Notification
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+type options struct {
+	repoOpts     []repository.RepositoryOption
+	capabilities []string
+}
+
+// Option configures Dial.
+type Option func(*options)
+
+// WithRepositoryOptions passes options, such as a shared jump client
+// manager, to the SSH connector.
+func WithRepositoryOptions(opts ...repository.RepositoryOption) Option {
+	return func(o *options) {
+		o.repoOpts = append(o.repoOpts, opts...)
+	}
+}
+
+// WithCapabilities advertises capabilities in the client hello in addition
+// to base:1.0 and base:1.1.
+func WithCapabilities(capabilities ...string) Option {
+	return func(o *options) {
+		o.capabilities = append(o.capabilities, capabilities...)
+	}
+}
+
+// Dial connects to cfg, starts the netconf subsystem and exchanges hellos.
+// NETCONF usually listens on port 830, so set config.WithPort("830") unless
+// the device serves the subsystem on 22. ctx bounds the connect and the
+// hello exchange.
+func Dial(ctx context.Context, logger *slog.Logger, cfg *config.DeviceConfig, opts ...Option) (*Session, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	repo := repository.NewSSHRepository(logger, o.repoOpts...)
+	client, err := repo.(repository.ContextConnector).ConnectContext(ctx, *cfg)
+	if err != nil {
+		return nil, err
+	}
+	disconnect := func() { repo.Disconnect(client, cfg.JumpServer) }
+
+	session, stdout, stdin, err := startSubsystem(client)
+	if err != nil {
+		disconnect()
+		return nil, err
+	}
+	closeFunc := func() error {
+		err := session.Close()
+		disconnect()
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return err
+	}
+	s, err := newSession(ctx, logger, stdout, stdin, closeFunc, o.capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("netconf hello with %s: %w", cfg.IP, err)
+	}
+	return s, nil
+}
+
+func startSubsystem(client *ssh.Client) (*ssh.Session, io.Reader, io.Writer, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, nil, fmt.Errorf("failed to obtain stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, nil, fmt.Errorf("failed to obtain stdout pipe: %w", err)
+	}
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		session.Close()
+		return nil, nil, nil, fmt.Errorf("failed to start netconf subsystem: %w", err)
+	}
+	return session, stdout, stdin, nil
+}
+
+type hello struct {
+	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    uint64   `xml:"session-id,omitempty"`
+}
+
+// newSession exchanges hellos over r and w and starts reading replies.
+// closeFunc is called once when the session ends.
+func newSession(ctx context.Context, logger *slog.Logger, r io.Reader, w io.Writer, closeFunc func() error, capabilities []string) (*Session, error) {
+	s := &Session{
+		logger:  logger,
+		framer:  newFramer(r, w),
+		close:   closeFunc,
+		pending: make(map[string]chan *Reply),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ours := append([]string{CapBase10, CapBase11}, capabilities...)
+	msg, err := xml.Marshal(hello{Capabilities: ours})
+	if err != nil {
+		closeFunc()
+		return nil, err
+	}
+	if err := s.framer.writeMessage(append([]byte(xml.Header), msg...)); err != nil {
+		closeFunc()
+		return nil, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	type result struct {
+		hello hello
+		err   error
+	}
+	received := make(chan result, 1)
+	go func() {
+		var res result
+		msg, err := s.framer.readMessage()
+		if err != nil {
+			res.err = fmt.Errorf("failed to read hello: %w", err)
+		} else if err := xml.Unmarshal(msg, &res.hello); err != nil {
+			res.err = fmt.Errorf("malformed hello: %w", err)
+		}
+		received <- res
+	}()
+	var theirs hello
+	select {
+	case res := <-received:
+		if res.err != nil {
+			closeFunc()
+			return nil, res.err
+		}
+		theirs = res.hello
+	case <-ctx.Done():
+		closeFunc()
+		return nil, ctx.Err()
+	}
+
+	for _, capability := range theirs.Capabilities {
+		s.serverCaps = append(s.serverCaps, strings.TrimSpace(capability))
+	}
+	s.id = theirs.SessionID
+	if !s.HasCapability(CapBase10) && !s.HasCapability(CapBase11) {
+		closeFunc()
+		return nil, errors.New("server does not support NETCONF base:1.0 or base:1.1")
+	}
+	s.chunked = s.HasCapability(CapBase11)
+	s.framer.chunked = s.chunked
+
+	version := "1.0"
+	if s.chunked {
+		version = "1.1"
+	}
+	logger.Info("NETCONF session established", "sessionID", s.id, "base", version)
+	go s.readLoop()
+	return s, nil
+}
+
+// SessionID returns the session-id the server assigned in its hello.
+func (s *Session) SessionID() uint64 {
+	return s.id
+}
+
+// Capabilities returns the capabilities the server advertised.
+func (s *Session) Capabilities() []string {
+	return append([]string(nil), s.serverCaps...)
+}
+
+// HasCapability reports whether the server advertised uri, ignoring any
+// query parameters such as ?module=.
+func (s *Session) HasCapability(uri string) bool {
+	for _, capability := range s.serverCaps {
+		if capability == uri || strings.HasPrefix(capability, uri+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply is an rpc-reply. Data holds the contents of <data> for get and
+// get-config; Errors holds every rpc-error, including warnings.
+type Reply struct {
+	MessageID string
+	OK        bool
+	Data      []byte
+	Errors    []RPCError
+	Raw       []byte
+}
+
+// RPCError is an rpc-error from the server. Info holds the contents of
+// error-info as XML.
+type RPCError struct {
+	Type     string
+	Tag      string
+	Severity string
+	AppTag   string
+	Path     string
+	Message  string
+	Info     string
+}
+
+func (e *RPCError) Error() string {
+	msg := fmt.Sprintf("netconf rpc-error: %s %s", e.Type, e.Tag)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Path != "" {
+		msg += " (path " + e.Path + ")"
+	}
+	return msg
+}
+
+type rawReply struct {
+	MessageID string    `xml:"message-id,attr"`
+	OK        *struct{} `xml:"ok"`
+	Data      *struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"data"`
+	Errors []struct {
+		Type     string `xml:"error-type"`
+		Tag      string `xml:"error-tag"`
+		Severity string `xml:"error-severity"`
+		AppTag   string `xml:"error-app-tag"`
+		Path     string `xml:"error-path"`
+		Message  string `xml:"error-message"`
+		Info     struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"error-info"`
+	} `xml:"rpc-error"`
+}
+
+func parseReply(msg []byte) (*Reply, error) {
+	var raw rawReply
+	if err := xml.Unmarshal(msg, &raw); err != nil {
+		return nil, err
+	}
+	reply := &Reply{MessageID: raw.MessageID, OK: raw.OK != nil, Raw: msg}
+	if raw.Data != nil {
+		reply.Data = bytes.TrimSpace(raw.Data.Inner)
+	}
+	for _, e := range raw.Errors {
+		reply.Errors = append(reply.Errors, RPCError{
+			Type:     strings.TrimSpace(e.Type),
+			Tag:      strings.TrimSpace(e.Tag),
+			Severity: strings.TrimSpace(e.Severity),
+			AppTag:   strings.TrimSpace(e.AppTag),
+			Path:     strings.TrimSpace(e.Path),
+			Message:  strings.TrimSpace(e.Message),
+			Info:     strings.TrimSpace(e.Info.Inner),
+		})
+	}
+	return reply, nil
+}
+
+// Err returns the first rpc-error with severity error, or nil when the
+// reply only carries warnings.
+func (r *Reply) Err() error {
+	for i := range r.Errors {
+		if r.Errors[i].Severity != "warning" {
+			return &r.Errors[i]
+		}
+	}
+	return nil
+}
+
+// Call sends operation, the XML inside <rpc>, and waits for its reply. An
+// rpc-error is returned as a *RPCError alongside the reply.
+func (s *Session) Call(ctx context.Context, operation string) (*Reply, error) {
+	id := strconv.FormatUint(s.nextID.Add(1), 10)
+	replies := make(chan *Reply, 1)
+
+	s.mu.Lock()
+	if s.pending == nil {
+		s.mu.Unlock()
+		return nil, s.closedError()
+	}
+	s.pending[id] = replies
+	s.mu.Unlock()
+
+	msg := fmt.Sprintf(`<rpc xmlns="%s" message-id="%s">%s</rpc>`, baseNamespace, id, operation)
+	s.logger.Debug("Sending NETCONF rpc", "messageID", id, "sessionID", s.id)
+	if err := s.framer.writeMessage([]byte(msg)); err != nil {
+		s.forget(id)
+		return nil, fmt.Errorf("failed to send rpc: %w", err)
+	}
+
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return nil, s.closedError()
+		}
+		return reply, reply.Err()
+	case <-ctx.Done():
+		s.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Session) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+}
+
+func (s *Session) closedError() error {
+	<-s.done
+	if s.err != nil && !errors.Is(s.err, io.EOF) {
+		return fmt.Errorf("%w: %w", ErrClosed, s.err)
+	}
+	return ErrClosed
+}
+
+// readLoop routes replies to their callers and notifications to the
+// subscription until the session ends.
+func (s *Session) readLoop() {
+	var err error
+	defer func() {
+		s.mu.Lock()
+		s.err = err
+		for id, replies := range s.pending {
+			close(replies)
+			delete(s.pending, id)
+		}
+		s.pending = nil
+		if s.notifications != nil {
+			close(s.notifications)
+		}
+		s.mu.Unlock()
+		close(s.done)
+	}()
+
+	for {
+		var msg []byte
+		msg, err = s.framer.readMessage()
+		if err != nil {
+			return
+		}
+		switch rootElement(msg) {
+		case "rpc-reply":
+			reply, parseErr := parseReply(msg)
+			if parseErr != nil {
+				s.logger.Warn("Discarding malformed NETCONF reply", "error", parseErr)
+				continue
+			}
+			s.mu.Lock()
+			replies := s.pending[reply.MessageID]
+			delete(s.pending, reply.MessageID)
+			s.mu.Unlock()
+			if replies == nil {
+				s.logger.Warn("Discarding NETCONF reply nobody is waiting for", "messageID", reply.MessageID)
+				continue
+			}
+			replies <- reply
+		case "notification":
+			s.deliver(msg)
+		default:
+			s.logger.Warn("Discarding unexpected NETCONF message", "message", string(msg))
+		}
+	}
+}
+
+func rootElement(msg []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(msg))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// Close sends close-session and closes the connection.
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		ctx, cancel := context.WithTimeout(context.Background(), closeSessionTimeout)
+		if _, callErr := s.Call(ctx, "<close-session/>"); callErr != nil && !errors.Is(callErr, ErrClosed) {
+			s.logger.Debug("NETCONF close-session failed", "error", callErr)
+		}
+		cancel()
+		err = s.close()
+		<-s.done
+		s.logger.Info("NETCONF session closed", "sessionID", s.id)
+	})
+	return err
+}
@@ -0,0 +1,243 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/netconftest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+const interfacesXML = `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>Gi0/0/0/0</name><enabled>true</enabled></interface></interfaces>`
+
+func dialTestServer(t *testing.T, server *netconftest.Server) *Session {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("cisco"),
+		config.WithMaxRetry(1),
+	)
+	s, err := Dial(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestHelloNegotiatesFraming(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		capabilities []string
+		chunked      bool
+	}{
+		{"base 1.1", nil, true},
+		{"base 1.0 only", []string{CapBase10, CapCandidate}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := netconftest.Start(t, netconftest.Options{
+				Username:     "admin",
+				Password:     "cisco",
+				Capabilities: tc.capabilities,
+				Running:      interfacesXML,
+			})
+			s := dialTestServer(t, server)
+
+			if s.chunked != tc.chunked {
+				t.Fatalf("chunked = %v, want %v", s.chunked, tc.chunked)
+			}
+			if s.SessionID() == 0 {
+				t.Fatal("SessionID() = 0, want the id from the server hello")
+			}
+			if !s.HasCapability(CapCandidate) {
+				t.Fatalf("HasCapability(candidate) = false, capabilities %v", s.Capabilities())
+			}
+			data, err := s.GetConfig(testContext(t), Running, Subtree(`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`))
+			if err != nil {
+				t.Fatalf("GetConfig returned error: %v", err)
+			}
+			if string(data) != interfacesXML {
+				t.Fatalf("GetConfig data = %s, want %s", data, interfacesXML)
+			}
+		})
+	}
+}
+
+func TestGetReturnsStateData(t *testing.T) {
+	server := netconftest.Start(t, netconftest.Options{
+		Username: "admin",
+		Password: "cisco",
+		Running:  interfacesXML,
+		State:    `<system-state xmlns="urn:ietf:params:xml:ns:yang:ietf-system"><platform><os-name>IOS XR</os-name></platform></system-state>`,
+	})
+	s := dialTestServer(t, server)
+
+	data, err := s.Get(testContext(t), XPath(`/system-state/platform[os-name="IOS XR"]`))
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if !strings.Contains(string(data), "<os-name>IOS XR</os-name>") {
+		t.Fatalf("Get data = %s, want system state", data)
+	}
+}
+
+func TestCandidateEditValidateCommit(t *testing.T) {
+	server := netconftest.Start(t, netconftest.Options{
+		Username: "admin",
+		Password: "cisco",
+		Running:  interfacesXML,
+		Validate: func(config string) string {
+			if strings.Contains(config, "<mtu>0</mtu>") {
+				return "mtu must be at least 68"
+			}
+			return ""
+		},
+	})
+	s := dialTestServer(t, server)
+	ctx := testContext(t)
+	replacement := strings.Replace(interfacesXML, "<enabled>true</enabled>", "<enabled>false</enabled>", 1)
+
+	if err := s.Lock(ctx, Candidate); err != nil {
+		t.Fatalf("Lock returned error: %v", err)
+	}
+	if err := s.EditConfig(ctx, Candidate, replacement, WithDefaultOperation("replace")); err != nil {
+		t.Fatalf("EditConfig returned error: %v", err)
+	}
+	if err := s.Validate(ctx, Candidate); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if server.Running() != interfacesXML {
+		t.Fatal("running changed before commit")
+	}
+	if err := s.Commit(ctx); err != nil {
+		t.Fatalf("Commit returned error: %v", err)
+	}
+	if err := s.Unlock(ctx, Candidate); err != nil {
+		t.Fatalf("Unlock returned error: %v", err)
+	}
+	if server.Running() != replacement {
+		t.Fatalf("running = %s, want %s", server.Running(), replacement)
+	}
+
+	s.EditConfig(ctx, Candidate, "<mtu>0</mtu>")
+	err := s.Validate(ctx, Candidate)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "mtu must be at least 68" {
+		t.Fatalf("Validate error = %v, want the server's rpc-error", err)
+	}
+	if err := s.DiscardChanges(ctx); err != nil {
+		t.Fatalf("DiscardChanges returned error: %v", err)
+	}
+	if server.Candidate() != replacement {
+		t.Fatalf("candidate = %s after discard-changes, want running", server.Candidate())
+	}
+
+	want := []string{"lock", "edit-config", "validate", "commit", "unlock", "edit-config", "validate", "discard-changes"}
+	if got := server.Operations(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("operations = %v, want %v", got, want)
+	}
+}
+
+func TestLockHeldByAnotherSession(t *testing.T) {
+	server := netconftest.Start(t, netconftest.Options{Username: "admin", Password: "cisco"})
+	first := dialTestServer(t, server)
+	second := dialTestServer(t, server)
+	ctx := testContext(t)
+
+	if err := first.Lock(ctx, Running); err != nil {
+		t.Fatalf("Lock returned error: %v", err)
+	}
+	err := second.Lock(ctx, Running)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Tag != "lock-denied" {
+		t.Fatalf("second Lock error = %v, want lock-denied", err)
+	}
+	if !strings.Contains(rpcErr.Info, "<session-id>1</session-id>") {
+		t.Fatalf("error-info = %q, want the holder's session-id", rpcErr.Info)
+	}
+	if err := second.EditConfig(ctx, Running, interfacesXML); err == nil {
+		t.Fatal("EditConfig on a datastore locked by another session succeeded")
+	}
+
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for second.Lock(ctx, Running) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("lock was not released when the holding session closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeStreamsNotifications(t *testing.T) {
+	server := netconftest.Start(t, netconftest.Options{Username: "admin", Password: "cisco"})
+	s := dialTestServer(t, server)
+	ctx := testContext(t)
+
+	events, err := s.Subscribe(ctx, WithStream("NETCONF"))
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	if _, err := s.Subscribe(ctx); err == nil {
+		t.Fatal("second Subscribe succeeded")
+	}
+
+	event := `<netconf-config-change xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-notifications"><datastore>running</datastore></netconf-config-change>`
+	server.Notify("2024-05-01T10:00:00Z", event)
+	server.Notify("2024-05-01T10:00:01Z", event)
+
+	for _, want := range []string{"2024-05-01T10:00:00Z", "2024-05-01T10:00:01Z"} {
+		select {
+		case n := <-events:
+			if n.EventTime.Format(time.RFC3339) != want {
+				t.Fatalf("EventTime = %s, want %s", n.EventTime.Format(time.RFC3339), want)
+			}
+			if string(n.XML) != event {
+				t.Fatalf("XML = %s, want %s", n.XML, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification received")
+		}
+	}
+
+	// RPCs still work while subscribed.
+	if _, err := s.Get(ctx, Filter{}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	s.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("notification channel still open after Close")
+	}
+	if _, err := s.Get(context.Background(), Filter{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestUnsupportedOperationIsAnRPCError(t *testing.T) {
+	server := netconftest.Start(t, netconftest.Options{Username: "admin", Password: "cisco"})
+	s := dialTestServer(t, server)
+
+	reply, err := s.Call(testContext(t), "<kill-session><session-id>7</session-id></kill-session>")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Tag != "operation-not-supported" {
+		t.Fatalf("Call error = %v, want operation-not-supported", err)
+	}
+	if reply == nil || reply.OK {
+		t.Fatalf("reply = %+v, want the rpc-error reply", reply)
+	}
+}
@@ -0,0 +1,138 @@
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// notificationBuffer is how many notifications are held for a slow
+// reader before the session stops reading.
+const notificationBuffer = 64
+
+var eventTimeElement = regexp.MustCompile(`(?s)<(\w+:)?eventTime[^>]*>.*?</(\w+:)?eventTime>`)
+
+// Notification is an event from a subscription (RFC 5277). XML holds the
+// event content without eventTime.
+type Notification struct {
+	EventTime time.Time
+	XML       []byte
+}
+
+type subscribeOptions struct {
+	stream    string
+	filter    Filter
+	startTime time.Time
+	stopTime  time.Time
+}
+
+// SubscribeOption configures Subscribe.
+type SubscribeOption func(*subscribeOptions)
+
+// WithStream subscribes to a named stream instead of the default NETCONF
+// stream.
+func WithStream(name string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.stream = name
+	}
+}
+
+// WithFilter only delivers events matching filter.
+func WithFilter(filter Filter) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.filter = filter
+	}
+}
+
+// WithStartTime replays stored events from start, on streams that support
+// replay.
+func WithStartTime(start time.Time) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.startTime = start
+	}
+}
+
+// WithStopTime ends a replay subscription at stop.
+func WithStopTime(stop time.Time) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.stopTime = stop
+	}
+}
+
+// Subscribe sends create-subscription and returns the channel events are
+// delivered on. The channel is closed when the session ends. Replies to
+// other RPCs wait while the channel is full, so keep reading it. A session
+// has at most one subscription.
+func (s *Session) Subscribe(ctx context.Context, opts ...SubscribeOption) (<-chan Notification, error) {
+	var o subscribeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s.mu.Lock()
+	if s.notifications != nil {
+		s.mu.Unlock()
+		return nil, errors.New("netconf session already has a subscription")
+	}
+	if s.pending == nil {
+		s.mu.Unlock()
+		return nil, s.closedError()
+	}
+	notifications := make(chan Notification, notificationBuffer)
+	s.notifications = notifications
+	s.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString(`<create-subscription xmlns="` + notificationNamespace + `">`)
+	if o.stream != "" {
+		b.WriteString("<stream>" + escape(o.stream) + "</stream>")
+	}
+	b.WriteString(o.filter.xml())
+	if !o.startTime.IsZero() {
+		b.WriteString("<startTime>" + o.startTime.Format(time.RFC3339Nano) + "</startTime>")
+	}
+	if !o.stopTime.IsZero() {
+		b.WriteString("<stopTime>" + o.stopTime.Format(time.RFC3339Nano) + "</stopTime>")
+	}
+	b.WriteString("</create-subscription>")
+
+	if _, err := s.Call(ctx, b.String()); err != nil {
+		s.mu.Lock()
+		if s.notifications == notifications && s.pending != nil {
+			s.notifications = nil
+		}
+		s.mu.Unlock()
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (s *Session) deliver(msg []byte) {
+	var raw struct {
+		EventTime string `xml:"eventTime"`
+		Inner     []byte `xml:",innerxml"`
+	}
+	if err := xml.Unmarshal(msg, &raw); err != nil {
+		s.logger.Warn("Discarding malformed NETCONF notification", "error", err)
+		return
+	}
+	n := Notification{XML: bytes.TrimSpace(eventTimeElement.ReplaceAll(raw.Inner, nil))}
+	if t, err := time.Parse(time.RFC3339Nano, raw.EventTime); err == nil {
+		n.EventTime = t
+	}
+
+	s.mu.Lock()
+	notifications := s.notifications
+	s.mu.Unlock()
+	if notifications == nil {
+		s.logger.Warn("Discarding NETCONF notification without a subscription")
+		return
+	}
+	select {
+	case notifications <- n:
+	case <-s.closing:
+	}
+}
@@ -0,0 +1,162 @@
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+)
+
+// Datastore names a configuration datastore.
+type Datastore string
+
+const (
+	Running   Datastore = "running"
+	Candidate Datastore = "candidate"
+	Startup   Datastore = "startup"
+)
+
+func (d Datastore) xml() string {
+	return "<" + string(d) + "/>"
+}
+
+// Filter selects part of the data returned by Get and GetConfig. The zero
+// Filter returns everything.
+type Filter struct {
+	kind  string
+	value string
+}
+
+// Subtree filters with a subtree of XML, e.g.
+// `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`.
+func Subtree(content string) Filter {
+	return Filter{kind: "subtree", value: content}
+}
+
+// XPath filters with an XPath expression. The server must advertise the
+// :xpath capability.
+func XPath(expr string) Filter {
+	return Filter{kind: "xpath", value: expr}
+}
+
+func (f Filter) xml() string {
+	switch f.kind {
+	case "subtree":
+		return `<filter type="subtree">` + f.value + `</filter>`
+	case "xpath":
+		return `<filter type="xpath" select="` + escape(f.value) + `"/>`
+	default:
+		return ""
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Get returns state and configuration data, the contents of <data>.
+func (s *Session) Get(ctx context.Context, filter Filter) ([]byte, error) {
+	reply, err := s.Call(ctx, "<get>"+filter.xml()+"</get>")
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+// GetConfig returns the configuration in source, the contents of <data>.
+func (s *Session) GetConfig(ctx context.Context, source Datastore, filter Filter) ([]byte, error) {
+	reply, err := s.Call(ctx, "<get-config><source>"+source.xml()+"</source>"+filter.xml()+"</get-config>")
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+type editOptions struct {
+	defaultOperation string
+	testOption       string
+	errorOption      string
+}
+
+// EditOption configures EditConfig.
+type EditOption func(*editOptions)
+
+// WithDefaultOperation sets default-operation: merge (the server default),
+// replace or none.
+func WithDefaultOperation(operation string) EditOption {
+	return func(o *editOptions) {
+		o.defaultOperation = operation
+	}
+}
+
+// WithTestOption sets test-option: test-then-set, set or test-only. The
+// server must advertise :validate.
+func WithTestOption(option string) EditOption {
+	return func(o *editOptions) {
+		o.testOption = option
+	}
+}
+
+// WithErrorOption sets error-option: stop-on-error, continue-on-error or
+// rollback-on-error.
+func WithErrorOption(option string) EditOption {
+	return func(o *editOptions) {
+		o.errorOption = option
+	}
+}
+
+// EditConfig loads content, the XML inside <config>, into target.
+func (s *Session) EditConfig(ctx context.Context, target Datastore, content string, opts ...EditOption) error {
+	var o editOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var b strings.Builder
+	b.WriteString("<edit-config><target>" + target.xml() + "</target>")
+	if o.defaultOperation != "" {
+		b.WriteString("<default-operation>" + escape(o.defaultOperation) + "</default-operation>")
+	}
+	if o.testOption != "" {
+		b.WriteString("<test-option>" + escape(o.testOption) + "</test-option>")
+	}
+	if o.errorOption != "" {
+		b.WriteString("<error-option>" + escape(o.errorOption) + "</error-option>")
+	}
+	b.WriteString("<config>" + content + "</config></edit-config>")
+	_, err := s.Call(ctx, b.String())
+	return err
+}
+
+// Lock locks target against other sessions. A lock held elsewhere fails
+// with error-tag lock-denied; Info carries the holder's session-id.
+func (s *Session) Lock(ctx context.Context, target Datastore) error {
+	_, err := s.Call(ctx, "<lock><target>"+target.xml()+"</target></lock>")
+	return err
+}
+
+// Unlock releases a lock taken with Lock.
+func (s *Session) Unlock(ctx context.Context, target Datastore) error {
+	_, err := s.Call(ctx, "<unlock><target>"+target.xml()+"</target></unlock>")
+	return err
+}
+
+// Validate checks source without applying it. The server must advertise
+// :validate.
+func (s *Session) Validate(ctx context.Context, source Datastore) error {
+	_, err := s.Call(ctx, "<validate><source>"+source.xml()+"</source></validate>")
+	return err
+}
+
+// Commit copies the candidate datastore to running. The server must
+// advertise :candidate.
+func (s *Session) Commit(ctx context.Context) error {
+	_, err := s.Call(ctx, "<commit/>")
+	return err
+}
+
+// DiscardChanges reverts the candidate datastore to running.
+func (s *Session) DiscardChanges(ctx context.Context) error {
+	_, err := s.Call(ctx, "<discard-changes/>")
+	return err
+}
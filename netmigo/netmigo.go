@@ -4,24 +4,91 @@ import (
     "log/slog"
     "time"
 
+    "github.com/jonelmawirat/netmigo/netmigo/backup"
+    "github.com/jonelmawirat/netmigo/netmigo/challenge"
+    "github.com/jonelmawirat/netmigo/netmigo/ciscoconf"
+    "github.com/jonelmawirat/netmigo/netmigo/compliance"
     "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/configdiff"
+    "github.com/jonelmawirat/netmigo/netmigo/credentials"
     "github.com/jonelmawirat/netmigo/netmigo/factory"
+    "github.com/jonelmawirat/netmigo/netmigo/getters"
+    "github.com/jonelmawirat/netmigo/netmigo/netconf"
+    "github.com/jonelmawirat/netmigo/netmigo/pool"
+    "github.com/jonelmawirat/netmigo/netmigo/render"
     "github.com/jonelmawirat/netmigo/netmigo/repository"
     "github.com/jonelmawirat/netmigo/netmigo/service"
+    "github.com/jonelmawirat/netmigo/netmigo/textfsm"
 )
 
 type DeviceConfig = config.DeviceConfig
 type DeviceConfigOption = config.DeviceConfigOption
+type AddressFamily = config.AddressFamily
+type Dialer = config.Dialer
+type DialerFunc = config.DialerFunc
+type Transport = config.Transport
+type ConsoleConfig = config.ConsoleConfig
 
 var (
-    NewDeviceConfig       = config.NewDeviceConfig
-    WithUsername          = config.WithUsername
-    WithPassword          = config.WithPassword
-    WithKeyPath           = config.WithKeyPath
-    WithPort              = config.WithPort
-    WithJumpServer        = config.WithJumpServer
-    WithMaxRetry          = config.WithMaxRetry
-    WithConnectionTimeout = config.WithConnectionTimeout
+    NewDeviceConfig           = config.NewDeviceConfig
+    WithUsername              = config.WithUsername
+    WithPassword              = config.WithPassword
+    WithKeyPath               = config.WithKeyPath
+    WithKeyPassphrase         = config.WithKeyPassphrase
+    WithKeyPassphraseCallback = config.WithKeyPassphraseCallback
+    WithPrivateKey            = config.WithPrivateKey
+    WithSigner                = config.WithSigner
+    WithPort                  = config.WithPort
+    WithJumpServer            = config.WithJumpServer
+    WithMaxRetry              = config.WithMaxRetry
+    WithConnectionTimeout     = config.WithConnectionTimeout
+    WithAddressFamily         = config.WithAddressFamily
+    WithResolver              = config.WithResolver
+    WithDNSServer             = config.WithDNSServer
+    WithSourceAddress         = config.WithSourceAddress
+    WithDialer                = config.WithDialer
+    WithSOCKS5Proxy           = config.WithSOCKS5Proxy
+    WithHTTPConnectProxy      = config.WithHTTPConnectProxy
+    WithProxyCommand          = config.WithProxyCommand
+    LoadSSHConfig             = config.LoadSSHConfig
+    WithCertificate           = config.WithCertificate
+    WithHostCAFile            = config.WithHostCAFile
+    WithCredentialProvider    = config.WithCredentialProvider
+    WithKeyboardInteractive   = config.WithKeyboardInteractive
+    WithKeyboardInteractiveID = config.WithKeyboardInteractiveID
+    WithChallengeResponse     = config.WithChallengeResponse
+    WithChallengeResponseID   = config.WithChallengeResponseID
+    DialerWithID              = config.DialerWithID
+    WithTransport             = config.WithTransport
+    WithTelnetPort            = config.WithTelnetPort
+    WithPrompt                = config.WithPrompt
+    WithSecret                = config.WithSecret
+    WithConsole               = config.WithConsole
+    WithConsoleBreak          = config.WithConsoleBreak
+    WithConsoleClearLine      = config.WithConsoleClearLine
+    WithConsoleClearCommand   = config.WithConsoleClearCommand
+)
+
+type ChallengeRule = challenge.Rule
+type ChallengeResponder = challenge.Responder
+
+var (
+    MatchPrompt     = challenge.Match
+    MustMatchPrompt = challenge.MustMatch
+    StaticAnswer    = challenge.Static
+    TOTPAnswer      = challenge.TOTP
+)
+
+type Credential = credentials.Credential
+type CredentialProvider = credentials.CredentialProvider
+
+var (
+    StaticCredentials  = credentials.Static
+    EnvCredentials     = credentials.Env
+    NetrcCredentials   = credentials.Netrc
+    VaultCredentials   = credentials.Vault
+    CommandCredentials = credentials.Command
+    CredentialsWithID  = credentials.WithID
 )
 
 type ExecuteOption = repository.ExecuteOption
@@ -34,18 +101,189 @@ func WithFirstByteTimeout(d time.Duration) ExecuteOption {
     return repository.WithFirstByteTimeout(d)
 }
 
+func WithEnable(secret string) ExecuteOption {
+    return repository.WithEnable(secret)
+}
+
+func WithSudo() ExecuteOption {
+    return repository.WithSudo()
+}
+
+func WithSudoPassword(password string) ExecuteOption {
+    return repository.WithSudoPassword(password)
+}
+
+func WithStopOnError() ExecuteOption {
+    return repository.WithStopOnError()
+}
+
+func WithTextFSM(index *TextFSMIndex, records *[]map[string]any) ExecuteOption {
+    return service.WithTextFSM(index, records)
+}
+
+type TextFSMIndex = textfsm.Index
+type TextFSMTemplate = textfsm.Template
+
+var (
+    LoadTextFSMIndex    = textfsm.LoadIndex
+    LoadTextFSMTemplate = textfsm.LoadTemplate
+    ErrNoTemplate       = textfsm.ErrNoTemplate
+)
+
+var (
+    ErrEnableFailed = repository.ErrEnableFailed
+    ErrSudoFailed   = repository.ErrSudoFailed
+)
+
+type ConfigResult = repository.ConfigResult
+type ConfigLineResult = repository.ConfigLineResult
+type ConfigError = repository.ConfigError
+
+const (
+    CISCO_IOSXR   = config.CISCO_IOSXR
+    CISCO_IOSXE   = config.CISCO_IOSXE
+    CISCO_NXOS    = config.CISCO_NXOS
+    LINUX         = config.LINUX
+    JUNIPER_JUNOS = config.JUNIPER_JUNOS
+    ARISTA_EOS    = config.ARISTA_EOS
+)
+
 const (
-    CISCO_IOSXR = config.CISCO_IOSXR
-    CISCO_IOSXE = config.CISCO_IOSXE
-    CISCO_NXOS  = config.CISCO_NXOS
-    LINUX       = config.LINUX
+    AddressFamilyAny        = config.AddressFamilyAny
+    AddressFamilyIPv4       = config.AddressFamilyIPv4
+    AddressFamilyIPv6       = config.AddressFamilyIPv6
+    AddressFamilyPreferIPv4 = config.AddressFamilyPreferIPv4
+    AddressFamilyPreferIPv6 = config.AddressFamilyPreferIPv6
+)
+
+const (
+    TransportSSH           = config.TransportSSH
+    TransportTelnet        = config.TransportTelnet
+    TransportSSHThenTelnet = config.TransportSSHThenTelnet
 )
 
 type Device = service.DeviceService
+type ContextConnector = service.ContextConnector
+type Pinger = service.Pinger
+type Enabler = service.Enabler
+type Configurer = service.Configurer
+type Forwarder = service.Forwarder
+type StructuredExecutor = service.StructuredExecutor
+
+var (
+    ErrUnsupportedOverTelnet       = service.ErrUnsupportedOverTelnet
+    ErrUnsupportedOnConsole        = service.ErrUnsupportedOnConsole
+    ErrStructuredOutputUnsupported = service.ErrStructuredOutputUnsupported
+    ErrUnsupportedByRepository     = service.ErrUnsupportedByRepository
+)
 
 type Iosxr = service.IosxrDeviceService
+type Iosxe = service.IosxeDeviceService
 type Linux = service.LinuxDeviceService
 
-func NewDevice(logger *slog.Logger, platform config.Platform) (Device, error) {
-    return factory.NewDevice(logger, platform)
+type IosxrConfigSession = service.IosxrConfigSession
+type CommitOption = service.CommitOption
+type CommitResult = service.CommitResult
+type RollbackResult = service.RollbackResult
+
+var (
+    WithCommitLabel        = service.WithCommitLabel
+    WithCommitComment      = service.WithCommitComment
+    WithCommitConfirmed    = service.WithCommitConfirmed
+    ErrCommitFailed        = service.ErrCommitFailed
+    ErrRollbackFailed      = service.ErrRollbackFailed
+    ErrConfigSessionClosed = repository.ErrConfigSessionClosed
+)
+
+type RepositoryOption = repository.RepositoryOption
+type Forward = repository.Forward
+type JumpClientManager = repository.JumpClientManager
+type JumpClientManagerOption = repository.JumpClientManagerOption
+
+var (
+    NewJumpClientManager         = repository.NewJumpClientManager
+    WithJumpClientManager        = repository.WithJumpClientManager
+    WithIdleTTL                  = repository.WithIdleTTL
+    WithHealthCheck              = repository.WithHealthCheck
+    WithMaxChannelsPerConnection = repository.WithMaxChannelsPerConnection
+    WithMaxConnectionsPerJump    = repository.WithMaxConnectionsPerJump
+    WithConnectRate              = repository.WithConnectRate
+)
+
+type Pool = pool.Pool
+type PooledDevice = pool.Conn
+type PoolOption = pool.Option
+
+var (
+    NewPool                   = pool.New
+    WithPoolMaxPerDevice      = pool.WithMaxPerDevice
+    WithPoolIdleTimeout       = pool.WithIdleTimeout
+    WithPoolMaxLifetime       = pool.WithMaxLifetime
+    WithPoolRepositoryOptions = pool.WithRepositoryOptions
+)
+
+type NetconfSession = netconf.Session
+
+var DialNetconf = netconf.Dial
+
+type BackupManager = backup.Manager
+type BackupResult = backup.Result
+type BackupStore = backup.Store
+
+var (
+    NewBackupManager = backup.New
+    NewDirStore      = backup.NewDirStore
+    NewGitStore      = backup.NewGitStore
+)
+
+type ConfigTree = ciscoconf.Config
+type ConfigNode = ciscoconf.Node
+
+var (
+    ParseConfig     = ciscoconf.Parse
+    ParseConfigFile = ciscoconf.ParseFile
+)
+
+type ConfigDiff = configdiff.Result
+
+var (
+    CompareConfig        = configdiff.Compare
+    CompareRunningConfig = configdiff.CompareRunning
+)
+
+type ConfigTemplate = render.Template
+type TemplateVars = render.Vars
+type Inventory = render.Inventory
+
+var (
+    NewConfigTemplate         = render.New
+    NewConfigTemplateFromFile = render.NewFromFile
+    LoadInventory             = render.LoadInventory
+)
+
+type ComplianceRule = compliance.Rule
+type ComplianceRuleSet = compliance.RuleSet
+type ComplianceReport = compliance.Report
+
+var (
+    NewComplianceRuleSet  = compliance.NewRuleSet
+    LoadComplianceRuleSet = compliance.LoadRuleSet
+    NewComplianceReport   = compliance.NewReport
+)
+
+type Getters = getters.Getters
+type Facts = getters.Facts
+type Interface = getters.Interface
+type InterfaceCounters = getters.InterfaceCounters
+type LLDPNeighbor = getters.LLDPNeighbor
+type ARPEntry = getters.ARPEntry
+type BGPNeighbor = getters.BGPNeighbor
+
+var (
+    NewGetters                    = getters.New
+    ErrGettersUnsupportedPlatform = getters.ErrUnsupportedPlatform
+)
+
+func NewDevice(logger *slog.Logger, platform config.Platform, opts ...RepositoryOption) (Device, error) {
+    return factory.NewDevice(logger, platform, opts...)
 }
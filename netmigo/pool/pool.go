@@ -0,0 +1,375 @@
+// Package pool keeps connected devices around between requests, for
+// long-running services that run commands on demand against the same set of
+// routers.
+package pool
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "sync"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/factory"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+    "github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+const (
+    defaultMaxPerDevice = 4
+    defaultIdleTimeout  = 5 * time.Minute
+)
+
+// ErrClosed is returned by Get after Close.
+var ErrClosed = errors.New("device pool is closed")
+
+var timeNowFunc = time.Now
+
+// Pool hands out connected devices keyed by platform and
+// config.DeviceConfig.Key. Idle connections are reused, validated with Ping
+// before checkout, and evicted once they have been idle or open too long.
+type Pool struct {
+    logger       *slog.Logger
+    maxPerDevice int
+    idleTimeout  time.Duration
+    maxLifetime  time.Duration
+    repoOpts     []repository.RepositoryOption
+    newDevice    func(platform config.Platform) (service.DeviceService, error)
+
+    mu      sync.Mutex
+    devices map[string]*devicePool
+    closed  bool
+    stop    chan struct{}
+}
+
+type devicePool struct {
+    idle []*idleConn
+    open int
+    // wake is closed, and replaced, when a connection is returned or
+    // closed, so queued callers re-check.
+    wake chan struct{}
+}
+
+type idleConn struct {
+    device   service.DeviceService
+    created  time.Time
+    lastUsed time.Time
+}
+
+// Option configures a Pool.
+type Option func(*Pool)
+
+// WithMaxPerDevice caps the open connections to one device, idle or in use.
+// Get waits for a free connection beyond the cap. The default is 4.
+func WithMaxPerDevice(n int) Option {
+    return func(p *Pool) {
+        p.maxPerDevice = n
+    }
+}
+
+// WithIdleTimeout closes connections that have been idle for d. Zero keeps
+// idle connections until Close. The default is five minutes.
+func WithIdleTimeout(d time.Duration) Option {
+    return func(p *Pool) {
+        p.idleTimeout = d
+    }
+}
+
+// WithMaxLifetime closes connections once they have been open for d, even
+// if they are used constantly. Zero means no limit.
+func WithMaxLifetime(d time.Duration) Option {
+    return func(p *Pool) {
+        p.maxLifetime = d
+    }
+}
+
+// WithRepositoryOptions passes opts to every device the pool creates, e.g.
+// to share a JumpClientManager.
+func WithRepositoryOptions(opts ...repository.RepositoryOption) Option {
+    return func(p *Pool) {
+        p.repoOpts = append(p.repoOpts, opts...)
+    }
+}
+
+func New(logger *slog.Logger, opts ...Option) *Pool {
+    p := &Pool{
+        logger:       logger,
+        maxPerDevice: defaultMaxPerDevice,
+        idleTimeout:  defaultIdleTimeout,
+        devices:      make(map[string]*devicePool),
+        stop:         make(chan struct{}),
+    }
+    for _, opt := range opts {
+        opt(p)
+    }
+    if p.maxPerDevice < 1 {
+        p.maxPerDevice = 1
+    }
+    if p.newDevice == nil {
+        p.newDevice = func(platform config.Platform) (service.DeviceService, error) {
+            return factory.NewDevice(p.logger, platform, p.repoOpts...)
+        }
+    }
+    if interval := p.evictInterval(); interval > 0 {
+        go p.evictLoop(interval)
+    }
+    return p
+}
+
+// Get returns a connected device for cfg, reusing an idle connection when
+// one passes validation. When the device is at its connection cap, Get
+// waits until a connection is released or ctx is done. The returned Conn
+// must be released with Release or Discard.
+func (p *Pool) Get(ctx context.Context, platform config.Platform, cfg *config.DeviceConfig) (*Conn, error) {
+    key := fmt.Sprintf("%v|%s", platform, cfg.Key())
+
+    for {
+        p.mu.Lock()
+        if p.closed {
+            p.mu.Unlock()
+            return nil, ErrClosed
+        }
+        dp, exists := p.devices[key]
+        if !exists {
+            dp = &devicePool{wake: make(chan struct{})}
+            p.devices[key] = dp
+        }
+
+        if n := len(dp.idle); n > 0 {
+            ic := dp.idle[n-1]
+            dp.idle = dp.idle[:n-1]
+            p.mu.Unlock()
+
+            if p.expired(ic, timeNowFunc()) {
+                p.closeConn(key, ic.device)
+                continue
+            }
+            if err := ping(ic.device); err != nil {
+                p.logger.Info("Discarding pooled connection that failed validation", "device", cfg.Address(), "error", err)
+                p.closeConn(key, ic.device)
+                continue
+            }
+            return &Conn{DeviceService: ic.device, pool: p, key: key, created: ic.created}, nil
+        }
+
+        if dp.open < p.maxPerDevice {
+            dp.open++
+            p.mu.Unlock()
+
+            device, err := p.connect(ctx, platform, cfg)
+            if err != nil {
+                p.mu.Lock()
+                dp.open--
+                p.broadcast(dp)
+                p.mu.Unlock()
+                return nil, err
+            }
+            return &Conn{DeviceService: device, pool: p, key: key, created: timeNowFunc()}, nil
+        }
+
+        wake := dp.wake
+        p.mu.Unlock()
+
+        select {
+        case <-wake:
+        case <-ctx.Done():
+            return nil, fmt.Errorf("waiting for a pooled connection to %s: %w", cfg.Address(), ctx.Err())
+        }
+    }
+}
+
+// Close disconnects idle connections and makes later Get calls fail.
+// Connections still checked out are disconnected when they are released.
+func (p *Pool) Close() error {
+    p.mu.Lock()
+    if p.closed {
+        p.mu.Unlock()
+        return nil
+    }
+    p.closed = true
+    close(p.stop)
+    var idle []service.DeviceService
+    for _, dp := range p.devices {
+        for _, ic := range dp.idle {
+            idle = append(idle, ic.device)
+        }
+        dp.open -= len(dp.idle)
+        dp.idle = nil
+        p.broadcast(dp)
+    }
+    p.mu.Unlock()
+
+    for _, device := range idle {
+        device.Disconnect()
+    }
+    return nil
+}
+
+// Stats reports the number of open connections across all devices and how
+// many of them are idle.
+func (p *Pool) Stats() (open, idle int) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for _, dp := range p.devices {
+        open += dp.open
+        idle += len(dp.idle)
+    }
+    return open, idle
+}
+
+func (p *Pool) connect(ctx context.Context, platform config.Platform, cfg *config.DeviceConfig) (service.DeviceService, error) {
+    device, err := p.newDevice(platform)
+    if err != nil {
+        return nil, err
+    }
+    if connector, ok := device.(service.ContextConnector); ok {
+        err = connector.ConnectContext(ctx, cfg)
+    } else {
+        err = device.Connect(cfg)
+    }
+    if err != nil {
+        return nil, err
+    }
+    return device, nil
+}
+
+// ping validates an idle connection before it is handed out again. Devices
+// that are not a service.Pinger are handed out unchecked.
+func ping(device service.DeviceService) error {
+    if pinger, ok := device.(service.Pinger); ok {
+        return pinger.Ping()
+    }
+    return nil
+}
+
+func (p *Pool) put(key string, device service.DeviceService, created time.Time) {
+    now := timeNowFunc()
+    p.mu.Lock()
+    dp := p.devices[key]
+    if p.closed || dp == nil || (p.maxLifetime > 0 && now.Sub(created) >= p.maxLifetime) {
+        p.mu.Unlock()
+        p.closeConn(key, device)
+        return
+    }
+    dp.idle = append(dp.idle, &idleConn{device: device, created: created, lastUsed: now})
+    p.broadcast(dp)
+    p.mu.Unlock()
+}
+
+// closeConn disconnects a connection that is no longer counted as idle.
+func (p *Pool) closeConn(key string, device service.DeviceService) {
+    device.Disconnect()
+    p.mu.Lock()
+    if dp := p.devices[key]; dp != nil && dp.open > 0 {
+        dp.open--
+        p.broadcast(dp)
+    }
+    p.mu.Unlock()
+}
+
+func (p *Pool) expired(ic *idleConn, now time.Time) bool {
+    if p.idleTimeout > 0 && now.Sub(ic.lastUsed) >= p.idleTimeout {
+        return true
+    }
+    return p.maxLifetime > 0 && now.Sub(ic.created) >= p.maxLifetime
+}
+
+func (p *Pool) evictInterval() time.Duration {
+    interval := p.idleTimeout
+    if p.maxLifetime > 0 && (interval == 0 || p.maxLifetime < interval) {
+        interval = p.maxLifetime
+    }
+    return interval / 2
+}
+
+func (p *Pool) evictLoop(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            p.evictStale()
+        case <-p.stop:
+            return
+        }
+    }
+}
+
+// evictStale closes idle connections past their idle timeout or lifetime.
+func (p *Pool) evictStale() {
+    now := timeNowFunc()
+    var stale []service.DeviceService
+    p.mu.Lock()
+    for key, dp := range p.devices {
+        kept := dp.idle[:0]
+        for _, ic := range dp.idle {
+            if p.expired(ic, now) {
+                stale = append(stale, ic.device)
+                dp.open--
+                continue
+            }
+            kept = append(kept, ic)
+        }
+        dp.idle = kept
+        if dp.open == 0 {
+            delete(p.devices, key)
+        }
+        p.broadcast(dp)
+    }
+    p.mu.Unlock()
+
+    for _, device := range stale {
+        device.Disconnect()
+    }
+}
+
+// broadcast wakes queued callers. It must be called with p.mu held.
+func (p *Pool) broadcast(dp *devicePool) {
+    close(dp.wake)
+    dp.wake = make(chan struct{})
+}
+
+// Conn is a pooled, connected device. The optional capabilities, such as
+// service.Enabler, are on the embedded DeviceService:
+// conn.DeviceService.(service.Enabler).
+type Conn struct {
+    service.DeviceService
+    pool     *Pool
+    key      string
+    created  time.Time
+    mu       sync.Mutex
+    returned bool
+}
+
+// Release returns the connection to the pool for reuse. The Conn must not
+// be used afterwards.
+func (c *Conn) Release() {
+    if c.markReturned() {
+        c.pool.put(c.key, c.DeviceService, c.created)
+    }
+}
+
+// Discard disconnects the connection instead of returning it, e.g. after a
+// command timed out and the session state is unknown.
+func (c *Conn) Discard() {
+    if c.markReturned() {
+        c.pool.closeConn(c.key, c.DeviceService)
+    }
+}
+
+// Disconnect is Discard, so the pool's connection count stays correct.
+func (c *Conn) Disconnect() {
+    c.Discard()
+}
+
+func (c *Conn) markReturned() bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.returned {
+        return false
+    }
+    c.returned = true
+    return true
+}
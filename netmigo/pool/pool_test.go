@@ -0,0 +1,162 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+func newTestPool(t *testing.T, opts ...Option) *Pool {
+	t.Helper()
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func newTestDevice(t *testing.T) (*sshtest.Server, *config.DeviceConfig) {
+	t.Helper()
+	server := sshtest.NewServer(t, "admin", "secret", nil)
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("secret"),
+		config.WithMaxRetry(1),
+	)
+	return server, cfg
+}
+
+func TestPoolReusesIdleConnection(t *testing.T) {
+	server, cfg := newTestDevice(t)
+	p := newTestPool(t)
+
+	first, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	first.Release()
+	first.Release() // a second release is ignored
+
+	second, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("second Get returned error: %v", err)
+	}
+	if second.DeviceService != first.DeviceService {
+		t.Fatal("idle connection was not reused")
+	}
+	if server.Connections() != 1 {
+		t.Fatalf("server connections = %d, want 1", server.Connections())
+	}
+	if open, idle := p.Stats(); open != 1 || idle != 0 {
+		t.Fatalf("Stats = %d open, %d idle; want 1, 0", open, idle)
+	}
+	second.Release()
+}
+
+func TestPoolCapsConnectionsPerDevice(t *testing.T) {
+	_, cfg := newTestDevice(t)
+	p := newTestPool(t, WithMaxPerDevice(1))
+
+	held, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx, config.LINUX, cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get beyond cap error = %v, want deadline exceeded", err)
+	}
+
+	got := make(chan *Conn, 1)
+	go func() {
+		conn, err := p.Get(context.Background(), config.LINUX, cfg)
+		if err != nil {
+			t.Errorf("queued Get returned error: %v", err)
+		}
+		got <- conn
+	}()
+	time.Sleep(20 * time.Millisecond)
+	held.Release()
+
+	select {
+	case conn := <-got:
+		if conn == nil || conn.DeviceService != held.DeviceService {
+			t.Fatal("queued Get did not receive the released connection")
+		}
+		conn.Release()
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued Get did not return after Release")
+	}
+}
+
+func TestPoolReplacesConnectionThatFailsValidation(t *testing.T) {
+	server, cfg := newTestDevice(t)
+	p := newTestPool(t)
+
+	first, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	first.Release()
+	server.DropConnections()
+
+	second, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get after drop returned error: %v", err)
+	}
+	defer second.Release()
+	if second.DeviceService == first.DeviceService {
+		t.Fatal("dead connection was handed out")
+	}
+	if server.Connections() != 2 {
+		t.Fatalf("server connections = %d, want 2", server.Connections())
+	}
+	if open, _ := p.Stats(); open != 1 {
+		t.Fatalf("open connections = %d, want 1", open)
+	}
+}
+
+func TestPoolEvictsIdleConnections(t *testing.T) {
+	_, cfg := newTestDevice(t)
+	p := newTestPool(t, WithIdleTimeout(40*time.Millisecond))
+
+	conn, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	conn.Release()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if open, _ := p.Stats(); open == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("idle connection was not evicted")
+}
+
+func TestPoolDiscardAndClose(t *testing.T) {
+	_, cfg := newTestDevice(t)
+	p := newTestPool(t)
+
+	conn, err := p.Get(context.Background(), config.LINUX, cfg)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	conn.Discard()
+	if open, idle := p.Stats(); open != 0 || idle != 0 {
+		t.Fatalf("Stats after Discard = %d open, %d idle; want 0, 0", open, idle)
+	}
+
+	p.Close()
+	if _, err := p.Get(context.Background(), config.LINUX, cfg); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close error = %v, want ErrClosed", err)
+	}
+}
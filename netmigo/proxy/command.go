@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxCommandStderr bounds how much of a proxy command's stderr is kept
+	// for the error reported when it exits.
+	maxCommandStderr = 4096
+	// commandWaitDelay bounds how long Close waits for the command's
+	// output to drain after it was killed.
+	commandWaitDelay = 2 * time.Second
+)
+
+// CommandDialer runs an OpenSSH-style ProxyCommand and uses the process's
+// stdin and stdout as the transport. The command string is passed to the
+// shell unchanged; callers expand %h/%p tokens beforehand.
+type CommandDialer struct {
+	Command string
+}
+
+func NewCommandDialer(command string) *CommandDialer {
+	return &CommandDialer{Command: command}
+}
+
+// DialContext starts the command. The process outlives the dial, so it
+// runs under its own context, cancelled by Close or by a deadline set on
+// the connection; ctx only ends it while the dial is in progress. Once
+// the process exits, reads fail with an error that carries the end of
+// its stderr.
+func (d *CommandDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Command == "" {
+		return nil, errors.New("proxy command is empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	procCtx, kill := context.WithCancel(context.WithoutCancel(ctx))
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(procCtx, "cmd", "/C", d.Command)
+	} else {
+		cmd = exec.CommandContext(procCtx, "/bin/sh", "-c", d.Command)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	stderr := &stderrTail{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		kill()
+		return nil, fmt.Errorf("proxy command stdin: %w", err)
+	}
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+
+	stop := context.AfterFunc(ctx, kill)
+	defer stop()
+	if err := cmd.Start(); err != nil {
+		kill()
+		return nil, fmt.Errorf("start proxy command %q: %w", d.Command, err)
+	}
+
+	c := &commandConn{
+		command: d.Command,
+		cmd:     cmd,
+		kill:    kill,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+		remote:  commandAddr(address),
+		done:    make(chan struct{}),
+	}
+	go c.wait(stdoutWriter)
+	if err := ctx.Err(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// commandConn adapts a running proxy command to net.Conn. A deadline that
+// passes kills the process, so unlike a socket the connection cannot be
+// used again afterwards; closing the connection kills the process too.
+type commandConn struct {
+	command string
+	cmd     *exec.Cmd
+	kill    context.CancelFunc
+	stdin   io.WriteCloser
+	stdout  *io.PipeReader
+	stderr  *stderrTail
+	remote  commandAddr
+
+	done    chan struct{}
+	expired atomic.Bool
+
+	mu         sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+	closeOnce  sync.Once
+}
+
+// wait reaps the process and ends reads with the reason it exited.
+func (c *commandConn) wait(stdout *io.PipeWriter) {
+	defer close(c.done)
+	err := c.cmd.Wait()
+	switch {
+	case c.expired.Load():
+		stdout.CloseWithError(fmt.Errorf("proxy command %q: %w", c.command, os.ErrDeadlineExceeded))
+	case err != nil:
+		stdout.CloseWithError(c.exitError(err))
+	default:
+		stdout.Close()
+	}
+}
+
+func (c *commandConn) exitError(err error) error {
+	if message := c.stderr.String(); message != "" {
+		return fmt.Errorf("proxy command %q exited: %w: %s", c.command, err, message)
+	}
+	return fmt.Errorf("proxy command %q exited: %w", c.command, err)
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	n, err := c.stdin.Write(b)
+	if err != nil && c.expired.Load() {
+		err = fmt.Errorf("proxy command %q: %w", c.command, os.ErrDeadlineExceeded)
+	}
+	return n, err
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		stopTimer(&c.readTimer)
+		stopTimer(&c.writeTimer)
+		c.mu.Unlock()
+		c.stdin.Close()
+		c.kill()
+		<-c.done
+		c.stdout.Close()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("proxy-command") }
+func (c *commandConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(&c.readTimer, t)
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(&c.writeTimer, t)
+	return nil
+}
+
+// setDeadline replaces timer with one that kills the process at t. A zero
+// t only clears it.
+func (c *commandConn) setDeadline(timer **time.Timer, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stopTimer(timer)
+	if t.IsZero() {
+		return
+	}
+	*timer = time.AfterFunc(time.Until(t), func() {
+		c.expired.Store(true)
+		c.kill()
+	})
+}
+
+func stopTimer(timer **time.Timer) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+}
+
+// stderrTail keeps the last maxCommandStderr bytes a proxy command wrote
+// to stderr.
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (s *stderrTail) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, b...)
+	if len(s.buf) > maxCommandStderr {
+		s.buf = append([]byte(nil), s.buf[len(s.buf)-maxCommandStderr:]...)
+	}
+	return len(b), nil
+}
+
+func (s *stderrTail) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.TrimSpace(string(s.buf))
+}
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "proxy-command" }
+func (a commandAddr) String() string  { return string(a) }
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// HTTPConnectDialer tunnels connections through an HTTP proxy using the
+// CONNECT method, with optional Basic proxy authentication.
+type HTTPConnectDialer struct {
+	ProxyAddress string
+	Auth         *Auth
+	Header       http.Header
+	Forward      ContextDialer
+}
+
+func NewHTTPConnectDialer(proxyAddress string, auth *Auth, forward ContextDialer) *HTTPConnectDialer {
+	return &HTTPConnectDialer{ProxyAddress: proxyAddress, Auth: auth, Forward: forward}
+}
+
+// ID names the proxy route, so configs that reach a jump server through
+// the same proxy share the connection. It includes the proxy password and
+// is empty when Forward has no ID.
+func (d *HTTPConnectDialer) ID() string {
+	id := routeID("http-connect", d.ProxyAddress, d.Auth, d.Forward)
+	if id != "" && len(d.Header) > 0 {
+		id += "\x00" + fmt.Sprint(d.Header)
+	}
+	return id
+}
+
+func (d *HTTPConnectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("http proxy: unsupported network %q", network)
+	}
+	conn, err := forwardDialer(d.Forward).DialContext(ctx, "tcp", d.ProxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("http proxy %s: %w", d.ProxyAddress, err)
+	}
+	clearDeadline := applyContextDeadline(ctx, conn)
+	tunnel, err := d.connect(conn, address)
+	clearDeadline()
+	if err != nil {
+		conn.Close()
+		err = handshakeError(ctx, err)
+		return nil, fmt.Errorf("http proxy %s: %w", d.ProxyAddress, err)
+	}
+	return tunnel, nil
+}
+
+func (d *HTTPConnectDialer) connect(conn net.Conn, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	for key, values := range d.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if d.Auth != nil {
+		token := base64.StdEncoding.EncodeToString([]byte(d.Auth.Username + ":" + d.Auth.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+token)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write CONNECT request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s rejected: %s", address, resp.Status)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns bytes the proxy sent right after its CONNECT reply
+// before reading from the underlying connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
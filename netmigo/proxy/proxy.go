@@ -0,0 +1,76 @@
+// Package proxy provides net.Conn dialers that reach devices through
+// SOCKS5 or HTTP CONNECT proxies. The dialers satisfy config.Dialer and can
+// be set on a DeviceConfig, including the config of a jump server.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// ContextDialer opens a connection to address over network.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Auth holds optional proxy credentials.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// routeID names a proxy route for DeviceConfig.Key: the kind of proxy, its
+// address and credentials and the ID of the forward dialer. It is empty
+// when the forward dialer has no ID, since the route cannot be compared
+// then.
+func routeID(kind, proxyAddress string, auth *Auth, forward ContextDialer) string {
+	id := kind + "\x00" + proxyAddress
+	if auth != nil {
+		id += "\x00" + auth.Username + "\x00" + auth.Password
+	}
+	if forward == nil {
+		return id
+	}
+	identified, ok := forward.(interface{ ID() string })
+	if !ok || identified.ID() == "" {
+		return ""
+	}
+	return id + "\x00via\x00" + identified.ID()
+}
+
+func forwardDialer(forward ContextDialer) ContextDialer {
+	if forward == nil {
+		return &net.Dialer{}
+	}
+	return forward
+}
+
+// applyContextDeadline bounds the proxy handshake by the context deadline
+// and returns a function that clears it again.
+func applyContextDeadline(ctx context.Context, conn net.Conn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	return func() {
+		stop()
+		_ = conn.SetDeadline(time.Time{})
+	}
+}
+
+// handshakeError reports context cancellation or expiry instead of the
+// i/o error it caused on the proxy connection.
+func handshakeError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
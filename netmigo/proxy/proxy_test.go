@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOCKS5DialerWithAuthReachesTarget(t *testing.T) {
+	target := startEchoServer(t)
+	proxyAddr, requested := startSOCKS5StandIn(t, &Auth{Username: "svc", Password: "s3cret"})
+
+	dialer := NewSOCKS5Dialer(proxyAddr, &Auth{Username: "svc", Password: "s3cret"}, nil)
+	conn, err := dialer.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	assertEcho(t, conn)
+	if got := <-requested; got != target {
+		t.Fatalf("proxy CONNECT target = %q, want %q", got, target)
+	}
+}
+
+func TestSOCKS5DialerPassesHostNamesUnresolved(t *testing.T) {
+	proxyAddr, requested := startSOCKS5StandIn(t, nil)
+
+	dialer := NewSOCKS5Dialer(proxyAddr, nil, nil)
+	conn, err := dialer.DialContext(context.Background(), "tcp", "router1.example:22")
+	if err == nil {
+		conn.Close()
+	}
+	if got := <-requested; got != "router1.example:22" {
+		t.Fatalf("proxy CONNECT target = %q, want router1.example:22", got)
+	}
+}
+
+func TestSOCKS5DialerRejectsBadCredentials(t *testing.T) {
+	proxyAddr, _ := startSOCKS5StandIn(t, &Auth{Username: "svc", Password: "s3cret"})
+
+	dialer := NewSOCKS5Dialer(proxyAddr, &Auth{Username: "svc", Password: "wrong"}, nil)
+	_, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:22")
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("DialContext error = %v, want authentication failure", err)
+	}
+}
+
+func TestHTTPConnectDialerReachesTarget(t *testing.T) {
+	target := startEchoServer(t)
+	proxyAddr := startHTTPConnectStandIn(t, "Basic "+basicToken("svc", "s3cret"))
+
+	dialer := NewHTTPConnectDialer(proxyAddr, &Auth{Username: "svc", Password: "s3cret"}, nil)
+	conn, err := dialer.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	assertEcho(t, conn)
+}
+
+func TestHTTPConnectDialerReportsProxyRejection(t *testing.T) {
+	proxyAddr := startHTTPConnectStandIn(t, "Basic "+basicToken("svc", "s3cret"))
+
+	dialer := NewHTTPConnectDialer(proxyAddr, nil, nil)
+	_, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:22")
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Fatalf("DialContext error = %v, want 407 rejection", err)
+	}
+}
+
+func TestDialersChainThroughForward(t *testing.T) {
+	target := startEchoServer(t)
+	socksAddr, _ := startSOCKS5StandIn(t, nil)
+	httpAddr := startHTTPConnectStandIn(t, "")
+
+	// The HTTP proxy is itself only reachable through the SOCKS5 proxy.
+	dialer := NewHTTPConnectDialer(httpAddr, nil, NewSOCKS5Dialer(socksAddr, nil, nil))
+	conn, err := dialer.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	assertEcho(t, conn)
+}
+
+func TestDialerHonoursContextDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = NewSOCKS5Dialer(listener.Addr().String(), nil, nil).DialContext(ctx, "tcp", "127.0.0.1:22")
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("DialContext error = %v, want deadline exceeded", err)
+	}
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write through tunnel: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+	if line != "ping\n" {
+		t.Fatalf("echo = %q, want ping", line)
+	}
+}
+
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	return serve(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+	})
+}
+
+// startSOCKS5StandIn runs a minimal SOCKS5 server that supports CONNECT and
+// reports each requested target on the returned channel.
+func startSOCKS5StandIn(t *testing.T, auth *Auth) (string, <-chan string) {
+	t.Helper()
+	requested := make(chan string, 10)
+	addr := serve(t, func(conn net.Conn) {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		methods := make([]byte, header[1])
+		io.ReadFull(conn, methods)
+
+		if auth == nil {
+			conn.Write([]byte{socks5Version, socks5AuthNone})
+		} else {
+			conn.Write([]byte{socks5Version, socks5AuthPassword})
+			prefix := make([]byte, 2)
+			io.ReadFull(conn, prefix)
+			user := make([]byte, prefix[1])
+			io.ReadFull(conn, user)
+			passLen := make([]byte, 1)
+			io.ReadFull(conn, passLen)
+			pass := make([]byte, passLen[0])
+			io.ReadFull(conn, pass)
+			if string(user) != auth.Username || string(pass) != auth.Password {
+				conn.Write([]byte{0x01, 0x01})
+				return
+			}
+			conn.Write([]byte{0x01, 0x00})
+		}
+
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		var host string
+		switch request[3] {
+		case socks5AddrIPv4:
+			ip := make([]byte, 4)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		case socks5AddrIPv6:
+			ip := make([]byte, 16)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		case socks5AddrDomain:
+			length := make([]byte, 1)
+			io.ReadFull(conn, length)
+			name := make([]byte, length[0])
+			io.ReadFull(conn, name)
+			host = string(name)
+		}
+		portBytes := make([]byte, 2)
+		io.ReadFull(conn, portBytes)
+		target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+		requested <- target
+
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			conn.Write([]byte{socks5Version, 0x04, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer upstream.Close()
+		conn.Write([]byte{socks5Version, 0x00, 0x00, socks5AddrIPv4, 127, 0, 0, 1, 0, 0})
+		pipe(conn, upstream)
+	})
+	return addr, requested
+}
+
+// startHTTPConnectStandIn runs a minimal HTTP CONNECT proxy. When
+// wantAuth is non-empty, requests without a matching Proxy-Authorization
+// header are rejected with 407.
+func startHTTPConnectStandIn(t *testing.T, wantAuth string) string {
+	t.Helper()
+	return serve(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect {
+			io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			return
+		}
+		if wantAuth != "" && req.Header.Get("Proxy-Authorization") != wantAuth {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		upstream, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		defer upstream.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		pipe(conn, upstream)
+	})
+}
+
+func serve(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+}
+
+func basicToken(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestCommandDialerUsesProcessStdio(t *testing.T) {
+	conn, err := NewCommandDialer("cat").DialContext(context.Background(), "tcp", "router1:22")
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	assertEcho(t, conn)
+	if conn.RemoteAddr().String() != "router1:22" {
+		t.Fatalf("RemoteAddr = %s, want router1:22", conn.RemoteAddr())
+	}
+}
+
+func TestCommandDialerReportsStderrWhenTheCommandFails(t *testing.T) {
+	conn, err := NewCommandDialer("echo 'nc: connect to router1 port 22: Connection refused' >&2; exit 1").DialContext(context.Background(), "tcp", "router1:22")
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil || !strings.Contains(err.Error(), "Connection refused") || !strings.Contains(err.Error(), "exit status 1") {
+		t.Fatalf("Read error = %v, want the exit status and stderr", err)
+	}
+}
+
+func TestCommandDialerDeadlineKillsTheCommand(t *testing.T) {
+	conn, err := NewCommandDialer("sleep 30").DialContext(context.Background(), "tcp", "router1:22")
+	if err != nil {
+		t.Fatalf("DialContext returned error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Read returned after %s, want the deadline to end it", elapsed)
+	}
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version        = 0x05
+	socks5AuthNone       = 0x00
+	socks5AuthPassword   = 0x02
+	socks5AuthNoAccepted = 0xff
+	socks5CmdConnect     = 0x01
+	socks5AddrIPv4       = 0x01
+	socks5AddrDomain     = 0x03
+	socks5AddrIPv6       = 0x04
+)
+
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// SOCKS5Dialer connects through a SOCKS5 proxy (RFC 1928), optionally
+// authenticating with username/password (RFC 1929). Host names are passed
+// to the proxy unresolved.
+type SOCKS5Dialer struct {
+	ProxyAddress string
+	Auth         *Auth
+	Forward      ContextDialer
+}
+
+func NewSOCKS5Dialer(proxyAddress string, auth *Auth, forward ContextDialer) *SOCKS5Dialer {
+	return &SOCKS5Dialer{ProxyAddress: proxyAddress, Auth: auth, Forward: forward}
+}
+
+// ID names the proxy route, so configs that reach a jump server through
+// the same proxy share the connection. It includes the proxy password and
+// is empty when Forward has no ID.
+func (d *SOCKS5Dialer) ID() string {
+	return routeID("socks5", d.ProxyAddress, d.Auth, d.Forward)
+}
+
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5 proxy: unsupported network %q", network)
+	}
+	conn, err := forwardDialer(d.Forward).DialContext(ctx, "tcp", d.ProxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("socks5 proxy %s: %w", d.ProxyAddress, err)
+	}
+	clearDeadline := applyContextDeadline(ctx, conn)
+	err = d.handshake(conn, address)
+	clearDeadline()
+	if err != nil {
+		conn.Close()
+		err = handshakeError(ctx, err)
+		return nil, fmt.Errorf("socks5 proxy %s: %w", d.ProxyAddress, err)
+	}
+	return conn, nil
+}
+
+func (d *SOCKS5Dialer) handshake(conn net.Conn, address string) error {
+	methods := []byte{socks5AuthNone}
+	if d.Auth != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("write greeting: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read method selection: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected protocol version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if d.Auth == nil {
+			return errors.New("proxy requested credentials but none were configured")
+		}
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	case socks5AuthNoAccepted:
+		return errors.New("no acceptable authentication methods")
+	default:
+		return fmt.Errorf("unsupported authentication method %d", reply[1])
+	}
+
+	request, err := socks5ConnectRequest(address)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("write connect request: %w", err)
+	}
+	return readSOCKS5ConnectReply(conn)
+}
+
+func (d *SOCKS5Dialer) authenticate(conn net.Conn) error {
+	if len(d.Auth.Username) > 255 || len(d.Auth.Password) > 255 {
+		return errors.New("username or password longer than 255 bytes")
+	}
+	msg := []byte{0x01, byte(len(d.Auth.Username))}
+	msg = append(msg, d.Auth.Username...)
+	msg = append(msg, byte(len(d.Auth.Password)))
+	msg = append(msg, d.Auth.Password...)
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read authentication reply: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+func socks5ConnectRequest(address string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address %q: %w", address, err)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target port %q", portString)
+	}
+
+	request := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(request, socks5AddrIPv4)
+			request = append(request, ip4...)
+		} else {
+			request = append(request, socks5AddrIPv6)
+			request = append(request, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("target host name %q is too long", host)
+		}
+		request = append(request, socks5AddrDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	return binary.BigEndian.AppendUint16(request, uint16(port)), nil
+}
+
+func readSOCKS5ConnectReply(conn net.Conn) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("read connect reply: %w", err)
+	}
+	if header[1] != 0x00 {
+		if msg, ok := socks5ReplyMessages[header[1]]; ok {
+			return fmt.Errorf("connect failed: %s", msg)
+		}
+		return fmt.Errorf("connect failed with code %d", header[1])
+	}
+
+	var addrLen int
+	switch header[3] {
+	case socks5AddrIPv4:
+		addrLen = net.IPv4len
+	case socks5AddrIPv6:
+		addrLen = net.IPv6len
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return fmt.Errorf("read bound address: %w", err)
+		}
+		addrLen = int(length[0])
+	default:
+		return fmt.Errorf("unsupported bound address type %d", header[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("read bound address: %w", err)
+	}
+	return nil
+}
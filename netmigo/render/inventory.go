@@ -0,0 +1,53 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// ErrUnknownDevice is returned for a device that is not in the inventory.
+var ErrUnknownDevice = errors.New("device not in inventory")
+
+// Inventory holds template variables per device. It is read from JSON:
+//
+//	{
+//	  "defaults": {"ntp_server": "192.0.2.123"},
+//	  "devices": {
+//	    "edge1": {"loopback": "10.255.0.1"},
+//	    "edge2": {"loopback": "10.255.0.2", "ntp_server": "192.0.2.124"}
+//	  }
+//	}
+type Inventory struct {
+	Defaults Vars            `json:"defaults"`
+	Devices  map[string]Vars `json:"devices"`
+}
+
+// LoadInventory reads the inventory in the JSON file at path.
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", path, err)
+	}
+	return &inv, nil
+}
+
+// Vars returns the variables of device: the defaults, overridden by the
+// device's own. The device's name is available as "name" unless the
+// inventory sets it.
+func (inv *Inventory) Vars(device string) (Vars, error) {
+	own, ok := inv.Devices[device]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDevice, device)
+	}
+	vars := Vars{"name": device}
+	maps.Copy(vars, inv.Defaults)
+	maps.Copy(vars, own)
+	return vars, nil
+}
@@ -0,0 +1,255 @@
+// Package render renders configuration templates with per-device
+// variables, validates the result and sends it to a device, or shows what
+// it would change without sending it.
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/jonelmawirat/netmigo/netmigo/backup"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/configdiff"
+	"github.com/jonelmawirat/netmigo/netmigo/repository"
+	"github.com/jonelmawirat/netmigo/netmigo/service"
+)
+
+// noValue is what text/template prints for a nil value.
+const noValue = "<no value>"
+
+// Vars are the variables a template is rendered with.
+type Vars map[string]any
+
+// Validator checks the rendered configuration lines and returns a problem
+// with them, or nil.
+type Validator func(lines []string) error
+
+// ValidationError lists what is wrong with a rendered template.
+type ValidationError struct {
+	Template string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("template %s did not render a valid configuration: %s", e.Template, strings.Join(e.Problems, "; "))
+}
+
+// Template is a parsed configuration template.
+type Template struct {
+	name       string
+	tmpl       *template.Template
+	required   []string
+	validators []Validator
+}
+
+// Option configures a Template.
+type Option func(*templateOptions)
+
+type templateOptions struct {
+	funcs      template.FuncMap
+	required   []string
+	validators []Validator
+}
+
+// WithFuncs adds functions the template can call.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(o *templateOptions) {
+		if o.funcs == nil {
+			o.funcs = template.FuncMap{}
+		}
+		for name, fn := range funcs {
+			o.funcs[name] = fn
+		}
+	}
+}
+
+// WithRequired names variables that must be set, and not empty, for the
+// template to render.
+func WithRequired(names ...string) Option {
+	return func(o *templateOptions) {
+		o.required = append(o.required, names...)
+	}
+}
+
+// WithValidator adds a check of the rendered lines.
+func WithValidator(v Validator) Option {
+	return func(o *templateOptions) {
+		o.validators = append(o.validators, v)
+	}
+}
+
+// New parses text as a template named name. A variable the template uses
+// but the Vars lack is an error when rendering, not an empty string.
+func New(name, text string, opts ...Option) (*Template, error) {
+	var o templateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(o.funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return &Template{name: name, tmpl: tmpl, required: o.required, validators: o.validators}, nil
+}
+
+// NewFromFile parses the template in the file at path, named after the
+// file.
+func NewFromFile(path string, opts ...Option) (*Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	return New(filepath.Base(path), string(text), opts...)
+}
+
+// Name returns the template's name.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Rendered is a rendered template.
+type Rendered struct {
+	Text string
+	// Lines are the lines of Text to send, without blank lines and "!"
+	// separators.
+	Lines []string
+}
+
+// Render renders the template with vars and validates the result. A
+// failed validation returns a *ValidationError, along with the rendered
+// text when the problem is in it.
+func (t *Template) Render(vars Vars) (*Rendered, error) {
+	var problems []string
+	for _, name := range t.required {
+		if v, ok := vars[name]; !ok || v == nil || fmt.Sprint(v) == "" {
+			problems = append(problems, fmt.Sprintf("variable %s is not set", name))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Template: t.name, Problems: problems}
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, map[string]any(vars)); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", t.name, err)
+	}
+	rendered := &Rendered{Text: b.String(), Lines: configLines(b.String())}
+
+	for i, line := range strings.Split(rendered.Text, "\n") {
+		if strings.Contains(line, noValue) {
+			problems = append(problems, fmt.Sprintf("line %d has an unset value: %s", i+1, strings.TrimSpace(line)))
+		}
+	}
+	if len(rendered.Lines) == 0 {
+		problems = append(problems, "no configuration lines")
+	}
+	for _, validate := range t.validators {
+		if err := validate(rendered.Lines); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return rendered, &ValidationError{Template: t.name, Problems: problems}
+	}
+	return rendered, nil
+}
+
+// configLines returns the lines of text to send, skipping blank lines and
+// "!" separators like SendConfigFile does.
+func configLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		line = strings.TrimRight(line, " \t")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed == "!" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ApplyOption configures Apply.
+type ApplyOption func(*applyOptions)
+
+type applyOptions struct {
+	dryRun   io.Writer
+	execOpts []repository.ExecuteOption
+}
+
+// DryRun makes Apply print the rendered configuration and its diff against
+// the running configuration to w instead of sending it. Only the command
+// that retrieves the running configuration runs on the device.
+func DryRun(w io.Writer) ApplyOption {
+	return func(o *applyOptions) {
+		o.dryRun = w
+	}
+}
+
+// WithExecuteOptions passes opts to SendConfigSet, or in a dry run to the
+// Execute that retrieves the running configuration.
+func WithExecuteOptions(opts ...repository.ExecuteOption) ApplyOption {
+	return func(o *applyOptions) {
+		o.execOpts = append(o.execOpts, opts...)
+	}
+}
+
+// Result is the outcome of Apply.
+type Result struct {
+	Rendered *Rendered
+	// Diff compares the rendered snippet with the running configuration.
+	// It is only set in a dry run on a platform with a backup profile.
+	Diff *configdiff.Result
+	// Config is the device's answer to the lines; nil in a dry run.
+	Config *repository.ConfigResult
+}
+
+// Apply renders the template with vars and sends the lines to a connected
+// device with SendConfigSet, so device must be a service.Configurer unless
+// the run is dry. Nothing is sent when rendering or validation fails.
+func (t *Template) Apply(device service.DeviceService, platform config.Platform, vars Vars, opts ...ApplyOption) (*Result, error) {
+	var o applyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rendered, err := t.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Rendered: rendered}
+	if o.dryRun != nil {
+		return result, t.dryRun(o.dryRun, device, platform, result, o.execOpts)
+	}
+	configurer, ok := device.(service.Configurer)
+	if !ok {
+		return result, fmt.Errorf("render: %T cannot send configuration", device)
+	}
+	result.Config, err = configurer.SendConfigSet(rendered.Lines, o.execOpts...)
+	return result, err
+}
+
+func (t *Template) dryRun(w io.Writer, device service.DeviceService, platform config.Platform, result *Result, execOpts []repository.ExecuteOption) error {
+	fmt.Fprintf(w, "! rendered from %s\n%s", t.name, result.Rendered.Text)
+	if !strings.HasSuffix(result.Rendered.Text, "\n") {
+		fmt.Fprintln(w)
+	}
+	diff, err := configdiff.CompareRunning(device, platform, result.Rendered.Text, configdiff.Merge(), configdiff.WithExecuteOptions(execOpts...))
+	if errors.Is(err, backup.ErrNoProfile) {
+		_, err = fmt.Fprintf(w, "! no running configuration to compare for %v\n", platform)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	result.Diff = diff
+	if diff.Equal() {
+		_, err = fmt.Fprintln(w, "! no changes to the running configuration")
+		return err
+	}
+	_, err = fmt.Fprintf(w, "! diff against the running configuration\n%s", diff.Unified)
+	return err
+}
@@ -0,0 +1,192 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/internal/devicetest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+const interfacesTemplate = `hostname {{.name}}
+!
+{{- range .interfaces}}
+interface {{.name}}
+ description {{.description}}
+{{- if .shutdown}}
+ shutdown
+{{- else}}
+ no shutdown
+{{- end}}
+!
+{{- end}}
+ntp server {{.ntp_server}}
+`
+
+const inventoryJSON = `{
+  "defaults": {"ntp_server": "192.0.2.123"},
+  "devices": {
+    "edge1": {
+      "interfaces": [
+        {"name": "GigabitEthernet0/0/0/0", "description": "uplink to core", "shutdown": false},
+        {"name": "GigabitEthernet0/0/0/1", "description": "spare", "shutdown": true}
+      ]
+    },
+    "edge2": {"ntp_server": "192.0.2.124"}
+  }
+}`
+
+const runningConfig = `RP/0/RSP0/CPU0:edge1#show running-config
+Building configuration...
+hostname edge1
+interface GigabitEthernet0/0/0/0
+ description uplink
+ no shutdown
+!
+interface GigabitEthernet0/0/0/1
+ description spare
+ shutdown
+!
+ntp server 192.0.2.123
+end
+
+RP/0/RSP0/CPU0:edge1#`
+
+func loadInventory(t *testing.T) *Inventory {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := os.WriteFile(path, []byte(inventoryJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := LoadInventory(path)
+	if err != nil {
+		t.Fatalf("LoadInventory returned error: %v", err)
+	}
+	return inv
+}
+
+func TestInventoryVarsOverrideDefaults(t *testing.T) {
+	inv := loadInventory(t)
+	vars, err := inv.Vars("edge2")
+	if err != nil {
+		t.Fatalf("Vars returned error: %v", err)
+	}
+	if want := (Vars{"name": "edge2", "ntp_server": "192.0.2.124"}); !reflect.DeepEqual(vars, want) {
+		t.Fatalf("Vars() = %v, want %v", vars, want)
+	}
+	if _, err := inv.Vars("edge3"); !errors.Is(err, ErrUnknownDevice) {
+		t.Fatalf("Vars error = %v, want ErrUnknownDevice", err)
+	}
+}
+
+func TestApplySendsRenderedLines(t *testing.T) {
+	tmpl, err := New("interfaces", interfacesTemplate)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	vars, err := loadInventory(t).Vars("edge1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := devicetest.New(t, runningConfig)
+	result, err := tmpl.Apply(device, config.CISCO_IOSXR, vars)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	want := []string{
+		"hostname edge1",
+		"interface GigabitEthernet0/0/0/0",
+		" description uplink to core",
+		" no shutdown",
+		"interface GigabitEthernet0/0/0/1",
+		" description spare",
+		" shutdown",
+		"ntp server 192.0.2.123",
+	}
+	if sent := device.Sent(); !reflect.DeepEqual(sent, want) {
+		t.Fatalf("sent =\n%s\nwant\n%s", strings.Join(sent, "\n"), strings.Join(want, "\n"))
+	}
+	if !result.Config.Committed || result.Diff != nil {
+		t.Fatalf("Apply() = %+v", result)
+	}
+}
+
+func TestApplyDryRunPrintsDiffWithoutSending(t *testing.T) {
+	tmpl, err := New("interfaces", interfacesTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := loadInventory(t).Vars("edge1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := devicetest.New(t, runningConfig)
+	var out strings.Builder
+	result, err := tmpl.Apply(device, config.CISCO_IOSXR, vars, DryRun(&out))
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if sent := device.Sent(); sent != nil || result.Config != nil {
+		t.Fatalf("dry run sent %q", sent)
+	}
+	if want := []string{"interface GigabitEthernet0/0/0/0", " description uplink to core"}; !reflect.DeepEqual(result.Diff.Commands, want) {
+		t.Fatalf("Diff.Commands = %q, want %q", result.Diff.Commands, want)
+	}
+	for _, part := range []string{
+		"! rendered from interfaces\nhostname edge1\n",
+		"! diff against the running configuration\n--- running\n+++ candidate\n",
+		"+ description uplink to core\n",
+	} {
+		if !strings.Contains(out.String(), part) {
+			t.Fatalf("dry run output missing %q:\n%s", part, out.String())
+		}
+	}
+
+	out.Reset()
+	if _, err := tmpl.Apply(device, config.LINUX, vars, DryRun(&out)); err != nil || !strings.Contains(out.String(), "! no running configuration to compare for") {
+		t.Fatalf("Linux dry run = %q, %v", out.String(), err)
+	}
+}
+
+func TestRenderValidation(t *testing.T) {
+	noAAA := func(lines []string) error {
+		for _, line := range lines {
+			if strings.HasPrefix(line, "no aaa") {
+				return fmt.Errorf("line %q removes AAA", line)
+			}
+		}
+		return nil
+	}
+	tmpl, err := New("ntp", "{{.prefix}} aaa new-model\nntp server {{.ntp_server}}\n", WithRequired("ntp_server"), WithValidator(noAAA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *ValidationError
+	if _, err := tmpl.Render(Vars{"prefix": ""}); !errors.As(err, &verr) || verr.Problems[0] != "variable ntp_server is not set" {
+		t.Fatalf("Render error = %v, want the unset variable", err)
+	}
+	if _, err := tmpl.Render(Vars{"ntp_server": "192.0.2.1"}); err == nil || errors.As(err, &verr) {
+		t.Fatalf("Render error = %v, want a missing key error", err)
+	}
+	if _, err := tmpl.Render(Vars{"prefix": "no", "ntp_server": nil}); !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("Render error = %v, want the unset variable", err)
+	}
+	rendered, err := tmpl.Render(Vars{"prefix": "no", "ntp_server": "192.0.2.1"})
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), `removes AAA`) || rendered == nil {
+		t.Fatalf("Render error = %v, want the validator's problem", err)
+	}
+
+	unset, err := New("unset", "ntp server {{.server.address}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unset.Render(Vars{"server": map[string]any{"address": nil}}); !errors.As(err, &verr) || !strings.Contains(verr.Problems[0], "line 1 has an unset value") {
+		t.Fatalf("Render error = %v, want the <no value> line", err)
+	}
+}
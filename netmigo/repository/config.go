@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ciscoConfigError matches the messages IOS, IOS-XE, IOS-XR and NX-OS
+	// print when a configuration line is rejected.
+	ciscoConfigError = regexp.MustCompile(`(?im)^\s*(%\s*(invalid|incomplete|ambiguous|unknown|unrecognized|failed|error|bad|cannot|not )|\^$|error:|syntax error)`)
+	// shellCommandError matches common failures of shell commands.
+	shellCommandError = regexp.MustCompile(`(?im)(command not found|permission denied|no such file or directory|syntax error|cannot )`)
+	// configConfirmPrompt matches a yes/no question such as IOS-XR's
+	// "Uncommitted changes found, commit them before exiting(yes/no/cancel)?".
+	configConfirmPrompt = regexp.MustCompile(`(?i)\(yes/no(/cancel)?\)\??\s*(\[\w+\])?\s*:?\s*$`)
+)
+
+// ConfigMode tells a shell how to enter and leave configuration mode and
+// how to recognise a rejected line.
+type ConfigMode struct {
+	// Enter is sent before the lines, e.g. "configure terminal". Empty
+	// sends the lines straight to the shell.
+	Enter string
+	// Commit is sent after the lines when none failed, for platforms with
+	// a candidate configuration such as IOS-XR.
+	Commit string
+	// Exit is sent last, e.g. "end". A yes/no question on the way out,
+	// such as IOS-XR's uncommitted changes prompt, is answered "no".
+	Exit         string
+	ErrorPattern *regexp.Regexp
+}
+
+var (
+	// CiscoConfigMode is configuration mode on IOS, IOS-XE and NX-OS.
+	CiscoConfigMode = ConfigMode{Enter: "configure terminal", Exit: "end", ErrorPattern: ciscoConfigError}
+	// IosxrConfigMode enters the IOS-XR target configuration and commits it
+	// when every line was accepted.
+	IosxrConfigMode = ConfigMode{Enter: "configure", Commit: "commit", Exit: "end", ErrorPattern: ciscoConfigError}
+	// ShellConfigMode runs the lines as commands in one shell.
+	ShellConfigMode = ConfigMode{ErrorPattern: shellCommandError}
+)
+
+// ConfigLineResult is what the device answered to one line. Error holds
+// the line of output that marked it as rejected.
+type ConfigLineResult struct {
+	Line   string
+	Output string
+	Error  string
+}
+
+// ConfigResult is the outcome of a configuration push. OutputFile holds
+// the whole session transcript, like the output files of Execute.
+type ConfigResult struct {
+	Lines      []ConfigLineResult
+	Commit     *ConfigLineResult
+	Committed  bool
+	OutputFile string
+}
+
+// Failed returns the lines the device rejected.
+func (r *ConfigResult) Failed() []ConfigLineResult {
+	var failed []ConfigLineResult
+	for _, line := range r.Lines {
+		if line.Error != "" {
+			failed = append(failed, line)
+		}
+	}
+	return failed
+}
+
+// Err returns a *ConfigError when a line or the commit was rejected.
+func (r *ConfigResult) Err() error {
+	failed := r.Failed()
+	if r.Commit != nil && r.Commit.Error != "" {
+		failed = append(failed, *r.Commit)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &ConfigError{Failed: failed}
+}
+
+// ConfigError lists the configuration lines a device rejected.
+type ConfigError struct {
+	Failed []ConfigLineResult
+}
+
+func (e *ConfigError) Error() string {
+	first := e.Failed[0]
+	msg := fmt.Sprintf("configuration line %q rejected: %s", first.Line, first.Error)
+	if len(e.Failed) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Failed)-1)
+	}
+	return msg
+}
+
+// configure enters configuration mode, sends lines, commits them when the
+// mode has a commit command and every line was accepted, and leaves again.
+// Configuration mode is left even when a line fails.
+func (sh *shellConn) configure(logger *slog.Logger, lines []string, mode ConfigMode, options *ExecuteOptions) (*ConfigResult, error) {
+	session, err := sh.openConfigSession(logger, mode, options, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := session.Send(lines)
+	if err == nil && mode.Commit != "" {
+		commit, commitErr := session.Command(mode.Commit)
+		if commitErr != nil {
+			err = commitErr
+		} else {
+			result.Commit = &commit
+			result.Committed = commit.Error == ""
+			err = result.Err()
+		}
+	}
+	path, closeErr := session.Close()
+	result.OutputFile = path
+	if err != nil {
+		return result, err
+	}
+	return result, closeErr
+}
+
+// answer collects output up to the prompt. A yes/no question is answered
+// "no" when decline is set and otherwise ends collection like a prompt.
+func (sh *shellConn) answer(firstByteTimeout, inactivityTimeout time.Duration, decline bool) ([]byte, error) {
+	var output []byte
+	for {
+		chunk, _, err := sh.collectUntil(firstByteTimeout, inactivityTimeout, configConfirmPrompt)
+		if err != nil {
+			return output, err
+		}
+		output = append(output, chunk...)
+		if !decline || !configConfirmPrompt.MatchString(lastLine(output)) {
+			return output, nil
+		}
+		if err := sh.writeLine("no"); err != nil {
+			return output, err
+		}
+		decline = false
+	}
+}
+
+// lineOutput strips the echoed line and the trailing prompt from output.
+func lineOutput(output []byte, line string) string {
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[:i]
+	} else {
+		output = nil
+	}
+	text := strings.ReplaceAll(string(output), "\r", "")
+	if first, rest, found := strings.Cut(text, "\n"); strings.HasSuffix(strings.TrimSpace(first), strings.TrimSpace(line)) {
+		if !found {
+			rest = ""
+		}
+		text = rest
+	}
+	return strings.Trim(text, "\n")
+}
+
+// errorLine returns the first line of output matching pattern.
+func errorLine(pattern *regexp.Regexp, output string) string {
+	if pattern == nil {
+		return ""
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if !pattern.MatchString(line) {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		// A lone caret points into the line above; report the message
+		// below it, which says what was wrong.
+		if line == "^" {
+			for _, next := range lines[i+1:] {
+				if next = strings.TrimSpace(next); next != "" {
+					return next
+				}
+			}
+		}
+		return line
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrConfigSessionClosed is returned by a ConfigSession after Close.
+var ErrConfigSessionClosed = errors.New("configuration session closed")
+
+// ConfigSession holds a shell in configuration mode across calls, for
+// platforms that stage changes and commit them separately. Other commands
+// on the same Telnet or console connection wait until Close.
+type ConfigSession struct {
+	sh      *shellConn
+	logger  *slog.Logger
+	mode    ConfigMode
+	options *ExecuteOptions
+	release func()
+
+	transcript []byte
+	left       bool
+	closed     bool
+}
+
+// openConfigSession takes the shell, enters enable when options ask for it
+// and then configuration mode. release, when set, runs on Close or when
+// the session cannot be opened.
+func (sh *shellConn) openConfigSession(logger *slog.Logger, mode ConfigMode, options *ExecuteOptions, release func()) (*ConfigSession, error) {
+	sh.exec.Lock()
+	s := &ConfigSession{sh: sh, logger: logger, mode: mode, options: options, release: release}
+	fail := func(err error) (*ConfigSession, error) {
+		s.closed = true
+		sh.exec.Unlock()
+		if release != nil {
+			release()
+		}
+		return nil, err
+	}
+
+	if options.Enable {
+		if err := sh.enable(logger, options.EnableSecret, options.Timeout); err != nil {
+			return fail(err)
+		}
+	}
+	sh.drain()
+	if mode.Enter == "" {
+		return s, nil
+	}
+	logger.Info("Entering configuration mode", "command", mode.Enter)
+	result, err := s.Command(mode.Enter)
+	if err != nil {
+		return fail(err)
+	}
+	if result.Error != "" {
+		return fail(fmt.Errorf("failed to enter configuration mode with %q: %s", mode.Enter, result.Error))
+	}
+	return s, nil
+}
+
+// Send sends lines and records the device's answer to each. Nothing is
+// committed. With StopOnError the remaining lines are skipped after the
+// first rejection, and with Sudo each line runs through sudo.
+func (s *ConfigSession) Send(lines []string) (*ConfigResult, error) {
+	result := &ConfigResult{}
+	for _, line := range lines {
+		s.logger.Info("Sending configuration line", "line", line)
+		var lr ConfigLineResult
+		var err error
+		if s.options.Sudo && !s.closed {
+			var output []byte
+			output, err = s.sh.runSudo(s.logger, line, s.options)
+			s.transcript = append(s.transcript, output...)
+			lr = s.lineResult(line, output)
+		} else {
+			lr, err = s.Command(line)
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Lines = append(result.Lines, lr)
+		if lr.Error != "" {
+			s.logger.Warn("Configuration line rejected", "line", line, "error", lr.Error)
+			if s.options.StopOnError {
+				break
+			}
+		}
+	}
+	return result, result.Err()
+}
+
+// Command sends one line and returns the device's answer. A yes/no
+// question ends the answer like a prompt and is left for the next line to
+// answer.
+func (s *ConfigSession) Command(command string) (ConfigLineResult, error) {
+	return s.send(command, false)
+}
+
+// Leave sends command, which leaves configuration mode, such as "end" or
+// IOS-XR's "abort". A question about uncommitted changes is answered "no".
+func (s *ConfigSession) Leave(command string) (ConfigLineResult, error) {
+	s.logger.Info("Leaving configuration mode", "command", command)
+	result, err := s.send(command, true)
+	if err == nil {
+		s.left = true
+	}
+	return result, err
+}
+
+// Close leaves configuration mode with the mode's Exit command unless
+// Leave already did, writes the session transcript to the output directory
+// and releases the shell. It returns the transcript's path.
+func (s *ConfigSession) Close() (string, error) {
+	if s.closed {
+		return "", ErrConfigSessionClosed
+	}
+	var exitErr error
+	if !s.left && s.mode.Exit != "" {
+		if _, err := s.Leave(s.mode.Exit); err != nil {
+			exitErr = fmt.Errorf("leaving configuration mode: %w", err)
+		}
+	}
+	s.closed = true
+	s.sh.exec.Unlock()
+	if s.release != nil {
+		s.release()
+	}
+
+	path, err := writeCommandOutput(s.logger, fmt.Sprintf("config_output_%s.txt", time.Now().Format("20060102150405.000000000")), s.transcript)
+	if err != nil {
+		return "", err
+	}
+	return path, exitErr
+}
+
+func (s *ConfigSession) send(command string, decline bool) (ConfigLineResult, error) {
+	if s.closed {
+		return ConfigLineResult{}, ErrConfigSessionClosed
+	}
+	if err := s.sh.writeLine(command); err != nil {
+		return ConfigLineResult{}, fmt.Errorf("failed to send %q: %w", command, err)
+	}
+	output, err := s.sh.answer(s.options.FirstByteTimeout, s.options.Timeout, decline)
+	s.transcript = append(s.transcript, output...)
+	if err != nil {
+		return ConfigLineResult{}, fmt.Errorf("configuration line %q: %w", command, err)
+	}
+	return s.lineResult(command, output), nil
+}
+
+func (s *ConfigSession) lineResult(line string, output []byte) ConfigLineResult {
+	text := lineOutput(output, line)
+	return ConfigLineResult{Line: line, Output: text, Error: errorLine(s.mode.ErrorPattern, text)}
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+)
+
+func configureInterfaces(line string) string {
+	if strings.HasPrefix(line, "interface ") || strings.HasPrefix(line, "description ") {
+		return ""
+	}
+	return "                 ^\n% Invalid input detected at '^' marker."
+}
+
+func TestSendConfigReportsRejectedLines(t *testing.T) {
+	chdirTemp(t)
+	client := connectCLI(t, sshtest.CLI{Configure: configureInterfaces})
+	repo := NewSSHRepository(slog.New(slog.NewTextHandler(io.Discard, nil))).(*sshRepositoryImpl)
+
+	lines := []string{"interface Gi0/1", " description uplink", " speed fast", " description core"}
+	result, err := repo.SendConfig(client, lines, CiscoConfigMode, WithTimeout(5*time.Second))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("SendConfig error = %v, want *ConfigError", err)
+	}
+	if len(result.Lines) != len(lines) {
+		t.Fatalf("got %d line results, want %d", len(result.Lines), len(lines))
+	}
+	if len(configErr.Failed) != 1 || configErr.Failed[0].Line != " speed fast" {
+		t.Fatalf("failed lines = %+v, want only %q", configErr.Failed, " speed fast")
+	}
+	if got := result.Lines[2].Error; got != "% Invalid input detected at '^' marker." {
+		t.Fatalf("Error = %q, want the message below the caret", got)
+	}
+	if result.Lines[0].Error != "" || result.Lines[0].Output != "" {
+		t.Fatalf("accepted line result = %+v, want no output", result.Lines[0])
+	}
+	if output := readOutput(t, result.OutputFile); !strings.Contains(output, "router(config)#") || !strings.HasSuffix(strings.TrimSpace(output), "router#") {
+		t.Fatalf("transcript = %q, want configuration mode entered and left", output)
+	}
+
+	result, err = repo.SendConfig(client, lines, CiscoConfigMode, WithStopOnError(), WithTimeout(5*time.Second))
+	if err == nil || len(result.Lines) != 3 {
+		t.Fatalf("SendConfig with StopOnError = %d lines, %v, want 3 lines and an error", len(result.Lines), err)
+	}
+}
+
+func TestSendConfigCommitsOnlyWhenEveryLineIsAccepted(t *testing.T) {
+	chdirTemp(t)
+	client := connectCLI(t, sshtest.CLI{
+		Prompt:    "RP/0/RSP0/CPU0:router#",
+		Configure: configureInterfaces,
+		Candidate: true,
+	})
+	repo := NewSSHRepository(slog.New(slog.NewTextHandler(io.Discard, nil))).(*sshRepositoryImpl)
+
+	result, err := repo.SendConfig(client, []string{"interface Gi0/0/0/1", " description uplink"}, IosxrConfigMode, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("SendConfig returned error: %v", err)
+	}
+	if !result.Committed || result.Commit == nil || result.Commit.Line != "commit" {
+		t.Fatalf("result = %+v, want the changes committed", result)
+	}
+
+	result, err = repo.SendConfig(client, []string{"interface Gi0/0/0/1", " mtu jumbo"}, IosxrConfigMode, WithTimeout(5*time.Second))
+	if err == nil || result.Committed || result.Commit != nil {
+		t.Fatalf("result = %+v, %v, want no commit after a rejected line", result, err)
+	}
+	output := readOutput(t, result.OutputFile)
+	if !strings.Contains(output, "Uncommitted changes found") || !strings.HasSuffix(strings.TrimSpace(output), "RP/0/RSP0/CPU0:router#") {
+		t.Fatalf("transcript = %q, want the uncommitted changes declined on the way out", output)
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"", ""},
+		{"% Incomplete command.", "% Incomplete command."},
+		{"   ^\n% Invalid input detected at '^' marker.", "% Invalid input detected at '^' marker."},
+		{"% Ambiguous command:  \"sh\"", "% Ambiguous command:  \"sh\""},
+		{"Building configuration...\n[OK]", ""},
+	}
+	for _, tt := range tests {
+		if got := errorLine(ciscoConfigError, tt.output); got != tt.want {
+			t.Errorf("errorLine(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultConsoleClearCommand = "clear line %s"
+	consoleWakeAttempts        = 3
+	// consoleBreakLength is the break duration in milliseconds requested
+	// over SSH (RFC 4335).
+	consoleBreakLength = 500
+)
+
+var (
+	// consoleSettleTime is how long the line must stay quiet before the
+	// console server is considered done with its own login and banner.
+	consoleSettleTime = 1 * time.Second
+	// consoleWakeInterval is how long to wait for output before sending
+	// another carriage return to wake the line.
+	consoleWakeInterval = 2 * time.Second
+	// consoleClearTimeout bounds each step of clearing a busy line.
+	consoleClearTimeout = 2 * time.Second
+)
+
+var (
+	consoleLineBusy    = regexp.MustCompile(`(?i)(connection refused by remote host|line is busy|port (is )?(already )?in use|port busy)`)
+	consolePressReturn = regexp.MustCompile(`(?i)press return to get started`)
+	consoleMore        = regexp.MustCompile(`(?i)-+ ?more ?-+\s*$`)
+	consoleSetupDialog = regexp.MustCompile(`(?i)initial configuration dialog\?\s*\[yes/no\]:\s*$`)
+	consoleConfigMode  = regexp.MustCompile(`\(config[^)]*\)#\s*$`)
+	consoleROMMON      = regexp.MustCompile(`(?i)(rommon\s*\d*\s*>|^switch:|^loader>)\s*$`)
+	consoleConfirm     = regexp.MustCompile(`\[confirm\]\s*$`)
+	consoleCommandErr  = regexp.MustCompile(`(?m)^%\s*(invalid|incomplete|ambiguous|unknown)`)
+
+	errConsoleLineBusy = errors.New("console line is busy")
+)
+
+// ConsoleConn is a logged-in session on a device console line.
+type ConsoleConn struct {
+	*shellConn
+
+	telnet  *TelnetConn
+	client  *ssh.Client
+	session *ssh.Session
+
+	jumpClient *ssh.Client
+	jumpCfg    *config.DeviceConfig
+
+	rommon bool
+}
+
+// ROMMON reports whether the device was found at a ROMMON or boot loader
+// prompt rather than its CLI.
+func (c *ConsoleConn) ROMMON() bool {
+	return c.rommon
+}
+
+// Transport reports how the console server was reached.
+func (c *ConsoleConn) Transport() config.Transport {
+	if c.telnet != nil {
+		return config.TransportTelnet
+	}
+	return config.TransportSSH
+}
+
+// Close closes the connection to the console server without logging out
+// of the device.
+func (c *ConsoleConn) Close() error {
+	err := c.shellConn.Close()
+	if c.client != nil {
+		c.client.Close()
+	}
+	return err
+}
+
+func (c *ConsoleConn) sendBreak() error {
+	if c.telnet != nil {
+		return c.telnet.sendBreak()
+	}
+	ok, err := c.session.SendRequest("break", true, ssh.Marshal(struct{ Length uint32 }{consoleBreakLength}))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("console server refused the break request")
+	}
+	return nil
+}
+
+// ConsoleRepository reaches devices through console server lines. It
+// handles the console server login, wakes the line, logs in to the device
+// or picks up a session that is already logged in, and can clear a line a
+// stale session is holding. Commands then behave as on TelnetRepository.
+type ConsoleRepository interface {
+	Connect(cfg config.DeviceConfig) (*ConsoleConn, error)
+	ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*ConsoleConn, error)
+	Disconnect(conn *ConsoleConn)
+	InteractiveExecute(conn *ConsoleConn, command string, opts ...ExecuteOption) (string, error)
+	InteractiveExecuteMultiple(conn *ConsoleConn, commands []string, opts ...ExecuteOption) ([]string, error)
+	Ping(conn *ConsoleConn) error
+	SendBreak(conn *ConsoleConn) error
+	Privileged(conn *ConsoleConn, opts ...ExecuteOption) (bool, error)
+	SendConfig(conn *ConsoleConn, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error)
+	OpenConfigSession(conn *ConsoleConn, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error)
+}
+
+type consoleRepositoryImpl struct {
+	logger *slog.Logger
+	jumps  *JumpClientManager
+	telnet TelnetRepository
+}
+
+// NewConsoleRepository accepts the same options as NewSSHRepository.
+func NewConsoleRepository(logger *slog.Logger, opts ...RepositoryOption) ConsoleRepository {
+	base := &sshRepositoryImpl{jumps: DefaultJumpClientManager}
+	for _, opt := range opts {
+		opt(base)
+	}
+	return &consoleRepositoryImpl{
+		logger: logger,
+		jumps:  base.jumps,
+		telnet: NewTelnetRepository(logger, opts...),
+	}
+}
+
+func (r *consoleRepositoryImpl) Connect(cfg config.DeviceConfig) (*ConsoleConn, error) {
+	return r.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext connects to the console line in cfg.Console. When the
+// console server reports the line busy and ClearServer is set, the line is
+// cleared and the connection retried once.
+func (r *consoleRepositoryImpl) ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*ConsoleConn, error) {
+	if cfg.Console == nil {
+		return nil, errors.New("device config has no console settings; use WithConsole")
+	}
+	if cfg.TelnetPort == "" {
+		cfg.TelnetPort = defaultTelnetPort
+	}
+
+	conn, err := r.open(ctx, cfg)
+	if errors.Is(err, errConsoleLineBusy) && cfg.Console.ClearServer != nil {
+		r.logger.Warn("Console line is busy, clearing it", "line", cfg.Console.Line)
+		if clearErr := r.clearLine(ctx, cfg.Console); clearErr != nil {
+			return nil, fmt.Errorf("%w; clearing line %s failed: %w", err, cfg.Console.Line, clearErr)
+		}
+		conn, err = r.open(ctx, cfg)
+	}
+	return conn, err
+}
+
+func (r *consoleRepositoryImpl) open(ctx context.Context, cfg config.DeviceConfig) (*ConsoleConn, error) {
+	if cfg.Transport == config.TransportTelnet {
+		return r.openTelnet(ctx, cfg)
+	}
+
+	client, jumpClient, err := connectToTarget(ctx, r.jumps, cfg)
+	if err != nil {
+		if cfg.Transport != config.TransportSSHThenTelnet || isAuthFailureError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		r.logger.Warn("SSH to console server failed, falling back to Telnet", "host", cfg.IP, "error", err)
+		return r.openTelnet(ctx, cfg)
+	}
+
+	sh, session, err := newSSHShell(client)
+	if err != nil {
+		client.Close()
+		if jumpClient != nil {
+			releaseJumpClientFunc(r.jumps, cfg.JumpServer, jumpClient)
+		}
+		return nil, err
+	}
+	conn := &ConsoleConn{shellConn: sh, client: client, session: session}
+	if jumpClient != nil {
+		conn.jumpClient = jumpClient
+		conn.jumpCfg = cfg.JumpServer
+	}
+	return r.start(conn, cfg)
+}
+
+func (r *consoleRepositoryImpl) openTelnet(ctx context.Context, cfg config.DeviceConfig) (*ConsoleConn, error) {
+	if cfg.JumpServer == nil {
+		netConn, err := dialTelnet(r.logger, cfg)
+		if err != nil {
+			return nil, err
+		}
+		t := newTelnetConn(netConn)
+		return r.start(&ConsoleConn{shellConn: t.shellConn, telnet: t}, cfg)
+	}
+
+	jumpClient, err := getJumpClientFunc(r.jumps, ctx, cfg.JumpServer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jump server client: %w", err)
+	}
+	netConn, err := dialTelnetThroughJump(jumpClient, cfg)
+	if err != nil {
+		releaseJumpClientFunc(r.jumps, cfg.JumpServer, jumpClient)
+		return nil, err
+	}
+	t := newTelnetConn(netConn)
+	return r.start(&ConsoleConn{shellConn: t.shellConn, telnet: t, jumpClient: jumpClient, jumpCfg: cfg.JumpServer}, cfg)
+}
+
+// start runs the console login on a freshly opened connection and closes
+// it again if the login fails.
+func (r *consoleRepositoryImpl) start(conn *ConsoleConn, cfg config.DeviceConfig) (*ConsoleConn, error) {
+	if err := r.login(conn, cfg); err != nil {
+		r.closeConn(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// login performs the two-stage console login. Prompts that arrive before
+// the line is woken come from the console server and are answered with the
+// DeviceConfig credentials; prompts after the wake come from the device and
+// are answered with the ConsoleConfig credentials.
+func (r *consoleRepositoryImpl) login(conn *ConsoleConn, cfg config.DeviceConfig) error {
+	if cfg.Prompt != nil {
+		conn.prompt = cfg.Prompt
+	}
+	timeout := cfg.ConnectionTimeout
+	if timeout <= 0 {
+		timeout = defaultTelnetLoginTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	output, err := r.loginServer(conn, cfg, deadline.C)
+	if err != nil {
+		return err
+	}
+	if cfg.Console.Break {
+		r.logger.Info("Sending break on console line")
+		if err := conn.sendBreak(); err != nil {
+			return fmt.Errorf("failed to send break: %w", err)
+		}
+	}
+	return r.loginDevice(conn, cfg, output, deadline.C)
+}
+
+// loginServer answers the console server's own login prompts, on Telnet,
+// and waits for the line to go quiet. Output that is not a server prompt is
+// handed on to the device stage.
+func (r *consoleRepositoryImpl) loginServer(conn *ConsoleConn, cfg config.DeviceConfig, deadline <-chan time.Time) ([]byte, error) {
+	quiet := time.NewTimer(consoleSettleTime)
+	defer quiet.Stop()
+
+	var output []byte
+	sentUsername, sentPassword := false, false
+	for {
+		select {
+		case chunk, ok := <-conn.data:
+			if !ok {
+				return nil, r.closedError(cfg, output, conn.err)
+			}
+			output = append(output, chunk...)
+			quiet.Reset(consoleSettleTime)
+		case <-quiet.C:
+			return output, nil
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for console server %s (last output %q)", r.address(conn, cfg), lastLine(output))
+		}
+
+		if consoleLineBusy.Match(output) {
+			return nil, fmt.Errorf("%s: %w", r.address(conn, cfg), errConsoleLineBusy)
+		}
+		if conn.telnet == nil {
+			// Over SSH the console server has already authenticated us.
+			continue
+		}
+		if telnetLoginFailed.Match(output) {
+			return nil, fmt.Errorf("console server authentication failed for %q on %s", cfg.Username, r.address(conn, cfg))
+		}
+		last := lastLine(output)
+		switch {
+		case telnetUsernamePrompt.MatchString(last):
+			if sentUsername {
+				return nil, fmt.Errorf("console server authentication failed for %q on %s: asked to log in again", cfg.Username, r.address(conn, cfg))
+			}
+			r.logger.Debug("Answering console server username prompt", "prompt", last)
+			if err := conn.writeLine(cfg.Username); err != nil {
+				return nil, err
+			}
+			sentUsername = true
+			output = output[:0]
+		case telnetPasswordPrompt.MatchString(last):
+			if sentPassword {
+				return nil, fmt.Errorf("console server authentication failed for %q on %s: password rejected", cfg.Username, r.address(conn, cfg))
+			}
+			r.logger.Debug("Answering console server password prompt", "prompt", last)
+			if err := conn.writeLine(cfg.Password); err != nil {
+				return nil, err
+			}
+			sentPassword = true
+			output = output[:0]
+		}
+	}
+}
+
+// loginDevice wakes the line and works through whatever the device shows
+// until it reaches a CLI or ROMMON prompt.
+func (r *consoleRepositoryImpl) loginDevice(conn *ConsoleConn, cfg config.DeviceConfig, output []byte, deadline <-chan time.Time) error {
+	console := cfg.Console
+	wakes := 1
+	if err := conn.writeLine(""); err != nil {
+		return fmt.Errorf("failed to wake console line: %w", err)
+	}
+	idle := time.NewTimer(consoleWakeInterval)
+	defer idle.Stop()
+
+	sentUsername, sentPassword := false, false
+	for {
+		select {
+		case chunk, ok := <-conn.data:
+			if !ok {
+				return r.closedError(cfg, output, conn.err)
+			}
+			output = append(output, chunk...)
+			idle.Reset(consoleWakeInterval)
+		case <-idle.C:
+			if wakes == consoleWakeAttempts {
+				return fmt.Errorf("no response on console line %s after %d wake attempts (last output %q)", r.address(conn, cfg), wakes, lastLine(output))
+			}
+			wakes++
+			r.logger.Debug("Waking console line again", "attempt", wakes)
+			if err := conn.writeLine(""); err != nil {
+				return fmt.Errorf("failed to wake console line: %w", err)
+			}
+			idle.Reset(consoleWakeInterval)
+			continue
+		case <-deadline:
+			return fmt.Errorf("timed out waiting for the device on console line %s (last output %q)", r.address(conn, cfg), lastLine(output))
+		}
+
+		if consoleLineBusy.Match(output) {
+			return fmt.Errorf("%s: %w", r.address(conn, cfg), errConsoleLineBusy)
+		}
+		if telnetLoginFailed.Match(output) {
+			return fmt.Errorf("console authentication failed for %q on the device", console.Username)
+		}
+		last := lastLine(output)
+		var err error
+		switch {
+		case consolePressReturn.Match(output):
+			err = conn.writeLine("")
+		case consoleMore.MatchString(last):
+			// A pager left over from the previous session.
+			err = conn.write([]byte("q"))
+		case consoleSetupDialog.MatchString(last):
+			err = conn.writeLine("no")
+		case consoleROMMON.MatchString(last):
+			r.logger.Info("Device is at a ROMMON prompt", "prompt", last)
+			conn.rommon = true
+			return nil
+		case telnetUsernamePrompt.MatchString(last):
+			if sentUsername {
+				return fmt.Errorf("console authentication failed for %q on the device: asked to log in again", console.Username)
+			}
+			if console.Username == "" {
+				return errors.New("device asked for a username on the console but none is configured")
+			}
+			sentUsername = true
+			err = conn.writeLine(console.Username)
+		case telnetPasswordPrompt.MatchString(last):
+			if sentPassword {
+				return fmt.Errorf("console authentication failed for %q on the device: password rejected", console.Username)
+			}
+			sentPassword = true
+			err = conn.writeLine(console.Password)
+		case consoleConfigMode.MatchString(last):
+			r.logger.Info("Console session was left in configuration mode, leaving it", "prompt", last)
+			err = conn.writeLine("end")
+		case conn.prompt.MatchString(last):
+			r.logger.Info("Console login complete", "prompt", last, "alreadyLoggedIn", !sentUsername && !sentPassword)
+			return nil
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("console login: %w", err)
+		}
+		output = output[:0]
+	}
+}
+
+func (r *consoleRepositoryImpl) closedError(cfg config.DeviceConfig, output []byte, err error) error {
+	if consoleLineBusy.Match(output) {
+		return fmt.Errorf("%s: %w", cfg.Address(), errConsoleLineBusy)
+	}
+	return fmt.Errorf("console connection closed during login (last output %q): %w", lastLine(output), err)
+}
+
+func (r *consoleRepositoryImpl) address(conn *ConsoleConn, cfg config.DeviceConfig) string {
+	if conn.telnet != nil {
+		return cfg.TelnetAddress()
+	}
+	return cfg.Address()
+}
+
+// clearLine logs in to the console server CLI and clears the busy line,
+// confirming the prompt Cisco terminal servers show.
+func (r *consoleRepositoryImpl) clearLine(ctx context.Context, console *config.ConsoleConfig) error {
+	sh, closeShell, err := r.openManagementShell(ctx, *console.ClearServer)
+	if err != nil {
+		return err
+	}
+	defer closeShell()
+
+	format := console.ClearCommand
+	if format == "" {
+		format = defaultConsoleClearCommand
+	}
+	command := fmt.Sprintf(format, console.Line)
+	r.logger.Info("Clearing console line", "command", command)
+
+	sh.drain()
+	if err := sh.writeLine(command); err != nil {
+		return err
+	}
+	output, _, err := sh.collect(consoleClearTimeout, consoleClearTimeout)
+	if err != nil {
+		return err
+	}
+	if consoleConfirm.MatchString(lastLine(output)) {
+		if err := sh.writeLine(""); err != nil {
+			return err
+		}
+		more, _, err := sh.collect(consoleClearTimeout, consoleClearTimeout)
+		if err != nil {
+			return err
+		}
+		output = append(output, more...)
+	}
+	if consoleCommandErr.Match(output) {
+		return fmt.Errorf("%q was rejected: %q", command, lastLine(output))
+	}
+	return nil
+}
+
+// openManagementShell logs in to a console server's own CLI over Telnet or
+// SSH and returns the shell with a function that logs out again.
+func (r *consoleRepositoryImpl) openManagementShell(ctx context.Context, cfg config.DeviceConfig) (*shellConn, func(), error) {
+	if cfg.Transport == config.TransportTelnet {
+		t, err := r.telnet.ConnectContext(ctx, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t.shellConn, func() { r.telnet.Disconnect(t) }, nil
+	}
+
+	client, jumpClient, err := connectToTarget(ctx, r.jumps, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		client.Close()
+		if jumpClient != nil {
+			releaseJumpClientFunc(r.jumps, cfg.JumpServer, jumpClient)
+		}
+	}
+	sh, _, err := newSSHShell(client)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	if cfg.Prompt != nil {
+		sh.prompt = cfg.Prompt
+	}
+	// Wait out the banner and first prompt.
+	if _, _, err := sh.collect(cfg.ConnectionTimeout, consoleClearTimeout); err != nil {
+		sh.Close()
+		release()
+		return nil, nil, err
+	}
+	return sh, func() {
+		sh.writeLine("exit")
+		sh.Close()
+		release()
+	}, nil
+}
+
+// closeConn closes conn and releases its jump server lease.
+func (r *consoleRepositoryImpl) closeConn(conn *ConsoleConn) {
+	conn.Close()
+	if conn.jumpCfg != nil {
+		r.logger.Info("Releasing jump server client", "jumpserver", conn.jumpCfg.IP)
+		releaseJumpClientFunc(r.jumps, conn.jumpCfg, conn.jumpClient)
+	}
+}
+
+// Disconnect logs out of the device, so the console line is not left
+// logged in, and closes the connection.
+func (r *consoleRepositoryImpl) Disconnect(conn *ConsoleConn) {
+	if conn == nil {
+		return
+	}
+	r.logger.Info("Logging out of console line")
+	if !conn.rommon {
+		if err := conn.writeLine("exit"); err != nil {
+			r.logger.Debug("Failed to send exit on console line", "error", err)
+		}
+	}
+	r.closeConn(conn)
+}
+
+func (r *consoleRepositoryImpl) InteractiveExecute(conn *ConsoleConn, command string, opts ...ExecuteOption) (string, error) {
+	if conn == nil {
+		return "", errors.New("console connection is nil; not connected")
+	}
+	return conn.execute(r.logger, command, opts)
+}
+
+func (r *consoleRepositoryImpl) InteractiveExecuteMultiple(conn *ConsoleConn, commands []string, opts ...ExecuteOption) ([]string, error) {
+	if conn == nil {
+		return nil, errors.New("console connection is nil; not connected")
+	}
+	return conn.executeMultiple(r.logger, commands, opts)
+}
+
+// Ping sends an empty line and waits for the prompt to come back.
+func (r *consoleRepositoryImpl) Ping(conn *ConsoleConn) error {
+	if conn == nil {
+		return errors.New("console connection is nil; not connected")
+	}
+	if err := conn.ping(defaultJumpHealthCheckTimeout); err != nil {
+		return fmt.Errorf("console ping: %w", err)
+	}
+	return nil
+}
+
+// SendBreak sends a break on the console line, e.g. to interrupt a boot.
+func (r *consoleRepositoryImpl) SendBreak(conn *ConsoleConn) error {
+	if conn == nil {
+		return errors.New("console connection is nil; not connected")
+	}
+	conn.exec.Lock()
+	defer conn.exec.Unlock()
+	return conn.sendBreak()
+}
+
+// Privileged applies WithEnable or WithSudo from opts and reports whether
+// the console session is privileged.
+func (r *consoleRepositoryImpl) Privileged(conn *ConsoleConn, opts ...ExecuteOption) (bool, error) {
+	if conn == nil {
+		return false, errors.New("console connection is nil; not connected")
+	}
+	return conn.privilege(r.logger, NewExecuteOptions(opts...))
+}
+
+// SendConfig sends lines in configuration mode over the console line and
+// returns what the device answered to each line.
+func (r *consoleRepositoryImpl) SendConfig(conn *ConsoleConn, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error) {
+	if conn == nil {
+		return nil, errors.New("console connection is nil; not connected")
+	}
+	return conn.configure(r.logger, lines, mode, NewExecuteOptions(opts...))
+}
+
+// OpenConfigSession enters configuration mode on the console line. Other
+// commands on conn wait until the session is closed.
+func (r *consoleRepositoryImpl) OpenConfigSession(conn *ConsoleConn, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error) {
+	if conn == nil {
+		return nil, errors.New("console connection is nil; not connected")
+	}
+	return conn.openConfigSession(r.logger, mode, NewExecuteOptions(opts...), nil)
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/internal/telnettest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func shortConsoleTimers(t *testing.T) {
+	t.Helper()
+	settle, wake, clear := consoleSettleTime, consoleWakeInterval, consoleClearTimeout
+	consoleSettleTime = 100 * time.Millisecond
+	consoleWakeInterval = 500 * time.Millisecond
+	consoleClearTimeout = 500 * time.Millisecond
+	t.Cleanup(func() {
+		consoleSettleTime, consoleWakeInterval, consoleClearTimeout = settle, wake, clear
+	})
+}
+
+func newConsoleServer(t *testing.T, opts telnettest.Options, cfgOpts ...config.DeviceConfigOption) (*telnettest.Server, *config.DeviceConfig) {
+	t.Helper()
+	server := telnettest.Start(t, opts)
+	cfgOpts = append([]config.DeviceConfigOption{
+		config.WithTransport(config.TransportTelnet),
+		config.WithTelnetPort(server.Port()),
+		config.WithUsername(opts.Username),
+		config.WithPassword(opts.Password),
+		config.WithMaxRetry(1),
+		config.WithConnectionTimeout(10 * time.Second),
+	}, cfgOpts...)
+	return server, config.NewDeviceConfig(server.Host(), cfgOpts...)
+}
+
+func newTestConsoleRepository() ConsoleRepository {
+	return NewConsoleRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestConsoleTwoStageLoginAndLogout(t *testing.T) {
+	chdirTemp(t)
+	shortConsoleTimers(t)
+	server, cfg := newConsoleServer(t, telnettest.Options{
+		Username: "tsadmin",
+		Password: "tspass",
+		Handler:  versionHandler,
+		Console:  &telnettest.Console{Username: "admin", Password: "cisco"},
+	}, config.WithConsole("admin", "cisco"))
+	repo := newTestConsoleRepository()
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	if conn.ROMMON() {
+		t.Fatal("ROMMON() = true, want false")
+	}
+	path, err := repo.InteractiveExecute(conn, "show version", WithTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	output, _ := os.ReadFile(path)
+	if !strings.Contains(string(output), "Version 12.2(55)SE") {
+		t.Fatalf("output = %q, want show version output", output)
+	}
+	if !server.LoggedIn() {
+		t.Fatal("device is not logged in on the console line")
+	}
+
+	repo.Disconnect(conn)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.LoggedIn() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.LoggedIn() {
+		t.Fatal("Disconnect left the console line logged in")
+	}
+}
+
+func TestConsoleRejectedDeviceLogin(t *testing.T) {
+	shortConsoleTimers(t)
+	_, cfg := newConsoleServer(t, telnettest.Options{
+		Console: &telnettest.Console{Username: "admin", Password: "cisco"},
+	}, config.WithConsole("admin", "wrong"))
+
+	_, err := newTestConsoleRepository().Connect(*cfg)
+	if err == nil || !IsAuthFailure(err) {
+		t.Fatalf("Connect error = %v, want an authentication failure", err)
+	}
+}
+
+func TestConsoleResumesSessionLeftInConfigMode(t *testing.T) {
+	chdirTemp(t)
+	shortConsoleTimers(t)
+	_, cfg := newConsoleServer(t, telnettest.Options{
+		Handler: versionHandler,
+		Console: &telnettest.Console{Username: "admin", Password: "cisco", LoggedIn: true, ConfigMode: true},
+	}, config.WithConsole("admin", "cisco"))
+	repo := newTestConsoleRepository()
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	path, err := repo.InteractiveExecute(conn, "show clock", WithTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	output, _ := os.ReadFile(path)
+	if strings.Contains(string(output), "(config)") || !strings.Contains(string(output), "UTC") {
+		t.Fatalf("output = %q, want show clock output at the exec prompt", output)
+	}
+}
+
+func TestConsoleBreakReachesROMMON(t *testing.T) {
+	shortConsoleTimers(t)
+	server, cfg := newConsoleServer(t, telnettest.Options{
+		Console: &telnettest.Console{Username: "admin", Password: "cisco"},
+	}, config.WithConsole("admin", "cisco"), config.WithConsoleBreak())
+	repo := newTestConsoleRepository()
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	if !conn.ROMMON() {
+		t.Fatal("ROMMON() = false after sending a break")
+	}
+	if server.Breaks() != 1 {
+		t.Fatalf("breaks = %d, want 1", server.Breaks())
+	}
+}
+
+func TestConsoleClearsBusyLine(t *testing.T) {
+	chdirTemp(t)
+	shortConsoleTimers(t)
+	var console *telnettest.Server
+	cleared := make(chan string, 1)
+	management := telnettest.Start(t, telnettest.Options{
+		Username: "tsadmin",
+		Password: "tspass",
+		Prompt:   "ts#",
+		Handler: func(command string) string {
+			cleared <- command
+			console.SetBusy(false)
+			return "[confirm]"
+		},
+	})
+	managementCfg := config.NewDeviceConfig(management.Host(),
+		config.WithTransport(config.TransportTelnet),
+		config.WithTelnetPort(management.Port()),
+		config.WithUsername("tsadmin"),
+		config.WithPassword("tspass"),
+		config.WithMaxRetry(1),
+	)
+	console, cfg := newConsoleServer(t, telnettest.Options{
+		Handler: versionHandler,
+		Console: &telnettest.Console{LoggedIn: true, Busy: true},
+	}, config.WithConsole("", ""), config.WithConsoleClearLine(managementCfg, "2"))
+	repo := newTestConsoleRepository()
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	if got := <-cleared; got != "clear line 2" {
+		t.Fatalf("management command = %q, want clear line 2", got)
+	}
+	if console.Connections() != 2 {
+		t.Fatalf("console connections = %d, want 2", console.Connections())
+	}
+}
+
+func TestConsoleBusyLineWithoutClearServer(t *testing.T) {
+	shortConsoleTimers(t)
+	_, cfg := newConsoleServer(t, telnettest.Options{
+		Console: &telnettest.Console{Busy: true},
+	}, config.WithConsole("", ""))
+
+	_, err := newTestConsoleRepository().Connect(*cfg)
+	if !errors.Is(err, errConsoleLineBusy) {
+		t.Fatalf("Connect error = %v, want errConsoleLineBusy", err)
+	}
+}
+
+// serialConsoleShell plays a router on an Opengear-style SSH console port:
+// silent until woken, then a device login and an exec prompt.
+func serialConsoleShell(channel ssh.Channel) {
+	reader := bufio.NewReader(channel)
+	readLine := func() (string, bool) {
+		var line []byte
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			if b == '\r' || b == '\n' {
+				return string(line), true
+			}
+			line = append(line, b)
+		}
+	}
+	if _, ok := readLine(); !ok {
+		return
+	}
+	for {
+		io.WriteString(channel, "\r\nUsername: ")
+		username, ok := readLine()
+		if !ok {
+			return
+		}
+		io.WriteString(channel, "\r\nPassword: ")
+		password, ok := readLine()
+		if !ok {
+			return
+		}
+		if username == "admin" && password == "cisco" {
+			break
+		}
+		io.WriteString(channel, "\r\n% Login invalid\r\n")
+	}
+	for {
+		io.WriteString(channel, "\r\nrouter#")
+		command, ok := readLine()
+		if !ok || command == "exit" {
+			return
+		}
+		if command != "" {
+			io.WriteString(channel, "\r\n"+versionHandler(command)+"\r\n")
+		}
+	}
+}
+
+func TestConsoleOverSSH(t *testing.T) {
+	chdirTemp(t)
+	shortConsoleTimers(t)
+	server := sshtest.NewServer(t, "tsadmin:port02", "tspass", serialConsoleShell)
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("tsadmin:port02"),
+		config.WithPassword("tspass"),
+		config.WithMaxRetry(1),
+		config.WithConsole("admin", "cisco"),
+	)
+	repo := newTestConsoleRepository()
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	if conn.Transport() != config.TransportSSH {
+		t.Fatalf("Transport() = %v, want ssh", conn.Transport())
+	}
+	path, err := repo.InteractiveExecute(conn, "show version", WithTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	output, _ := os.ReadFile(path)
+	if !strings.Contains(string(output), "Version 12.2(55)SE") {
+		t.Fatalf("output = %q, want show version output", output)
+	}
+}
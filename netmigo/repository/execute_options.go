@@ -1,10 +1,29 @@
 package repository
 
-import "time"
+import (
+    "time"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+)
 
 type ExecuteOptions struct {
     Timeout          time.Duration
     FirstByteTimeout time.Duration
+    // Enable raises the shell to privileged EXEC with EnableSecret before
+    // commands run.
+    Enable           bool
+    EnableSecret     string
+    // Sudo runs each command through sudo, answering its prompt with
+    // SudoPassword. The password never reaches the output files.
+    Sudo             bool
+    SudoPassword     string
+    // StopOnError skips the remaining configuration lines after the first
+    // one the device rejects.
+    StopOnError      bool
+    // ParseOutput is called by the device services with the output of each
+    // Execute, without the prompt and echoed command. See
+    // service.WithTextFSM.
+    ParseOutput      func(platform config.Platform, command, output string) error
 }
 
 type ExecuteOption func(*ExecuteOptions)
@@ -33,3 +52,37 @@ func WithFirstByteTimeout(d time.Duration) ExecuteOption {
         o.FirstByteTimeout = d
     }
 }
+
+// WithEnable runs enable, answering the Password: prompt with secret, before
+// the commands. A shell already at a # prompt is left as it is.
+func WithEnable(secret string) ExecuteOption {
+    return func(o *ExecuteOptions) {
+        o.Enable = true
+        o.EnableSecret = secret
+    }
+}
+
+// WithSudo runs each command with sudo. The device services fill in the
+// password from the device config; use WithSudoPassword to set it here.
+func WithSudo() ExecuteOption {
+    return func(o *ExecuteOptions) {
+        o.Sudo = true
+    }
+}
+
+// WithSudoPassword runs each command with sudo and answers the password
+// prompt with password.
+func WithSudoPassword(password string) ExecuteOption {
+    return func(o *ExecuteOptions) {
+        o.Sudo = true
+        o.SudoPassword = password
+    }
+}
+
+// WithStopOnError makes SendConfig stop at the first rejected line instead
+// of sending the rest.
+func WithStopOnError() ExecuteOption {
+    return func(o *ExecuteOptions) {
+        o.StopOnError = true
+    }
+}
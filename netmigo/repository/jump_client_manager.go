@@ -1,77 +1,557 @@
 package repository
 
 import (
+    "context"
+    "errors"
     "fmt"
     "sync"
+    "time"
 
     "github.com/jonelmawirat/netmigo/netmigo/config"
     "golang.org/x/crypto/ssh"
 )
 
-type sharedJumpClient struct {
-    client   *ssh.Client
-    refCount int
-    mu       sync.Mutex
-}
+const (
+    defaultJumpHealthCheckInterval = 15 * time.Second
+    defaultJumpHealthCheckTimeout  = 5 * time.Second
+)
+
+var errJumpManagerClosed = errors.New("jump client manager is closed")
+
+// DefaultJumpClientManager is used by repositories created without
+// WithJumpClientManager and by ReleaseJumpClient.
+var DefaultJumpClientManager = NewJumpClientManager()
+
+// JumpClientManager shares SSH connections to jump servers between all
+// devices reached through them. Each device holds a lease, which stands for
+// one direct-tcpip channel on a jump connection. Once the last lease on a
+// jump server is released its connections are kept for the idle TTL before
+// being closed, so sequential batches can reuse them.
+type JumpClientManager struct {
+    idleTTL        time.Duration
+    healthInterval time.Duration
+    healthTimeout  time.Duration
+    maxChannels    int
+    maxConns       int
+    ratePerSecond  float64
+    rateBurst      int
+    connect        func(ctx context.Context, parent *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error)
 
-type jumpClientManager struct {
-    clients map[string]*sharedJumpClient
     mu      sync.Mutex
+    servers map[string]*jumpServer
+    closed  bool
+}
+
+// jumpServer is the state kept for one jump server key.
+type jumpServer struct {
+    cfg       *config.DeviceConfig
+    conns     []*jumpConn
+    dialing   int
+    leases    int
+    idleTimer *time.Timer
+    limiter   *rateLimiter
+    // holders lists the clients leased through each config pointer, so
+    // ReleaseJumpClient can tell which connection its lease is on.
+    holders map[*config.DeviceConfig][]*ssh.Client
+    // wake is closed, and replaced, whenever a channel slot frees up or a
+    // connection attempt finishes, so queued callers re-check.
+    wake chan struct{}
+}
+
+type jumpConn struct {
+    client  *ssh.Client
+    parent  *ssh.Client
+    done    chan struct{}
+    checked time.Time
+    active  int
+    // probing is closed when the health probe in flight finishes.
+    probing chan struct{}
+    // unhealthy is set when a probe fails. The connection gets no new
+    // leases and is closed once the leases it has are released.
+    unhealthy bool
+}
+
+// JumpClientManagerOption configures a JumpClientManager.
+type JumpClientManagerOption func(*JumpClientManager)
+
+// WithIdleTTL keeps released jump connections open for ttl before closing
+// them. Zero closes a connection as soon as its last user releases it.
+func WithIdleTTL(ttl time.Duration) JumpClientManagerOption {
+    return func(m *JumpClientManager) {
+        m.idleTTL = ttl
+    }
+}
+
+// WithHealthCheck probes a shared jump connection with an OpenSSH keepalive
+// request when it is handed out and has not been checked for interval. A
+// connection that does not answer within timeout gets no new leases and is
+// closed once its current leases are released. A zero timeout disables
+// probing; connections the server closed are still replaced.
+func WithHealthCheck(interval, timeout time.Duration) JumpClientManagerOption {
+    return func(m *JumpClientManager) {
+        m.healthInterval = interval
+        m.healthTimeout = timeout
+    }
+}
+
+// WithMaxChannelsPerConnection caps the devices reached concurrently
+// through one jump connection, which should stay below the bastion's sshd
+// MaxSessions. Callers beyond the cap wait for a free slot. Zero means no
+// limit.
+func WithMaxChannelsPerConnection(n int) JumpClientManagerOption {
+    return func(m *JumpClientManager) {
+        m.maxChannels = n
+    }
+}
+
+// WithMaxConnectionsPerJump lets the manager open up to n SSH connections to
+// the same jump server and spread devices across them. It only has an effect
+// together with WithMaxChannelsPerConnection. The default is one.
+func WithMaxConnectionsPerJump(n int) JumpClientManagerOption {
+    return func(m *JumpClientManager) {
+        m.maxConns = n
+    }
+}
+
+// WithConnectRate limits how many devices per second start connecting
+// through one jump server, allowing bursts of up to burst, so bastion sshd
+// rate limits are not tripped. A non-positive rate means no limit.
+func WithConnectRate(perSecond float64, burst int) JumpClientManagerOption {
+    return func(m *JumpClientManager) {
+        m.ratePerSecond = perSecond
+        m.rateBurst = burst
+    }
+}
+
+func NewJumpClientManager(opts ...JumpClientManagerOption) *JumpClientManager {
+    m := &JumpClientManager{
+        healthInterval: defaultJumpHealthCheckInterval,
+        healthTimeout:  defaultJumpHealthCheckTimeout,
+        maxConns:       1,
+        connect:        connectJumpClient,
+        servers:        make(map[string]*jumpServer),
+    }
+    for _, opt := range opts {
+        opt(m)
+    }
+    if m.maxConns < 1 {
+        m.maxConns = 1
+    }
+    return m
+}
+
+func connectJumpClient(ctx context.Context, parent *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
+    if parent != nil {
+        return connectThroughJumpServer(ctx, parent, cfg)
+    }
+    return connectDirectly(ctx, cfg)
 }
 
-var manager = &jumpClientManager{
-    clients: make(map[string]*sharedJumpClient),
+// Acquire is AcquireContext without a deadline.
+func (m *JumpClientManager) Acquire(cfg *config.DeviceConfig) (*ssh.Client, error) {
+    return m.AcquireContext(context.Background(), cfg)
 }
 
-func getJumpClient(cfg *config.DeviceConfig) (*ssh.Client, error) {
+// AcquireContext takes a lease on a shared client for cfg, connecting or
+// replacing a dead connection as needed. When channel or rate limits are
+// reached the call queues until a slot is free or ctx is done. Every
+// successful call must be paired with ReleaseClient.
+func (m *JumpClientManager) AcquireContext(ctx context.Context, cfg *config.DeviceConfig) (*ssh.Client, error) {
     if cfg == nil {
         return nil, nil
     }
 
-    key := fmt.Sprintf("%s@%s:%s", cfg.Username, cfg.IP, cfg.Port)
+    key := jumpClientKey(cfg)
 
-    manager.mu.Lock()
-    shared, exists := manager.clients[key]
+    m.mu.Lock()
+    if m.closed {
+        m.mu.Unlock()
+        return nil, errJumpManagerClosed
+    }
+    srv, exists := m.servers[key]
     if !exists {
-        client, err := connectDirectly(*cfg)
-        if err != nil {
-            manager.mu.Unlock()
-            return nil, fmt.Errorf("jump client manager failed to connect: %w", err)
+        srv = &jumpServer{cfg: cfg, holders: make(map[*config.DeviceConfig][]*ssh.Client), wake: make(chan struct{})}
+        if m.ratePerSecond > 0 {
+            srv.limiter = newRateLimiter(m.ratePerSecond, m.rateBurst)
         }
-        shared = &sharedJumpClient{
-            client:   client,
-            refCount: 0,
+        m.servers[key] = srv
+    }
+    // The lease is counted while queueing so the server is not closed as
+    // idle underneath the caller.
+    srv.leases++
+    if srv.idleTimer != nil {
+        srv.idleTimer.Stop()
+        srv.idleTimer = nil
+    }
+    m.mu.Unlock()
+
+    if srv.limiter != nil {
+        if err := srv.limiter.wait(ctx); err != nil {
+            m.release(key, cfg, nil, false)
+            return nil, fmt.Errorf("waiting to connect through jump server %s: %w", cfg.Address(), err)
         }
-        manager.clients[key] = shared
     }
-    manager.mu.Unlock()
 
-    shared.mu.Lock()
-    defer shared.mu.Unlock()
-    shared.refCount++
+    for {
+        m.mu.Lock()
+        if m.closed {
+            m.mu.Unlock()
+            return nil, errJumpManagerClosed
+        }
+        m.pruneDead(srv)
+
+        if conn := m.pickConn(srv); conn != nil {
+            if probing := conn.probing; probing != nil {
+                // Wait for the probe in flight instead of handing out a
+                // connection that may be about to be marked unhealthy.
+                m.mu.Unlock()
+                select {
+                case <-probing:
+                case <-ctx.Done():
+                    m.release(key, cfg, nil, false)
+                    return nil, fmt.Errorf("waiting for a health check of jump server %s: %w", cfg.Address(), ctx.Err())
+                }
+                continue
+            }
+            conn.active++
+            if m.healthTimeout <= 0 || timeNowFunc().Sub(conn.checked) < m.healthInterval {
+                srv.holders[cfg] = append(srv.holders[cfg], conn.client)
+                m.mu.Unlock()
+                return conn.client, nil
+            }
+
+            probing := make(chan struct{})
+            conn.probing = probing
+            m.mu.Unlock()
+            err := probeJumpClientFunc(conn.client, m.healthTimeout)
+            m.mu.Lock()
+            conn.probing = nil
+            close(probing)
+            if err == nil {
+                conn.checked = timeNowFunc()
+                srv.holders[cfg] = append(srv.holders[cfg], conn.client)
+                m.mu.Unlock()
+                return conn.client, nil
+            }
+            // Other leases may still have sessions on the connection, so it
+            // is only closed once the last of them is released.
+            conn.unhealthy = true
+            conn.active--
+            m.broadcast(srv)
+            retired := m.retireIfIdle(srv, conn)
+            m.mu.Unlock()
+            if retired {
+                m.closeConn(srv.cfg, conn)
+            }
+            continue
+        }
+
+        if m.healthyConns(srv)+srv.dialing < m.maxConns {
+            srv.dialing++
+            m.mu.Unlock()
+
+            conn, err := m.dialConn(ctx, cfg)
+
+            m.mu.Lock()
+            srv.dialing--
+            m.broadcast(srv)
+            if err == nil && m.closed {
+                err = errJumpManagerClosed
+            }
+            if err != nil {
+                m.mu.Unlock()
+                if conn != nil {
+                    m.closeConn(cfg, conn)
+                }
+                m.release(key, cfg, nil, false)
+                return nil, fmt.Errorf("jump client manager failed to connect: %w", err)
+            }
+            conn.active = 1
+            srv.conns = append(srv.conns, conn)
+            srv.holders[cfg] = append(srv.holders[cfg], conn.client)
+            m.mu.Unlock()
+            return conn.client, nil
+        }
+
+        wake := srv.wake
+        m.mu.Unlock()
 
-    return shared.client, nil
+        select {
+        case <-wake:
+        case <-ctx.Done():
+            m.release(key, cfg, nil, false)
+            return nil, fmt.Errorf("waiting for a free channel on jump server %s: %w", cfg.Address(), ctx.Err())
+        }
+    }
 }
 
-func ReleaseJumpClient(cfg *config.DeviceConfig) {
+// ReleaseClient drops the lease on client returned by AcquireContext.
+func (m *JumpClientManager) ReleaseClient(cfg *config.DeviceConfig, client *ssh.Client) {
     if cfg == nil {
         return
     }
+    m.release(jumpClientKey(cfg), cfg, client, true)
+}
+
+// release drops a lease taken through cfg. holdsSlot is false for callers
+// that gave up while queueing and never got a channel slot on a
+// connection; otherwise the slot is freed on the connection of client.
+func (m *JumpClientManager) release(key string, cfg *config.DeviceConfig, client *ssh.Client, holdsSlot bool) {
+    m.mu.Lock()
+    srv, exists := m.servers[key]
+    if !exists {
+        m.mu.Unlock()
+        return
+    }
+    var closing []*jumpConn
+    if holdsSlot {
+        m.dropHolder(srv, cfg, client)
+        for _, conn := range srv.conns {
+            if conn.active > 0 && conn.client == client {
+                conn.active--
+                if m.retireIfIdle(srv, conn) {
+                    closing = append(closing, conn)
+                }
+                break
+            }
+        }
+    }
+    srv.leases--
+    m.broadcast(srv)
+    if srv.leases <= 0 {
+        if m.idleTTL > 0 && !m.closed {
+            srv.idleTimer = time.AfterFunc(m.idleTTL, func() { m.expire(key, srv) })
+        } else {
+            delete(m.servers, key)
+            closing = append(closing, srv.conns...)
+            srv.conns = nil
+        }
+    }
+    m.mu.Unlock()
+
+    for _, conn := range closing {
+        m.closeConn(srv.cfg, conn)
+    }
+}
+
+// dropHolder forgets one lease of client taken through cfg. It must be
+// called with m.mu held.
+func (m *JumpClientManager) dropHolder(srv *jumpServer, cfg *config.DeviceConfig, client *ssh.Client) {
+    clients := srv.holders[cfg]
+    for i, c := range clients {
+        if c == client {
+            clients = append(clients[:i], clients[i+1:]...)
+            break
+        }
+    }
+    if len(clients) == 0 {
+        delete(srv.holders, cfg)
+        return
+    }
+    srv.holders[cfg] = clients
+}
+
+// Close closes every jump connection, including ones still in use, and
+// wakes queued callers. Later Acquire calls fail.
+func (m *JumpClientManager) Close() error {
+    m.mu.Lock()
+    m.closed = true
+    servers := m.servers
+    m.servers = make(map[string]*jumpServer)
+    var conns []*jumpConn
+    for _, srv := range servers {
+        if srv.idleTimer != nil {
+            srv.idleTimer.Stop()
+        }
+        conns = append(conns, srv.conns...)
+        srv.conns = nil
+        m.broadcast(srv)
+    }
+    m.mu.Unlock()
+
+    for _, conn := range conns {
+        conn.client.Close()
+    }
+    return nil
+}
+
+func (m *JumpClientManager) expire(key string, srv *jumpServer) {
+    m.mu.Lock()
+    if m.servers[key] != srv || srv.leases > 0 {
+        m.mu.Unlock()
+        return
+    }
+    delete(m.servers, key)
+    conns := srv.conns
+    srv.conns = nil
+    m.mu.Unlock()
+
+    for _, conn := range conns {
+        m.closeConn(srv.cfg, conn)
+    }
+}
+
+// dialConn opens a new connection to cfg. A jump server behind its own jump
+// server (ProxyJump chains) holds a lease on the outer hop for as long as
+// the connection lives.
+func (m *JumpClientManager) dialConn(ctx context.Context, cfg *config.DeviceConfig) (*jumpConn, error) {
+    var parent *ssh.Client
+    if cfg.JumpServer != nil {
+        var err error
+        parent, err = m.AcquireContext(ctx, cfg.JumpServer)
+        if err != nil {
+            return nil, err
+        }
+    }
+    client, err := m.connect(ctx, parent, *cfg)
+    if err != nil {
+        if parent != nil {
+            m.ReleaseClient(cfg.JumpServer, parent)
+        }
+        return nil, err
+    }
+
+    conn := &jumpConn{
+        client:  client,
+        parent:  parent,
+        done:    make(chan struct{}),
+        checked: timeNowFunc(),
+    }
+    go func() {
+        client.Wait()
+        close(conn.done)
+    }()
+    return conn, nil
+}
+
+// pickConn returns the healthy connection with the fewest active channels
+// that is below the channel cap. It must be called with m.mu held.
+func (m *JumpClientManager) pickConn(srv *jumpServer) *jumpConn {
+    var best *jumpConn
+    for _, conn := range srv.conns {
+        if conn.unhealthy || (m.maxChannels > 0 && conn.active >= m.maxChannels) {
+            continue
+        }
+        if best == nil || conn.active < best.active {
+            best = conn
+        }
+    }
+    return best
+}
 
-    key := fmt.Sprintf("%s@%s:%s", cfg.Username, cfg.IP, cfg.Port)
+// pruneDead drops connections the server has closed. It must be called with
+// m.mu held; the clients are already closed, only parent leases are
+// released in the background.
+func (m *JumpClientManager) pruneDead(srv *jumpServer) {
+    for _, conn := range append([]*jumpConn(nil), srv.conns...) {
+        select {
+        case <-conn.done:
+            m.removeConn(srv, conn)
+            go m.closeConn(srv.cfg, conn)
+        default:
+        }
+    }
+}
 
-    manager.mu.Lock()
-    defer manager.mu.Unlock()
+// healthyConns counts the connections new leases can go to. It must be
+// called with m.mu held.
+func (m *JumpClientManager) healthyConns(srv *jumpServer) int {
+    n := 0
+    for _, conn := range srv.conns {
+        if !conn.unhealthy {
+            n++
+        }
+    }
+    return n
+}
 
-    if shared, exists := manager.clients[key]; exists {
-        shared.mu.Lock()
-        shared.refCount--
-        shouldClose := shared.refCount <= 0
-        shared.mu.Unlock()
+// retireIfIdle removes an unhealthy connection once nothing uses it and
+// reports whether the caller must close it. It must be called with m.mu
+// held.
+func (m *JumpClientManager) retireIfIdle(srv *jumpServer, conn *jumpConn) bool {
+    if !conn.unhealthy || conn.active > 0 {
+        return false
+    }
+    m.removeConn(srv, conn)
+    return true
+}
 
-        if shouldClose {
-            shared.client.Close()
-            delete(manager.clients, key)
+// removeConn must be called with m.mu held. Leases still pointing at the
+// removed connection are only counted against the server from now on.
+func (m *JumpClientManager) removeConn(srv *jumpServer, conn *jumpConn) {
+    for i, c := range srv.conns {
+        if c == conn {
+            srv.conns = append(srv.conns[:i], srv.conns[i+1:]...)
+            m.broadcast(srv)
+            return
         }
     }
 }
+
+func (m *JumpClientManager) closeConn(cfg *config.DeviceConfig, conn *jumpConn) {
+    conn.client.Close()
+    if conn.parent != nil {
+        m.ReleaseClient(cfg.JumpServer, conn.parent)
+    }
+}
+
+// broadcast wakes queued callers. It must be called with m.mu held.
+func (m *JumpClientManager) broadcast(srv *jumpServer) {
+    close(srv.wake)
+    srv.wake = make(chan struct{})
+}
+
+// probeClient sends an OpenSSH keepalive. Any reply, including a refusal,
+// proves the connection is alive.
+func probeClient(client *ssh.Client, timeout time.Duration) error {
+    result := make(chan error, 1)
+    go func() {
+        _, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+        result <- err
+    }()
+    select {
+    case err := <-result:
+        return err
+    case <-timeAfterFunc(timeout):
+        return errors.New("keepalive timed out")
+    }
+}
+
+// jumpClientKey identifies a jump server by config.DeviceConfig.Key, so two
+// configs for the same bastion with different accounts never share a
+// connection.
+func jumpClientKey(cfg *config.DeviceConfig) string {
+    return cfg.Key()
+}
+
+// ReleaseJumpClient releases a jump client acquired through
+// DefaultJumpClientManager.
+//
+// Deprecated: use DefaultJumpClientManager.ReleaseClient, which names the
+// client. ReleaseJumpClient releases the latest lease taken through cfg, or
+// when there is none, through another config with the same key.
+func ReleaseJumpClient(cfg *config.DeviceConfig) {
+    if cfg == nil {
+        return
+    }
+    m := DefaultJumpClientManager
+    key := jumpClientKey(cfg)
+    m.mu.Lock()
+    srv, exists := m.servers[key]
+    if !exists {
+        m.mu.Unlock()
+        return
+    }
+    holder := cfg
+    if len(srv.holders[holder]) == 0 {
+        for other := range srv.holders {
+            holder = other
+            break
+        }
+    }
+    clients := srv.holders[holder]
+    m.mu.Unlock()
+    if len(clients) > 0 {
+        m.release(key, holder, clients[len(clients)-1], true)
+    }
+}
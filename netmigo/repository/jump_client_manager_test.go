@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnectToTargetThroughChainedJumpServers(t *testing.T) {
+	outer := sshtest.NewServer(t, "outer", "outer-pass", nil)
+	inner := sshtest.NewServer(t, "inner", "inner-pass", nil)
+	target := sshtest.NewServer(t, "admin", "target-pass", nil)
+
+	outerCfg := config.NewDeviceConfig(outer.Host(),
+		config.WithPort(outer.Port()),
+		config.WithUsername("outer"),
+		config.WithPassword("outer-pass"),
+	)
+	innerCfg := config.NewDeviceConfig(inner.Host(),
+		config.WithPort(inner.Port()),
+		config.WithUsername("inner"),
+		config.WithPassword("inner-pass"),
+		config.WithJumpServer(outerCfg),
+	)
+	targetCfg := config.NewDeviceConfig(target.Host(),
+		config.WithPort(target.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("target-pass"),
+		config.WithJumpServer(innerCfg),
+	)
+
+	jumps := NewJumpClientManager()
+	first, firstJump, err := connectToTarget(context.Background(), jumps, *targetCfg)
+	if err != nil {
+		t.Fatalf("first connectToTarget returned error: %v", err)
+	}
+	second, secondJump, err := connectToTarget(context.Background(), jumps, *targetCfg)
+	if err != nil {
+		t.Fatalf("second connectToTarget returned error: %v", err)
+	}
+
+	if outer.Connections() != 1 || inner.Connections() != 1 {
+		t.Fatalf("jump connections = outer %d inner %d, want 1 each", outer.Connections(), inner.Connections())
+	}
+	if target.Connections() != 2 {
+		t.Fatalf("target connections = %d, want 2", target.Connections())
+	}
+
+	first.Close()
+	jumps.ReleaseClient(innerCfg, firstJump)
+	second.Close()
+	jumps.ReleaseClient(innerCfg, secondJump)
+
+	jumps.mu.Lock()
+	remaining := len(jumps.servers)
+	jumps.mu.Unlock()
+	if remaining != 0 {
+		t.Fatalf("jump clients still registered = %d, want 0", remaining)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for outer.OpenChannels() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if outer.OpenChannels() != 0 {
+		t.Fatalf("outer jump still has %d open channels", outer.OpenChannels())
+	}
+}
+
+func TestJumpClientManagerKeepsIdleClientForTTL(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithIdleTTL(100 * time.Millisecond))
+	t.Cleanup(func() { jumps.Close() })
+
+	first, err := jumps.Acquire(jumpCfg)
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+	jumps.ReleaseClient(jumpCfg, first)
+	second, err := jumps.Acquire(jumpCfg)
+	if err != nil {
+		t.Fatalf("second Acquire returned error: %v", err)
+	}
+	if first != second || jump.Connections() != 1 {
+		t.Fatalf("idle client was not reused: connections = %d", jump.Connections())
+	}
+	jumps.ReleaseClient(jumpCfg, second)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		jumps.mu.Lock()
+		remaining := len(jumps.servers)
+		jumps.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	jumps.mu.Lock()
+	defer jumps.mu.Unlock()
+	if len(jumps.servers) != 0 {
+		t.Fatal("idle jump client was not closed after the TTL")
+	}
+}
+
+func TestJumpClientManagerReplacesDeadClient(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithHealthCheck(0, time.Second))
+	t.Cleanup(func() { jumps.Close() })
+
+	first, err := jumps.Acquire(jumpCfg)
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+	jump.DropConnections()
+
+	second, err := jumps.Acquire(jumpCfg)
+	if err != nil {
+		t.Fatalf("Acquire after drop returned error: %v", err)
+	}
+	if first == second || jump.Connections() != 2 {
+		t.Fatalf("dead jump client was not replaced: connections = %d", jump.Connections())
+	}
+	if _, _, err := second.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		t.Fatalf("replacement client is not usable: %v", err)
+	}
+
+	jumps.ReleaseClient(jumpCfg, first)
+	jumps.ReleaseClient(jumpCfg, second)
+	jumps.mu.Lock()
+	defer jumps.mu.Unlock()
+	if len(jumps.servers) != 0 {
+		t.Fatalf("jump clients still registered = %d, want 0", len(jumps.servers))
+	}
+}
+
+func TestJumpClientManagerKeepsUnhealthyClientUntilReleased(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithHealthCheck(0, time.Second))
+	t.Cleanup(func() { jumps.Close() })
+
+	first, err := jumps.Acquire(jumpCfg)
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+
+	originalProbe := probeJumpClientFunc
+	t.Cleanup(func() { probeJumpClientFunc = originalProbe })
+	probeJumpClientFunc = func(*ssh.Client, time.Duration) error { return errors.New("keepalive timed out") }
+	second, err := jumps.Acquire(jumpCfg)
+	probeJumpClientFunc = originalProbe
+	if err != nil {
+		t.Fatalf("Acquire after a failed probe returned error: %v", err)
+	}
+	if first == second || jump.Connections() != 2 {
+		t.Fatalf("unhealthy jump client was handed out again: connections = %d", jump.Connections())
+	}
+	if _, _, err := first.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		t.Fatalf("unhealthy jump client was closed while still leased: %v", err)
+	}
+
+	jumps.ReleaseClient(jumpCfg, first)
+	if _, _, err := first.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		t.Fatal("unhealthy jump client was not closed after its last lease was released")
+	}
+	if _, _, err := second.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		t.Fatalf("healthy jump client was closed: %v", err)
+	}
+	jumps.ReleaseClient(jumpCfg, second)
+}
+
+func TestReleaseJumpClientReleasesTheLeaseOfItsConfig(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	newJumpCfg := func() *config.DeviceConfig {
+		return config.NewDeviceConfig(jump.Host(),
+			config.WithPort(jump.Port()),
+			config.WithUsername("jump"),
+			config.WithPassword("jump-pass"),
+		)
+	}
+	first, second := newJumpCfg(), newJumpCfg()
+
+	original := DefaultJumpClientManager
+	t.Cleanup(func() { DefaultJumpClientManager = original })
+	jumps := NewJumpClientManager(WithMaxChannelsPerConnection(1), WithMaxConnectionsPerJump(2))
+	DefaultJumpClientManager = jumps
+	t.Cleanup(func() { jumps.Close() })
+
+	firstClient, err := jumps.Acquire(first)
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+	if _, err := jumps.Acquire(second); err != nil {
+		t.Fatalf("second Acquire returned error: %v", err)
+	}
+	if jump.Connections() != 2 {
+		t.Fatalf("connections = %d, want 2", jump.Connections())
+	}
+
+	ReleaseJumpClient(second)
+	jumps.mu.Lock()
+	for _, conn := range jumps.servers[jumpClientKey(first)].conns {
+		if want := map[bool]int{true: 1, false: 0}[conn.client == firstClient]; conn.active != want {
+			t.Errorf("connection %p has %d leases, want %d", conn.client, conn.active, want)
+		}
+	}
+	jumps.mu.Unlock()
+
+	ReleaseJumpClient(first)
+	jumps.mu.Lock()
+	defer jumps.mu.Unlock()
+	if len(jumps.servers) != 0 {
+		t.Fatalf("jump servers still registered = %d, want 0", len(jumps.servers))
+	}
+}
+
+func TestJumpClientKeyIncludesCredentials(t *testing.T) {
+	base := config.NewDeviceConfig("10.0.0.1", config.WithUsername("jump"), config.WithPassword("one"))
+	other := *base
+	other.Password = "two"
+	withKey := *base
+	withKey.KeyPath = "/keys/id_ed25519"
+
+	keys := map[string]bool{
+		jumpClientKey(base):     true,
+		jumpClientKey(&other):   true,
+		jumpClientKey(&withKey): true,
+	}
+	if len(keys) != 3 {
+		t.Fatalf("configs with different credentials share a key: %v", keys)
+	}
+	if strings.Contains(jumpClientKey(base), "one") {
+		t.Fatal("jump client key contains the password")
+	}
+	if jumpClientKey(base) != jumpClientKey(config.NewDeviceConfig("10.0.0.1", config.WithUsername("jump"), config.WithPassword("one"))) {
+		t.Fatal("identical configs produce different keys")
+	}
+}
+
+func TestJumpClientManagerQueuesBeyondChannelLimit(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithMaxChannelsPerConnection(2))
+	t.Cleanup(func() { jumps.Close() })
+
+	var held *ssh.Client
+	for i := 0; i < 2; i++ {
+		client, err := jumps.Acquire(jumpCfg)
+		if err != nil {
+			t.Fatalf("Acquire %d returned error: %v", i, err)
+		}
+		held = client
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := jumps.AcquireContext(ctx, jumpCfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireContext beyond limit error = %v, want deadline exceeded", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := jumps.Acquire(jumpCfg)
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("queued Acquire returned before a slot was released: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	jumps.ReleaseClient(jumpCfg, held)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("queued Acquire returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued Acquire did not get the released slot")
+	}
+
+	if jump.Connections() != 1 {
+		t.Fatalf("jump connections = %d, want 1", jump.Connections())
+	}
+}
+
+func TestJumpClientManagerSpreadsAcrossConnections(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithMaxChannelsPerConnection(2), WithMaxConnectionsPerJump(2))
+	t.Cleanup(func() { jumps.Close() })
+
+	perClient := map[*ssh.Client]int{}
+	for i := 0; i < 4; i++ {
+		client, err := jumps.Acquire(jumpCfg)
+		if err != nil {
+			t.Fatalf("Acquire %d returned error: %v", i, err)
+		}
+		perClient[client]++
+	}
+	if len(perClient) != 2 || jump.Connections() != 2 {
+		t.Fatalf("leases spread over %d clients and %d connections, want 2", len(perClient), jump.Connections())
+	}
+	for client, n := range perClient {
+		if n != 2 {
+			t.Fatalf("client %p has %d leases, want 2", client, n)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := jumps.AcquireContext(ctx, jumpCfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireContext beyond limit error = %v, want deadline exceeded", err)
+	}
+
+	for client := range perClient {
+		jumps.ReleaseClient(jumpCfg, client)
+		again, err := jumps.Acquire(jumpCfg)
+		if err != nil {
+			t.Fatalf("Acquire after release returned error: %v", err)
+		}
+		if again != client {
+			t.Fatal("released slot was not reused on the same connection")
+		}
+		break
+	}
+}
+
+func TestJumpClientManagerLimitsConnectRate(t *testing.T) {
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+	)
+	jumps := NewJumpClientManager(WithConnectRate(20, 1))
+	t.Cleanup(func() { jumps.Close() })
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := jumps.Acquire(jumpCfg); err != nil {
+			t.Fatalf("Acquire %d returned error: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("three acquisitions at 20/s took %v, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := jumps.AcquireContext(ctx, jumpCfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("rate-limited AcquireContext error = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+)
+
+// trailingPrompt matches a prompt left at the end of an output file whose
+// echo line did not show it, such as over Telnet.
+var trailingPrompt = regexp.MustCompile(`^\S*[A-Za-z]\S*[#>$]\s*(exit)?$`)
+
+// CommandOutput cuts the output of command out of an output file: it drops
+// everything up to and including the line that echoes the command, and the
+// prompt lines after the output. The prompt is taken from the echo line
+// when it shows one, so output that ends in something else is left as it
+// is. Without an echo line the whole file is returned.
+func CommandOutput(command string, output []byte) string {
+	lines := strings.Split(strings.ReplaceAll(string(output), "\r", ""), "\n")
+	command = strings.TrimSpace(command)
+	prompt := ""
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, " \t")
+		if before, ok := strings.CutSuffix(trimmed, command); ok && command != "" {
+			prompt = strings.TrimSpace(before)
+			lines = lines[i+1:]
+			break
+		}
+	}
+	// Without a prompt from the echo line only the final prompt is
+	// dropped, since output lines such as XML closing tags can look like
+	// prompts too.
+	guessed := false
+	for len(lines) > 0 {
+		last := strings.TrimSpace(lines[len(lines)-1])
+		isPrompt := prompt != "" && strings.HasPrefix(last, prompt) || prompt == "" && !guessed && trailingPrompt.MatchString(last)
+		if last != "" && !isPrompt {
+			break
+		}
+		guessed = guessed || last != ""
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
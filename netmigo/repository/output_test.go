@@ -0,0 +1,39 @@
+package repository
+
+import "testing"
+
+func TestCommandOutput(t *testing.T) {
+	for name, tc := range map[string]struct {
+		command, output, want string
+	}{
+		"prompt and echo": {
+			command: "show clock",
+			output:  "\r\nRP/0/RSP0/CPU0:edge1#show clock\r\n02:00:01.512 UTC Fri Oct 16 2026\r\n\r\nRP/0/RSP0/CPU0:edge1#exit\r\n",
+			want:    "02:00:01.512 UTC Fri Oct 16 2026\n",
+		},
+		"shell": {
+			command: "df",
+			output:  "Welcome\nadmin@server:~$ df\nFilesystem 1K-blocks\n/dev/sda1 100\nadmin@server:~$ ",
+			want:    "Filesystem 1K-blocks\n/dev/sda1 100\n",
+		},
+		"echo without prompt": {
+			command: "show clock",
+			output:  "show clock\r\n02:00:01.512 UTC\r\n\r\nRP/0/RSP0/CPU0:edge1#",
+			want:    "02:00:01.512 UTC\n",
+		},
+		"closing tags are not prompts": {
+			command: "show inventory | xml",
+			output:  "show inventory | xml\r\n<Response>\r\n <Get/>\r\n</Response>\r\n\r\nRP/0/RSP0/CPU0:edge1#",
+			want:    "<Response>\n <Get/>\n</Response>\n",
+		},
+		"no echo": {
+			command: "show clock",
+			output:  "02:00:01.512 UTC\n\n",
+			want:    "02:00:01.512 UTC\n",
+		},
+	} {
+		if got := CommandOutput(tc.command, []byte(tc.output)); got != tc.want {
+			t.Errorf("%s: CommandOutput() = %q, want %q", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sudoPromptMarker replaces sudo's own prompt so it can be recognised in any
+// locale and removed from the output afterwards.
+const sudoPromptMarker = "[netmigo sudo password]:"
+
+var (
+	sudoPrompt     = regexp.MustCompile(regexp.QuoteMeta(sudoPromptMarker) + `\s*$`)
+	sudoRejected   = regexp.MustCompile(`(?i)(sorry, try again|incorrect password attempts?|is not in the sudoers file|is not allowed to (run|execute)|a password is required)`)
+	enableRejected = regexp.MustCompile(`(?i)%\s*(access denied|bad secrets?|bad passwords?|no password set)`)
+)
+
+var (
+	// ErrEnableFailed is returned when enable does not reach a privileged
+	// prompt, usually because the secret was rejected.
+	ErrEnableFailed = errors.New("enable failed")
+	// ErrSudoFailed is returned when sudo rejects the password or the user.
+	ErrSudoFailed = errors.New("sudo failed")
+)
+
+// isPrivilegedPrompt reports whether line is a privileged prompt: # on
+// Cisco devices and for root on Linux.
+func isPrivilegedPrompt(line string) bool {
+	return strings.HasSuffix(strings.TrimSpace(line), "#")
+}
+
+// privilege applies the Enable and Sudo options to the shell and reports
+// whether it is privileged. Without either option it only looks at the
+// prompt.
+func (sh *shellConn) privilege(logger *slog.Logger, options *ExecuteOptions) (bool, error) {
+	sh.exec.Lock()
+	defer sh.exec.Unlock()
+
+	switch {
+	case options.Enable:
+		if err := sh.enable(logger, options.EnableSecret, options.Timeout); err != nil {
+			return false, err
+		}
+		return true, nil
+	case options.Sudo:
+		// sudo -v only validates the password, so nothing runs.
+		if _, err := sh.runSudo(logger, "-v", options); err != nil {
+			return false, err
+		}
+		return true, nil
+	default:
+		return sh.atPrivilegedPrompt(options.Timeout)
+	}
+}
+
+// atPrivilegedPrompt sends an empty line and checks the prompt that comes
+// back. sh.exec must be held.
+func (sh *shellConn) atPrivilegedPrompt(timeout time.Duration) (bool, error) {
+	sh.drain()
+	if err := sh.writeLine(""); err != nil {
+		return false, err
+	}
+	output, prompted, err := sh.collect(timeout, timeout)
+	if err != nil {
+		return false, err
+	}
+	if !prompted {
+		return false, fmt.Errorf("no prompt within %s", timeout)
+	}
+	return isPrivilegedPrompt(lastLine(output)), nil
+}
+
+// enable raises the shell to privileged EXEC, answering the Password:
+// prompt with secret. A shell already at a # prompt is left alone. sh.exec
+// must be held.
+func (sh *shellConn) enable(logger *slog.Logger, secret string, timeout time.Duration) error {
+	privileged, err := sh.atPrivilegedPrompt(timeout)
+	if err != nil {
+		return fmt.Errorf("enable: %w", err)
+	}
+	if privileged {
+		return nil
+	}
+
+	logger.Info("Entering privileged EXEC mode")
+	if err := sh.writeLine("enable"); err != nil {
+		return fmt.Errorf("failed to send enable: %w", err)
+	}
+	var output []byte
+	answered := false
+	for {
+		chunk, matched, err := sh.collectUntil(timeout, timeout, telnetPasswordPrompt)
+		if err != nil {
+			return fmt.Errorf("enable: %w", err)
+		}
+		output = append(output, chunk...)
+		last := lastLine(output)
+		switch {
+		case enableRejected.Match(output):
+			sh.collect(timeout, timeout)
+			return fmt.Errorf("%w: %s", ErrEnableFailed, strings.TrimSpace(enableRejected.FindString(string(output))))
+		case telnetPasswordPrompt.MatchString(last):
+			if answered {
+				// Leave the repeated prompt with empty answers so the
+				// shell is back at its user EXEC prompt.
+				for i := 0; i < 2; i++ {
+					sh.writeLine("")
+					sh.collectUntil(timeout, timeout, telnetPasswordPrompt)
+				}
+				return fmt.Errorf("%w: secret rejected", ErrEnableFailed)
+			}
+			if err := sh.writeLine(secret); err != nil {
+				return fmt.Errorf("failed to send enable secret: %w", err)
+			}
+			answered = true
+			output = output[:0]
+		case matched:
+			if !isPrivilegedPrompt(last) {
+				return fmt.Errorf("%w: prompt %q is not privileged", ErrEnableFailed, last)
+			}
+			logger.Info("Privileged EXEC mode entered", "prompt", last)
+			return nil
+		default:
+			return fmt.Errorf("%w: no prompt within %s", ErrEnableFailed, timeout)
+		}
+	}
+}
+
+// runSudo runs command with sudo, answering its password prompt once. The
+// prompt and the password are removed from the output. sh.exec must be
+// held.
+func (sh *shellConn) runSudo(logger *slog.Logger, command string, options *ExecuteOptions) ([]byte, error) {
+	logger.Info("Sending command with sudo", "command", command)
+	if err := sh.writeLine(fmt.Sprintf("sudo -p '%s ' %s", sudoPromptMarker, command)); err != nil {
+		return nil, fmt.Errorf("failed to send command %q: %w", command, err)
+	}
+
+	var output []byte
+	answered := false
+	for {
+		chunk, prompted, err := sh.collectUntil(options.FirstByteTimeout, options.Timeout, sudoPrompt)
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", command, err)
+		}
+		output = append(output, chunk...)
+		if !sudoPrompt.MatchString(lastLine(output)) {
+			if !prompted {
+				logger.Info("Inactivity timer expired before the prompt returned, assuming command output is complete.", "command", command)
+			}
+			break
+		}
+		if answered {
+			// Interrupt sudo rather than let it wait for another try.
+			sh.write([]byte{0x03})
+			sh.collect(options.Timeout, options.Timeout)
+			return nil, fmt.Errorf("%w: password rejected for %q", ErrSudoFailed, command)
+		}
+		logger.Debug("Answering sudo password prompt")
+		if err := sh.writeLine(options.SudoPassword); err != nil {
+			return nil, fmt.Errorf("failed to send sudo password: %w", err)
+		}
+		answered = true
+	}
+
+	if match := sudoRejected.Find(sudoMessage(output)); match != nil {
+		return nil, fmt.Errorf("%w: %s for %q", ErrSudoFailed, match, command)
+	}
+	return scrubSudo(output, options.SudoPassword), nil
+}
+
+// sudoOutputStart returns where the command's own output begins: after the
+// line holding the last password prompt, or after the command echo when
+// sudo did not ask.
+func sudoOutputStart(output []byte) int {
+	start := 0
+	if i := bytes.LastIndex(output, []byte(sudoPromptMarker)); i >= 0 {
+		start = i
+	}
+	end := bytes.IndexByte(output[start:], '\n')
+	if end < 0 {
+		return len(output)
+	}
+	return start + end + 1
+}
+
+// sudoMessage returns the first line of the command's output. That is where
+// sudo reports a rejection; what follows may well mention sudo, so it is
+// not checked.
+func sudoMessage(output []byte) []byte {
+	output = output[sudoOutputStart(output):]
+	for len(output) > 0 {
+		var line []byte
+		line, output, _ = bytes.Cut(output, []byte("\n"))
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line
+		}
+	}
+	return nil
+}
+
+// scrubSudo removes the sudo prompt marker and any echo of the password
+// from the lines before the command's output. The output itself is left
+// alone, even where it happens to contain the password.
+func scrubSudo(output []byte, password string) []byte {
+	start := sudoOutputStart(output)
+	head := bytes.ReplaceAll(output[:start], []byte(sudoPromptMarker+" "), nil)
+	head = bytes.ReplaceAll(head, []byte(sudoPromptMarker), nil)
+	if password != "" {
+		head = bytes.ReplaceAll(head, []byte(password), []byte("********"))
+	}
+	return append(head, output[start:]...)
+}
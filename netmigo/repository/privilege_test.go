@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/internal/telnettest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func connectCLI(t *testing.T, cli sshtest.CLI) *ssh.Client {
+	t.Helper()
+	server := sshtest.NewServer(t, "admin", "secret", cli.Shell)
+	client, err := connectDirectly(context.Background(), *config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("secret"),
+		config.WithMaxRetry(1),
+	))
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func runningConfig(command string, privileged bool) string {
+	if command != "show running-config" {
+		return "% Invalid input detected at '^' marker."
+	}
+	if !privileged {
+		return "% Invalid input detected at '^' marker."
+	}
+	return "hostname router\nenable secret 9 $9$abc"
+}
+
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestEnableOverTelnetLastsForTheSession(t *testing.T) {
+	chdirTemp(t)
+	server := telnettest.Start(t, telnettest.Options{
+		Username: "admin",
+		Password: "cisco",
+		Secret:   "s3cret",
+		Handler:  versionHandler,
+	})
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	conn, err := repo.Connect(*config.NewDeviceConfig(server.Host(),
+		config.WithTelnetPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("cisco"),
+		config.WithMaxRetry(1),
+	))
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	if privileged, err := repo.Privileged(conn); err != nil || privileged {
+		t.Fatalf("Privileged() = %v, %v before enable, want false", privileged, err)
+	}
+	if _, err := repo.Privileged(conn, WithEnable("wrong")); !errors.Is(err, ErrEnableFailed) {
+		t.Fatalf("enable with a wrong secret error = %v, want ErrEnableFailed", err)
+	}
+	if privileged, err := repo.Privileged(conn, WithEnable("s3cret")); err != nil || !privileged {
+		t.Fatalf("Privileged(WithEnable) = %v, %v, want true", privileged, err)
+	}
+	if privileged, err := repo.Privileged(conn); err != nil || !privileged {
+		t.Fatalf("Privileged() = %v, %v after enable, want true", privileged, err)
+	}
+	path, err := repo.InteractiveExecute(conn, "show version", WithTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	if output := readOutput(t, path); !strings.Contains(output, "Version 12.2(55)SE") || !strings.Contains(output, "router#") {
+		t.Fatalf("output = %q, want show version at the privileged prompt", output)
+	}
+}
+
+func TestEnableOverSSHEntersEnableInTheCommandShell(t *testing.T) {
+	chdirTemp(t)
+	client := connectCLI(t, sshtest.CLI{
+		UserPrompt: "router>",
+		Secret:     "s3cret",
+		Handler:    runningConfig,
+	})
+	repo := NewSSHRepository(slog.New(slog.NewTextHandler(io.Discard, nil))).(*sshRepositoryImpl)
+
+	if privileged, err := repo.Privileged(client); err != nil || privileged {
+		t.Fatalf("Privileged() = %v, %v, want false in user EXEC", privileged, err)
+	}
+	path, err := repo.InteractiveExecute(client, "show running-config", WithEnable("s3cret"), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	if output := readOutput(t, path); !strings.Contains(output, "hostname router") {
+		t.Fatalf("output = %q, want the running config", output)
+	}
+	if strings.Contains(readOutput(t, path), "s3cret") {
+		t.Fatal("output file contains the enable secret")
+	}
+
+	_, err = repo.InteractiveExecuteMultiple(client, []string{"show running-config"}, WithEnable("wrong"), WithTimeout(5*time.Second))
+	if !errors.Is(err, ErrEnableFailed) {
+		t.Fatalf("InteractiveExecuteMultiple error = %v, want ErrEnableFailed", err)
+	}
+}
+
+func TestSudoAnswersPromptWithoutLeakingPassword(t *testing.T) {
+	chdirTemp(t)
+	client := connectCLI(t, sshtest.CLI{
+		Prompt:       "admin@server:~$ ",
+		SudoPassword: "hunter2",
+		EchoInput:    true,
+		Handler: func(command string, privileged bool) string {
+			if command == "cat /etc/shadow" && privileged {
+				return "root:*:19000:0:99999:7:::"
+			}
+			if command == "grep sudo /var/log/auth.log" && privileged {
+				return "Oct 18 02:00:01 server sudo: pam_unix(sudo:auth): auth could not identify password\nSorry, try again."
+			}
+			return "cat: /etc/shadow: Permission denied"
+		},
+	})
+	repo := NewSSHRepository(slog.New(slog.NewTextHandler(io.Discard, nil))).(*sshRepositoryImpl)
+
+	paths, err := repo.InteractiveExecuteMultiple(client, []string{"cat /etc/shadow", "cat /etc/shadow"}, WithSudoPassword("hunter2"), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecuteMultiple returned error: %v", err)
+	}
+	for _, path := range paths {
+		output := readOutput(t, path)
+		if !strings.Contains(output, "root:*:19000") {
+			t.Fatalf("output = %q, want the shadow file", output)
+		}
+		if strings.Contains(output, "hunter2") || strings.Contains(output, sudoPromptMarker) {
+			t.Fatalf("output = %q leaks the sudo password or prompt", output)
+		}
+	}
+
+	// sudo's messages in the command's own output are not a rejection.
+	path, err := repo.InteractiveExecute(client, "grep sudo /var/log/auth.log", WithSudoPassword("hunter2"), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute of a log mentioning sudo returned error: %v", err)
+	}
+	if output := readOutput(t, path); !strings.Contains(output, "Sorry, try again.") {
+		t.Fatalf("output = %q, want the log lines", output)
+	}
+
+	if privileged, err := repo.Privileged(client, WithSudoPassword("hunter2")); err != nil || !privileged {
+		t.Fatalf("Privileged(WithSudoPassword) = %v, %v, want true", privileged, err)
+	}
+	_, err = repo.InteractiveExecute(client, "cat /etc/shadow", WithSudoPassword("wrong"), WithTimeout(5*time.Second))
+	if !errors.Is(err, ErrSudoFailed) {
+		t.Fatalf("InteractiveExecute error = %v, want ErrSudoFailed", err)
+	}
+	if strings.Contains(err.Error(), "wrong") {
+		t.Fatalf("error %q leaks the password", err)
+	}
+}
+
+func TestSudoMessageIsTheLineAfterThePrompt(t *testing.T) {
+	echo := "sudo -p '" + sudoPromptMarker + " ' apt update\r\n"
+	cases := map[string]string{
+		echo + sudoPromptMarker + " \r\nadmin is not in the sudoers file.  This incident will be reported.\r\nadmin@server:~$ ": "admin is not in the sudoers file.  This incident will be reported.",
+		echo + "sudo: a password is required\r\nadmin@server:~$ ":                                                               "sudo: a password is required",
+		echo + sudoPromptMarker + " \r\nHit:1 http://deb.debian.org\r\nSorry, try again.\r\n":                                   "Hit:1 http://deb.debian.org",
+	}
+	for output, want := range cases {
+		if got := string(sudoMessage([]byte(output))); got != want {
+			t.Errorf("sudoMessage(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestScrubSudoLeavesCommandOutputAlone(t *testing.T) {
+	echo := "sudo -p '" + sudoPromptMarker + " ' id admin\r\n"
+	output := echo + sudoPromptMarker + " admin\r\nuid=1000(admin) gid=1000(admin)\r\n"
+	want := "sudo -p '' id ********\r\n********\r\nuid=1000(admin) gid=1000(admin)\r\n"
+	if got := string(scrubSudo([]byte(output), "admin")); got != want {
+		t.Fatalf("scrubSudo = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// shellConn is an interactive CLI carried over a byte stream, a Telnet
+// connection or an SSH shell channel. Output is read by a pump goroutine so
+// collection can time out on transports without read deadlines.
+type shellConn struct {
+	// data carries output read by the pump goroutine; err is set before
+	// data is closed.
+	data   chan []byte
+	err    error
+	closed chan struct{}
+	once   sync.Once
+
+	// exec serialises commands, since the stream carries a single shell.
+	exec sync.Mutex
+
+	prompt *regexp.Regexp
+	eol    string
+	write  func([]byte) error
+	close  func() error
+}
+
+func newShellConn(read func([]byte) (int, error), write func([]byte) error, close func() error, eol string) *shellConn {
+	sh := &shellConn{
+		data:   make(chan []byte, 64),
+		closed: make(chan struct{}),
+		prompt: defaultTelnetPrompt,
+		eol:    eol,
+		write:  write,
+		close:  close,
+	}
+	go sh.pump(read)
+	return sh
+}
+
+// newSSHShell starts an interactive shell on client with the same terminal
+// settings as ExecutorInteractiveExecute.
+func newSSHShell(client *ssh.Client) (*shellConn, *ssh.Session, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("vt100", 80, 40, modes); err != nil {
+		session.Close()
+		return nil, nil, fmt.Errorf("failed to request pseudo terminal: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, fmt.Errorf("failed to obtain stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, nil, fmt.Errorf("failed to obtain stdout pipe: %w", err)
+	}
+	if err := session.Shell(); err != nil {
+		session.Close()
+		return nil, nil, fmt.Errorf("failed to start shell: %w", err)
+	}
+	write := func(b []byte) error {
+		_, err := stdin.Write(b)
+		return err
+	}
+	return newShellConn(stdout.Read, write, session.Close, "\r"), session, nil
+}
+
+// openPromptShell starts a prompt-driven shell on client for work the
+// one-shot executor cannot do: answering enable and sudo prompts, or
+// staying in configuration mode across lines. The returned function logs
+// out and closes the shell.
+func openPromptShell(client *ssh.Client, timeout time.Duration) (*shellConn, func(), error) {
+	if client == nil {
+		return nil, nil, errors.New("ssh client is nil; not connected")
+	}
+	sh, _, err := newSSHShell(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sh.ping(timeout); err != nil {
+		sh.Close()
+		return nil, nil, fmt.Errorf("waiting for shell prompt: %w", err)
+	}
+	return sh, func() {
+		sh.writeLine("exit")
+		sh.Close()
+	}, nil
+}
+
+// Close closes the stream without logging out.
+func (sh *shellConn) Close() error {
+	var err error
+	sh.once.Do(func() {
+		close(sh.closed)
+		err = sh.close()
+	})
+	return err
+}
+
+func (sh *shellConn) pump(read func([]byte) (int, error)) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			select {
+			case sh.data <- chunk:
+			case <-sh.closed:
+				err = errShellClosed
+			}
+		}
+		if err != nil {
+			sh.err = err
+			close(sh.data)
+			return
+		}
+	}
+}
+
+var errShellClosed = errors.New("connection closed")
+
+func (sh *shellConn) writeLine(line string) error {
+	return sh.write([]byte(line + sh.eol))
+}
+
+// drain discards output that arrived between commands.
+func (sh *shellConn) drain() {
+	for {
+		select {
+		case _, ok := <-sh.data:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// collect reads output until the prompt is back on the last line, no
+// output arrives for inactivityTimeout, or none at all within
+// firstByteTimeout. The prompt only counts after a line break, so the
+// prompt echoed in front of the command does not end collection.
+func (sh *shellConn) collect(firstByteTimeout, inactivityTimeout time.Duration) ([]byte, bool, error) {
+	return sh.collectUntil(firstByteTimeout, inactivityTimeout, nil)
+}
+
+// collectUntil is collect that also stops when the last line matches also,
+// such as a password prompt. The second result reports either match.
+func (sh *shellConn) collectUntil(firstByteTimeout, inactivityTimeout time.Duration, also *regexp.Regexp) ([]byte, bool, error) {
+	timer := time.NewTimer(firstByteTimeout)
+	defer timer.Stop()
+
+	var output []byte
+	for {
+		select {
+		case chunk, ok := <-sh.data:
+			if !ok {
+				if len(output) == 0 {
+					return nil, false, fmt.Errorf("connection closed: %w", sh.err)
+				}
+				return output, false, nil
+			}
+			output = append(output, chunk...)
+			last := lastLine(output)
+			if bytes.IndexByte(output, '\n') >= 0 && sh.prompt.MatchString(last) {
+				return output, true, nil
+			}
+			if also != nil && also.MatchString(last) {
+				return output, true, nil
+			}
+			timer.Reset(inactivityTimeout)
+		case <-timer.C:
+			return output, false, nil
+		}
+	}
+}
+
+// ping sends an empty line and waits for the prompt to come back.
+func (sh *shellConn) ping(timeout time.Duration) error {
+	sh.exec.Lock()
+	defer sh.exec.Unlock()
+
+	sh.drain()
+	if err := sh.writeLine(""); err != nil {
+		return err
+	}
+	_, prompted, err := sh.collect(timeout, timeout)
+	if err != nil {
+		return err
+	}
+	if !prompted {
+		return fmt.Errorf("no prompt within %s", timeout)
+	}
+	return nil
+}
+
+func (sh *shellConn) run(logger *slog.Logger, command string, options *ExecuteOptions) ([]byte, error) {
+	sh.drain()
+	if options.Sudo {
+		return sh.runSudo(logger, command, options)
+	}
+	logger.Info("Sending command", "command", command)
+	if err := sh.writeLine(command); err != nil {
+		return nil, fmt.Errorf("failed to send command %q: %w", command, err)
+	}
+	output, prompted, err := sh.collect(options.FirstByteTimeout, options.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("command %q: %w", command, err)
+	}
+	if !prompted {
+		logger.Info("Inactivity timer expired before the prompt returned, assuming command output is complete.", "command", command)
+	}
+	return output, nil
+}
+
+// execute runs command and writes its output to a file, like
+// ExecutorInteractiveExecute.
+func (sh *shellConn) execute(logger *slog.Logger, command string, opts []ExecuteOption) (string, error) {
+	options := NewExecuteOptions(opts...)
+	sh.exec.Lock()
+	defer sh.exec.Unlock()
+
+	if options.Enable {
+		if err := sh.enable(logger, options.EnableSecret, options.Timeout); err != nil {
+			return "", err
+		}
+	}
+	output, err := sh.run(logger, command, options)
+	if err != nil {
+		return "", err
+	}
+	outputFileName := fmt.Sprintf("cmd_output_%s.txt", time.Now().Format("20060102150405.000000000"))
+	return writeCommandOutput(logger, outputFileName, output)
+}
+
+// executeMultiple runs commands in order and writes one output file per
+// command, like ExecutorInteractiveExecuteMultiple.
+func (sh *shellConn) executeMultiple(logger *slog.Logger, commands []string, opts []ExecuteOption) ([]string, error) {
+	options := NewExecuteOptions(opts...)
+	sh.exec.Lock()
+	defer sh.exec.Unlock()
+
+	if options.Enable {
+		if err := sh.enable(logger, options.EnableSecret, options.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	var outputFiles []string
+	for idx, command := range commands {
+		output, err := sh.run(logger, command, options)
+		if err != nil {
+			return outputFiles, err
+		}
+		outputFileName := fmt.Sprintf("cmd_multi_output_%d_%s.txt", idx, time.Now().Format("20060102150405.000000000"))
+		path, err := writeCommandOutput(logger, outputFileName, output)
+		if err != nil {
+			return outputFiles, err
+		}
+		outputFiles = append(outputFiles, path)
+	}
+	logger.Info("All commands execution complete in single shell (multiple)", "count", len(commands))
+	return outputFiles, nil
+}
+
+func lastLine(output []byte) string {
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+	return string(bytes.TrimRight(output, "\r\x00"))
+}
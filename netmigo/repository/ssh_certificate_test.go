@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestValidateUserCertificate(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	base := ssh.Certificate{
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"neteng", "ops"},
+		ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+
+	cases := []struct {
+		name    string
+		mutate  func(c *ssh.Certificate)
+		user    string
+		wantErr string
+	}{
+		{name: "valid", user: "ops"},
+		{name: "expired", user: "ops", mutate: func(c *ssh.Certificate) { c.ValidBefore = uint64(now.Add(-time.Minute).Unix()) }, wantErr: "expired"},
+		{name: "not yet valid", user: "ops", mutate: func(c *ssh.Certificate) { c.ValidAfter = uint64(now.Add(time.Minute).Unix()) }, wantErr: "not valid until"},
+		{name: "wrong principal", user: "root", wantErr: "principal \"root\""},
+		{name: "host cert", user: "ops", mutate: func(c *ssh.Certificate) { c.CertType = ssh.HostCert }, wantErr: "not a user certificate"},
+		{name: "no principals", user: "anyone", mutate: func(c *ssh.Certificate) { c.ValidPrincipals = nil }},
+		{name: "forever", user: "ops", mutate: func(c *ssh.Certificate) { c.ValidBefore = ssh.CertTimeInfinity }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert := base
+			if tc.mutate != nil {
+				tc.mutate(&cert)
+			}
+			err := validateUserCertificate(&cert, tc.user, now)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateUserCertificate returned error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("validateUserCertificate error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectDirectlyWithUserAndHostCertificates(t *testing.T) {
+	userCA := sshtest.NewSigner(t)
+	hostCA := sshtest.NewSigner(t)
+	now := time.Now()
+
+	hostKey := sshtest.NewSigner(t)
+	hostCert := sshtest.SignCertificate(t, hostCA, hostKey.PublicKey(), ssh.HostCert, []string{"127.0.0.1"}, now.Add(-time.Hour), now.Add(time.Hour))
+	hostSigner, err := ssh.NewCertSigner(hostCert, hostKey)
+	if err != nil {
+		t.Fatalf("host cert signer: %v", err)
+	}
+	server := sshtest.Start(t, sshtest.Options{Username: "neteng", UserCA: userCA.PublicKey(), HostSigner: hostSigner})
+
+	dir := t.TempDir()
+	keyPath := writeEd25519Key(t, dir)
+	userKey := loadPublicKey(t, keyPath)
+	userCert := sshtest.SignCertificate(t, userCA, userKey, ssh.UserCert, []string{"neteng"}, now.Add(-time.Hour), now.Add(time.Hour))
+	certPath := keyPath + "-cert.pub"
+	writeFile(t, certPath, ssh.MarshalAuthorizedKey(userCert))
+	caPath := filepath.Join(dir, "host_ca.pub")
+	writeFile(t, caPath, append([]byte("# trusted host CA\n"), ssh.MarshalAuthorizedKey(hostCA.PublicKey())...))
+
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("neteng"),
+		config.WithKeyPath(keyPath),
+		config.WithCertificate(""),
+		config.WithHostCAFile(caPath),
+		config.WithMaxRetry(1),
+	)
+	client, err := connectDirectly(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	client.Close()
+
+	otherCAPath := filepath.Join(dir, "other_ca.pub")
+	writeFile(t, otherCAPath, ssh.MarshalAuthorizedKey(sshtest.NewSigner(t).PublicKey()))
+	cfg.HostCAPath = otherCAPath
+	if _, err := connectDirectly(context.Background(), *cfg); err == nil {
+		t.Fatal("expected host certificate from an untrusted CA to be rejected")
+	}
+}
+
+func TestConnectDirectlyChecksHostCertificateAgainstHostName(t *testing.T) {
+	originalLookup := lookupIPAddrFunc
+	t.Cleanup(func() { lookupIPAddrFunc = originalLookup })
+	lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+		if host != "router1.example" {
+			t.Fatalf("resolved %q, want router1.example", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	hostCA := sshtest.NewSigner(t)
+	hostKey := sshtest.NewSigner(t)
+	now := time.Now()
+	hostCert := sshtest.SignCertificate(t, hostCA, hostKey.PublicKey(), ssh.HostCert, []string{"router1.example"}, now.Add(-time.Hour), now.Add(time.Hour))
+	hostSigner, err := ssh.NewCertSigner(hostCert, hostKey)
+	if err != nil {
+		t.Fatalf("host cert signer: %v", err)
+	}
+	server := sshtest.Start(t, sshtest.Options{Username: "neteng", Password: "secret", HostSigner: hostSigner})
+	caPath := filepath.Join(t.TempDir(), "host_ca.pub")
+	writeFile(t, caPath, ssh.MarshalAuthorizedKey(hostCA.PublicKey()))
+
+	client, err := connectDirectly(context.Background(), *config.NewDeviceConfig("router1.example",
+		config.WithPort(server.Port()),
+		config.WithUsername("neteng"),
+		config.WithPassword("secret"),
+		config.WithHostCAFile(caPath),
+		config.WithAddressFamily(config.AddressFamilyPreferIPv4),
+		config.WithMaxRetry(1),
+	))
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	client.Close()
+}
+
+func TestConnectDirectlyRejectsExpiredCertificateBeforeDialing(t *testing.T) {
+	originalDial := sshDialFunc
+	t.Cleanup(func() { sshDialFunc = originalDial })
+	sshDialFunc = func(dialer config.Dialer, network, addr, hostAddr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatal("dial attempted with an expired certificate")
+		return nil, nil
+	}
+
+	dir := t.TempDir()
+	keyPath := writeEd25519Key(t, dir)
+	past := time.Now().Add(-48 * time.Hour)
+	cert := sshtest.SignCertificate(t, sshtest.NewSigner(t), loadPublicKey(t, keyPath), ssh.UserCert, []string{"neteng"}, past, past.Add(time.Hour))
+	writeFile(t, keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert))
+
+	_, err := connectDirectly(context.Background(), config.DeviceConfig{
+		IP:       "10.0.0.1",
+		Port:     "22",
+		Username: "neteng",
+		KeyPath:  keyPath,
+		CertPath: keyPath + "-cert.pub",
+	})
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("connectDirectly error = %v, want expiry error", err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir string) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	path := filepath.Join(dir, "id_ed25519")
+	writeFile(t, path, pem.EncodeToMemory(block))
+	return path
+}
+
+func loadPublicKey(t *testing.T, keyPath string) ssh.PublicKey {
+	t.Helper()
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
@@ -1,10 +1,10 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
-	"os"
 	"strings"
 	"time"
 
@@ -13,43 +13,51 @@ import (
 )
 
 var (
-	sshDialFunc                  = ssh.Dial
+	sshDialFunc                  = dialSSH
 	sleepFunc                    = time.Sleep
 	timeAfterFunc                = time.After
-	getJumpClientFunc            = getJumpClient
-	releaseJumpClientFunc        = ReleaseJumpClient
+	getJumpClientFunc            = (*JumpClientManager).AcquireContext
+	releaseJumpClientFunc        = (*JumpClientManager).ReleaseClient
 	connectThroughJumpFunc       = connectThroughJumpServer
+	probeJumpClientFunc          = probeClient
 	errJumpDialTimedOut    error = errors.New("jump server dial timed out")
 )
 
-func connectToTarget(cfg config.DeviceConfig) (*ssh.Client, error) {
+// connectToTarget returns the target client and, when cfg has a jump
+// server, the jump client it was reached through. The lease on the jump
+// client must be released when the target client is closed.
+func connectToTarget(ctx context.Context, jumps *JumpClientManager, cfg config.DeviceConfig) (*ssh.Client, *ssh.Client, error) {
 	if cfg.JumpServer != nil {
-		jumpClient, err := getJumpClientFunc(cfg.JumpServer)
+		jumpClient, err := getJumpClientFunc(jumps, ctx, cfg.JumpServer)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get jump server client: %w", err)
+			return nil, nil, fmt.Errorf("failed to get jump server client: %w", err)
 		}
-		client, err := connectThroughJumpFunc(jumpClient, cfg)
+		client, err := connectThroughJumpFunc(ctx, jumpClient, cfg)
 		if err != nil {
-			releaseJumpClientFunc(cfg.JumpServer)
-			return nil, err
+			releaseJumpClientFunc(jumps, cfg.JumpServer, jumpClient)
+			return nil, nil, err
 		}
-		return client, nil
+		return client, jumpClient, nil
 	}
-	return connectDirectly(cfg)
+	client, err := connectDirectly(ctx, cfg)
+	return client, nil, err
 }
 
-func connectDirectly(cfg config.DeviceConfig) (*ssh.Client, error) {
-	authMethods, err := getAuthMethods(&cfg)
+func connectDirectly(ctx context.Context, cfg config.DeviceConfig) (*ssh.Client, error) {
+	return withCredentialFallback(ctx, cfg, connectDirectlyWithCredential)
+}
+
+func connectDirectlyWithCredential(cfg config.DeviceConfig) (*ssh.Client, error) {
+	sshConfig, err := newClientConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
-	sshConfig := &ssh.ClientConfig{
-		User:            cfg.Username,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         cfg.ConnectionTimeout,
+	dialer, err := transportDialer(cfg)
+	if err != nil {
+		return nil, err
 	}
-	address := fmt.Sprintf("%s:%s", cfg.IP, cfg.Port)
+	address := cfg.Address()
+	network := targetNetwork(cfg)
 	maxRetries := cfg.MaxRetry
 	if maxRetries < 1 {
 		maxRetries = 1
@@ -58,7 +66,7 @@ func connectDirectly(cfg config.DeviceConfig) (*ssh.Client, error) {
 	attempts := 0
 	for attempts < maxRetries {
 		attempts++
-		client, err := sshDialFunc("tcp", address, sshConfig)
+		client, err := dialResolvedAddresses(cfg, dialer, network, sshConfig)
 		if err == nil {
 			return client, nil
 		}
@@ -71,11 +79,40 @@ func connectDirectly(cfg config.DeviceConfig) (*ssh.Client, error) {
 	return nil, fmt.Errorf("failed to connect to %s after %d %s: %w", address, attempts, attemptLabel(attempts), dialErr)
 }
 
-func connectThroughJumpServer(jumpClient *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
-	address := fmt.Sprintf("%s:%s", cfg.IP, cfg.Port)
+// dialResolvedAddresses tries each resolved address in order and returns the
+// first successful client. Auth failures are returned immediately since
+// another address of the same host will not accept different credentials.
+func dialResolvedAddresses(cfg config.DeviceConfig, dialer config.Dialer, network string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	addresses, err := resolveDialAddresses(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, address := range addresses {
+		client, err := sshDialFunc(dialer, network, address, cfg.Address(), sshConfig)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+		if isAuthFailureError(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func connectThroughJumpServer(ctx context.Context, jumpClient *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
+	return withCredentialFallback(ctx, cfg, func(candidate config.DeviceConfig) (*ssh.Client, error) {
+		return connectThroughJumpServerWithCredential(jumpClient, candidate)
+	})
+}
+
+func connectThroughJumpServerWithCredential(jumpClient *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
+	address := cfg.Address()
+	network := targetNetwork(cfg)
 
 	netConn, err := dialConnWithTimeout(func() (net.Conn, error) {
-		return jumpClient.Dial("tcp", address)
+		return jumpClient.Dial(network, address)
 	}, cfg.ConnectionTimeout)
 	if err != nil {
 		if errors.Is(err, errJumpDialTimedOut) {
@@ -84,19 +121,12 @@ func connectThroughJumpServer(jumpClient *ssh.Client, cfg config.DeviceConfig) (
 		return nil, fmt.Errorf("jump server dial error: %w", err)
 	}
 
-	authMethods, err := getAuthMethods(&cfg)
+	sshConfig, err := newClientConfig(cfg)
 	if err != nil {
 		netConn.Close()
 		return nil, err
 	}
 
-	sshConfig := &ssh.ClientConfig{
-		User:            cfg.Username,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         cfg.ConnectionTimeout,
-	}
-
 	clientConn, chans, reqs, err := ssh.NewClientConn(netConn, address, sshConfig)
 	if err != nil {
 		netConn.Close()
@@ -112,7 +142,7 @@ func dialConnWithTimeout(dial func() (net.Conn, error), timeout time.Duration) (
 		err  error
 	}
 
-	results := make(chan dialResult, 1)
+	results := make(chan dialResult)
 	done := make(chan struct{})
 	defer close(done)
 
@@ -148,6 +178,12 @@ func shouldRetrySSHConnectError(err error) bool {
 	return !isAuthFailureError(err)
 }
 
+// IsAuthFailure reports whether err from Connect means the device rejected
+// the credentials, as opposed to being unreachable.
+func IsAuthFailure(err error) bool {
+	return isAuthFailureError(err)
+}
+
 func isAuthFailureError(err error) bool {
 	if err == nil {
 		return false
@@ -174,32 +210,51 @@ func attemptLabel(attempts int) string {
 	return "attempts"
 }
 
+func newClientConfig(cfg config.DeviceConfig) (*ssh.ClientConfig, error) {
+	authMethods, err := getAuthMethods(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, hostKeyAlgorithms, err := hostKeyVerification(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:              cfg.Username,
+		Auth:              authMethods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           cfg.ConnectionTimeout,
+	}, nil
+}
+
 func getAuthMethods(cfg *config.DeviceConfig) ([]ssh.AuthMethod, error) {
 	var methods []ssh.AuthMethod
-	if cfg.KeyPath != "" {
-		pk, err := publicKeyFile(cfg.KeyPath)
+	certPath := cfg.CertificatePath()
+	if certPath != "" && !hasKeyMaterial(cfg) {
+		return nil, errors.New("certificate auth requires the matching private key")
+	}
+	if hasKeyMaterial(cfg) {
+		signer, err := loadSigner(cfg)
 		if err != nil {
 			return nil, err
 		}
-		methods = append(methods, pk)
+		if certPath != "" {
+			signer, err = newCertSigner(signer, certPath, cfg.Username)
+			if err != nil {
+				return nil, err
+			}
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
 	}
 	if cfg.Password != "" {
 		methods = append(methods, ssh.Password(cfg.Password))
 	}
+	if cfg.KeyboardInteractive != nil {
+		methods = append(methods, ssh.KeyboardInteractive(cfg.KeyboardInteractive))
+	}
 	if len(methods) == 0 {
 		return nil, errors.New("no auth method provided (need KeyPath or Password)")
 	}
 	return methods, nil
 }
-
-func publicKeyFile(file string) (ssh.AuthMethod, error) {
-	key, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("error reading key file: %w", err)
-	}
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing private key: %w", err)
-	}
-	return ssh.PublicKeys(signer), nil
-}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net"
@@ -49,7 +50,7 @@ func TestConnectDirectlyStopsRetryingAuthErrors(t *testing.T) {
 
 	attempts := 0
 	sleepCalls := 0
-	sshDialFunc = func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	sshDialFunc = func(dialer config.Dialer, network, addr, hostAddr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
 		attempts++
 		return nil, errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain")
 	}
@@ -57,7 +58,7 @@ func TestConnectDirectlyStopsRetryingAuthErrors(t *testing.T) {
 		sleepCalls++
 	}
 
-	_, err := connectDirectly(config.DeviceConfig{
+	_, err := connectDirectly(context.Background(), config.DeviceConfig{
 		IP:                "10.0.0.1",
 		Port:              "22",
 		Username:          "user",
@@ -89,7 +90,7 @@ func TestConnectDirectlyRetriesTransientErrors(t *testing.T) {
 
 	attempts := 0
 	sleepCalls := 0
-	sshDialFunc = func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	sshDialFunc = func(dialer config.Dialer, network, addr, hostAddr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
 		attempts++
 		if attempts < 3 {
 			return nil, errors.New("connection reset by peer")
@@ -100,7 +101,7 @@ func TestConnectDirectlyRetriesTransientErrors(t *testing.T) {
 		sleepCalls++
 	}
 
-	client, err := connectDirectly(config.DeviceConfig{
+	client, err := connectDirectly(context.Background(), config.DeviceConfig{
 		IP:                "10.0.0.1",
 		Port:              "22",
 		Username:          "user",
@@ -133,17 +134,17 @@ func TestConnectToTargetReleasesJumpClientOnFailedTargetConnect(t *testing.T) {
 	})
 
 	var releaseCalls atomic.Int32
-	getJumpClientFunc = func(cfg *config.DeviceConfig) (*ssh.Client, error) {
+	getJumpClientFunc = func(_ *JumpClientManager, _ context.Context, cfg *config.DeviceConfig) (*ssh.Client, error) {
 		return &ssh.Client{}, nil
 	}
-	connectThroughJumpFunc = func(client *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
+	connectThroughJumpFunc = func(_ context.Context, client *ssh.Client, cfg config.DeviceConfig) (*ssh.Client, error) {
 		return nil, errors.New("target auth failed")
 	}
-	releaseJumpClientFunc = func(cfg *config.DeviceConfig) {
+	releaseJumpClientFunc = func(_ *JumpClientManager, cfg *config.DeviceConfig, _ *ssh.Client) {
 		releaseCalls.Add(1)
 	}
 
-	_, err := connectToTarget(config.DeviceConfig{
+	_, _, err := connectToTarget(context.Background(), NewJumpClientManager(), config.DeviceConfig{
 		IP:                "10.0.0.1",
 		Port:              "22",
 		Username:          "user",
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/credentials"
+)
+
+// withCredentialFallback calls connect with the credentials set on cfg and
+// then with each credential provider in turn, moving on only when the
+// server rejects the credential. Providers are consulted lazily, so a
+// secret command for the emergency account only runs if it is needed. ctx
+// is passed to the providers.
+func withCredentialFallback[T any](ctx context.Context, cfg config.DeviceConfig, connect func(config.DeviceConfig) (T, error)) (T, error) {
+	if len(cfg.CredentialProviders) == 0 {
+		return connect(cfg)
+	}
+
+	providers := cfg.CredentialProviders
+	base := cfg
+	base.CredentialProviders = nil
+
+	var zero T
+	var failures []error
+	try := func(label string, candidate config.DeviceConfig) (T, bool, error) {
+		client, err := connect(candidate)
+		if err == nil {
+			return client, true, nil
+		}
+		err = fmt.Errorf("credential %s: %w", label, err)
+		if !isAuthFailureError(err) {
+			return zero, true, err
+		}
+		failures = append(failures, err)
+		return zero, false, nil
+	}
+
+	if hasOwnCredentials(base) {
+		if client, done, err := try("config", base); done {
+			return client, err
+		}
+	}
+
+	target := credentials.Target{Host: base.Host(), Port: base.Port, Username: base.Username}
+	for i, provider := range providers {
+		cred, err := provider.Credential(ctx, target)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("credential provider %d: %w", i+1, err))
+			continue
+		}
+		label := cred.Label
+		if label == "" {
+			label = fmt.Sprintf("provider %d", i+1)
+		}
+		if client, done, err := try(label, applyCredential(base, cred)); done {
+			return client, err
+		}
+	}
+
+	if len(failures) == 0 {
+		return zero, errors.New("no auth method provided (need KeyPath, Password or a credential provider)")
+	}
+	return zero, fmt.Errorf("all credentials failed for %s: %w", cfg.Address(), errors.Join(failures...))
+}
+
+func hasOwnCredentials(cfg config.DeviceConfig) bool {
+	return cfg.Password != "" || hasKeyMaterial(&cfg) || cfg.KeyboardInteractive != nil
+}
+
+// applyCredential overrides the fields of cfg that cred sets. A credential
+// with only a password keeps the device key, so both are offered; one with
+// a key path replaces the device's key material and certificate.
+func applyCredential(cfg config.DeviceConfig, cred credentials.Credential) config.DeviceConfig {
+	if cred.Username != "" {
+		cfg.Username = cred.Username
+	}
+	if cred.Password != "" {
+		cfg.Password = cred.Password
+	}
+	if cred.KeyPath != "" && cred.KeyPath != cfg.KeyPath {
+		cfg.KeyPath = cred.KeyPath
+		cfg.CertPath = ""
+		cfg.CertFromKeyPath = false
+		cfg.PrivateKey = nil
+		cfg.Signer = nil
+	}
+	return cfg
+}
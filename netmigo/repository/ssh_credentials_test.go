@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/credentials"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnectDirectlyFallsBackToNextCredential(t *testing.T) {
+	server := sshtest.NewServer(t, "local-admin", "emergency", nil)
+
+	var consulted []string
+	tacacs := credentials.ProviderFunc(func(ctx context.Context, target credentials.Target) (credentials.Credential, error) {
+		consulted = append(consulted, "tacacs")
+		return credentials.Credential{Label: "tacacs", Username: "svc-net", Password: "aaa-down"}, nil
+	})
+	missing := credentials.ProviderFunc(func(ctx context.Context, target credentials.Target) (credentials.Credential, error) {
+		consulted = append(consulted, "missing")
+		return credentials.Credential{}, credentials.ErrNotFound
+	})
+
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("local-admin"),
+		config.WithMaxRetry(3),
+		config.WithCredentialProvider(tacacs, missing, credentials.Static("emergency", "", "emergency")),
+	)
+	client, err := connectDirectly(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	client.Close()
+
+	if strings.Join(consulted, ",") != "tacacs,missing" {
+		t.Fatalf("consulted = %v", consulted)
+	}
+	// One rejected handshake for tacacs (auth errors are not retried) plus
+	// the successful emergency login.
+	if server.Connections() != 1 {
+		t.Fatalf("successful connections = %d, want 1", server.Connections())
+	}
+}
+
+func TestConnectDirectlyReportsEveryFailedCredential(t *testing.T) {
+	server := sshtest.NewServer(t, "admin", "right", nil)
+
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("wrong-1"),
+		config.WithCredentialProvider(credentials.Static("backup", "", "wrong-2")),
+	)
+	_, err := connectDirectly(context.Background(), *cfg)
+	if err == nil {
+		t.Fatal("connectDirectly returned nil error")
+	}
+	for _, want := range []string{"all credentials failed", "credential config", "credential backup"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestConnectDirectlyStopsOnNonAuthErrors(t *testing.T) {
+	calls := 0
+	provider := credentials.ProviderFunc(func(ctx context.Context, target credentials.Target) (credentials.Credential, error) {
+		calls++
+		return credentials.Credential{Password: "x"}, nil
+	})
+
+	_, err := withCredentialFallback(context.Background(), config.DeviceConfig{IP: "10.0.0.1", Port: "22", CredentialProviders: []credentials.CredentialProvider{provider, provider}},
+		func(config.DeviceConfig) (*ssh.Client, error) { return nil, errors.New("connection refused") })
+	if err == nil || calls != 1 {
+		t.Fatalf("err = %v, provider calls = %d, want error after 1 call", err, calls)
+	}
+}
+
+func TestWithCredentialFallbackPassesContextToProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	provider := credentials.ProviderFunc(func(ctx context.Context, target credentials.Target) (credentials.Credential, error) {
+		return credentials.Credential{}, ctx.Err()
+	})
+
+	_, err := withCredentialFallback(ctx, config.DeviceConfig{IP: "10.0.0.1", Port: "22", CredentialProviders: []credentials.CredentialProvider{provider}},
+		func(config.DeviceConfig) (*ssh.Client, error) { return nil, errors.New("unexpected connect") })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want the provider to see the cancelled context", err)
+	}
+}
+
+func TestApplyCredentialKeepsFieldsTheCredentialLeavesEmpty(t *testing.T) {
+	device := config.DeviceConfig{
+		Username: "admin",
+		Password: "device",
+		KeyPath:  "/keys/id_ed25519",
+		CertPath: "/keys/id_ed25519-cert.pub",
+	}
+
+	got := applyCredential(device, credentials.Credential{Password: "from-vault"})
+	if got.Username != "admin" || got.Password != "from-vault" || got.KeyPath != device.KeyPath || got.CertPath != device.CertPath {
+		t.Fatalf("password-only credential: got %+v", got)
+	}
+
+	got = applyCredential(device, credentials.Credential{Username: "svc-net", KeyPath: "/keys/svc"})
+	if got.Username != "svc-net" || got.Password != "device" || got.KeyPath != "/keys/svc" || got.CertPath != "" {
+		t.Fatalf("key credential: got %+v", got)
+	}
+}
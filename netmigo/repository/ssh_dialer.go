@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/proxy"
+	"golang.org/x/crypto/ssh"
+)
+
+var lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+	return resolver.LookupIPAddr(ctx, host)
+}
+
+// dialSSH connects to address and runs the SSH handshake for hostAddress,
+// the configured host:port. They differ when the host name was resolved
+// locally, and host certificates name the host, not the resolved IP.
+func dialSSH(dialer config.Dialer, network, address, hostAddress string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	ctx, cancel := dialTimeoutContext(sshConfig.Timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, hostAddress, sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// transportDialer returns the proxy command or custom dialer configured, or
+// a TCP dialer that honours the resolver and source address settings. The
+// proxy command is expanded here, from the final config.
+func transportDialer(cfg config.DeviceConfig) (config.Dialer, error) {
+	if cfg.ProxyCommand != "" {
+		return proxy.NewCommandDialer(cfg.ExpandProxyCommand()), nil
+	}
+	if cfg.Dialer != nil {
+		return cfg.Dialer, nil
+	}
+	return newNetDialer(cfg)
+}
+
+func newNetDialer(cfg config.DeviceConfig) (*net.Dialer, error) {
+	dialer := &net.Dialer{
+		Timeout:  cfg.ConnectionTimeout,
+		Resolver: cfg.Resolver,
+	}
+	if cfg.SourceAddress != "" {
+		host := cfg.SourceAddress
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", cfg.SourceAddress)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer, nil
+}
+
+// targetNetwork maps the configured address family to the network name
+// passed to the dialer.
+func targetNetwork(cfg config.DeviceConfig) string {
+	switch cfg.AddressFamily {
+	case config.AddressFamilyIPv4:
+		return "tcp4"
+	case config.AddressFamilyIPv6:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// resolveDialAddresses returns the host:port targets to try, in order. Host
+// names are only resolved locally when a family preference is configured;
+// otherwise resolution is left to the dialer. Custom dialers such as proxies
+// and proxy commands always receive the unresolved name.
+func resolveDialAddresses(cfg config.DeviceConfig) ([]string, error) {
+	host := cfg.Host()
+	if cfg.Dialer != nil || cfg.ProxyCommand != "" || net.ParseIP(host) != nil {
+		return []string{cfg.Address()}, nil
+	}
+
+	var preferV6 bool
+	switch cfg.AddressFamily {
+	case config.AddressFamilyPreferIPv4:
+		preferV6 = false
+	case config.AddressFamilyPreferIPv6:
+		preferV6 = true
+	default:
+		return []string{cfg.Address()}, nil
+	}
+
+	ctx, cancel := dialTimeoutContext(cfg.ConnectionTimeout)
+	defer cancel()
+	resolver := cfg.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := lookupIPAddrFunc(ctx, resolver, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("failed to resolve %s: no addresses found", host)
+	}
+
+	sort.SliceStable(ips, func(i, j int) bool {
+		iV6 := ips[i].IP.To4() == nil
+		jV6 := ips[j].IP.To4() == nil
+		return iV6 == preferV6 && jV6 != preferV6
+	})
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, net.JoinHostPort(ip.String(), cfg.Port))
+	}
+	return addresses, nil
+}
+
+func dialTimeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDeviceConfigAddressBracketsIPv6(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1":      "10.0.0.1:22",
+		"router1":       "router1:22",
+		"2001:db8::1":   "[2001:db8::1]:22",
+		"[2001:db8::1]": "[2001:db8::1]:22",
+	}
+	for host, want := range cases {
+		cfg := config.DeviceConfig{IP: host, Port: "22"}
+		if got := cfg.Address(); got != want {
+			t.Fatalf("Address() for %q = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestResolveDialAddressesPrefersConfiguredFamily(t *testing.T) {
+	original := lookupIPAddrFunc
+	t.Cleanup(func() { lookupIPAddrFunc = original })
+
+	lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{
+			{IP: net.ParseIP("192.0.2.10")},
+			{IP: net.ParseIP("2001:db8::10")},
+			{IP: net.ParseIP("192.0.2.11")},
+		}, nil
+	}
+
+	got, err := resolveDialAddresses(config.DeviceConfig{
+		IP:            "router1.example",
+		Port:          "22",
+		AddressFamily: config.AddressFamilyPreferIPv6,
+	})
+	if err != nil {
+		t.Fatalf("resolveDialAddresses returned error: %v", err)
+	}
+	want := []string{"[2001:db8::10]:22", "192.0.2.10:22", "192.0.2.11:22"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("addresses = %v, want %v", got, want)
+	}
+}
+
+func TestResolveDialAddressesSkipsLookupForLiterals(t *testing.T) {
+	original := lookupIPAddrFunc
+	t.Cleanup(func() { lookupIPAddrFunc = original })
+
+	lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+		t.Fatalf("unexpected lookup for %q", host)
+		return nil, nil
+	}
+
+	got, err := resolveDialAddresses(config.DeviceConfig{
+		IP:            "2001:db8::1",
+		Port:          "830",
+		AddressFamily: config.AddressFamilyPreferIPv4,
+	})
+	if err != nil {
+		t.Fatalf("resolveDialAddresses returned error: %v", err)
+	}
+	if want := []string{"[2001:db8::1]:830"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("addresses = %v, want %v", got, want)
+	}
+}
+
+func TestConnectDirectlyFallsBackAcrossResolvedAddresses(t *testing.T) {
+	originalDial := sshDialFunc
+	originalLookup := lookupIPAddrFunc
+	t.Cleanup(func() {
+		sshDialFunc = originalDial
+		lookupIPAddrFunc = originalLookup
+	})
+
+	lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("192.0.2.10")}, {IP: net.ParseIP("2001:db8::10")}}, nil
+	}
+	var dialed []string
+	sshDialFunc = func(dialer config.Dialer, network, addr, hostAddr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+		dialed = append(dialed, addr)
+		if addr == "[2001:db8::10]:22" {
+			return nil, errors.New("connect: network is unreachable")
+		}
+		return &ssh.Client{}, nil
+	}
+
+	_, err := connectDirectly(context.Background(), config.DeviceConfig{
+		IP:                "router1.example",
+		Port:              "22",
+		Username:          "user",
+		Password:          "pass",
+		MaxRetry:          1,
+		ConnectionTimeout: time.Second,
+		AddressFamily:     config.AddressFamilyPreferIPv6,
+	})
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	if want := []string{"[2001:db8::10]:22", "192.0.2.10:22"}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("dialed = %v, want %v", dialed, want)
+	}
+}
+
+func TestNewNetDialerBindsSourceAddress(t *testing.T) {
+	dialer, err := newNetDialer(config.DeviceConfig{SourceAddress: "2001:db8::5"})
+	if err != nil {
+		t.Fatalf("newNetDialer returned error: %v", err)
+	}
+	addr, ok := dialer.LocalAddr.(*net.TCPAddr)
+	if !ok || !addr.IP.Equal(net.ParseIP("2001:db8::5")) {
+		t.Fatalf("LocalAddr = %v, want 2001:db8::5", dialer.LocalAddr)
+	}
+
+	if _, err := newNetDialer(config.DeviceConfig{SourceAddress: "not-an-ip"}); err == nil {
+		t.Fatal("expected error for invalid source address")
+	}
+}
+
+func TestConnectToTargetUsesCustomDialerForJumpServer(t *testing.T) {
+	target := sshtest.NewServer(t, "admin", "target-pass", nil)
+	jump := sshtest.NewServer(t, "jump", "jump-pass", nil)
+
+	var dialed []string
+	jumpCfg := config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jump"),
+		config.WithPassword("jump-pass"),
+		config.WithDialer(config.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		})),
+	)
+	targetCfg := config.NewDeviceConfig(target.Host(),
+		config.WithPort(target.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("target-pass"),
+		config.WithJumpServer(jumpCfg),
+	)
+
+	jumps := NewJumpClientManager()
+	client, jumpClient, err := connectToTarget(context.Background(), jumps, *targetCfg)
+	if err != nil {
+		t.Fatalf("connectToTarget returned error: %v", err)
+	}
+	client.Close()
+	jumps.ReleaseClient(jumpCfg, jumpClient)
+
+	if want := []string{jump.Addr}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("custom dialer calls = %v, want %v", dialed, want)
+	}
+	if target.Connections() != 1 {
+		t.Fatalf("target connections = %d, want 1", target.Connections())
+	}
+}
+
+func TestResolveDialAddressesLeavesNamesToCustomDialer(t *testing.T) {
+	original := lookupIPAddrFunc
+	t.Cleanup(func() { lookupIPAddrFunc = original })
+
+	lookupIPAddrFunc = func(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, error) {
+		t.Fatalf("unexpected local lookup for %q", host)
+		return nil, nil
+	}
+
+	got, err := resolveDialAddresses(config.DeviceConfig{
+		IP:            "router1.example",
+		Port:          "22",
+		AddressFamily: config.AddressFamilyPreferIPv6,
+		Dialer:        &net.Dialer{},
+	})
+	if err != nil {
+		t.Fatalf("resolveDialAddresses returned error: %v", err)
+	}
+	if want := []string{"router1.example:22"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("addresses = %v, want %v", got, want)
+	}
+}
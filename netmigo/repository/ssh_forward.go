@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Forward is a running port forward. Connections accepted on Addr are
+// carried over the SSH connection until Close is called.
+type Forward struct {
+	listener net.Listener
+	dial     func() (net.Conn, error)
+	socks    *ssh.Client
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Addr is the address the forward listens on: a local address for local
+// and dynamic forwards, the address on the device for remote forwards.
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops accepting connections, closes the ones in flight and waits
+// for them to finish.
+func (f *Forward) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.listener.Close()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// LocalForward listens on localAddr and connects every accepted connection
+// to remoteAddr as seen from the device, like ssh -L. Use "127.0.0.1:0" to
+// pick a free port and read it back from Addr.
+func LocalForward(client *ssh.Client, localAddr, remoteAddr string) (*Forward, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("local forward listen on %s: %w", localAddr, err)
+	}
+	f := newForward(listener, func() (net.Conn, error) {
+		return client.Dial("tcp", remoteAddr)
+	})
+	f.start()
+	return f, nil
+}
+
+// RemoteForward asks the device to listen on remoteAddr and connects every
+// connection it accepts to localAddr on this host, like ssh -R.
+func RemoteForward(client *ssh.Client, remoteAddr, localAddr string) (*Forward, error) {
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("remote forward listen on %s: %w", remoteAddr, err)
+	}
+	f := newForward(listener, func() (net.Conn, error) {
+		return net.Dial("tcp", localAddr)
+	})
+	f.start()
+	return f, nil
+}
+
+// DynamicForward runs a SOCKS5 proxy on localAddr whose connections are
+// made from the device, like ssh -D. Only the CONNECT command without
+// authentication is supported, which is what HTTP and gRPC clients use.
+func DynamicForward(client *ssh.Client, localAddr string) (*Forward, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dynamic forward listen on %s: %w", localAddr, err)
+	}
+	f := newForward(listener, nil)
+	f.socks = client
+	f.start()
+	return f, nil
+}
+
+func newForward(listener net.Listener, dial func() (net.Conn, error)) *Forward {
+	return &Forward{
+		listener: listener,
+		dial:     dial,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+func (f *Forward) start() {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			conn, err := f.listener.Accept()
+			if err != nil {
+				return
+			}
+			if !f.track(conn) {
+				conn.Close()
+				return
+			}
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				defer f.untrack(conn)
+				f.handle(conn)
+			}()
+		}
+	}()
+}
+
+func (f *Forward) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var target net.Conn
+	var err error
+	if f.socks != nil {
+		target, err = socksConnect(conn, f.socks)
+	} else {
+		target, err = f.dial()
+	}
+	if err != nil {
+		return
+	}
+	if !f.track(target) {
+		target.Close()
+		return
+	}
+	defer f.untrack(target)
+	defer target.Close()
+
+	pipeConns(conn, target)
+}
+
+func (f *Forward) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(conn net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+}
+
+// pipeConns copies in both directions until either side is done.
+func pipeConns(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+}
+
+const (
+	socksVersion        = 0x05
+	socksNoAuth         = 0x00
+	socksNoAcceptable   = 0xff
+	socksCmdConnect     = 0x01
+	socksAddrIPv4       = 0x01
+	socksAddrDomain     = 0x03
+	socksAddrIPv6       = 0x04
+	socksReplySucceeded = 0x00
+	socksReplyFailure   = 0x01
+	socksReplyCommand   = 0x07
+	socksReplyAddrType  = 0x08
+)
+
+// socksConnect serves the SOCKS5 handshake on conn and dials the requested
+// address through client.
+func socksConnect(conn net.Conn, client *ssh.Client) (net.Conn, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return nil, err
+	}
+	if method == socksNoAcceptable {
+		return nil, errors.New("SOCKS client offered no supported auth method")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	if request[1] != socksCmdConnect {
+		socksReply(conn, socksReplyCommand)
+		return nil, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksReplyAddrType)
+		return nil, fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	target, err := client.Dial("tcp", address)
+	if err != nil {
+		socksReply(conn, socksReplyFailure)
+		return nil, fmt.Errorf("dial %s through SSH: %w", address, err)
+	}
+	if err := socksReply(conn, socksReplySucceeded); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"github.com/jonelmawirat/netmigo/netmigo/proxy"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLocalForward(t *testing.T) {
+	client := connectForwardTestClient(t)
+	echo := startEchoServer(t)
+
+	f, err := LocalForward(client, "127.0.0.1:0", echo)
+	if err != nil {
+		t.Fatalf("LocalForward returned error: %v", err)
+	}
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forward: %v", err)
+	}
+	defer conn.Close()
+	assertEcho(t, conn)
+}
+
+func TestRemoteForward(t *testing.T) {
+	client := connectForwardTestClient(t)
+	echo := startEchoServer(t)
+
+	f, err := RemoteForward(client, "127.0.0.1:0", echo)
+	if err != nil {
+		t.Fatalf("RemoteForward returned error: %v", err)
+	}
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("dial remote listener: %v", err)
+	}
+	defer conn.Close()
+	assertEcho(t, conn)
+}
+
+func TestDynamicForward(t *testing.T) {
+	client := connectForwardTestClient(t)
+	echo := startEchoServer(t)
+
+	f, err := DynamicForward(client, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("DynamicForward returned error: %v", err)
+	}
+
+	dialer := proxy.NewSOCKS5Dialer(f.Addr().String(), nil, nil)
+	conn, err := dialer.DialContext(context.Background(), "tcp", echo)
+	if err != nil {
+		t.Fatalf("dial through SOCKS forward: %v", err)
+	}
+	assertEcho(t, conn)
+
+	// Close tears down connections still in flight.
+	f.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection stayed open after Close")
+	}
+	if _, err := net.Dial("tcp", f.Addr().String()); err == nil {
+		t.Fatal("listener still accepting after Close")
+	}
+}
+
+func connectForwardTestClient(t *testing.T) *ssh.Client {
+	t.Helper()
+	server := sshtest.NewServer(t, "admin", "secret", nil)
+	client, err := connectDirectly(context.Background(), *config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("admin"),
+		config.WithPassword("secret"),
+		config.WithMaxRetry(1),
+	))
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != "ping\n" {
+		t.Fatalf("echo = %q, want ping", line)
+	}
+	conn.SetDeadline(time.Time{})
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/challenge"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnectDirectlyAnswersPasswordAndOTPPrompts(t *testing.T) {
+	const seed = "JBSWY3DPEHPK3PXP"
+	server := sshtest.Start(t, sshtest.Options{
+		Username: "neteng",
+		KeyboardInteractive: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client(conn.User(), "", []string{"Password: ", "Verification code: "}, []bool{false, false})
+			if err != nil {
+				return nil, err
+			}
+			// Accept the previous step too, in case the client computed the
+			// code just before a 30 second boundary.
+			now := time.Now()
+			current, _ := challenge.GenerateTOTP(seed, now)
+			previous, _ := challenge.GenerateTOTP(seed, now.Add(-30*time.Second))
+			if len(answers) != 2 || answers[0] != "s3cret" || (answers[1] != current && answers[1] != previous) {
+				return nil, errors.New("permission denied")
+			}
+			return nil, nil
+		},
+	})
+
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("neteng"),
+		config.WithMaxRetry(1),
+		config.WithChallengeResponse(
+			challenge.MustMatch(`(?i)password`, challenge.Static("s3cret")),
+			challenge.MustMatch(`(?i)verification code`, challenge.TOTP(seed)),
+		),
+	)
+	client, err := connectDirectly(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	client.Close()
+
+	cfg = config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("neteng"),
+		config.WithMaxRetry(1),
+		config.WithChallengeResponse(challenge.MustMatch(`(?i)password`, challenge.Static("s3cret"))),
+	)
+	if _, err := connectDirectly(context.Background(), *cfg); err == nil {
+		t.Fatal("expected unanswered OTP prompt to fail authentication")
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// hasKeyMaterial reports whether cfg carries a private key in any form.
+func hasKeyMaterial(cfg *config.DeviceConfig) bool {
+	return cfg.Signer != nil || len(cfg.PrivateKey) > 0 || cfg.KeyPath != ""
+}
+
+// loadSigner returns the signer for cfg, preferring Signer, then the
+// in-memory PrivateKey and finally the file at KeyPath.
+func loadSigner(cfg *config.DeviceConfig) (ssh.Signer, error) {
+	switch {
+	case cfg.Signer != nil:
+		return cfg.Signer, nil
+	case len(cfg.PrivateKey) > 0:
+		return parsePrivateKey(cfg.PrivateKey, "in-memory private key", cfg)
+	default:
+		key, err := os.ReadFile(cfg.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key file: %w", err)
+		}
+		return parsePrivateKey(key, "private key "+cfg.KeyPath, cfg)
+	}
+}
+
+func parsePrivateKey(key []byte, label string, cfg *config.DeviceConfig) (ssh.Signer, error) {
+	if cfg.KeyPassphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(cfg.KeyPassphrase))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s with passphrase: %w", label, err)
+		}
+		return signer, nil
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err == nil {
+		return signer, nil
+	}
+	var passphraseErr *ssh.PassphraseMissingError
+	if !errors.As(err, &passphraseErr) {
+		return nil, fmt.Errorf("error parsing %s: %w", label, err)
+	}
+	if cfg.KeyPassphraseFunc == nil {
+		return nil, fmt.Errorf("%s requires a passphrase; use WithKeyPassphrase or WithKeyPassphraseCallback", label)
+	}
+	passphrase, err := cfg.KeyPassphraseFunc()
+	if err != nil {
+		return nil, fmt.Errorf("passphrase for %s: %w", label, err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s with passphrase: %w", label, err)
+	}
+	return signer, nil
+}
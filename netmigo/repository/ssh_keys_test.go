@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLoadSignerEncryptedKey(t *testing.T) {
+	pemBytes, want := newEncryptedKey(t, "s3cret")
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	writeFile(t, path, pemBytes)
+
+	_, err := loadSigner(&config.DeviceConfig{KeyPath: path})
+	if err == nil || !strings.Contains(err.Error(), "requires a passphrase") {
+		t.Fatalf("loadSigner error = %v, want passphrase hint", err)
+	}
+
+	signer, err := loadSigner(&config.DeviceConfig{KeyPath: path, KeyPassphrase: "s3cret"})
+	if err != nil {
+		t.Fatalf("loadSigner with passphrase returned error: %v", err)
+	}
+	assertSameKey(t, signer, want)
+
+	if _, err := loadSigner(&config.DeviceConfig{KeyPath: path, KeyPassphrase: "wrong"}); err == nil {
+		t.Fatal("expected wrong passphrase to fail")
+	}
+}
+
+func TestLoadSignerPassphraseCallback(t *testing.T) {
+	pemBytes, want := newEncryptedKey(t, "s3cret")
+	calls := 0
+	cfg := config.NewDeviceConfig("10.0.0.1",
+		config.WithPrivateKey(pemBytes),
+		config.WithKeyPassphraseCallback(func() ([]byte, error) {
+			calls++
+			return []byte("s3cret"), nil
+		}),
+	)
+	signer, err := loadSigner(cfg)
+	if err != nil {
+		t.Fatalf("loadSigner returned error: %v", err)
+	}
+	assertSameKey(t, signer, want)
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+
+	cfg.KeyPassphraseFunc = func() ([]byte, error) { return nil, errors.New("prompt cancelled") }
+	if _, err := loadSigner(cfg); err == nil || !strings.Contains(err.Error(), "prompt cancelled") {
+		t.Fatalf("loadSigner error = %v, want callback error", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	configured, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	calls = 0
+	cfg = config.NewDeviceConfig("10.0.0.1",
+		config.WithKeyPath(filepath.Join(t.TempDir(), "missing")),
+		config.WithKeyPassphraseCallback(func() ([]byte, error) { calls++; return nil, nil }),
+	)
+	cfg.Signer = configured
+	signer, err = loadSigner(cfg)
+	if err != nil {
+		t.Fatalf("loadSigner with Signer returned error: %v", err)
+	}
+	assertSameKey(t, signer, configured.PublicKey())
+	if calls != 0 {
+		t.Fatal("callback called for an unencrypted signer")
+	}
+}
+
+func TestConnectDirectlyWithInMemoryKeyAndCertificate(t *testing.T) {
+	userCA := sshtest.NewSigner(t)
+	server := sshtest.Start(t, sshtest.Options{Username: "neteng", UserCA: userCA.PublicKey()})
+
+	pemBytes, pub := newEncryptedKey(t, "s3cret")
+	now := time.Now()
+	cert := sshtest.SignCertificate(t, userCA, pub, ssh.UserCert, []string{"neteng"}, now.Add(-time.Hour), now.Add(time.Hour))
+	certPath := filepath.Join(t.TempDir(), "id-cert.pub")
+	writeFile(t, certPath, ssh.MarshalAuthorizedKey(cert))
+
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithPort(server.Port()),
+		config.WithUsername("neteng"),
+		config.WithPrivateKey(pemBytes),
+		config.WithKeyPassphrase("s3cret"),
+		config.WithCertificate(certPath),
+		config.WithMaxRetry(1),
+	)
+	client, err := connectDirectly(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("connectDirectly returned error: %v", err)
+	}
+	client.Close()
+}
+
+func newEncryptedKey(t *testing.T, passphrase string) ([]byte, ssh.PublicKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	return pem.EncodeToMemory(block), pub
+}
+
+func assertSameKey(t *testing.T, signer ssh.Signer, want ssh.PublicKey) {
+	t.Helper()
+	if string(signer.PublicKey().Marshal()) != string(want.Marshal()) {
+		t.Fatal("signer does not match the expected key")
+	}
+}
@@ -1,7 +1,9 @@
 package repository
 
 import (
+    "context"
     "log/slog"
+    "sync"
 
     "golang.org/x/crypto/ssh"
 
@@ -16,16 +18,91 @@ type SSHRepository interface {
     ScpDownload(client *ssh.Client, remoteFilePath, localFilePath string) error
 }
 
+// The interfaces below are optional capabilities of an SSHRepository. The
+// repository NewSSHRepository returns has all of them; the device services
+// check for each with a type assertion, so a custom SSHRepository only
+// implements the ones it supports.
+
+// ContextConnector connects with a context that bounds queueing for a
+// shared jump server.
+type ContextConnector interface {
+    ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*ssh.Client, error)
+}
+
+// Pinger checks that a client is still usable.
+type Pinger interface {
+    Ping(client *ssh.Client) error
+}
+
+// PrivilegeChecker applies WithEnable or WithSudo and reports whether the
+// shell is privileged.
+type PrivilegeChecker interface {
+    Privileged(client *ssh.Client, opts ...ExecuteOption) (bool, error)
+}
+
+// Configurer sends configuration lines in configuration mode.
+type Configurer interface {
+    SendConfig(client *ssh.Client, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error)
+    OpenConfigSession(client *ssh.Client, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error)
+}
+
+// Forwarder forwards ports over a client, like ssh -L, -R and -D.
+type Forwarder interface {
+    LocalForward(client *ssh.Client, localAddr, remoteAddr string) (*Forward, error)
+    RemoteForward(client *ssh.Client, remoteAddr, localAddr string) (*Forward, error)
+    DynamicForward(client *ssh.Client, localAddr string) (*Forward, error)
+}
+
 type sshRepositoryImpl struct {
     logger *slog.Logger
+    jumps  *JumpClientManager
+
+    // jumpLeases maps target clients to the jump client they were reached
+    // through, so Disconnect releases the right jump connection.
+    mu         sync.Mutex
+    jumpLeases map[*ssh.Client]*ssh.Client
 }
 
-func NewSSHRepository(logger *slog.Logger) SSHRepository {
-    return &sshRepositoryImpl{logger: logger}
+// RepositoryOption configures an SSHRepository.
+type RepositoryOption func(*sshRepositoryImpl)
+
+// WithJumpClientManager makes the repository share jump connections through
+// m instead of DefaultJumpClientManager.
+func WithJumpClientManager(m *JumpClientManager) RepositoryOption {
+    return func(r *sshRepositoryImpl) {
+        r.jumps = m
+    }
+}
+
+func NewSSHRepository(logger *slog.Logger, opts ...RepositoryOption) SSHRepository {
+    r := &sshRepositoryImpl{
+        logger:     logger,
+        jumps:      DefaultJumpClientManager,
+        jumpLeases: make(map[*ssh.Client]*ssh.Client),
+    }
+    for _, opt := range opts {
+        opt(r)
+    }
+    return r
 }
 
 func (r *sshRepositoryImpl) Connect(cfg config.DeviceConfig) (*ssh.Client, error) {
-    return connectToTarget(cfg)
+    return r.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext is Connect with a context that bounds the time spent
+// queueing for a jump server channel or connect-rate slot.
+func (r *sshRepositoryImpl) ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*ssh.Client, error) {
+    client, jumpClient, err := connectToTarget(ctx, r.jumps, cfg)
+    if err != nil {
+        return nil, err
+    }
+    if jumpClient != nil {
+        r.mu.Lock()
+        r.jumpLeases[client] = jumpClient
+        r.mu.Unlock()
+    }
+    return client, nil
 }
 
 func (r *sshRepositoryImpl) Disconnect(client *ssh.Client, jumpCfg *config.DeviceConfig) {
@@ -33,22 +110,98 @@ func (r *sshRepositoryImpl) Disconnect(client *ssh.Client, jumpCfg *config.Devic
         r.logger.Info("Closing SSH connection to target device")
         client.Close()
     }
-    if jumpCfg != nil {
+    if jumpCfg != nil && client != nil {
+        r.mu.Lock()
+        jumpClient := r.jumpLeases[client]
+        delete(r.jumpLeases, client)
+        r.mu.Unlock()
         r.logger.Info("Releasing jump server client", "jumpserver", jumpCfg.IP)
-        ReleaseJumpClient(jumpCfg)
+        r.jumps.ReleaseClient(jumpCfg, jumpClient)
     }
 }
 
 func (r *sshRepositoryImpl) InteractiveExecute(client *ssh.Client, command string, opts ...ExecuteOption) (string, error) {
     options := NewExecuteOptions(opts...)
+    if options.Enable || options.Sudo {
+        sh, logout, err := openPromptShell(client, options.Timeout)
+        if err != nil {
+            return "", err
+        }
+        defer logout()
+        return sh.execute(r.logger, command, opts)
+    }
     return ExecutorInteractiveExecute(client, r.logger, command, options.FirstByteTimeout, options.Timeout)
 }
 
 func (r *sshRepositoryImpl) InteractiveExecuteMultiple(client *ssh.Client, commands []string, opts ...ExecuteOption) ([]string, error) {
     options := NewExecuteOptions(opts...)
+    if options.Enable || options.Sudo {
+        sh, logout, err := openPromptShell(client, options.Timeout)
+        if err != nil {
+            return nil, err
+        }
+        defer logout()
+        return sh.executeMultiple(r.logger, commands, opts)
+    }
     return ExecutorInteractiveExecuteMultiple(client, r.logger, commands, options.FirstByteTimeout, options.Timeout)
 }
 
 func (r *sshRepositoryImpl) ScpDownload(client *ssh.Client, remoteFilePath, localFilePath string) error {
     return ExecutorScpDownload(client, r.logger, remoteFilePath, localFilePath)
 }
+
+// Ping sends an OpenSSH keepalive to check that client is still usable.
+func (r *sshRepositoryImpl) Ping(client *ssh.Client) error {
+    return probeClient(client, defaultJumpHealthCheckTimeout)
+}
+
+// Privileged opens a shell, applies WithEnable or WithSudo from opts, and
+// reports whether the shell ends up privileged. Every command opens a new
+// shell over SSH, so pass the same options to each Execute as well.
+func (r *sshRepositoryImpl) Privileged(client *ssh.Client, opts ...ExecuteOption) (bool, error) {
+    options := NewExecuteOptions(opts...)
+    sh, logout, err := openPromptShell(client, options.Timeout)
+    if err != nil {
+        return false, err
+    }
+    defer logout()
+    return sh.privilege(r.logger, options)
+}
+
+// SendConfig sends lines in configuration mode over one shell and returns
+// what the device answered to each line.
+func (r *sshRepositoryImpl) SendConfig(client *ssh.Client, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error) {
+    options := NewExecuteOptions(opts...)
+    sh, logout, err := openPromptShell(client, options.Timeout)
+    if err != nil {
+        return nil, err
+    }
+    defer logout()
+    return sh.configure(r.logger, lines, mode, options)
+}
+
+// OpenConfigSession opens a shell and enters configuration mode in it. The
+// shell closes with the session.
+func (r *sshRepositoryImpl) OpenConfigSession(client *ssh.Client, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error) {
+    options := NewExecuteOptions(opts...)
+    sh, logout, err := openPromptShell(client, options.Timeout)
+    if err != nil {
+        return nil, err
+    }
+    return sh.openConfigSession(r.logger, mode, options, logout)
+}
+
+func (r *sshRepositoryImpl) LocalForward(client *ssh.Client, localAddr, remoteAddr string) (*Forward, error) {
+    r.logger.Info("Starting local port forward", "local", localAddr, "remote", remoteAddr)
+    return LocalForward(client, localAddr, remoteAddr)
+}
+
+func (r *sshRepositoryImpl) RemoteForward(client *ssh.Client, remoteAddr, localAddr string) (*Forward, error) {
+    r.logger.Info("Starting remote port forward", "remote", remoteAddr, "local", localAddr)
+    return RemoteForward(client, remoteAddr, localAddr)
+}
+
+func (r *sshRepositoryImpl) DynamicForward(client *ssh.Client, localAddr string) (*Forward, error) {
+    r.logger.Info("Starting dynamic SOCKS forward", "local", localAddr)
+    return DynamicForward(client, localAddr)
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// Telnet commands and options from RFC 854, 857, 858, 1073 and 1091.
+const (
+	telnetSE    = 240
+	telnetBreak = 243
+	telnetSB    = 250
+	telnetWill  = 251
+	telnetWont  = 252
+	telnetDo    = 253
+	telnetDont  = 254
+	telnetIAC   = 255
+
+	telnetOptEcho  = 1
+	telnetOptSGA   = 3
+	telnetOptTType = 24
+	telnetOptNAWS  = 31
+
+	telnetTTypeIs   = 0
+	telnetTTypeSend = 1
+
+	telnetTerminalType   = "VT100"
+	telnetTerminalWidth  = 80
+	telnetTerminalHeight = 40
+)
+
+// TelnetConn is an open Telnet session to a device. Option negotiation is
+// answered as data arrives; the shell sees only the device output.
+type TelnetConn struct {
+	*shellConn
+
+	conn   net.Conn
+	reader *bufio.Reader
+	lastCR bool
+
+	// local and remote record the options enabled on each side, so repeated
+	// requests are not answered again and negotiation cannot loop.
+	local  map[byte]bool
+	remote map[byte]bool
+
+	wmu sync.Mutex
+
+	jumpClient *ssh.Client
+	jumpCfg    *config.DeviceConfig
+}
+
+func newTelnetConn(conn net.Conn) *TelnetConn {
+	t := &TelnetConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		local:  make(map[byte]bool),
+		remote: make(map[byte]bool),
+	}
+	t.shellConn = newShellConn(t.read, t.writeData, conn.Close, "\r\n")
+	return t
+}
+
+// RemoteAddr is the address of the device, or of the jump server channel
+// when the session was opened through one.
+func (t *TelnetConn) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+// read fills p with device output, answering option negotiation and
+// dropping the Telnet framing on the way.
+func (t *TelnetConn) read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && t.reader.Buffered() == 0 {
+			break
+		}
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b == telnetIAC {
+			literal, err := t.command()
+			if err != nil {
+				return n, err
+			}
+			if !literal {
+				continue
+			}
+		} else if b == 0 && t.lastCR {
+			// CR NUL is a bare carriage return.
+			t.lastCR = false
+			continue
+		}
+		t.lastCR = b == '\r'
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// command handles the sequence after an IAC. It reports whether the IAC was
+// an escaped 0xff data byte.
+func (t *TelnetConn) command() (bool, error) {
+	cmd, err := t.reader.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch cmd {
+	case telnetIAC:
+		return true, nil
+	case telnetDo, telnetDont, telnetWill, telnetWont:
+		opt, err := t.reader.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		return false, t.negotiate(cmd, opt)
+	case telnetSB:
+		return false, t.subnegotiation()
+	default:
+		// NOP, GA and the other single byte commands carry no state.
+		return false, nil
+	}
+}
+
+// negotiate accepts server echo and suppress-go-ahead, offers a terminal
+// type and window size, and refuses everything else.
+func (t *TelnetConn) negotiate(cmd, opt byte) error {
+	switch cmd {
+	case telnetWill:
+		accept := opt == telnetOptEcho || opt == telnetOptSGA
+		if accept && t.remote[opt] {
+			return nil
+		}
+		t.remote[opt] = accept
+		if accept {
+			return t.send(telnetIAC, telnetDo, opt)
+		}
+		return t.send(telnetIAC, telnetDont, opt)
+	case telnetWont:
+		if !t.remote[opt] {
+			return nil
+		}
+		t.remote[opt] = false
+		return t.send(telnetIAC, telnetDont, opt)
+	case telnetDo:
+		accept := opt == telnetOptSGA || opt == telnetOptTType || opt == telnetOptNAWS
+		if accept && t.local[opt] {
+			return nil
+		}
+		t.local[opt] = accept
+		if !accept {
+			return t.send(telnetIAC, telnetWont, opt)
+		}
+		if err := t.send(telnetIAC, telnetWill, opt); err != nil {
+			return err
+		}
+		if opt == telnetOptNAWS {
+			return t.send(telnetIAC, telnetSB, telnetOptNAWS,
+				0, telnetTerminalWidth, 0, telnetTerminalHeight,
+				telnetIAC, telnetSE)
+		}
+		return nil
+	default:
+		if !t.local[opt] {
+			return nil
+		}
+		t.local[opt] = false
+		return t.send(telnetIAC, telnetWont, opt)
+	}
+}
+
+// subnegotiation reads up to IAC SE and answers a terminal type request.
+func (t *TelnetConn) subnegotiation() error {
+	var payload []byte
+	for {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == telnetIAC {
+			next, err := t.reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			if next == telnetSE {
+				break
+			}
+			b = next
+		}
+		payload = append(payload, b)
+	}
+	if len(payload) == 2 && payload[0] == telnetOptTType && payload[1] == telnetTTypeSend {
+		reply := []byte{telnetIAC, telnetSB, telnetOptTType, telnetTTypeIs}
+		reply = append(reply, telnetTerminalType...)
+		return t.send(append(reply, telnetIAC, telnetSE)...)
+	}
+	return nil
+}
+
+func (t *TelnetConn) send(b ...byte) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	_, err := t.conn.Write(b)
+	return err
+}
+
+// writeData sends data bytes, escaping any 0xff bytes as IAC IAC.
+func (t *TelnetConn) writeData(data []byte) error {
+	buf := make([]byte, 0, len(data)+2)
+	for _, b := range data {
+		if b == telnetIAC {
+			buf = append(buf, telnetIAC)
+		}
+		buf = append(buf, b)
+	}
+	return t.send(buf...)
+}
+
+// sendBreak sends the Telnet BREAK command, which console servers pass to
+// the serial line as a break signal.
+func (t *TelnetConn) sendBreak() error {
+	return t.send(telnetIAC, telnetBreak)
+}
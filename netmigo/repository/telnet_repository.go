@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultTelnetPort         = "23"
+	defaultTelnetLoginTimeout = 30 * time.Second
+)
+
+var (
+	telnetUsernamePrompt = regexp.MustCompile(`(?i)(user ?name|login)\s*:\s*$`)
+	telnetPasswordPrompt = regexp.MustCompile(`(?i)pass(word|code)\s*:\s*$`)
+	telnetLoginFailed    = regexp.MustCompile(`(?i)(login incorrect|login invalid|authentication failed|access denied|bad password)`)
+	// defaultTelnetPrompt wants a name-like character before the prompt
+	// character so a banner line of #### is not taken for a prompt.
+	defaultTelnetPrompt = regexp.MustCompile(`[\w.\-@:/~\])]\s?[>#$%]\s*$`)
+)
+
+// TelnetRepository runs commands over Telnet for devices that do not speak
+// SSH. Commands have the same semantics as SSHRepository: output is written
+// to a file under ssh_command_outputs and the path returned. Collection ends
+// when the device prompt comes back, or on the first-byte and inactivity
+// timeouts like SSH.
+type TelnetRepository interface {
+	Connect(cfg config.DeviceConfig) (*TelnetConn, error)
+	ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*TelnetConn, error)
+	Disconnect(conn *TelnetConn)
+	InteractiveExecute(conn *TelnetConn, command string, opts ...ExecuteOption) (string, error)
+	InteractiveExecuteMultiple(conn *TelnetConn, commands []string, opts ...ExecuteOption) ([]string, error)
+	Ping(conn *TelnetConn) error
+	Privileged(conn *TelnetConn, opts ...ExecuteOption) (bool, error)
+	SendConfig(conn *TelnetConn, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error)
+	OpenConfigSession(conn *TelnetConn, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error)
+}
+
+type telnetRepositoryImpl struct {
+	logger *slog.Logger
+	jumps  *JumpClientManager
+}
+
+// NewTelnetRepository accepts the same options as NewSSHRepository; a jump
+// server on the device config is used to open the Telnet connection.
+func NewTelnetRepository(logger *slog.Logger, opts ...RepositoryOption) TelnetRepository {
+	base := &sshRepositoryImpl{jumps: DefaultJumpClientManager}
+	for _, opt := range opts {
+		opt(base)
+	}
+	return &telnetRepositoryImpl{logger: logger, jumps: base.jumps}
+}
+
+func (r *telnetRepositoryImpl) Connect(cfg config.DeviceConfig) (*TelnetConn, error) {
+	return r.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext opens the Telnet connection and logs in. ctx bounds the
+// time spent queueing for a shared jump server.
+func (r *telnetRepositoryImpl) ConnectContext(ctx context.Context, cfg config.DeviceConfig) (*TelnetConn, error) {
+	if cfg.TelnetPort == "" {
+		cfg.TelnetPort = defaultTelnetPort
+	}
+	if cfg.JumpServer == nil {
+		return withCredentialFallback(ctx, cfg, r.connectDirectly)
+	}
+
+	jumpClient, err := getJumpClientFunc(r.jumps, ctx, cfg.JumpServer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jump server client: %w", err)
+	}
+	conn, err := withCredentialFallback(ctx, cfg, func(candidate config.DeviceConfig) (*TelnetConn, error) {
+		return r.connectThroughJump(jumpClient, candidate)
+	})
+	if err != nil {
+		releaseJumpClientFunc(r.jumps, cfg.JumpServer, jumpClient)
+		return nil, err
+	}
+	conn.jumpClient = jumpClient
+	conn.jumpCfg = cfg.JumpServer
+	return conn, nil
+}
+
+func (r *telnetRepositoryImpl) connectDirectly(cfg config.DeviceConfig) (*TelnetConn, error) {
+	conn, err := dialTelnet(r.logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return r.login(conn, cfg)
+}
+
+// dialTelnet opens the TCP connection to the Telnet port, retrying up to
+// MaxRetry times like the SSH connector.
+func dialTelnet(logger *slog.Logger, cfg config.DeviceConfig) (net.Conn, error) {
+	dialer, err := transportDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	target := cfg
+	target.Port = cfg.TelnetPort
+	network := targetNetwork(cfg)
+	maxRetries := cfg.MaxRetry
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+
+	var dialErr error
+	attempts := 0
+	for attempts < maxRetries {
+		attempts++
+		conn, err := dialTelnetAddresses(target, dialer, network)
+		if err == nil {
+			logger.Info("Telnet connection established", "address", conn.RemoteAddr().String())
+			return conn, nil
+		}
+		dialErr = err
+		if attempts == maxRetries {
+			break
+		}
+		sleepFunc(1 * time.Second)
+	}
+	return nil, fmt.Errorf("failed to connect to %s over telnet after %d %s: %w", cfg.TelnetAddress(), attempts, attemptLabel(attempts), dialErr)
+}
+
+func dialTelnetAddresses(cfg config.DeviceConfig, dialer config.Dialer, network string) (net.Conn, error) {
+	addresses, err := resolveDialAddresses(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, address := range addresses {
+		ctx, cancel := dialTimeoutContext(cfg.ConnectionTimeout)
+		conn, err := dialer.DialContext(ctx, network, address)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (r *telnetRepositoryImpl) connectThroughJump(jumpClient *ssh.Client, cfg config.DeviceConfig) (*TelnetConn, error) {
+	conn, err := dialTelnetThroughJump(jumpClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return r.login(conn, cfg)
+}
+
+func dialTelnetThroughJump(jumpClient *ssh.Client, cfg config.DeviceConfig) (net.Conn, error) {
+	address := cfg.TelnetAddress()
+	conn, err := dialConnWithTimeout(func() (net.Conn, error) {
+		return jumpClient.Dial(targetNetwork(cfg), address)
+	}, cfg.ConnectionTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("jump server dial to %s error: %w", address, err)
+	}
+	return conn, nil
+}
+
+// login answers the username and password prompts and waits for the CLI
+// prompt. A device that goes straight to the prompt needs no credentials.
+func (r *telnetRepositoryImpl) login(conn net.Conn, cfg config.DeviceConfig) (*TelnetConn, error) {
+	t := newTelnetConn(conn)
+	t.prompt = cfg.Prompt
+	if t.prompt == nil {
+		t.prompt = defaultTelnetPrompt
+	}
+	timeout := cfg.ConnectionTimeout
+	if timeout <= 0 {
+		timeout = defaultTelnetLoginTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var output []byte
+	sentUsername, sentPassword := false, false
+	for {
+		select {
+		case chunk, ok := <-t.data:
+			if !ok {
+				t.Close()
+				return nil, fmt.Errorf("telnet connection to %s closed during login: %w", cfg.TelnetAddress(), t.err)
+			}
+			output = append(output, chunk...)
+		case <-deadline.C:
+			t.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for telnet login on %s (last output %q)", timeout, cfg.TelnetAddress(), lastLine(output))
+		}
+
+		if telnetLoginFailed.Match(output) {
+			t.Close()
+			return nil, fmt.Errorf("telnet authentication failed for %q on %s", cfg.Username, cfg.TelnetAddress())
+		}
+		last := lastLine(output)
+		switch {
+		case telnetUsernamePrompt.MatchString(last):
+			if sentUsername {
+				t.Close()
+				return nil, fmt.Errorf("telnet authentication failed for %q on %s: asked to log in again", cfg.Username, cfg.TelnetAddress())
+			}
+			if cfg.Username == "" {
+				t.Close()
+				return nil, fmt.Errorf("%s asked for a telnet username but none is configured", cfg.TelnetAddress())
+			}
+			r.logger.Debug("Answering telnet username prompt", "prompt", last)
+			if err := t.writeLine(cfg.Username); err != nil {
+				t.Close()
+				return nil, fmt.Errorf("failed to send telnet username: %w", err)
+			}
+			sentUsername = true
+			output = output[:0]
+		case telnetPasswordPrompt.MatchString(last):
+			if sentPassword {
+				t.Close()
+				return nil, fmt.Errorf("telnet authentication failed for %q on %s: password rejected", cfg.Username, cfg.TelnetAddress())
+			}
+			r.logger.Debug("Answering telnet password prompt", "prompt", last)
+			if err := t.writeLine(cfg.Password); err != nil {
+				t.Close()
+				return nil, fmt.Errorf("failed to send telnet password: %w", err)
+			}
+			sentPassword = true
+			output = output[:0]
+		case t.prompt.MatchString(last):
+			r.logger.Info("Telnet login complete", "prompt", last)
+			return t, nil
+		}
+	}
+}
+
+func (r *telnetRepositoryImpl) Disconnect(conn *TelnetConn) {
+	if conn == nil {
+		return
+	}
+	r.logger.Info("Closing Telnet connection to target device")
+	if err := conn.writeLine("exit"); err != nil {
+		r.logger.Debug("Failed to send exit over telnet", "error", err)
+	}
+	conn.Close()
+	if conn.jumpCfg != nil {
+		r.logger.Info("Releasing jump server client", "jumpserver", conn.jumpCfg.IP)
+		releaseJumpClientFunc(r.jumps, conn.jumpCfg, conn.jumpClient)
+	}
+}
+
+func (r *telnetRepositoryImpl) InteractiveExecute(conn *TelnetConn, command string, opts ...ExecuteOption) (string, error) {
+	if conn == nil {
+		return "", errors.New("telnet connection is nil; not connected")
+	}
+	return conn.execute(r.logger, command, opts)
+}
+
+func (r *telnetRepositoryImpl) InteractiveExecuteMultiple(conn *TelnetConn, commands []string, opts ...ExecuteOption) ([]string, error) {
+	if conn == nil {
+		return nil, errors.New("telnet connection is nil; not connected")
+	}
+	return conn.executeMultiple(r.logger, commands, opts)
+}
+
+// Ping sends an empty line and waits for the prompt to come back.
+func (r *telnetRepositoryImpl) Ping(conn *TelnetConn) error {
+	if conn == nil {
+		return errors.New("telnet connection is nil; not connected")
+	}
+	if err := conn.ping(defaultJumpHealthCheckTimeout); err != nil {
+		return fmt.Errorf("telnet ping: %w", err)
+	}
+	return nil
+}
+
+// Privileged applies WithEnable or WithSudo from opts and reports whether
+// the session is privileged. Enable lasts for the rest of the connection.
+func (r *telnetRepositoryImpl) Privileged(conn *TelnetConn, opts ...ExecuteOption) (bool, error) {
+	if conn == nil {
+		return false, errors.New("telnet connection is nil; not connected")
+	}
+	return conn.privilege(r.logger, NewExecuteOptions(opts...))
+}
+
+// SendConfig sends lines in configuration mode and returns what the device
+// answered to each line.
+func (r *telnetRepositoryImpl) SendConfig(conn *TelnetConn, lines []string, mode ConfigMode, opts ...ExecuteOption) (*ConfigResult, error) {
+	if conn == nil {
+		return nil, errors.New("telnet connection is nil; not connected")
+	}
+	return conn.configure(r.logger, lines, mode, NewExecuteOptions(opts...))
+}
+
+// OpenConfigSession enters configuration mode on the connection. Other
+// commands on conn wait until the session is closed.
+func (r *telnetRepositoryImpl) OpenConfigSession(conn *TelnetConn, mode ConfigMode, opts ...ExecuteOption) (*ConfigSession, error) {
+	if conn == nil {
+		return nil, errors.New("telnet connection is nil; not connected")
+	}
+	return conn.openConfigSession(r.logger, mode, NewExecuteOptions(opts...), nil)
+}
+
+func writeCommandOutput(logger *slog.Logger, fileName string, output []byte) (string, error) {
+	if err := os.MkdirAll(outputDirName, 0755); err != nil {
+		logger.Error("Failed to create output directory", "directory", outputDirName, "error", err)
+		return "", fmt.Errorf("failed to create output directory %s: %w", outputDirName, err)
+	}
+	outputFilePath := filepath.Join(outputDirName, fileName)
+	if err := os.WriteFile(outputFilePath, output, 0644); err != nil {
+		logger.Error("Failed to write output file", "path", outputFilePath, "error", err)
+		return "", fmt.Errorf("failed to write output file %s: %w", outputFilePath, err)
+	}
+	logger.Info("Command execution complete", "outputFile", outputFilePath)
+	return outputFilePath, nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonelmawirat/netmigo/internal/sshtest"
+	"github.com/jonelmawirat/netmigo/internal/telnettest"
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+func newTelnetDevice(t *testing.T, opts telnettest.Options) (*telnettest.Server, *config.DeviceConfig) {
+	t.Helper()
+	server := telnettest.Start(t, opts)
+	cfg := config.NewDeviceConfig(server.Host(),
+		config.WithTransport(config.TransportTelnet),
+		config.WithTelnetPort(server.Port()),
+		config.WithUsername(opts.Username),
+		config.WithPassword(opts.Password),
+		config.WithMaxRetry(1),
+		config.WithConnectionTimeout(5*time.Second),
+	)
+	return server, cfg
+}
+
+// chdirTemp runs the test in a temporary directory so command output files
+// do not land in the package directory.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func versionHandler(command string) string {
+	switch command {
+	case "show version":
+		return "Cisco IOS Software, C2960 Software, Version 12.2(55)SE"
+	case "show clock":
+		return "*10:00:00.000 UTC Mon Mar 1 2021"
+	default:
+		return "% Invalid input detected at '^' marker."
+	}
+}
+
+func TestTelnetExecuteLogsInAndStopsAtPrompt(t *testing.T) {
+	chdirTemp(t)
+	server, cfg := newTelnetDevice(t, telnettest.Options{
+		Username: "admin",
+		Password: "cisco",
+		Banner:   "##########\nAuthorized access only\n##########",
+		Handler:  versionHandler,
+	})
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	if got := server.TerminalType(); got != telnetTerminalType {
+		t.Fatalf("terminal type = %q, want %q", got, telnetTerminalType)
+	}
+	if width, height := server.WindowSize(); width != telnetTerminalWidth || height != telnetTerminalHeight {
+		t.Fatalf("window size = %dx%d, want %dx%d", width, height, telnetTerminalWidth, telnetTerminalHeight)
+	}
+
+	// A long inactivity timeout shows collection ends on the prompt.
+	start := time.Now()
+	path, err := repo.InteractiveExecute(conn, "show version", WithTimeout(30*time.Second), WithFirstByteTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("InteractiveExecute took %s; prompt was not detected", elapsed)
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "Version 12.2(55)SE") {
+		t.Fatalf("output = %q, want show version output", output)
+	}
+
+	if err := repo.Ping(conn); err != nil {
+		t.Fatalf("Ping returned error: %v", err)
+	}
+}
+
+func TestTelnetExecuteMultipleKeepsOutputsSeparate(t *testing.T) {
+	chdirTemp(t)
+	_, cfg := newTelnetDevice(t, telnettest.Options{Username: "admin", Password: "cisco", Handler: versionHandler})
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+
+	paths, err := repo.InteractiveExecuteMultiple(conn, []string{"show version", "show clock"}, WithTimeout(30*time.Second))
+	if err != nil {
+		t.Fatalf("InteractiveExecuteMultiple returned error: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d output files, want 2", len(paths))
+	}
+	first, _ := os.ReadFile(paths[0])
+	second, _ := os.ReadFile(paths[1])
+	if !strings.Contains(string(first), "Version") || strings.Contains(string(first), "UTC") {
+		t.Fatalf("first output = %q", first)
+	}
+	if !strings.Contains(string(second), "UTC") || strings.Contains(string(second), "Version") {
+		t.Fatalf("second output = %q", second)
+	}
+}
+
+func TestTelnetConnectWithoutLogin(t *testing.T) {
+	chdirTemp(t)
+	_, cfg := newTelnetDevice(t, telnettest.Options{Prompt: "switch>", Handler: versionHandler})
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer repo.Disconnect(conn)
+	if _, err := repo.InteractiveExecute(conn, "show clock", WithTimeout(30*time.Second)); err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+}
+
+func TestTelnetRejectedLoginIsAuthFailure(t *testing.T) {
+	_, cfg := newTelnetDevice(t, telnettest.Options{Username: "admin", Password: "cisco"})
+	cfg.Password = "wrong"
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err := repo.Connect(*cfg)
+	if err == nil {
+		t.Fatal("expected login with the wrong password to fail")
+	}
+	if !IsAuthFailure(err) {
+		t.Fatalf("IsAuthFailure(%v) = false, want true", err)
+	}
+}
+
+func TestTelnetThroughJumpServer(t *testing.T) {
+	chdirTemp(t)
+	device, cfg := newTelnetDevice(t, telnettest.Options{Username: "admin", Password: "cisco", Handler: versionHandler})
+	jump := sshtest.NewServer(t, "jumpuser", "jumppass", nil)
+	cfg.JumpServer = config.NewDeviceConfig(jump.Host(),
+		config.WithPort(jump.Port()),
+		config.WithUsername("jumpuser"),
+		config.WithPassword("jumppass"),
+		config.WithMaxRetry(1),
+	)
+
+	manager := NewJumpClientManager()
+	defer manager.Close()
+	repo := NewTelnetRepository(slog.New(slog.NewTextHandler(io.Discard, nil)), WithJumpClientManager(manager))
+
+	conn, err := repo.Connect(*cfg)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	if _, err := repo.InteractiveExecute(conn, "show version", WithTimeout(30*time.Second)); err != nil {
+		t.Fatalf("InteractiveExecute returned error: %v", err)
+	}
+	repo.Disconnect(conn)
+
+	if device.Connections() != 1 || jump.Connections() != 1 {
+		t.Fatalf("connections: device %d, jump %d; want 1 each", device.Connections(), jump.Connections())
+	}
+}
+
+func TestTelnetConnRefusesUnknownOptionsAndUnescapesData(t *testing.T) {
+	client, server := net.Pipe()
+	conn := newTelnetConn(client)
+	defer conn.Close()
+
+	replies := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 6)
+		io.ReadFull(server, buf)
+		replies <- buf
+	}()
+	go server.Write([]byte{telnetIAC, telnetDo, 39, telnetIAC, telnetWill, 5, 'a', telnetIAC, telnetIAC, 'b'})
+
+	select {
+	case got := <-replies:
+		want := []byte{telnetIAC, telnetWont, 39, telnetIAC, telnetDont, 5}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("negotiation replies = %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no negotiation reply")
+	}
+
+	var data []byte
+	for len(data) < 3 {
+		select {
+		case chunk := <-conn.data:
+			data = append(data, chunk...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("data = %v, want a 0xff b", data)
+		}
+	}
+	if !bytes.Equal(data, []byte{'a', telnetIAC, 'b'}) {
+		t.Fatalf("data = %v, want a 0xff b", data)
+	}
+}
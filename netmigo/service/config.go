@@ -0,0 +1,32 @@
+package service
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// readConfigFile returns the configuration lines in path, skipping blank
+// lines and the "!" separators of saved Cisco configurations.
+func readConfigFile(path string) ([]string, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open config file %s: %w", path, err)
+    }
+    defer f.Close()
+
+    var lines []string
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), " \t\r")
+        if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed == "!" {
+            continue
+        }
+        lines = append(lines, line)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+    }
+    return lines, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/sshtest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+func TestIosxrSendConfigFileSkipsSeparators(t *testing.T) {
+    chdirTemp(t)
+    var mu sync.Mutex
+    var received []string
+    cfg := newCLIConfig(t, sshtest.CLI{
+        Prompt:    "RP/0/RSP0/CPU0:router#",
+        Candidate: true,
+        Configure: func(line string) string {
+            mu.Lock()
+            defer mu.Unlock()
+            received = append(received, line)
+            return ""
+        },
+    })
+    path := filepath.Join(t.TempDir(), "uplink.cfg")
+    os.WriteFile(path, []byte("!\ninterface Gi0/0/0/1\n description uplink\n!\n\nrouter static\n!\n"), 0644)
+
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxrDeviceService(repository.NewSSHRepository(logger), logger)
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    result, err := device.SendConfigFile(path, repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("SendConfigFile returned error: %v", err)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    want := []string{"interface Gi0/0/0/1", "description uplink", "router static"}
+    if !reflect.DeepEqual(received, want) {
+        t.Fatalf("device received %q, want %q", received, want)
+    }
+    if len(result.Lines) != 3 || !result.Committed {
+        t.Fatalf("result = %+v, want three lines committed", result)
+    }
+}
+
+func TestIosxeSendConfigSetAfterEnable(t *testing.T) {
+    chdirTemp(t)
+    var received []string
+    cfg := newCLIConfig(t, sshtest.CLI{
+        UserPrompt: "router>",
+        Prompt:     "router#",
+        Secret:     "s3cret",
+        Configure: func(line string) string {
+            received = append(received, line)
+            return ""
+        },
+    }, config.WithSecret("s3cret"))
+
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxeDeviceService(repository.NewSSHRepository(logger), logger)
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    if err := device.Enable(); err != nil {
+        t.Fatalf("Enable returned error: %v", err)
+    }
+    result, err := device.SendConfigSet([]string{"interface Gi1", " description uplink"}, repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("SendConfigSet returned error: %v", err)
+    }
+    want := []string{"interface Gi1", "description uplink"}
+    if !reflect.DeepEqual(received, want) {
+        t.Fatalf("device received %q, want %q", received, want)
+    }
+    if len(result.Lines) != 2 || result.Commit != nil {
+        t.Fatalf("result = %+v, want two lines and no commit", result)
+    }
+}
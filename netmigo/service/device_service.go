@@ -1,6 +1,8 @@
 package service
 
 import (
+    "context"
+
     "github.com/jonelmawirat/netmigo/netmigo/config"
     "github.com/jonelmawirat/netmigo/netmigo/repository"
 )
@@ -12,3 +14,45 @@ type DeviceService interface {
     Download(remoteFilePath, localFilePath string) error
     Disconnect()
 }
+
+// The interfaces below are optional capabilities of a DeviceService. The
+// devices netmigo builds have all of them; check for one with a type
+// assertion, so a custom DeviceService only implements the ones it
+// supports.
+
+// ContextConnector connects with a context that bounds queueing for a
+// shared jump server.
+type ContextConnector interface {
+    ConnectContext(ctx context.Context, cfg *config.DeviceConfig) error
+}
+
+// Pinger checks that the connection is still usable.
+type Pinger interface {
+    Ping() error
+}
+
+// Enabler enters privileged mode, enable on Cisco and sudo on Linux.
+type Enabler interface {
+    Enable() error
+    IsPrivileged() (bool, error)
+}
+
+// Configurer sends configuration lines in the platform's configuration
+// mode.
+type Configurer interface {
+    SendConfigSet(lines []string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error)
+    SendConfigFile(path string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error)
+}
+
+// Forwarder forwards ports over the connection, like ssh -L, -R and -D.
+type Forwarder interface {
+    LocalForward(localAddr, remoteAddr string) (*repository.Forward, error)
+    RemoteForward(remoteAddr, localAddr string) (*repository.Forward, error)
+    DynamicForward(localAddr string) (*repository.Forward, error)
+}
+
+// StructuredExecutor runs a command through the platform's structured
+// output pipe and decodes the result.
+type StructuredExecutor interface {
+    ExecuteStructured(command string, v any, opts ...repository.ExecuteOption) (string, error)
+}
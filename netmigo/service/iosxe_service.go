@@ -0,0 +1,301 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+
+    "golang.org/x/crypto/ssh"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+// IosxeDeviceService drives Cisco IOS and IOS-XE devices, which may log in
+// to user EXEC and need Enable before most show commands.
+type IosxeDeviceService struct {
+    repo   repository.SSHRepository
+    logger *slog.Logger
+    client *ssh.Client
+    devCfg config.DeviceConfig
+
+    telnet     repository.TelnetRepository
+    telnetConn *repository.TelnetConn
+
+    console     repository.ConsoleRepository
+    consoleConn *repository.ConsoleConn
+
+    // enabled is set once Enable succeeds, so each new SSH shell re-enters
+    // enable.
+    enabled bool
+}
+
+func NewIosxeDeviceService(repo repository.SSHRepository, logger *slog.Logger, opts ...Option) *IosxeDeviceService {
+    options := newServiceOptions(logger, opts)
+    return &IosxeDeviceService{repo: repo, logger: logger, telnet: options.telnet, console: options.console}
+}
+
+func (s *IosxeDeviceService) Connect(cfg *config.DeviceConfig) error {
+    return s.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext is Connect with a context that bounds queueing for a shared
+// jump server.
+func (s *IosxeDeviceService) ConnectContext(ctx context.Context, cfg *config.DeviceConfig) error {
+    s.logger.Info("Connecting to IOS-XE device service", "host", cfg.IP)
+    s.devCfg = *cfg
+    if cfg.Console != nil {
+        consoleConn, err := s.console.ConnectContext(ctx, *cfg)
+        if err != nil {
+            return err
+        }
+        s.consoleConn = consoleConn
+        return nil
+    }
+    client, telnetConn, err := connectTransport(ctx, s.logger, s.repo, s.telnet, cfg)
+    if err != nil {
+        // On failure, just return the error. Do NOT release the jump client
+        // as other goroutines might still be using it successfully.
+        return err
+    }
+    s.client = client
+    s.telnetConn = telnetConn
+    return nil
+}
+
+// Transport reports whether the service is connected over SSH or Telnet,
+// which matters after an SSH-then-Telnet fallback.
+func (s *IosxeDeviceService) Transport() config.Transport {
+    if s.consoleConn != nil {
+        return s.consoleConn.Transport()
+    }
+    if s.telnetConn != nil {
+        return config.TransportTelnet
+    }
+    return config.TransportSSH
+}
+
+func (s *IosxeDeviceService) Disconnect() {
+    s.logger.Info("Disconnecting IOS-XE device service")
+    s.enabled = false
+    if s.consoleConn != nil {
+        s.console.Disconnect(s.consoleConn)
+        s.consoleConn = nil
+        return
+    }
+    if s.telnetConn != nil {
+        s.telnet.Disconnect(s.telnetConn)
+        s.telnetConn = nil
+        return
+    }
+    s.repo.Disconnect(s.client, s.devCfg.JumpServer)
+    s.client = nil
+}
+
+func (s *IosxeDeviceService) Execute(command string, opts ...repository.ExecuteOption) (string, error) {
+    s.logger.Info("Executing command on IOS-XE service", "command", command)
+    path, err := s.execute(command, opts...)
+    if err != nil {
+        return path, err
+    }
+    return path, parseOutput(config.CISCO_IOSXE, command, path, opts)
+}
+
+func (s *IosxeDeviceService) execute(command string, opts ...repository.ExecuteOption) (string, error) {
+    opts = withPrivilege(s.devCfg, opts, s.enabled && s.client != nil, false)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecute(s.consoleConn, command, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecute(s.telnetConn, command, opts...)
+    }
+    if s.client == nil {
+        return "", errors.New("not connected (IosxeDeviceService)")
+    }
+    return s.repo.InteractiveExecute(s.client, command, opts...)
+}
+
+func (s *IosxeDeviceService) Download(remoteFilePath, localFilePath string) error {
+    s.logger.Info("Downloading file from IOS-XE service",
+        "remotePath", remoteFilePath,
+        "localPath", localFilePath,
+    )
+    if s.consoleConn != nil {
+        return fmt.Errorf("download: %w (IosxeDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return fmt.Errorf("download: %w (IosxeDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return errors.New("not connected (IosxeDeviceService)")
+    }
+    return s.repo.ScpDownload(s.client, remoteFilePath, localFilePath)
+}
+
+func (s *IosxeDeviceService) ExecuteMultiple(commands []string, opts ...repository.ExecuteOption) ([]string, error) {
+    s.logger.Info("Executing multiple commands on IOS-XE service", "commandsCount", len(commands))
+    opts = withPrivilege(s.devCfg, opts, s.enabled && s.client != nil, false)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecuteMultiple(s.consoleConn, commands, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecuteMultiple(s.telnetConn, commands, opts...)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxeDeviceService ExecuteMultiple)")
+    }
+    return s.repo.InteractiveExecuteMultiple(s.client, commands, opts...)
+}
+
+// Ping checks that the connection is still usable.
+func (s *IosxeDeviceService) Ping() error {
+    if s.consoleConn != nil {
+        return s.console.Ping(s.consoleConn)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.Ping(s.telnetConn)
+    }
+    if s.client == nil {
+        return errors.New("not connected (IosxeDeviceService)")
+    }
+    pinger, err := sshCapability[repository.Pinger](s.repo, "ping")
+    if err != nil {
+        return err
+    }
+    return pinger.Ping(s.client)
+}
+
+// LocalForward forwards localAddr on this host to remoteAddr as seen from
+// the device, like ssh -L.
+func (s *IosxeDeviceService) LocalForward(localAddr, remoteAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxeDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.LocalForward(s.client, localAddr, remoteAddr)
+}
+
+// RemoteForward forwards remoteAddr on the device to localAddr on this
+// host, like ssh -R.
+func (s *IosxeDeviceService) RemoteForward(remoteAddr, localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxeDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.RemoteForward(s.client, remoteAddr, localAddr)
+}
+
+// DynamicForward runs a SOCKS5 proxy on localAddr that connects from the
+// device, like ssh -D.
+func (s *IosxeDeviceService) DynamicForward(localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxeDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxeDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.DynamicForward(s.client, localAddr)
+}
+
+// SendBreak sends a serial break down the console line, which drops most
+// Cisco devices into ROMMON during boot.
+func (s *IosxeDeviceService) SendBreak() error {
+    if s.consoleConn == nil {
+        return errors.New("not connected through a console server (IosxeDeviceService)")
+    }
+    return s.console.SendBreak(s.consoleConn)
+}
+
+// Enable enters privileged EXEC mode, answering the Password: prompt with
+// the config's Secret. Over SSH each command gets a new shell, so later
+// commands enter enable again before they run.
+func (s *IosxeDeviceService) Enable() error {
+    if _, err := s.privileged(repository.WithEnable(s.devCfg.Secret)); err != nil {
+        return err
+    }
+    s.enabled = true
+    return nil
+}
+
+// IsPrivileged reports whether commands run at a # prompt.
+func (s *IosxeDeviceService) IsPrivileged() (bool, error) {
+    if s.enabled && s.client != nil {
+        return s.privileged(repository.WithEnable(s.devCfg.Secret))
+    }
+    return s.privileged()
+}
+
+func (s *IosxeDeviceService) privileged(opts ...repository.ExecuteOption) (bool, error) {
+    if s.consoleConn != nil {
+        return s.console.Privileged(s.consoleConn, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.Privileged(s.telnetConn, opts...)
+    }
+    if s.client == nil {
+        return false, errors.New("not connected (IosxeDeviceService)")
+    }
+    checker, err := sshCapability[repository.PrivilegeChecker](s.repo, "privilege")
+    if err != nil {
+        return false, err
+    }
+    return checker.Privileged(s.client, opts...)
+}
+
+// SendConfigSet enters configuration mode with "configure terminal", sends
+// lines and leaves with "end". IOS-XE applies each line as it is entered.
+// The result holds the device's answer to each line; a rejected line also
+// makes the error a *repository.ConfigError.
+func (s *IosxeDeviceService) SendConfigSet(lines []string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    s.logger.Info("Sending configuration set", "linesCount", len(lines))
+    opts = withPrivilege(s.devCfg, opts, s.enabled && s.client != nil, false)
+    if s.consoleConn != nil {
+        return s.console.SendConfig(s.consoleConn, lines, repository.CiscoConfigMode, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.SendConfig(s.telnetConn, lines, repository.CiscoConfigMode, opts...)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxeDeviceService)")
+    }
+    configurer, err := sshCapability[repository.Configurer](s.repo, "configuration")
+    if err != nil {
+        return nil, err
+    }
+    return configurer.SendConfig(s.client, lines, repository.CiscoConfigMode, opts...)
+}
+
+// SendConfigFile is SendConfigSet with the lines of the file at path.
+func (s *IosxeDeviceService) SendConfigFile(path string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    lines, err := readConfigFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return s.SendConfigSet(lines, opts...)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+    "strings"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+var (
+    // ErrCommitFailed is returned when IOS-XR rejects a commit. The
+    // CommitResult holds the output of show configuration failed.
+    ErrCommitFailed = errors.New("commit failed")
+    // ErrRollbackFailed is returned when rollback configuration is
+    // rejected.
+    ErrRollbackFailed = errors.New("rollback failed")
+)
+
+// CommitOption configures an IOS-XR commit.
+type CommitOption func(*commitOptions)
+
+type commitOptions struct {
+    label     string
+    comment   string
+    confirmed time.Duration
+}
+
+// WithCommitLabel names the commit in the commit database.
+func WithCommitLabel(label string) CommitOption {
+    return func(o *commitOptions) {
+        o.label = label
+    }
+}
+
+// WithCommitComment stores comment with the commit.
+func WithCommitComment(comment string) CommitOption {
+    return func(o *commitOptions) {
+        o.comment = comment
+    }
+}
+
+// WithCommitConfirmed commits on trial: the device rolls the change back
+// by itself unless Confirm follows within d. IOS-XR accepts 30 seconds to
+// a little over 18 hours.
+func WithCommitConfirmed(d time.Duration) CommitOption {
+    return func(o *commitOptions) {
+        o.confirmed = d
+    }
+}
+
+// command builds the commit line. The comment goes last because IOS-XR
+// reads it to the end of the line.
+func (o commitOptions) command() string {
+    command := "commit"
+    if o.label != "" {
+        command += " label " + o.label
+    }
+    if o.confirmed > 0 {
+        command += fmt.Sprintf(" confirmed %d", int(o.confirmed.Round(time.Second)/time.Second))
+    }
+    if o.comment != "" {
+        command += " comment " + o.comment
+    }
+    return command
+}
+
+// CommitResult is the outcome of a commit.
+type CommitResult struct {
+    Command string
+    Output  string
+    // Pending is set by commit confirmed until Confirm.
+    Pending bool
+    // NoChanges is set when there was nothing to commit.
+    NoChanges bool
+    // Failed holds show configuration failed after a rejected commit.
+    Failed string
+}
+
+// RollbackResult is the outcome of rollback configuration.
+type RollbackResult struct {
+    Command    string
+    Output     string
+    OutputFile string
+}
+
+// IosxrConfigSession is an IOS-XR configuration session. Lines sent go to
+// the target configuration and only take effect on Commit. Close ends the
+// session, discarding anything not committed. Over Telnet and console
+// lines other commands wait until the session is closed.
+type IosxrConfigSession struct {
+    session *repository.ConfigSession
+    logger  *slog.Logger
+}
+
+// ConfigSession enters configuration mode and keeps it for the session's
+// calls.
+func (s *IosxrDeviceService) ConfigSession(opts ...repository.ExecuteOption) (*IosxrConfigSession, error) {
+    s.logger.Info("Opening iOSXR configuration session")
+    session, err := s.openConfigSession(repository.IosxrConfigMode, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &IosxrConfigSession{session: session, logger: s.logger}, nil
+}
+
+// Rollback undoes the last n commits with rollback configuration last n.
+// The rollback is itself recorded as a commit.
+func (s *IosxrDeviceService) Rollback(n int, opts ...repository.ExecuteOption) (*RollbackResult, error) {
+    if n < 1 {
+        return nil, fmt.Errorf("%w: rollback needs at least one commit, got %d", ErrRollbackFailed, n)
+    }
+    command := fmt.Sprintf("rollback configuration last %d", n)
+    s.logger.Info("Rolling back iOSXR configuration", "command", command)
+    session, err := s.openConfigSession(repository.ConfigMode{ErrorPattern: repository.IosxrConfigMode.ErrorPattern}, opts)
+    if err != nil {
+        return nil, err
+    }
+    line, err := session.Command(command)
+    path, closeErr := session.Close()
+    if err != nil {
+        return nil, err
+    }
+    result := &RollbackResult{Command: command, Output: line.Output, OutputFile: path}
+    if line.Error != "" {
+        return result, fmt.Errorf("%w: %s", ErrRollbackFailed, line.Error)
+    }
+    return result, closeErr
+}
+
+func (s *IosxrDeviceService) openConfigSession(mode repository.ConfigMode, opts []repository.ExecuteOption) (*repository.ConfigSession, error) {
+    opts = withPrivilege(s.devCfg, opts, false, false)
+    if s.consoleConn != nil {
+        return s.console.OpenConfigSession(s.consoleConn, mode, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.OpenConfigSession(s.telnetConn, mode, opts...)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxrDeviceService)")
+    }
+    configurer, err := sshCapability[repository.Configurer](s.repo, "configuration")
+    if err != nil {
+        return nil, err
+    }
+    return configurer.OpenConfigSession(s.client, mode, opts...)
+}
+
+// Send adds lines to the target configuration. A line the device rejects
+// as it is typed makes the error a *repository.ConfigError.
+func (c *IosxrConfigSession) Send(lines []string) (*repository.ConfigResult, error) {
+    return c.session.Send(lines)
+}
+
+// Commit applies the target configuration. When IOS-XR rejects it the
+// result holds the output of show configuration failed, the error wraps
+// ErrCommitFailed and the target configuration is kept, so it can be
+// fixed and committed again or dropped with Abort.
+func (c *IosxrConfigSession) Commit(opts ...CommitOption) (*CommitResult, error) {
+    var options commitOptions
+    for _, opt := range opts {
+        opt(&options)
+    }
+    command := options.command()
+    c.logger.Info("Committing iOSXR configuration", "command", command)
+    line, err := c.session.Command(command)
+    if err != nil {
+        return nil, err
+    }
+    result := &CommitResult{
+        Command:   command,
+        Output:    line.Output,
+        NoChanges: strings.Contains(strings.ToLower(line.Output), "no configuration changes to commit"),
+    }
+    if line.Error != "" {
+        failed, err := c.ShowConfigurationFailed()
+        if err != nil {
+            return result, fmt.Errorf("%w: %s; show configuration failed: %w", ErrCommitFailed, line.Error, err)
+        }
+        result.Failed = failed
+        return result, fmt.Errorf("%w: %s", ErrCommitFailed, line.Error)
+    }
+    result.Pending = options.confirmed > 0 && !result.NoChanges
+    return result, nil
+}
+
+// Confirm makes a commit confirmed permanent before its timer runs out.
+func (c *IosxrConfigSession) Confirm() (*CommitResult, error) {
+    return c.Commit()
+}
+
+// ShowConfigurationFailed returns the errors of the session's last
+// rejected commit.
+func (c *IosxrConfigSession) ShowConfigurationFailed() (string, error) {
+    line, err := c.session.Command("show configuration failed")
+    if err != nil {
+        return "", err
+    }
+    return line.Output, nil
+}
+
+// Abort drops the target configuration and ends the session. It returns
+// the path of the session transcript.
+func (c *IosxrConfigSession) Abort() (string, error) {
+    c.logger.Info("Aborting iOSXR configuration session")
+    if _, err := c.session.Leave("abort"); err != nil {
+        c.session.Close()
+        return "", err
+    }
+    return c.session.Close()
+}
+
+// Close leaves configuration mode, discarding anything not committed, and
+// returns the path of the session transcript.
+func (c *IosxrConfigSession) Close() (string, error) {
+    return c.session.Close()
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+    "errors"
+    "io"
+    "log/slog"
+    "os"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/xrtest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+func connectXR(t *testing.T, opts xrtest.Options) (*IosxrDeviceService, *xrtest.Device) {
+    t.Helper()
+    chdirTemp(t)
+    opts.Username, opts.Password = "admin", "cisco"
+    device := xrtest.Start(t, opts)
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    service := NewIosxrDeviceService(repository.NewSSHRepository(logger), logger)
+    err := service.Connect(config.NewDeviceConfig(device.Host(),
+        config.WithPort(device.Port()),
+        config.WithUsername("admin"),
+        config.WithPassword("cisco"),
+        config.WithMaxRetry(1),
+    ))
+    if err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    t.Cleanup(service.Disconnect)
+    return service, device
+}
+
+func readCLIOutput(t *testing.T, path string) string {
+    t.Helper()
+    output, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(output)
+}
+
+func openXRSession(t *testing.T, service *IosxrDeviceService) *IosxrConfigSession {
+    t.Helper()
+    session, err := service.ConfigSession(repository.WithTimeout(5 * time.Second))
+    if err != nil {
+        t.Fatalf("ConfigSession returned error: %v", err)
+    }
+    return session
+}
+
+func TestIosxrCommitWithLabelAndComment(t *testing.T) {
+    service, device := connectXR(t, xrtest.Options{Running: []string{"hostname router"}})
+
+    session := openXRSession(t, service)
+    if _, err := session.Send([]string{"interface Gi0/0/0/1", "description uplink"}); err != nil {
+        t.Fatalf("Send returned error: %v", err)
+    }
+    if got := device.Running(); len(got) != 1 {
+        t.Fatalf("running = %q before commit, want it unchanged", got)
+    }
+    result, err := session.Commit(WithCommitLabel("uplink"), WithCommitComment("CHG-1234 new uplink"))
+    if err != nil {
+        t.Fatalf("Commit returned error: %v", err)
+    }
+    if result.Command != "commit label uplink comment CHG-1234 new uplink" || result.Pending || result.NoChanges {
+        t.Fatalf("result = %+v", result)
+    }
+    if again, err := session.Commit(); err != nil || !again.NoChanges {
+        t.Fatalf("second Commit = %+v, %v, want NoChanges", again, err)
+    }
+    if _, err := session.Close(); err != nil {
+        t.Fatalf("Close returned error: %v", err)
+    }
+
+    want := []string{"hostname router", "interface Gi0/0/0/1", " description uplink"}
+    if got := device.Running(); !reflect.DeepEqual(got, want) {
+        t.Fatalf("running = %q, want %q", got, want)
+    }
+    commits := device.Commits()
+    if len(commits) != 1 || commits[0].Label != "uplink" || commits[0].Comment != "CHG-1234 new uplink" {
+        t.Fatalf("commits = %+v, want one labelled commit", commits)
+    }
+}
+
+func TestIosxrFailedCommitCapturesShowConfigurationFailed(t *testing.T) {
+    service, device := connectXR(t, xrtest.Options{
+        Reject: func(line string) string {
+            if strings.HasPrefix(line, "bogus") {
+                return "% Invalid input detected at '^' marker."
+            }
+            return ""
+        },
+        Verify: func(line string) string {
+            if strings.Contains(line, "mtu 100") {
+                return "Invalid MTU: must be between 1514 and 9216"
+            }
+            return ""
+        },
+    })
+
+    session := openXRSession(t, service)
+    session.Send([]string{"interface Gi0/0/0/1", "mtu 100"})
+    result, err := session.Commit()
+    if !errors.Is(err, ErrCommitFailed) {
+        t.Fatalf("Commit error = %v, want ErrCommitFailed", err)
+    }
+    if !strings.Contains(result.Failed, "SEMANTIC ERRORS") || !strings.Contains(result.Failed, "Invalid MTU") {
+        t.Fatalf("Failed = %q, want show configuration failed output", result.Failed)
+    }
+    path, err := session.Abort()
+    if err != nil {
+        t.Fatalf("Abort returned error: %v", err)
+    }
+    if len(device.Running()) != 0 || len(device.Commits()) != 0 {
+        t.Fatalf("running = %q, want nothing applied", device.Running())
+    }
+    if _, err := session.Commit(); !errors.Is(err, repository.ErrConfigSessionClosed) {
+        t.Fatalf("Commit after Abort error = %v, want ErrConfigSessionClosed", err)
+    }
+    if output := readCLIOutput(t, path); !strings.HasSuffix(strings.TrimSpace(output), "RP/0/RSP0/CPU0:router#") {
+        t.Fatalf("transcript = %q, want it to end back in EXEC mode", output)
+    }
+
+    // The connection is still usable for the next session.
+    session = openXRSession(t, service)
+    if _, err := session.Send([]string{"interface Gi0/0/0/1", "mtu 9000", "bogus command"}); err == nil {
+        t.Fatal("Send with a line the device cannot parse returned no error")
+    }
+    session.Close()
+}
+
+func TestIosxrCommitConfirmed(t *testing.T) {
+    service, device := connectXR(t, xrtest.Options{})
+
+    session := openXRSession(t, service)
+    session.Send([]string{"hostname edge1"})
+    result, err := session.Commit(WithCommitConfirmed(2 * time.Minute))
+    if err != nil {
+        t.Fatalf("Commit returned error: %v", err)
+    }
+    if result.Command != "commit confirmed 120" || !result.Pending {
+        t.Fatalf("result = %+v, want a pending commit confirmed 120", result)
+    }
+    if commits := device.Commits(); len(commits) != 1 || !commits[0].Trial {
+        t.Fatalf("commits = %+v, want one trial commit", commits)
+    }
+    if _, err := session.Confirm(); err != nil {
+        t.Fatalf("Confirm returned error: %v", err)
+    }
+    if commits := device.Commits(); commits[0].Trial {
+        t.Fatal("commit still on trial after Confirm")
+    }
+
+    session.Send([]string{"hostname edge2"})
+    if _, err := session.Commit(WithCommitConfirmed(time.Minute)); err != nil {
+        t.Fatalf("Commit returned error: %v", err)
+    }
+    session.Close()
+    device.ExpireConfirmed()
+    if got := device.Running(); !reflect.DeepEqual(got, []string{"hostname edge1"}) {
+        t.Fatalf("running = %q, want the unconfirmed commit rolled back", got)
+    }
+}
+
+func TestIosxrRollback(t *testing.T) {
+    service, device := connectXR(t, xrtest.Options{Running: []string{"hostname router"}})
+
+    for _, line := range []string{"ntp server 10.0.0.1", "ntp server 10.0.0.2"} {
+        session := openXRSession(t, service)
+        session.Send([]string{line})
+        if _, err := session.Commit(); err != nil {
+            t.Fatalf("Commit returned error: %v", err)
+        }
+        session.Close()
+    }
+
+    result, err := service.Rollback(2, repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("Rollback returned error: %v", err)
+    }
+    if !strings.Contains(result.Output, "successfully rolled back 2 commits") || result.OutputFile == "" {
+        t.Fatalf("result = %+v", result)
+    }
+    if got := device.Running(); !reflect.DeepEqual(got, []string{"hostname router"}) {
+        t.Fatalf("running = %q, want the configuration before both commits", got)
+    }
+
+    if _, err := service.Rollback(10, repository.WithTimeout(5*time.Second)); !errors.Is(err, ErrRollbackFailed) {
+        t.Fatalf("Rollback(10) error = %v, want ErrRollbackFailed", err)
+    }
+}
+
+func TestIosxrCloseDiscardsUncommittedChanges(t *testing.T) {
+    service, device := connectXR(t, xrtest.Options{})
+
+    session := openXRSession(t, service)
+    session.Send([]string{"hostname edge1"})
+    path, err := session.Close()
+    if err != nil {
+        t.Fatalf("Close returned error: %v", err)
+    }
+    if len(device.Running()) != 0 {
+        t.Fatalf("running = %q, want uncommitted changes discarded", device.Running())
+    }
+    output := readCLIOutput(t, path)
+    if !strings.Contains(output, "Uncommitted changes found") || !strings.HasSuffix(strings.TrimSpace(output), "RP/0/RSP0/CPU0:router#") {
+        t.Fatalf("transcript = %q, want the changes declined on the way out", output)
+    }
+}
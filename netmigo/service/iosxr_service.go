@@ -1,7 +1,9 @@
 package service
 
 import (
+    "context"
     "errors"
+    "fmt"
     "log/slog"
 
     "golang.org/x/crypto/ssh"
@@ -15,33 +17,100 @@ type IosxrDeviceService struct {
     logger *slog.Logger
     client *ssh.Client
     devCfg config.DeviceConfig
+
+    telnet     repository.TelnetRepository
+    telnetConn *repository.TelnetConn
+
+    console     repository.ConsoleRepository
+    consoleConn *repository.ConsoleConn
 }
 
-func NewIosxrDeviceService(repo repository.SSHRepository, logger *slog.Logger) *IosxrDeviceService {
-    return &IosxrDeviceService{repo: repo, logger: logger}
+func NewIosxrDeviceService(repo repository.SSHRepository, logger *slog.Logger, opts ...Option) *IosxrDeviceService {
+    options := newServiceOptions(logger, opts)
+    return &IosxrDeviceService{repo: repo, logger: logger, telnet: options.telnet, console: options.console}
 }
 
 func (s *IosxrDeviceService) Connect(cfg *config.DeviceConfig) error {
+    return s.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext is Connect with a context that bounds queueing for a shared
+// jump server.
+func (s *IosxrDeviceService) ConnectContext(ctx context.Context, cfg *config.DeviceConfig) error {
     s.logger.Info("Connecting to iOSXR device service", "host", cfg.IP)
     s.devCfg = *cfg
-    client, err := s.repo.Connect(*cfg)
+    if cfg.Console != nil {
+        consoleConn, err := s.console.ConnectContext(ctx, *cfg)
+        if err != nil {
+            return err
+        }
+        s.consoleConn = consoleConn
+        return nil
+    }
+    client, telnetConn, err := connectTransport(ctx, s.logger, s.repo, s.telnet, cfg)
     if err != nil {
         // On failure, just return the error. Do NOT release the jump client
         // as other goroutines might still be using it successfully.
         return err
     }
     s.client = client
+    s.telnetConn = telnetConn
     return nil
 }
 
+// Transport reports whether the service is connected over SSH or Telnet,
+// which matters after an SSH-then-Telnet fallback.
+func (s *IosxrDeviceService) Transport() config.Transport {
+    if s.consoleConn != nil {
+        return s.consoleConn.Transport()
+    }
+    if s.telnetConn != nil {
+        return config.TransportTelnet
+    }
+    return config.TransportSSH
+}
+
 func (s *IosxrDeviceService) Disconnect() {
     s.logger.Info("Disconnecting iOSXR device service")
+    if s.consoleConn != nil {
+        s.console.Disconnect(s.consoleConn)
+        s.consoleConn = nil
+        return
+    }
+    if s.telnetConn != nil {
+        s.telnet.Disconnect(s.telnetConn)
+        s.telnetConn = nil
+        return
+    }
     s.repo.Disconnect(s.client, s.devCfg.JumpServer)
     s.client = nil
 }
 
 func (s *IosxrDeviceService) Execute(command string, opts ...repository.ExecuteOption) (string, error) {
     s.logger.Info("Executing command on iOSXR service", "command", command)
+    path, err := s.execute(command, opts...)
+    if err != nil {
+        return path, err
+    }
+    return path, parseOutput(config.CISCO_IOSXR, command, path, opts)
+}
+
+// ExecuteStructured runs command with "| xml" appended and decodes the
+// output into v, as encoding/xml would, or into maps when v is a *any.
+// It returns the path of the output file.
+func (s *IosxrDeviceService) ExecuteStructured(command string, v any, opts ...repository.ExecuteOption) (string, error) {
+    s.logger.Info("Executing structured command on iOSXR service", "command", command)
+    return executeStructured(s.execute, config.CISCO_IOSXR, command, v, opts)
+}
+
+func (s *IosxrDeviceService) execute(command string, opts ...repository.ExecuteOption) (string, error) {
+    opts = withPrivilege(s.devCfg, opts, false, false)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecute(s.consoleConn, command, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecute(s.telnetConn, command, opts...)
+    }
     if s.client == nil {
         return "", errors.New("not connected (IosxrDeviceService)")
     }
@@ -53,6 +122,12 @@ func (s *IosxrDeviceService) Download(remoteFilePath, localFilePath string) erro
         "remotePath", remoteFilePath,
         "localPath", localFilePath,
     )
+    if s.consoleConn != nil {
+        return fmt.Errorf("download: %w (IosxrDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return fmt.Errorf("download: %w (IosxrDeviceService)", ErrUnsupportedOverTelnet)
+    }
     if s.client == nil {
         return errors.New("not connected (IosxrDeviceService)")
     }
@@ -61,8 +136,131 @@ func (s *IosxrDeviceService) Download(remoteFilePath, localFilePath string) erro
 
 func (s *IosxrDeviceService) ExecuteMultiple(commands []string, opts ...repository.ExecuteOption) ([]string, error) {
     s.logger.Info("Executing multiple commands on iOSXR service", "commandsCount", len(commands))
+    opts = withPrivilege(s.devCfg, opts, false, false)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecuteMultiple(s.consoleConn, commands, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecuteMultiple(s.telnetConn, commands, opts...)
+    }
     if s.client == nil {
         return nil, errors.New("not connected (IosxrDeviceService ExecuteMultiple)")
     }
     return s.repo.InteractiveExecuteMultiple(s.client, commands, opts...)
 }
+
+// Ping checks that the connection is still usable.
+func (s *IosxrDeviceService) Ping() error {
+    if s.consoleConn != nil {
+        return s.console.Ping(s.consoleConn)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.Ping(s.telnetConn)
+    }
+    if s.client == nil {
+        return errors.New("not connected (IosxrDeviceService)")
+    }
+    pinger, err := sshCapability[repository.Pinger](s.repo, "ping")
+    if err != nil {
+        return err
+    }
+    return pinger.Ping(s.client)
+}
+
+// LocalForward forwards localAddr on this host to remoteAddr as seen from
+// the device, like ssh -L.
+func (s *IosxrDeviceService) LocalForward(localAddr, remoteAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxrDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.LocalForward(s.client, localAddr, remoteAddr)
+}
+
+// RemoteForward forwards remoteAddr on the device to localAddr on this
+// host, like ssh -R.
+func (s *IosxrDeviceService) RemoteForward(remoteAddr, localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxrDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.RemoteForward(s.client, remoteAddr, localAddr)
+}
+
+// DynamicForward runs a SOCKS5 proxy on localAddr that connects from the
+// device, like ssh -D.
+func (s *IosxrDeviceService) DynamicForward(localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (IosxrDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxrDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.DynamicForward(s.client, localAddr)
+}
+
+// SendBreak sends a serial break down the console line, which drops most
+// Cisco devices into ROMMON during boot.
+func (s *IosxrDeviceService) SendBreak() error {
+    if s.consoleConn == nil {
+        return errors.New("not connected through a console server (IosxrDeviceService)")
+    }
+    return s.console.SendBreak(s.consoleConn)
+}
+
+// SendConfigSet enters configuration mode with "configure", sends lines,
+// commits them when every line was accepted and leaves with "end". The
+// result holds the device's answer to each line; a rejected line also
+// makes the error a *repository.ConfigError.
+func (s *IosxrDeviceService) SendConfigSet(lines []string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    s.logger.Info("Sending configuration set", "linesCount", len(lines))
+    opts = withPrivilege(s.devCfg, opts, false, false)
+    if s.consoleConn != nil {
+        return s.console.SendConfig(s.consoleConn, lines, repository.IosxrConfigMode, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.SendConfig(s.telnetConn, lines, repository.IosxrConfigMode, opts...)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (IosxrDeviceService)")
+    }
+    configurer, err := sshCapability[repository.Configurer](s.repo, "configuration")
+    if err != nil {
+        return nil, err
+    }
+    return configurer.SendConfig(s.client, lines, repository.IosxrConfigMode, opts...)
+}
+
+// SendConfigFile is SendConfigSet with the lines of the file at path.
+func (s *IosxrDeviceService) SendConfigFile(path string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    lines, err := readConfigFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return s.SendConfigSet(lines, opts...)
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+    "context"
     "errors"
+    "fmt"
     "log/slog"
 
     "github.com/jonelmawirat/netmigo/netmigo/config"
@@ -14,33 +16,103 @@ type LinuxDeviceService struct {
     logger *slog.Logger
     client *ssh.Client
     devCfg config.DeviceConfig
+
+    telnet     repository.TelnetRepository
+    telnetConn *repository.TelnetConn
+
+    console     repository.ConsoleRepository
+    consoleConn *repository.ConsoleConn
+
+    // sudo is set once Enable succeeds, so every command runs with sudo.
+    sudo bool
 }
 
-func NewLinuxDeviceService(repo repository.SSHRepository, logger *slog.Logger) *LinuxDeviceService {
-    return &LinuxDeviceService{repo: repo, logger: logger}
+func NewLinuxDeviceService(repo repository.SSHRepository, logger *slog.Logger, opts ...Option) *LinuxDeviceService {
+    options := newServiceOptions(logger, opts)
+    return &LinuxDeviceService{repo: repo, logger: logger, telnet: options.telnet, console: options.console}
 }
 
 func (s *LinuxDeviceService) Connect(cfg *config.DeviceConfig) error {
+    return s.ConnectContext(context.Background(), cfg)
+}
+
+// ConnectContext is Connect with a context that bounds queueing for a shared
+// jump server.
+func (s *LinuxDeviceService) ConnectContext(ctx context.Context, cfg *config.DeviceConfig) error {
     s.logger.Info("Connecting to Linux device service", "host", cfg.IP)
     s.devCfg = *cfg
-    client, err := s.repo.Connect(*cfg)
+    if cfg.Console != nil {
+        consoleConn, err := s.console.ConnectContext(ctx, *cfg)
+        if err != nil {
+            return err
+        }
+        s.consoleConn = consoleConn
+        return nil
+    }
+    client, telnetConn, err := connectTransport(ctx, s.logger, s.repo, s.telnet, cfg)
     if err != nil {
         // On failure, just return the error. Do NOT release the jump client
         // as other goroutines might still be using it successfully.
         return err
     }
     s.client = client
+    s.telnetConn = telnetConn
     return nil
 }
 
+// Transport reports whether the service is connected over SSH or Telnet,
+// which matters after an SSH-then-Telnet fallback.
+func (s *LinuxDeviceService) Transport() config.Transport {
+    if s.consoleConn != nil {
+        return s.consoleConn.Transport()
+    }
+    if s.telnetConn != nil {
+        return config.TransportTelnet
+    }
+    return config.TransportSSH
+}
+
 func (s *LinuxDeviceService) Disconnect() {
     s.logger.Info("Disconnecting Linux device service")
+    s.sudo = false
+    if s.consoleConn != nil {
+        s.console.Disconnect(s.consoleConn)
+        s.consoleConn = nil
+        return
+    }
+    if s.telnetConn != nil {
+        s.telnet.Disconnect(s.telnetConn)
+        s.telnetConn = nil
+        return
+    }
     s.repo.Disconnect(s.client, s.devCfg.JumpServer)
     s.client = nil
 }
 
 func (s *LinuxDeviceService) Execute(command string, opts ...repository.ExecuteOption) (string, error) {
     s.logger.Info("Executing command on Linux service", "command", command)
+    path, err := s.execute(command, opts...)
+    if err != nil {
+        return path, err
+    }
+    return path, parseOutput(config.LINUX, command, path, opts)
+}
+
+// ExecuteStructured fails with ErrStructuredOutputUnsupported, as Linux
+// has no pipe that turns any command's output into JSON.
+func (s *LinuxDeviceService) ExecuteStructured(command string, v any, opts ...repository.ExecuteOption) (string, error) {
+    s.logger.Info("Executing structured command on Linux service", "command", command)
+    return executeStructured(s.execute, config.LINUX, command, v, opts)
+}
+
+func (s *LinuxDeviceService) execute(command string, opts ...repository.ExecuteOption) (string, error) {
+    opts = withPrivilege(s.devCfg, opts, false, s.sudo)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecute(s.consoleConn, command, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecute(s.telnetConn, command, opts...)
+    }
     if s.client == nil {
         return "", errors.New("not connected (LinuxDeviceService)")
     }
@@ -52,6 +124,12 @@ func (s *LinuxDeviceService) Download(remoteFilePath, localFilePath string) erro
         "remotePath", remoteFilePath,
         "localPath", localFilePath,
     )
+    if s.consoleConn != nil {
+        return fmt.Errorf("download: %w (LinuxDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return fmt.Errorf("download: %w (LinuxDeviceService)", ErrUnsupportedOverTelnet)
+    }
     if s.client == nil {
         return errors.New("not connected (LinuxDeviceService)")
     }
@@ -60,8 +138,167 @@ func (s *LinuxDeviceService) Download(remoteFilePath, localFilePath string) erro
 
 func (s *LinuxDeviceService) ExecuteMultiple(commands []string, opts ...repository.ExecuteOption) ([]string, error) {
     s.logger.Info("Executing multiple commands on Linux service", "commandsCount", len(commands))
+    opts = withPrivilege(s.devCfg, opts, false, s.sudo)
+    if s.consoleConn != nil {
+        return s.console.InteractiveExecuteMultiple(s.consoleConn, commands, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.InteractiveExecuteMultiple(s.telnetConn, commands, opts...)
+    }
     if s.client == nil {
         return nil, errors.New("not connected (LinuxDeviceService ExecuteMultiple)")
     }
     return s.repo.InteractiveExecuteMultiple(s.client, commands, opts...)
 }
+
+// Ping checks that the connection is still usable.
+func (s *LinuxDeviceService) Ping() error {
+    if s.consoleConn != nil {
+        return s.console.Ping(s.consoleConn)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.Ping(s.telnetConn)
+    }
+    if s.client == nil {
+        return errors.New("not connected (LinuxDeviceService)")
+    }
+    pinger, err := sshCapability[repository.Pinger](s.repo, "ping")
+    if err != nil {
+        return err
+    }
+    return pinger.Ping(s.client)
+}
+
+// LocalForward forwards localAddr on this host to remoteAddr as seen from
+// the device, like ssh -L.
+func (s *LinuxDeviceService) LocalForward(localAddr, remoteAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (LinuxDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.LocalForward(s.client, localAddr, remoteAddr)
+}
+
+// RemoteForward forwards remoteAddr on the device to localAddr on this
+// host, like ssh -R.
+func (s *LinuxDeviceService) RemoteForward(remoteAddr, localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (LinuxDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.RemoteForward(s.client, remoteAddr, localAddr)
+}
+
+// DynamicForward runs a SOCKS5 proxy on localAddr that connects from the
+// device, like ssh -D.
+func (s *LinuxDeviceService) DynamicForward(localAddr string) (*repository.Forward, error) {
+    if s.consoleConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOnConsole)
+    }
+    if s.telnetConn != nil {
+        return nil, fmt.Errorf("port forwarding: %w (LinuxDeviceService)", ErrUnsupportedOverTelnet)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (LinuxDeviceService)")
+    }
+    forwarder, err := sshCapability[repository.Forwarder](s.repo, "port forwarding")
+    if err != nil {
+        return nil, err
+    }
+    return forwarder.DynamicForward(s.client, localAddr)
+}
+
+// SendBreak sends a serial break down the console line, which drops most
+// Cisco devices into ROMMON during boot.
+func (s *LinuxDeviceService) SendBreak() error {
+    if s.consoleConn == nil {
+        return errors.New("not connected through a console server (LinuxDeviceService)")
+    }
+    return s.console.SendBreak(s.consoleConn)
+}
+
+// Enable runs every later command with sudo, answering its prompt with the
+// config's Secret or, when that is empty, the login password. The password
+// is checked with sudo -v first.
+func (s *LinuxDeviceService) Enable() error {
+    if _, err := s.privileged(repository.WithSudoPassword(sudoPassword(s.devCfg))); err != nil {
+        return err
+    }
+    s.sudo = true
+    return nil
+}
+
+// IsPrivileged reports whether commands run as root, through Enable or
+// because the login shell is root's.
+func (s *LinuxDeviceService) IsPrivileged() (bool, error) {
+    if s.sudo {
+        return true, nil
+    }
+    return s.privileged()
+}
+
+func (s *LinuxDeviceService) privileged(opts ...repository.ExecuteOption) (bool, error) {
+    if s.consoleConn != nil {
+        return s.console.Privileged(s.consoleConn, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.Privileged(s.telnetConn, opts...)
+    }
+    if s.client == nil {
+        return false, errors.New("not connected (LinuxDeviceService)")
+    }
+    checker, err := sshCapability[repository.PrivilegeChecker](s.repo, "privilege")
+    if err != nil {
+        return false, err
+    }
+    return checker.Privileged(s.client, opts...)
+}
+
+// SendConfigSet runs lines one after another in a single shell, with sudo
+// after Enable or WithSudo. The result holds the output of each line; a
+// failed line also makes the error a *repository.ConfigError.
+func (s *LinuxDeviceService) SendConfigSet(lines []string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    s.logger.Info("Sending configuration set", "linesCount", len(lines))
+    opts = withPrivilege(s.devCfg, opts, false, s.sudo)
+    if s.consoleConn != nil {
+        return s.console.SendConfig(s.consoleConn, lines, repository.ShellConfigMode, opts...)
+    }
+    if s.telnetConn != nil {
+        return s.telnet.SendConfig(s.telnetConn, lines, repository.ShellConfigMode, opts...)
+    }
+    if s.client == nil {
+        return nil, errors.New("not connected (LinuxDeviceService)")
+    }
+    configurer, err := sshCapability[repository.Configurer](s.repo, "configuration")
+    if err != nil {
+        return nil, err
+    }
+    return configurer.SendConfig(s.client, lines, repository.ShellConfigMode, opts...)
+}
+
+// SendConfigFile is SendConfigSet with the lines of the file at path.
+func (s *LinuxDeviceService) SendConfigFile(path string, opts ...repository.ExecuteOption) (*repository.ConfigResult, error) {
+    lines, err := readConfigFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return s.SendConfigSet(lines, opts...)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+    "github.com/jonelmawirat/netmigo/netmigo/textfsm"
+)
+
+// WithTextFSM makes Execute parse the command's output, without the prompt
+// and echoed command, with the template index has for the device's platform
+// and the command, and store the records in *records. The output file is
+// still written. A command without a template makes Execute fail with
+// textfsm.ErrNoTemplate.
+func WithTextFSM(index *textfsm.Index, records *[]map[string]any) repository.ExecuteOption {
+    return func(o *repository.ExecuteOptions) {
+        o.ParseOutput = func(platform config.Platform, command, output string) error {
+            parsed, err := index.Parse(textfsm.PlatformName(platform), command, output)
+            if err != nil {
+                return err
+            }
+            *records = parsed
+            return nil
+        }
+    }
+}
+
+// parseOutput hands the output file Execute wrote for command to the
+// ParseOutput option, when opts has one.
+func parseOutput(platform config.Platform, command, path string, opts []repository.ExecuteOption) error {
+    options := repository.NewExecuteOptions(opts...)
+    if options.ParseOutput == nil {
+        return nil
+    }
+    output, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    if err := options.ParseOutput(platform, command, repository.CommandOutput(command, output)); err != nil {
+        return fmt.Errorf("parsing output of %q: %w", command, err)
+    }
+    return nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+    "errors"
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/telnettest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+    "github.com/jonelmawirat/netmigo/netmigo/textfsm"
+)
+
+func TestExecuteWithTextFSMReturnsRecords(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "index": "Template, Hostname, Platform, Command\n\ncisco_xr_show_clock.textfsm, .*, cisco_xr, sh[[ow]] clo[[ck]]\n",
+        // The template fails on any line it does not know, so the prompt
+        // and echoed command must not reach it.
+        "cisco_xr_show_clock.textfsm": "Value TIME (\\S+)\nValue TIMEZONE (\\S+)\n\nStart\n  ^${TIME} ${TIMEZONE} \\w+ \\w+ \\d+ \\d+$$ -> Record\n  ^\\s*$$\n  ^. -> Error\n",
+    }
+    for name, content := range files {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    index, err := textfsm.LoadIndex(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    chdirTemp(t)
+    telnet := telnettest.Start(t, telnettest.Options{
+        Username: "admin",
+        Password: "cisco",
+        Prompt:   "RP/0/RSP0/CPU0:edge1#",
+        Handler: func(command string) string {
+            if command == "show clock" {
+                return "02:00:01.512 UTC Fri Oct 16 2026"
+            }
+            return "% Invalid input detected at '^' marker."
+        },
+    })
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxrDeviceService(repository.NewSSHRepository(logger), logger)
+    err = device.Connect(config.NewDeviceConfig(telnet.Host(),
+        config.WithTransport(config.TransportTelnet),
+        config.WithTelnetPort(telnet.Port()),
+        config.WithUsername("admin"),
+        config.WithPassword("cisco"),
+        config.WithMaxRetry(1),
+    ))
+    if err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    var records []map[string]any
+    path, err := device.Execute("show clock", repository.WithTimeout(5*time.Second), WithTextFSM(index, &records))
+    if err != nil {
+        t.Fatalf("Execute returned error: %v", err)
+    }
+    if want := []map[string]any{{"time": "02:00:01.512", "timezone": "UTC"}}; !reflect.DeepEqual(records, want) {
+        t.Fatalf("records = %v, want %v", records, want)
+    }
+    if _, err := os.Stat(path); err != nil {
+        t.Fatalf("output file: %v", err)
+    }
+
+    if _, err := device.Execute("show version", repository.WithTimeout(5*time.Second), WithTextFSM(index, &records)); !errors.Is(err, textfsm.ErrNoTemplate) {
+        t.Fatalf("Execute error = %v, want ErrNoTemplate", err)
+    }
+}
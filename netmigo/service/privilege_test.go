@@ -0,0 +1,124 @@
+package service
+
+import (
+    "errors"
+    "io"
+    "log/slog"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/sshtest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+func chdirTemp(t *testing.T) {
+    wd, _ := os.Getwd()
+    os.Chdir(t.TempDir())
+    t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func newCLIConfig(t *testing.T, cli sshtest.CLI, opts ...config.DeviceConfigOption) *config.DeviceConfig {
+    server := sshtest.NewServer(t, "admin", "cisco", cli.Shell)
+    opts = append([]config.DeviceConfigOption{
+        config.WithPort(server.Port()),
+        config.WithUsername("admin"),
+        config.WithPassword("cisco"),
+        config.WithMaxRetry(1),
+    }, opts...)
+    return config.NewDeviceConfig(server.Host(), opts...)
+}
+
+func TestIosxeEnableKeepsLaterCommandsPrivileged(t *testing.T) {
+    chdirTemp(t)
+    cfg := newCLIConfig(t, sshtest.CLI{
+        UserPrompt: "router>",
+        Secret:     "s3cret",
+        Handler: func(command string, privileged bool) string {
+            if privileged {
+                return "hostname router"
+            }
+            return "% Invalid input detected at '^' marker."
+        },
+    }, config.WithSecret("s3cret"))
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxeDeviceService(repository.NewSSHRepository(logger), logger)
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    if privileged, err := device.IsPrivileged(); err != nil || privileged {
+        t.Fatalf("IsPrivileged() = %v, %v before Enable, want false", privileged, err)
+    }
+    if err := device.Enable(); err != nil {
+        t.Fatalf("Enable returned error: %v", err)
+    }
+    if privileged, err := device.IsPrivileged(); err != nil || !privileged {
+        t.Fatalf("IsPrivileged() = %v, %v after Enable, want true", privileged, err)
+    }
+    paths, err := device.ExecuteMultiple([]string{"show running-config"}, repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("ExecuteMultiple returned error: %v", err)
+    }
+    if output, _ := os.ReadFile(paths[0]); !strings.Contains(string(output), "hostname router") {
+        t.Fatalf("output = %q, want privileged output", output)
+    }
+}
+
+func TestIosxeEnableWithWrongSecret(t *testing.T) {
+    cfg := newCLIConfig(t, sshtest.CLI{UserPrompt: "router>", Secret: "s3cret"}, config.WithSecret("wrong"))
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxeDeviceService(repository.NewSSHRepository(logger), logger)
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    if err := device.Enable(); !errors.Is(err, repository.ErrEnableFailed) {
+        t.Fatalf("Enable error = %v, want ErrEnableFailed", err)
+    }
+}
+
+func TestLinuxSudoUsesLoginPasswordByDefault(t *testing.T) {
+    chdirTemp(t)
+    cfg := newCLIConfig(t, sshtest.CLI{
+        Prompt:       "admin@server:~$ ",
+        SudoPassword: "cisco",
+        Handler: func(command string, privileged bool) string {
+            if privileged {
+                return "uid=0(root) gid=0(root)"
+            }
+            return "uid=1000(admin) gid=1000(admin)"
+        },
+    })
+    device := newTestLinuxService()
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    path, err := device.Execute("id", repository.WithSudo(), repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("Execute returned error: %v", err)
+    }
+    if output, _ := os.ReadFile(path); !strings.Contains(string(output), "uid=0(root)") {
+        t.Fatalf("output = %q, want the command run as root", output)
+    }
+
+    if privileged, err := device.IsPrivileged(); err != nil || privileged {
+        t.Fatalf("IsPrivileged() = %v, %v before Enable, want false", privileged, err)
+    }
+    if err := device.Enable(); err != nil {
+        t.Fatalf("Enable returned error: %v", err)
+    }
+    path, err = device.Execute("id", repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("Execute returned error: %v", err)
+    }
+    if output, _ := os.ReadFile(path); !strings.Contains(string(output), "uid=0(root)") {
+        t.Fatalf("output = %q after Enable, want the command run as root", output)
+    }
+}
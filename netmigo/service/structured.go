@@ -0,0 +1,150 @@
+package service
+
+import (
+    "bytes"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+// ErrStructuredOutputUnsupported is returned by ExecuteStructured on
+// platforms whose CLI cannot print JSON or XML.
+var ErrStructuredOutputUnsupported = errors.New("structured output not supported")
+
+// structuredFormat is how a platform prints a command's output as data:
+// the pipe appended to the command, the characters the data starts with
+// and how to decode it.
+type structuredFormat struct {
+    suffix string
+    start  string
+    decode func(data []byte, v any) error
+}
+
+var structuredFormats = map[config.Platform]structuredFormat{
+    config.CISCO_IOSXR:   {suffix: "| xml", start: "<", decode: decodeXML},
+    config.CISCO_NXOS:    {suffix: "| json", start: "{[", decode: json.Unmarshal},
+    config.JUNIPER_JUNOS: {suffix: "| display json", start: "{[", decode: json.Unmarshal},
+    config.ARISTA_EOS:    {suffix: "| json", start: "{[", decode: json.Unmarshal},
+}
+
+// executeStructured runs command with the structured-output suffix of
+// platform through execute and decodes the output into v.
+func executeStructured(execute func(string, ...repository.ExecuteOption) (string, error), platform config.Platform, command string, v any, opts []repository.ExecuteOption) (string, error) {
+    format, ok := structuredFormats[platform]
+    if !ok {
+        return "", fmt.Errorf("%w on %v", ErrStructuredOutputUnsupported, platform)
+    }
+    command = strings.TrimSpace(command)
+    if !strings.HasSuffix(command, format.suffix) {
+        command += " " + format.suffix
+    }
+    path, err := execute(command, opts...)
+    if err != nil {
+        return path, err
+    }
+    output, err := os.ReadFile(path)
+    if err != nil {
+        return path, err
+    }
+    data, err := structuredData(repository.CommandOutput(command, output), format.start)
+    if err != nil {
+        return path, fmt.Errorf("%q: %w", command, err)
+    }
+    if err := format.decode([]byte(data), v); err != nil {
+        return path, fmt.Errorf("decoding output of %q: %w", command, err)
+    }
+    return path, nil
+}
+
+// structuredData drops the lines before the data, such as the timestamp
+// IOS-XR prints before every show command. Output without data is
+// usually an error message, which is returned as the error.
+func structuredData(output, start string) (string, error) {
+    lines := strings.Split(output, "\n")
+    for i, line := range lines {
+        if trimmed := strings.TrimSpace(line); trimmed != "" && strings.ContainsAny(trimmed[:1], start) {
+            return strings.Join(lines[i:], "\n"), nil
+        }
+    }
+    for _, line := range lines {
+        if line = strings.TrimSpace(line); line != "" {
+            return "", fmt.Errorf("no structured output: %s", line)
+        }
+    }
+    return "", errors.New("no structured output")
+}
+
+// decodeXML decodes XML into v. encoding/xml cannot decode into an
+// interface, so for a *any the document becomes maps: the root element's
+// name maps to its value, an element with only text is that text, and
+// any other element is a map of its children by name, with attributes
+// under "@name", text under "#text" and repeated children as a []any.
+func decodeXML(data []byte, v any) error {
+    p, ok := v.(*any)
+    if !ok {
+        return xml.Unmarshal(data, v)
+    }
+    d := xml.NewDecoder(bytes.NewReader(data))
+    for {
+        token, err := d.Token()
+        if err != nil {
+            return err
+        }
+        if start, ok := token.(xml.StartElement); ok {
+            value, err := xmlElement(d, start)
+            if err != nil {
+                return err
+            }
+            *p = map[string]any{start.Name.Local: value}
+            return nil
+        }
+    }
+}
+
+func xmlElement(d *xml.Decoder, start xml.StartElement) (any, error) {
+    fields := make(map[string]any)
+    for _, attr := range start.Attr {
+        fields["@"+attr.Name.Local] = attr.Value
+    }
+    var text strings.Builder
+    for {
+        token, err := d.Token()
+        if err != nil {
+            return nil, err
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            child, err := xmlElement(d, t)
+            if err != nil {
+                return nil, err
+            }
+            // Elements decode to strings and maps, so a []any is always
+            // an earlier repetition.
+            switch existing := fields[t.Name.Local].(type) {
+            case nil:
+                fields[t.Name.Local] = child
+            case []any:
+                fields[t.Name.Local] = append(existing, child)
+            default:
+                fields[t.Name.Local] = []any{existing, child}
+            }
+        case xml.CharData:
+            text.Write(t)
+        case xml.EndElement:
+            s := strings.TrimSpace(text.String())
+            if len(fields) == 0 {
+                return s, nil
+            }
+            if s != "" {
+                fields["#text"] = s
+            }
+            return fields, nil
+        }
+    }
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+    "errors"
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/telnettest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+const platformXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Response MajorVersion="1" MinorVersion="0">
+ <Get>
+  <Operational>
+   <PlatformInventory>
+    <Rack><Naming><Name>0</Name></Naming><Serial>FOX1234ABCD</Serial></Rack>
+    <Rack><Naming><Name>1</Name></Naming><Serial>FOX1234ABCE</Serial></Rack>
+   </PlatformInventory>
+  </Operational>
+ </Get>
+</Response>`
+
+func TestExecuteStructuredDecodesXML(t *testing.T) {
+    chdirTemp(t)
+    telnet := telnettest.Start(t, telnettest.Options{
+        Username: "admin",
+        Password: "cisco",
+        Prompt:   "RP/0/RSP0/CPU0:edge1#",
+        Handler: func(command string) string {
+            if command == "show platform inventory | xml" {
+                return "Fri Oct 16 02:00:01.512 UTC\n" + platformXML
+            }
+            return "% Invalid input detected at '^' marker."
+        },
+    })
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewIosxrDeviceService(repository.NewSSHRepository(logger), logger)
+    err := device.Connect(config.NewDeviceConfig(telnet.Host(),
+        config.WithTransport(config.TransportTelnet),
+        config.WithTelnetPort(telnet.Port()),
+        config.WithUsername("admin"),
+        config.WithPassword("cisco"),
+        config.WithMaxRetry(1),
+    ))
+    if err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    var inventory struct {
+        Racks []struct {
+            Name   string `xml:"Naming>Name"`
+            Serial string `xml:"Serial"`
+        } `xml:"Get>Operational>PlatformInventory>Rack"`
+    }
+    path, err := device.ExecuteStructured("show platform inventory", &inventory, repository.WithTimeout(5*time.Second))
+    if err != nil {
+        t.Fatalf("ExecuteStructured returned error: %v", err)
+    }
+    if len(inventory.Racks) != 2 || inventory.Racks[1].Name != "1" || inventory.Racks[1].Serial != "FOX1234ABCE" {
+        t.Fatalf("inventory = %+v", inventory)
+    }
+    if _, err := os.Stat(path); err != nil {
+        t.Fatalf("output file: %v", err)
+    }
+
+    // The suffix is not appended twice.
+    var doc any
+    if _, err := device.ExecuteStructured("show platform inventory | xml", &doc, repository.WithTimeout(5*time.Second)); err != nil {
+        t.Fatalf("ExecuteStructured into any returned error: %v", err)
+    }
+    response := doc.(map[string]any)["Response"].(map[string]any)
+    if response["@MajorVersion"] != "1" {
+        t.Fatalf("Response attributes = %v", response)
+    }
+    racks := response["Get"].(map[string]any)["Operational"].(map[string]any)["PlatformInventory"].(map[string]any)["Rack"]
+    want := []any{
+        map[string]any{"Naming": map[string]any{"Name": "0"}, "Serial": "FOX1234ABCD"},
+        map[string]any{"Naming": map[string]any{"Name": "1"}, "Serial": "FOX1234ABCE"},
+    }
+    if !reflect.DeepEqual(racks, want) {
+        t.Fatalf("Rack = %v, want %v", racks, want)
+    }
+
+    _, err = device.ExecuteStructured("show bogus", &doc, repository.WithTimeout(5*time.Second))
+    if err == nil || !strings.Contains(err.Error(), "% Invalid input") {
+        t.Fatalf("ExecuteStructured error = %v, want the device's error message", err)
+    }
+}
+
+func TestExecuteStructuredDecodesJSON(t *testing.T) {
+    tests := []struct {
+        platform config.Platform
+        output   string
+        sent     string
+    }{
+        {config.CISCO_NXOS, "switch1# show version | json\n{\"host_name\": \"switch1\", \"os\": \"9.3(8)\"}\nswitch1# \n", "show version | json"},
+        {config.JUNIPER_JUNOS, "admin@switch1> show version | display json\n{\"host_name\": \"switch1\", \"os\": \"21.4R3\"}\n\nadmin@switch1> \n", "show version | display json"},
+        {config.ARISTA_EOS, "switch1#show version | json\n{\n  \"host_name\": \"switch1\",\n  \"os\": \"4.30.1F\"\n}\nswitch1#\n", "show version | json"},
+    }
+    for _, tt := range tests {
+        path := filepath.Join(t.TempDir(), "output.txt")
+        if err := os.WriteFile(path, []byte(tt.output), 0644); err != nil {
+            t.Fatal(err)
+        }
+        var sent string
+        execute := func(command string, opts ...repository.ExecuteOption) (string, error) {
+            sent = command
+            return path, nil
+        }
+
+        var version struct {
+            HostName string `json:"host_name"`
+            OS       string `json:"os"`
+        }
+        if _, err := executeStructured(execute, tt.platform, "show version", &version, nil); err != nil {
+            t.Fatalf("%v: executeStructured returned error: %v", tt.platform, err)
+        }
+        if sent != tt.sent {
+            t.Errorf("%v: sent %q, want %q", tt.platform, sent, tt.sent)
+        }
+        if version.HostName != "switch1" || version.OS == "" {
+            t.Errorf("%v: version = %+v", tt.platform, version)
+        }
+    }
+}
+
+func TestExecuteStructuredUnsupportedOnLinux(t *testing.T) {
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    device := NewLinuxDeviceService(repository.NewSSHRepository(logger), logger)
+    var v any
+    if _, err := device.ExecuteStructured("ip addr", &v); !errors.Is(err, ErrStructuredOutputUnsupported) {
+        t.Fatalf("ExecuteStructured error = %v, want ErrStructuredOutputUnsupported", err)
+    }
+}
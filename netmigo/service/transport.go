@@ -0,0 +1,133 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+
+    "golang.org/x/crypto/ssh"
+
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+// ErrUnsupportedOverTelnet is returned by Download and the port forwards
+// when the device was reached over Telnet.
+var ErrUnsupportedOverTelnet = errors.New("not supported over Telnet")
+
+// ErrUnsupportedOnConsole is returned by Download and the port forwards
+// when the device was reached through a console server.
+var ErrUnsupportedOnConsole = errors.New("not supported on a console line")
+
+// ErrUnsupportedByRepository is returned when the SSHRepository a service
+// was built with lacks the optional capability a method needs, such as
+// repository.Forwarder for the port forwards.
+var ErrUnsupportedByRepository = errors.New("not supported by the SSH repository")
+
+type serviceOptions struct {
+    telnet  repository.TelnetRepository
+    console repository.ConsoleRepository
+}
+
+// Option configures a device service.
+type Option func(*serviceOptions)
+
+// WithTelnetRepository sets the repository used when the device config
+// selects Telnet. It defaults to repository.NewTelnetRepository.
+func WithTelnetRepository(repo repository.TelnetRepository) Option {
+    return func(o *serviceOptions) {
+        o.telnet = repo
+    }
+}
+
+// WithConsoleRepository sets the repository used when the device config
+// has console access set. It defaults to repository.NewConsoleRepository.
+func WithConsoleRepository(repo repository.ConsoleRepository) Option {
+    return func(o *serviceOptions) {
+        o.console = repo
+    }
+}
+
+func newServiceOptions(logger *slog.Logger, opts []Option) serviceOptions {
+    var options serviceOptions
+    for _, opt := range opts {
+        opt(&options)
+    }
+    if options.telnet == nil {
+        options.telnet = repository.NewTelnetRepository(logger)
+    }
+    if options.console == nil {
+        options.console = repository.NewConsoleRepository(logger)
+    }
+    return options
+}
+
+// connectTransport connects over the transport cfg selects and returns
+// either the SSH client or the Telnet connection.
+func connectTransport(ctx context.Context, logger *slog.Logger, sshRepo repository.SSHRepository, telnetRepo repository.TelnetRepository, cfg *config.DeviceConfig) (*ssh.Client, *repository.TelnetConn, error) {
+    switch cfg.Transport {
+    case config.TransportTelnet:
+        conn, err := telnetRepo.ConnectContext(ctx, *cfg)
+        return nil, conn, err
+    case config.TransportSSHThenTelnet:
+        client, err := connectSSH(ctx, sshRepo, cfg)
+        if err == nil {
+            return client, nil, nil
+        }
+        if repository.IsAuthFailure(err) || ctx.Err() != nil {
+            return nil, nil, err
+        }
+        logger.Warn("SSH connection failed, falling back to Telnet", "host", cfg.IP, "error", err)
+        conn, telnetErr := telnetRepo.ConnectContext(ctx, *cfg)
+        if telnetErr != nil {
+            return nil, nil, fmt.Errorf("ssh: %w; telnet fallback: %w", err, telnetErr)
+        }
+        return nil, conn, nil
+    default:
+        client, err := connectSSH(ctx, sshRepo, cfg)
+        return client, nil, err
+    }
+}
+
+// connectSSH connects with ctx when the repository is a
+// repository.ContextConnector and without it otherwise.
+func connectSSH(ctx context.Context, repo repository.SSHRepository, cfg *config.DeviceConfig) (*ssh.Client, error) {
+    if connector, ok := repo.(repository.ContextConnector); ok {
+        return connector.ConnectContext(ctx, *cfg)
+    }
+    return repo.Connect(*cfg)
+}
+
+// sshCapability returns repo as the optional capability T, or an error
+// wrapping ErrUnsupportedByRepository that names what needed it.
+func sshCapability[T any](repo repository.SSHRepository, what string) (T, error) {
+    capability, ok := repo.(T)
+    if !ok {
+        return capability, fmt.Errorf("%s: %w", what, ErrUnsupportedByRepository)
+    }
+    return capability, nil
+}
+
+// sudoPassword is the password sudo is answered with: Secret when set,
+// otherwise the login password.
+func sudoPassword(cfg config.DeviceConfig) string {
+    if cfg.Secret != "" {
+        return cfg.Secret
+    }
+    return cfg.Password
+}
+
+// withPrivilege adds the options that keep a service privileged across
+// commands: enable in every new SSH shell once Enable has succeeded, and
+// the sudo password from cfg for WithSudo or after a Linux Enable.
+func withPrivilege(cfg config.DeviceConfig, opts []repository.ExecuteOption, enable, sudo bool) []repository.ExecuteOption {
+    options := repository.NewExecuteOptions(opts...)
+    if enable && !options.Enable {
+        opts = append(opts, repository.WithEnable(cfg.Secret))
+    }
+    if (sudo || options.Sudo) && options.SudoPassword == "" {
+        opts = append(opts, repository.WithSudoPassword(sudoPassword(cfg)))
+    }
+    return opts
+}
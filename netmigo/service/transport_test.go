@@ -0,0 +1,138 @@
+package service
+
+import (
+    "errors"
+    "io"
+    "log/slog"
+    "net"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/jonelmawirat/netmigo/internal/sshtest"
+    "github.com/jonelmawirat/netmigo/internal/telnettest"
+    "github.com/jonelmawirat/netmigo/netmigo/config"
+    "github.com/jonelmawirat/netmigo/netmigo/repository"
+)
+
+func newTestLinuxService() *LinuxDeviceService {
+    logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+    return NewLinuxDeviceService(repository.NewSSHRepository(logger), logger)
+}
+
+// closedPort returns a loopback port nothing listens on.
+func closedPort(t *testing.T) string {
+    t.Helper()
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, port, _ := net.SplitHostPort(listener.Addr().String())
+    listener.Close()
+    return port
+}
+
+func TestSSHThenTelnetFallsBackWhenSSHIsUnreachable(t *testing.T) {
+    chdirTemp(t)
+
+    telnet := telnettest.Start(t, telnettest.Options{
+        Username: "admin",
+        Password: "cisco",
+        Handler:  func(command string) string { return "output of " + command },
+    })
+    cfg := config.NewDeviceConfig(telnet.Host(),
+        config.WithPort(closedPort(t)),
+        config.WithTelnetPort(telnet.Port()),
+        config.WithTransport(config.TransportSSHThenTelnet),
+        config.WithUsername("admin"),
+        config.WithPassword("cisco"),
+        config.WithMaxRetry(1),
+        config.WithConnectionTimeout(5*time.Second),
+    )
+
+    device := newTestLinuxService()
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    if device.Transport() != config.TransportTelnet {
+        t.Fatalf("Transport() = %v, want telnet", device.Transport())
+    }
+    path, err := device.Execute("show clock", repository.WithTimeout(30*time.Second))
+    if err != nil {
+        t.Fatalf("Execute returned error: %v", err)
+    }
+    if output, _ := os.ReadFile(path); len(output) == 0 {
+        t.Fatal("Execute wrote no output")
+    }
+    if err := device.Download("/etc/hosts", "hosts"); !errors.Is(err, ErrUnsupportedOverTelnet) {
+        t.Fatalf("Download error = %v, want ErrUnsupportedOverTelnet", err)
+    }
+}
+
+func TestSSHThenTelnetDoesNotFallBackOnAuthFailure(t *testing.T) {
+    ssh := sshtest.NewServer(t, "admin", "cisco", nil)
+    telnet := telnettest.Start(t, telnettest.Options{Username: "admin", Password: "cisco"})
+    newCfg := func(password string) *config.DeviceConfig {
+        return config.NewDeviceConfig(ssh.Host(),
+            config.WithPort(ssh.Port()),
+            config.WithTelnetPort(telnet.Port()),
+            config.WithTransport(config.TransportSSHThenTelnet),
+            config.WithUsername("admin"),
+            config.WithPassword(password),
+            config.WithMaxRetry(1),
+        )
+    }
+
+    device := newTestLinuxService()
+    if err := device.Connect(newCfg("wrong")); err == nil {
+        t.Fatal("expected the rejected SSH password to fail")
+    }
+    if telnet.Connections() != 0 {
+        t.Fatalf("telnet connections = %d, want no fallback after an auth failure", telnet.Connections())
+    }
+
+    if err := device.Connect(newCfg("cisco")); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+    if device.Transport() != config.TransportSSH {
+        t.Fatalf("Transport() = %v, want ssh", device.Transport())
+    }
+}
+
+func TestConsoleAccessRoutesCommandsToTheConsoleLine(t *testing.T) {
+    chdirTemp(t)
+
+    console := telnettest.Start(t, telnettest.Options{
+        Handler: func(command string) string { return "output of " + command },
+        Console: &telnettest.Console{Username: "admin", Password: "cisco"},
+    })
+    cfg := config.NewDeviceConfig(console.Host(),
+        config.WithTransport(config.TransportTelnet),
+        config.WithTelnetPort(console.Port()),
+        config.WithConsole("admin", "cisco"),
+        config.WithMaxRetry(1),
+    )
+
+    device := newTestLinuxService()
+    if err := device.Connect(cfg); err != nil {
+        t.Fatalf("Connect returned error: %v", err)
+    }
+    defer device.Disconnect()
+
+    path, err := device.Execute("show clock", repository.WithTimeout(30*time.Second))
+    if err != nil {
+        t.Fatalf("Execute returned error: %v", err)
+    }
+    if output, _ := os.ReadFile(path); len(output) == 0 {
+        t.Fatal("Execute wrote no output")
+    }
+    if err := device.Ping(); err != nil {
+        t.Fatalf("Ping returned error: %v", err)
+    }
+    if _, err := device.LocalForward("127.0.0.1:0", "127.0.0.1:22"); !errors.Is(err, ErrUnsupportedOnConsole) {
+        t.Fatalf("LocalForward error = %v, want ErrUnsupportedOnConsole", err)
+    }
+}
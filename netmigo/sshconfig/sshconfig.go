@@ -0,0 +1,282 @@
+// Package sshconfig reads OpenSSH client configuration files. It supports
+// Host blocks with wildcard and negated patterns, Include directives and
+// first-value-wins lookup. Match blocks are skipped.
+package sshconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const maxIncludeDepth = 16
+
+// Config is a parsed ssh_config file.
+type Config struct {
+	blocks []block
+}
+
+type block struct {
+	patterns []string
+	match    bool
+	options  []option
+}
+
+type option struct {
+	key    string
+	values []string
+	// raw is the text after the keyword as written, quotes included.
+	raw string
+}
+
+// DefaultPath returns ~/.ssh/config for the current user.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// ParseFile reads and parses the ssh_config file at path, following
+// Include directives.
+func ParseFile(path string) (*Config, error) {
+	cfg := &Config{blocks: []block{{patterns: []string{"*"}}}}
+	if err := cfg.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse parses ssh_config content from r. Include directives are resolved
+// relative to ~/.ssh.
+func Parse(r io.Reader) (*Config, error) {
+	cfg := &Config{blocks: []block{{patterns: []string{"*"}}}}
+	if err := cfg.parse(r, "<input>", 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) parseFile(name string, depth int) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("open ssh config %q: %w", name, err)
+	}
+	defer file.Close()
+	return c.parse(file, name, depth)
+}
+
+func (c *Config) parse(r io.Reader, name string, depth int) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		key, values, raw, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		if key == "" {
+			continue
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("%s:%d: missing value for %s", name, lineNumber, key)
+		}
+
+		switch key {
+		case "host":
+			c.blocks = append(c.blocks, block{patterns: values})
+		case "match":
+			c.blocks = append(c.blocks, block{match: true})
+		case "include":
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s:%d: include nested too deeply", name, lineNumber)
+			}
+			enclosing := c.blocks[len(c.blocks)-1]
+			before := len(c.blocks)
+			if err := c.include(values, depth); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+			}
+			if len(c.blocks) != before {
+				// Options after the Include still belong to the enclosing block.
+				c.blocks = append(c.blocks, block{patterns: enclosing.patterns, match: enclosing.match})
+			}
+		default:
+			current := &c.blocks[len(c.blocks)-1]
+			current.options = append(current.options, option{key: key, values: values, raw: raw})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read ssh config %q: %w", name, err)
+	}
+	return nil
+}
+
+// include parses the referenced files into the current block, as OpenSSH
+// does when Include appears inside a Host section.
+func (c *Config) include(patterns []string, depth int) error {
+	for _, pattern := range patterns {
+		pattern = expandHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			dir, err := DefaultPath()
+			if err != nil {
+				return err
+			}
+			pattern = filepath.Join(filepath.Dir(dir), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("include %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if err := c.parseFile(match, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the first value of key that applies to alias, or "".
+func (c *Config) Get(alias, key string) string {
+	values := c.lookup(alias, key, false)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// GetArgs returns all arguments of the first matching key for alias, for
+// multi-word options such as ProxyCommand.
+func (c *Config) GetArgs(alias, key string) []string {
+	return c.lookup(alias, key, false)
+}
+
+// GetRaw returns the text of the first matching key for alias as written,
+// quotes included, or "". ProxyCommand needs it: OpenSSH hands the line
+// to a shell unsplit, so joining GetArgs would lose its quoting.
+func (c *Config) GetRaw(alias, key string) string {
+	options := c.options(alias, key)
+	if len(options) == 0 {
+		return ""
+	}
+	return options[0].raw
+}
+
+// GetAll returns the first value of every matching occurrence of key, for
+// options that accumulate such as IdentityFile.
+func (c *Config) GetAll(alias, key string) []string {
+	return c.lookup(alias, key, true)
+}
+
+func (c *Config) lookup(alias, key string, all bool) []string {
+	options := c.options(alias, key)
+	if len(options) == 0 {
+		return nil
+	}
+	if !all {
+		return options[0].values
+	}
+	values := make([]string, len(options))
+	for i, opt := range options {
+		values[i] = opt.values[0]
+	}
+	return values
+}
+
+// options returns every occurrence of key that applies to alias, in file
+// order.
+func (c *Config) options(alias, key string) []option {
+	key = strings.ToLower(key)
+	var options []option
+	for _, b := range c.blocks {
+		if b.match || !matchesHost(b.patterns, alias) {
+			continue
+		}
+		for _, opt := range b.options {
+			if opt.key == key {
+				options = append(options, opt)
+			}
+		}
+	}
+	return options
+}
+
+func matchesHost(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+		if err != nil || !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// splitLine returns the lower-cased keyword, its arguments, honouring
+// "key=value" syntax, double quotes and comments, and the text of the
+// arguments as written.
+func splitLine(line string) (string, []string, string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, "", nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, "", nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	hasArg := false
+	for i, r := range rest {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		case r == '#' && !inQuotes && !hasArg:
+			return key, args, strings.TrimSpace(rest[:i]), nil
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if inQuotes {
+		return "", nil, "", errors.New("unterminated quote")
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return key, args, rest, nil
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	return p
+}
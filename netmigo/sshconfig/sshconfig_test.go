@@ -0,0 +1,117 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleConfig = `
+# global defaults
+User fallback
+
+Host core-* !core-lab
+    User neteng
+    Port 2222
+    IdentityFile ~/.ssh/core_ed25519
+    IdentityFile=~/.ssh/id_rsa
+
+Host bastion
+    HostName bastion.example.net
+    ProxyCommand "/usr/bin/nc" -X 5 -x proxy:1080 %h %p
+
+Match host core-lab
+    User ignored
+
+Host *
+    ConnectTimeout 7
+    User late
+`
+
+func TestGetAppliesFirstMatchingValue(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	cases := []struct {
+		alias, key, want string
+	}{
+		{"core-r1", "User", "fallback"},
+		{"core-r1", "port", "2222"},
+		{"core-lab", "Port", ""},
+		{"bastion", "HostName", "bastion.example.net"},
+		{"other", "ConnectTimeout", "7"},
+	}
+	for _, tc := range cases {
+		if got := cfg.Get(tc.alias, tc.key); got != tc.want {
+			t.Fatalf("Get(%q, %q) = %q, want %q", tc.alias, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestHostBlockOverridesLaterDefaults(t *testing.T) {
+	cfg, err := Parse(strings.NewReader("Host r1\n  User alice\nHost *\n  User bob\n"))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if got := cfg.Get("r1", "User"); got != "alice" {
+		t.Fatalf("User = %q, want alice", got)
+	}
+	if got := cfg.Get("r2", "User"); got != "bob" {
+		t.Fatalf("User = %q, want bob", got)
+	}
+}
+
+func TestGetAllAndGetArgs(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	identities := cfg.GetAll("core-r1", "IdentityFile")
+	if want := []string{"~/.ssh/core_ed25519", "~/.ssh/id_rsa"}; !reflect.DeepEqual(identities, want) {
+		t.Fatalf("IdentityFile = %v, want %v", identities, want)
+	}
+
+	args := cfg.GetArgs("bastion", "ProxyCommand")
+	if want := []string{"/usr/bin/nc", "-X", "5", "-x", "proxy:1080", "%h", "%p"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("ProxyCommand = %v, want %v", args, want)
+	}
+	if raw, want := cfg.GetRaw("bastion", "ProxyCommand"), `"/usr/bin/nc" -X 5 -x proxy:1080 %h %p`; raw != want {
+		t.Fatalf("raw ProxyCommand = %q, want %q", raw, want)
+	}
+}
+
+func TestParseFileFollowsInclude(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "site.conf")
+	if err := os.WriteFile(included, []byte("Host edge1\n  Port 830\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "config")
+	content := "Host edge1\n  Include " + included + "\n  User ops\n"
+	if err := os.WriteFile(main, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseFile(main)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if got := cfg.Get("edge1", "Port"); got != "830" {
+		t.Fatalf("Port = %q, want 830", got)
+	}
+	if got := cfg.Get("edge1", "User"); got != "ops" {
+		t.Fatalf("User = %q, want ops", got)
+	}
+}
+
+func TestParseRejectsUnterminatedQuote(t *testing.T) {
+	_, err := Parse(strings.NewReader("Host r1\n  ProxyCommand \"nc %h\n"))
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("Parse error = %v, want line 2 quote error", err)
+	}
+}
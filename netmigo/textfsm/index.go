@@ -0,0 +1,179 @@
+package textfsm
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+// ErrNoTemplate is returned when no index entry matches a platform and
+// command.
+var ErrNoTemplate = errors.New("no TextFSM template for command")
+
+// completion matches the [[...]] abbreviation syntax of index commands.
+var completion = regexp.MustCompile(`\[\[(.+?)\]\]`)
+
+// platformNames are the ntc-templates names of the platforms.
+var platformNames = map[config.Platform]string{
+	config.CISCO_IOSXR:   "cisco_xr",
+	config.CISCO_IOSXE:   "cisco_ios",
+	config.CISCO_NXOS:    "cisco_nxos",
+	config.LINUX:         "linux",
+	config.JUNIPER_JUNOS: "juniper_junos",
+	config.ARISTA_EOS:    "arista_eos",
+}
+
+// PlatformName returns the ntc-templates name of platform, such as
+// "cisco_xr" for CISCO_IOSXR. IOS-XE uses the cisco_ios templates.
+func PlatformName(platform config.Platform) string {
+	return platformNames[platform]
+}
+
+type indexEntry struct {
+	line      int
+	templates []string
+	columns   map[string]*regexp.Regexp
+}
+
+// Index maps platforms and commands to templates, read from an
+// ntc-templates style index file: comment lines starting with #, a header
+// line naming the Template, Hostname, Platform and Command columns, and a
+// comma-separated entry per template. The Platform and Command columns
+// are regular expressions, and a command may abbreviate words with
+// [[...]], so "sh[[ow]] ver[[sion]]" matches "sh ver" through "show
+// version". The first matching entry wins, so longer commands go first.
+type Index struct {
+	dir     string
+	entries []indexEntry
+
+	mu        sync.Mutex
+	templates map[string]*Template
+}
+
+// LoadIndex reads the file named index in dir. Templates are loaded from
+// dir the first time they are used.
+func LoadIndex(dir string) (*Index, error) {
+	path := filepath.Join(dir, "index")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TextFSM index: %w", err)
+	}
+	idx := &Index{dir: dir, templates: make(map[string]*Template)}
+
+	var header []string
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		r := csv.NewReader(strings.NewReader(line))
+		r.TrimLeadingSpace = true
+		fields, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+		if header == nil {
+			header = fields
+			if !slices.Contains(header, "Template") {
+				return nil, fmt.Errorf("%s: header has no Template column", path)
+			}
+			continue
+		}
+		if len(fields) != len(header) {
+			return nil, fmt.Errorf("%s line %d: %d fields, header has %d", path, i+1, len(fields), len(header))
+		}
+		entry := indexEntry{line: i + 1, columns: make(map[string]*regexp.Regexp)}
+		for j, column := range header {
+			if column == "Template" {
+				entry.templates = strings.Split(fields[j], ":")
+				continue
+			}
+			if fields[j] == "" {
+				continue
+			}
+			pattern := fields[j]
+			if column == "Command" {
+				pattern = completion.ReplaceAllStringFunc(pattern, expand)
+			}
+			re, err := regexp.Compile("^(?:" + pattern + ")")
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %s: %w", path, i+1, column, err)
+			}
+			entry.columns[column] = re
+		}
+		idx.entries = append(idx.entries, entry)
+	}
+	return idx, nil
+}
+
+// expand turns [[ow]] into (o(w)?)?.
+func expand(abbreviation string) string {
+	word := abbreviation[2 : len(abbreviation)-2]
+	var b strings.Builder
+	for i, r := range word {
+		if i > 0 {
+			b.WriteByte('(')
+		}
+		b.WriteRune(r)
+	}
+	return "(" + b.String() + strings.Repeat(")?", len([]rune(word)))
+}
+
+// Template returns the template for command on platform, an
+// ntc-templates platform name such as "cisco_xr".
+func (idx *Index) Template(platform, command string) (*Template, error) {
+	attributes := map[string]string{"Platform": platform, "Command": strings.TrimSpace(command)}
+	for _, entry := range idx.entries {
+		if !entry.matches(attributes) {
+			continue
+		}
+		if len(entry.templates) > 1 {
+			return nil, fmt.Errorf("index line %d: combined templates %s are not supported", entry.line, strings.Join(entry.templates, ":"))
+		}
+		return idx.load(entry.templates[0])
+	}
+	return nil, fmt.Errorf("%w %q on %s", ErrNoTemplate, command, platform)
+}
+
+func (e indexEntry) matches(attributes map[string]string) bool {
+	for column, value := range attributes {
+		if re, ok := e.columns[column]; ok && !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *Index) load(name string) (*Template, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if t, ok := idx.templates[name]; ok {
+		return t, nil
+	}
+	t, err := LoadTemplate(filepath.Join(idx.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	idx.templates[name] = t
+	return t, nil
+}
+
+// Parse parses the output of command on platform with the template the
+// index names for them.
+func (idx *Index) Parse(platform, command, output string) ([]map[string]any, error) {
+	t, err := idx.Template(platform, command)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(output)
+}
@@ -0,0 +1,206 @@
+package textfsm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Error is returned when a rule with the Error action matches.
+type Error struct {
+	Template string
+	Message  string
+	Line     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("template %s: %s on line %q", e.Template, e.Message, e.Line)
+}
+
+// cell is a value's state while parsing. set is false for values not
+// assigned since the last clear, which Python's textfsm keeps as None.
+type cell struct {
+	text string
+	list []string
+	set  bool
+	// kept is the last assignment of a Filldown value.
+	kept *cell
+}
+
+func (c *cell) empty() bool {
+	return !c.set || c.text == "" && c.list == nil
+}
+
+type parser struct {
+	t       *Template
+	cells   []cell
+	records [][]cell
+}
+
+// Parse runs the template over text and returns a record per row, keyed by
+// the value names in lower case as Netmiko and ntc-templates users expect.
+// List values are []string; all others are strings.
+func (t *Template) Parse(text string) ([]map[string]any, error) {
+	rows, err := t.ParseRows(text)
+	if err != nil {
+		return nil, err
+	}
+	header := t.Header()
+	records := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		record := make(map[string]any, len(header))
+		for j, name := range header {
+			record[strings.ToLower(name)] = row[j]
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// ParseRows is Parse returning rows in Header order, with the value names
+// as they are in the template.
+func (t *Template) ParseRows(text string) ([][]any, error) {
+	p := &parser{t: t, cells: make([]cell, len(t.values))}
+	state := "Start"
+	for _, line := range strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r", ""), "\n"), "\n") {
+		next, err := p.line(state, line)
+		if err != nil {
+			return nil, err
+		}
+		state = next
+		if state == "End" || state == "EOF" {
+			break
+		}
+	}
+	// Reaching the end of the input records what is left, unless the
+	// template defines an EOF state to prevent it.
+	if _, eof := t.states["EOF"]; state != "End" && !eof {
+		p.record()
+	}
+
+	rows := make([][]any, len(p.records))
+	for i, record := range p.records {
+		row := make([]any, len(record))
+		for j, c := range record {
+			if t.values[j].list {
+				row[j] = append([]string{}, c.list...)
+			} else {
+				row[j] = c.text
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// line runs the rules of state against line and returns the next state.
+func (p *parser) line(state, line string) (string, error) {
+	for _, r := range p.t.states[state] {
+		m := r.re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		for g, name := range r.re.SubexpNames() {
+			idx, ok := p.t.byName[name]
+			if !ok {
+				continue
+			}
+			if m[2*g] < 0 {
+				p.assign(idx, "", false)
+			} else {
+				p.assign(idx, line[m[2*g]:m[2*g+1]], true)
+			}
+		}
+
+		switch r.record {
+		case "Record":
+			p.record()
+		case "Clear":
+			p.clear(false)
+		case "Clearall":
+			p.clear(true)
+		}
+		if r.err {
+			message := r.newState
+			if message == "" {
+				message = "state error"
+			}
+			return "", &Error{Template: p.t.name, Message: message, Line: line}
+		}
+		if !r.next {
+			continue
+		}
+		if r.newState != "" {
+			return r.newState, nil
+		}
+		return state, nil
+	}
+	return state, nil
+}
+
+func (p *parser) assign(idx int, text string, matched bool) {
+	v, c := p.t.values[idx], &p.cells[idx]
+	if v.list {
+		if matched {
+			c.list = append(c.list, text)
+			c.set = true
+		}
+	} else {
+		c.text, c.set = text, matched
+	}
+	if v.filldown {
+		kept := cell{text: c.text, list: slices.Clone(c.list), set: c.set}
+		c.kept = &kept
+	}
+	if v.fillup && !c.empty() {
+		for i := len(p.records) - 1; i >= 0; i-- {
+			if !p.records[i][idx].empty() {
+				break
+			}
+			p.records[i][idx] = cell{text: c.text, list: slices.Clone(c.list), set: true}
+		}
+	}
+}
+
+// record appends the current values as a record, unless a Required value
+// is empty or no value is set, and clears them.
+func (p *parser) record() {
+	for i, v := range p.t.values {
+		if v.required && p.cells[i].empty() {
+			p.clear(false)
+			return
+		}
+	}
+	anySet := false
+	for i, v := range p.t.values {
+		c := p.cells[i]
+		if c.set && (!v.list || len(c.list) > 0) {
+			anySet = true
+		}
+	}
+	if !anySet {
+		return
+	}
+	record := make([]cell, len(p.cells))
+	for i, c := range p.cells {
+		record[i] = cell{text: c.text, list: slices.Clone(c.list), set: c.set}
+	}
+	p.records = append(p.records, record)
+	p.clear(false)
+}
+
+// clear resets the values, keeping Filldown values unless all is set.
+func (p *parser) clear(all bool) {
+	for i := range p.cells {
+		c := &p.cells[i]
+		kept := c.kept
+		*c = cell{}
+		if kept == nil {
+			continue
+		}
+		if all {
+			continue
+		}
+		*c = cell{text: kept.text, list: slices.Clone(kept.list), set: kept.set, kept: kept}
+	}
+}
@@ -0,0 +1,320 @@
+// Package textfsm parses command output with TextFSM templates, the
+// format used by ntc-templates. Templates written for Python's textfsm
+// work as long as their regular expressions are valid RE2, which rules out
+// lookarounds and backreferences.
+package textfsm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Value options.
+const (
+	optFilldown = "Filldown"
+	optKey      = "Key"
+	optRequired = "Required"
+	optList     = "List"
+	optFillup   = "Fillup"
+)
+
+var (
+	// ruleAction matches what follows "->" in a rule: a line operation,
+	// optionally with a record operation after a dot, or a record
+	// operation alone, then optionally a new state, or for Error a
+	// message.
+	ruleAction = regexp.MustCompile(`^(?:(?:(Continue|Next|Error)(?:\.(Clear|Clearall|Record|NoRecord))?|(Clear|Clearall|Record|NoRecord))(?:\s+|$))?(\w+|".*")?$`)
+	stateName  = regexp.MustCompile(`^\w+$`)
+)
+
+type value struct {
+	name                                  string
+	pattern                               string
+	filldown, key, required, list, fillup bool
+}
+
+type rule struct {
+	line     int
+	match    string
+	re       *regexp.Regexp
+	next     bool // Next, not Continue
+	record   string
+	err      bool
+	newState string
+}
+
+// Template is a parsed TextFSM template. It is safe for concurrent use;
+// every Parse runs with its own state.
+type Template struct {
+	name   string
+	values []*value
+	byName map[string]int
+	states map[string][]rule
+}
+
+// ParseTemplate parses a TextFSM template read from r. name is used in
+// error messages.
+func ParseTemplate(name string, r io.Reader) (*Template, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	t := &Template{name: name, byName: make(map[string]int), states: make(map[string][]rule)}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n")
+	i, err := t.parseValues(lines)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.parseStates(lines, i); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTemplate parses the TextFSM template in the file at path.
+func LoadTemplate(path string) (*Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open template: %w", err)
+	}
+	defer f.Close()
+	return ParseTemplate(path, f)
+}
+
+func (t *Template) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("template %s line %d: %s", t.name, line+1, fmt.Sprintf(format, args...))
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// parseValues reads the Value lines up to the first blank line and returns
+// the index of the line after it.
+func (t *Template) parseValues(lines []string) (int, error) {
+	for i, line := range lines {
+		if isComment(line) {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			return i + 1, nil
+		}
+		if !strings.HasPrefix(line, "Value ") {
+			return 0, t.errorf(i, "expected a Value line, got %q", line)
+		}
+		v, err := t.parseValue(i, line)
+		if err != nil {
+			return 0, err
+		}
+		if _, dup := t.byName[v.name]; dup {
+			return 0, t.errorf(i, "duplicate value %s", v.name)
+		}
+		t.byName[v.name] = len(t.values)
+		t.values = append(t.values, v)
+	}
+	return len(lines), nil
+}
+
+// parseValue parses "Value [Options] Name (regex)". Like textfsm it splits
+// on single spaces, so the regular expression may contain spaces.
+func (t *Template) parseValue(i int, line string) (*value, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) < 3 {
+		return nil, t.errorf(i, "expected at least 3 fields in %q", line)
+	}
+	v := &value{name: fields[1], pattern: strings.Join(fields[2:], " ")}
+	if !strings.HasPrefix(fields[2], "(") {
+		v.name, v.pattern = fields[2], strings.Join(fields[3:], " ")
+		for _, option := range strings.Split(fields[1], ",") {
+			switch option {
+			case optFilldown:
+				v.filldown = true
+			case optKey:
+				v.key = true
+			case optRequired:
+				v.required = true
+			case optList:
+				v.list = true
+			case optFillup:
+				v.fillup = true
+			default:
+				return nil, t.errorf(i, "unknown value option %q", option)
+			}
+		}
+	}
+	if !stateName.MatchString(v.name) {
+		return nil, t.errorf(i, "invalid value name %q", v.name)
+	}
+	if !strings.HasPrefix(v.pattern, "(") || !strings.HasSuffix(v.pattern, ")") {
+		return nil, t.errorf(i, "value %s must be contained within a '()' pair", v.name)
+	}
+	if _, err := regexp.Compile(pythonToRE2(v.pattern)); err != nil {
+		return nil, t.errorf(i, "value %s: %v", v.name, err)
+	}
+	return v, nil
+}
+
+// parseStates reads the state definitions starting at lines[start].
+func (t *Template) parseStates(lines []string, start int) error {
+	state := ""
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if isComment(line) {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			state = ""
+			continue
+		}
+		if state == "" {
+			name := strings.TrimSpace(line)
+			if line != name || !stateName.MatchString(name) {
+				return t.errorf(i, "invalid state name %q", line)
+			}
+			if _, dup := t.states[name]; dup {
+				return t.errorf(i, "duplicate state %s", name)
+			}
+			t.states[name] = nil
+			state = name
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if line == trimmed || !strings.HasPrefix(trimmed, "^") {
+			return t.errorf(i, "rule %q must be indented and start with '^'", line)
+		}
+		r, err := t.parseRule(i, trimmed)
+		if err != nil {
+			return err
+		}
+		t.states[state] = append(t.states[state], r)
+	}
+
+	if _, ok := t.states["Start"]; !ok {
+		return fmt.Errorf("template %s has no Start state", t.name)
+	}
+	if len(t.states["End"]) > 0 {
+		return fmt.Errorf("template %s: the End state must be empty", t.name)
+	}
+	for _, rules := range t.states {
+		for _, r := range rules {
+			if r.newState == "" || r.err || r.newState == "End" || r.newState == "EOF" {
+				continue
+			}
+			if _, ok := t.states[r.newState]; !ok {
+				return t.errorf(r.line, "unknown state %s", r.newState)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Template) parseRule(i int, line string) (rule, error) {
+	r := rule{line: i, match: line, next: true}
+	if idx := strings.LastIndex(line, " ->"); idx >= 0 {
+		r.match = line[:idx]
+		m := ruleAction.FindStringSubmatch(strings.TrimSpace(line[idx+3:]))
+		if m == nil {
+			return r, t.errorf(i, "invalid action %q", strings.TrimSpace(line[idx+3:]))
+		}
+		lineOp, recordOp := m[1], m[2]
+		if m[3] != "" {
+			recordOp = m[3]
+		}
+		r.next = lineOp != "Continue"
+		r.err = lineOp == "Error"
+		if recordOp != "NoRecord" {
+			r.record = recordOp
+		}
+		r.newState = strings.Trim(m[4], `"`)
+		if lineOp == "Continue" && r.newState != "" {
+			return r, t.errorf(i, "Continue cannot change state")
+		}
+	}
+	pattern, err := t.substitute(i, strings.TrimRight(r.match, " \t"))
+	if err != nil {
+		return r, err
+	}
+	r.re, err = regexp.Compile("^(?:" + pythonToRE2(pattern) + ")")
+	if err != nil {
+		return r, t.errorf(i, "%v", err)
+	}
+	return r, nil
+}
+
+// substitute replaces ${Name} and $Name with the value's regular
+// expression as a named group and $$ with $, as Python's string.Template
+// does.
+func (t *Template) substitute(i int, match string) (string, error) {
+	var b strings.Builder
+	for j := 0; j < len(match); j++ {
+		if match[j] != '$' {
+			b.WriteByte(match[j])
+			continue
+		}
+		rest := match[j+1:]
+		var name string
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			b.WriteByte('$')
+			j++
+			continue
+		case strings.HasPrefix(rest, "{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return "", t.errorf(i, "unterminated ${ in %q", match)
+			}
+			name = rest[1:end]
+			j += end + 1
+		default:
+			n := 0
+			for n < len(rest) && isIdentByte(rest[n], n == 0) {
+				n++
+			}
+			if n == 0 {
+				return "", t.errorf(i, "invalid placeholder in %q; use $$ for end of line", match)
+			}
+			name = rest[:n]
+			j += n
+		}
+		idx, ok := t.byName[name]
+		if !ok {
+			return "", t.errorf(i, "unknown value %s", name)
+		}
+		v := t.values[idx]
+		b.WriteString("(?P<" + v.name + ">" + v.pattern[1:])
+	}
+	return b.String(), nil
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+// pythonToRE2 rewrites the Python regular expression syntax that RE2
+// spells differently.
+func pythonToRE2(pattern string) string {
+	return strings.ReplaceAll(pattern, `\Z`, `\z`)
+}
+
+// Header returns the names of the template's values, in order.
+func (t *Template) Header() []string {
+	names := make([]string, len(t.values))
+	for i, v := range t.values {
+		names[i] = v.name
+	}
+	return names
+}
+
+// Keys returns the names of the values with the Key option.
+func (t *Template) Keys() []string {
+	var keys []string
+	for _, v := range t.values {
+		if v.key {
+			keys = append(keys, v.name)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,187 @@
+package textfsm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonelmawirat/netmigo/netmigo/config"
+)
+
+func parseTemplate(t *testing.T, text string) *Template {
+	t.Helper()
+	tmpl, err := ParseTemplate("test", strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("ParseTemplate returned error: %v", err)
+	}
+	return tmpl
+}
+
+func TestIndexParsesWithAbbreviatedCommands(t *testing.T) {
+	idx, err := LoadIndex("testdata")
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join("testdata", "cisco_xr_show_ip_interface_brief.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"show ip interface brief", "sh ip int br", "show ipv4 interface brief"} {
+		records, err := idx.Parse(PlatformName(config.CISCO_IOSXR), command, string(output))
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", command, err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("Parse(%q) = %d records, want 4", command, len(records))
+		}
+		want := map[string]any{"interface": "GigabitEthernet0/0/0/1", "ip_address": "unassigned", "status": "Shutdown", "protocol": "Down", "vrf": "default"}
+		if !reflect.DeepEqual(records[2], want) {
+			t.Fatalf("records[2] = %v, want %v", records[2], want)
+		}
+	}
+
+	if _, err := idx.Parse("cisco_xr", "show version", ""); !errors.Is(err, ErrNoTemplate) {
+		t.Fatalf("Parse error = %v, want ErrNoTemplate", err)
+	}
+	if _, err := idx.Parse("linux", "show ip interface brief", ""); !errors.Is(err, ErrNoTemplate) {
+		t.Fatalf("Parse error = %v, want ErrNoTemplate for another platform", err)
+	}
+
+	var tmplErr *Error
+	if _, err := idx.Parse("cisco_xr", "show ip interface brief", "% Invalid input detected at '^' marker.\n"); !errors.As(err, &tmplErr) {
+		t.Fatalf("Parse error = %v, want the template's Error action", err)
+	}
+}
+
+func TestFilldownRequiredAndList(t *testing.T) {
+	tmpl := parseTemplate(t, `Value Filldown VRF (\S+)
+Value Required,Key NEIGHBOR (\d+\.\d+\.\d+\.\d+)
+Value REMOTE_AS (\d+)
+Value List CAPABILITIES (\S+)
+
+Start
+  ^VRF -> Continue.Record
+  ^VRF ${VRF}
+  ^Neighbor -> Continue.Record
+  ^Neighbor ${NEIGHBOR}, remote AS ${REMOTE_AS}
+  ^\s+Capability ${CAPABILITIES}
+  ^Summary -> Record
+`)
+	text := `VRF default
+Summary
+Neighbor 192.0.2.2, remote AS 65001
+  Capability route-refresh
+  Capability 4-byte-as
+Neighbor 192.0.2.6, remote AS 65002
+VRF customer
+Neighbor 198.51.100.2, remote AS 65010
+  Capability graceful-restart
+`
+	rows, err := tmpl.ParseRows(text)
+	if err != nil {
+		t.Fatalf("ParseRows returned error: %v", err)
+	}
+	want := [][]any{
+		{"default", "192.0.2.2", "65001", []string{"route-refresh", "4-byte-as"}},
+		{"default", "192.0.2.6", "65002", []string{}},
+		{"customer", "198.51.100.2", "65010", []string{"graceful-restart"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ParseRows() =\n%v\nwant\n%v", rows, want)
+	}
+	if keys := tmpl.Keys(); !reflect.DeepEqual(keys, []string{"NEIGHBOR"}) {
+		t.Fatalf("Keys() = %v", keys)
+	}
+}
+
+func TestValuePatternWithParenthesisInClass(t *testing.T) {
+	tmpl := parseTemplate(t, `Value VERSION ([^)]+)
+
+Start
+  ^Kernel \(${VERSION}\) -> Record
+`)
+	rows, err := tmpl.ParseRows("Kernel (5.15.0-91-generic)\n")
+	if err != nil {
+		t.Fatalf("ParseRows returned error: %v", err)
+	}
+	if want := [][]any{{"5.15.0-91-generic"}}; !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ParseRows() = %v, want %v", rows, want)
+	}
+}
+
+func TestFillupStatesAndEOF(t *testing.T) {
+	tmpl := parseTemplate(t, `Value NAME (\w+)
+Value Fillup AREA (\d+)
+
+Start
+  ^router -> Routers
+
+Routers
+  ^\s+name ${NAME} -> Record
+  ^\s+area ${AREA}
+  ^end -> End
+`)
+	// Fillup copies area 1 up to r4 and stops at r3, which has an area.
+	rows, err := tmpl.ParseRows("ignored\nrouter\n name r1\n name r2\n area 0\n name r3\n name r4\n area 1\nend\n name r5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]any{{"r1", "0"}, {"r2", "0"}, {"r3", "0"}, {"r4", "1"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ParseRows() = %v, want %v", rows, want)
+	}
+
+	// An EOF state stops the record that the end of input makes otherwise.
+	withEOF := parseTemplate(t, "Value NAME (\\w+)\n\nStart\n  ^name ${NAME}\n\nEOF\n")
+	if rows, err := withEOF.ParseRows("name r1\n"); err != nil || len(rows) != 0 {
+		t.Fatalf("ParseRows() = %v, %v, want no rows", rows, err)
+	}
+	withoutEOF := parseTemplate(t, "Value NAME (\\w+)\n\nStart\n  ^name ${NAME}\n")
+	if rows, err := withoutEOF.ParseRows("name r1\n"); err != nil || len(rows) != 1 {
+		t.Fatalf("ParseRows() = %v, %v, want one row", rows, err)
+	}
+}
+
+func TestClearallAndErrorMessages(t *testing.T) {
+	tmpl := parseTemplate(t, `Value Filldown HOST (\S+)
+Value PORT (\d+)
+
+Start
+  ^host ${HOST}
+  ^port ${PORT} -> Record
+  ^reset -> Clearall
+  ^fail -> Error "unexpected failure"
+`)
+	rows, err := tmpl.ParseRows("host a\nport 1\nreset\nport 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]any{{"a", "1"}, {"", "2"}}; !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ParseRows() = %v, want %v", rows, want)
+	}
+	var tmplErr *Error
+	if _, err := tmpl.ParseRows("fail\n"); !errors.As(err, &tmplErr) || tmplErr.Message != "unexpected failure" {
+		t.Fatalf("ParseRows error = %v", err)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for name, text := range map[string]string{
+		"no Start":          "Value A (\\d+)\n\nOther\n  ^${A}\n",
+		"unknown value":     "Value A (\\d+)\n\nStart\n  ^${B}\n",
+		"unknown state":     "Value A (\\d+)\n\nStart\n  ^${A} -> Missing\n",
+		"bare dollar":       "Value A (\\d+)\n\nStart\n  ^${A}$\n",
+		"continue state":    "Value A (\\d+)\n\nStart\n  ^${A} -> Continue Start\n",
+		"unknown option":    "Value Sometimes A (\\d+)\n\nStart\n  ^${A}\n",
+		"no parentheses":    "Value A \\d+\n\nStart\n  ^${A}\n",
+		"lookahead":         "Value A ((?!x)\\d+)\n\nStart\n  ^${A}\n",
+		"rule not indented": "Value A (\\d+)\n\nStart\n^${A}\n",
+	} {
+		if _, err := ParseTemplate(name, strings.NewReader(text)); err == nil {
+			t.Errorf("%s: ParseTemplate returned no error", name)
+		}
+	}
+}
@@ -20,7 +20,7 @@ func main() {
     iosxrCfg := netmigo.NewDeviceConfig(
         "sandbox-iosxr-1.cisco.com",
         netmigo.WithUsername("admin"),
-        netmigo.WithPassword("C1sco12345"),
+        netmigo.WithCredentialProvider(netmigo.EnvCredentials("", "NETMIGO_PASSWORD")),
         netmigo.WithConnectionTimeout(15*time.Second),
     )
 
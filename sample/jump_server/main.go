@@ -27,7 +27,7 @@ func main() {
     targetCfg := netmigo.NewDeviceConfig(
         "sandbox-iosxr-1.cisco.com",
         netmigo.WithUsername("admin"),
-        netmigo.WithPassword("C1sco12345"),
+        netmigo.WithCredentialProvider(netmigo.EnvCredentials("", "NETMIGO_PASSWORD")),
         netmigo.WithConnectionTimeout(5*time.Second),
         netmigo.WithJumpServer(jumpServerCfg),
     )